@@ -3,6 +3,8 @@ package agent
 import (
 	"context"
 	"fmt"
+	"io"
+	"os"
 	"sync"
 	"time"
 
@@ -12,8 +14,10 @@ import (
 	"github.com/kazakovdmitriy/go-musthave-metrics/internal/agent/provider"
 	"github.com/kazakovdmitriy/go-musthave-metrics/internal/agent/reporter"
 	"github.com/kazakovdmitriy/go-musthave-metrics/internal/agent/sender"
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/agent/spool"
 	"github.com/kazakovdmitriy/go-musthave-metrics/internal/config"
 	"github.com/kazakovdmitriy/go-musthave-metrics/internal/handler/middlewares/signer"
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/model"
 	"github.com/kazakovdmitriy/go-musthave-metrics/internal/service/signerservice"
 	"go.uber.org/zap"
 )
@@ -24,6 +28,8 @@ type App struct {
 	logger    *zap.Logger
 	collector interfaces.MetricsCollector
 	reporter  interfaces.MetricsReporter
+	closer    io.Closer
+	spool     *spool.Spool
 	wg        sync.WaitGroup
 }
 
@@ -34,19 +40,53 @@ func (a *App) Initialize(ctx context.Context) error {
 		zap.Bool("rate_limiting_enabled", a.config.RateLimit > 0),
 	)
 
+	buckets := a.config.AggregationBuckets
+	switch a.config.Aggregation {
+	case config.AggregationLast, config.AggregationGauges, "":
+	case config.AggregationHistogram:
+		if len(buckets) == 0 {
+			buckets = model.DefaultBuckets
+		}
+		if err := model.ValidateBuckets(buckets); err != nil {
+			return fmt.Errorf("invalid aggregation buckets: %w", err)
+		}
+	default:
+		return fmt.Errorf("unknown aggregation %q", a.config.Aggregation)
+	}
+
 	var signerService signer.Signer
 	if a.config.SecretKey != "" {
 		signerService = signerservice.NewSHA256Signer(a.config.SecretKey)
 	}
 
-	httpClient, err := client.NewClient(
-		a.config.ServerAddr,
-		signerService,
-		a.logger,
-		a.config,
-	)
-	if err != nil {
-		return err
+	var httpClient interfaces.HTTPClient
+	switch a.config.Transport {
+	case config.TransportGRPC:
+		grpcClient, err := client.NewGRPCClient(
+			a.config.GRPCAddr,
+			signerService,
+			a.logger,
+			a.config,
+		)
+		if err != nil {
+			return err
+		}
+		httpClient = grpcClient
+		a.closer = grpcClient
+		a.logger.Info("using grpc transport", zap.String("grpc_addr", a.config.GRPCAddr))
+	case config.TransportHTTP, "":
+		var err error
+		httpClient, err = client.NewClient(
+			a.config.ServerAddr,
+			signerService,
+			a.logger,
+			a.config,
+		)
+		if err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown transport %q", a.config.Transport)
 	}
 
 	providers := []interfaces.MetricsProvider{
@@ -57,7 +97,34 @@ func (a *App) Initialize(ctx context.Context) error {
 	pollingInterval := time.Duration(a.config.PollingInterval) * time.Second
 	reportInterval := time.Duration(a.config.ReportInterval) * time.Second
 
-	a.collector = collector.NewMetricsCollector(ctx, pollingInterval, a.logger, providers)
+	a.collector = collector.NewMetricsCollector(ctx, pollingInterval, a.logger, providers, a.config.Aggregation, buckets)
+
+	// В режиме меток хост и ядро передаются метками, а не в имени метрики
+	var labels model.Labels
+	if a.config.Labels {
+		host, err := os.Hostname()
+		if err != nil {
+			return fmt.Errorf("failed to get hostname: %w", err)
+		}
+		labels = model.Labels{"host": host}
+		a.logger.Info("attaching labels to metrics", zap.String("host", host))
+	}
+
+	// Интерфейс остается nil, если спул выключен
+	var metricsSpool interfaces.MetricsSpool
+	if a.config.SpoolDir != "" {
+		var err error
+		a.spool, err = spool.Open(
+			a.config.SpoolDir,
+			a.config.SpoolMaxBytes,
+			time.Duration(a.config.SpoolMaxAge)*time.Second,
+			a.logger,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to open spool: %w", err)
+		}
+		metricsSpool = a.spool
+	}
 
 	var metricsSender interfaces.MetricsSender
 
@@ -67,6 +134,8 @@ func (a *App) Initialize(ctx context.Context) error {
 			httpClient,
 			a.config.RateLimit,
 			a.config.RateLimit*2,
+			labels,
+			metricsSpool,
 			a.logger,
 		)
 		a.logger.Info("using limited sender with worker pool",
@@ -79,6 +148,8 @@ func (a *App) Initialize(ctx context.Context) error {
 			httpClient,
 			0,
 			0,
+			labels,
+			metricsSpool,
 			a.logger,
 		)
 		a.logger.Info("using unlimited sender")
@@ -148,5 +219,18 @@ func (a *App) Wait() {
 		a.reporter.Stop()
 	}
 
+	if a.closer != nil {
+		if err := a.closer.Close(); err != nil {
+			a.logger.Error("failed to close client", zap.Error(err))
+		}
+	}
+
+	// Спул закрывается после отправителя: при остановке он еще дописывает батчи
+	if a.spool != nil {
+		if err := a.spool.Close(); err != nil {
+			a.logger.Error("failed to close spool", zap.Error(err))
+		}
+	}
+
 	a.logger.Info("agent shutdown completed")
 }
@@ -71,7 +71,7 @@ func (c *Client) SetHeader(key, value string) {
 }
 
 // doRequest выполняет HTTP запрос
-func (c *Client) doRequest(method, endpoint string, body interface{}) ([]byte, error) {
+func (c *Client) doRequest(method, endpoint string, body interface{}, idempotencyKey string) ([]byte, error) {
 	reader, bodyData, hashValue, err := c.requestProcessor.ProcessRequest(body)
 	if err != nil {
 		return nil, err
@@ -83,6 +83,9 @@ func (c *Client) doRequest(method, endpoint string, body interface{}) ([]byte, e
 	}
 
 	c.setRequestHeaders(req, bodyData, hashValue)
+	if idempotencyKey != "" {
+		req.Header.Set(idempotencyKeyHeader, idempotencyKey)
+	}
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
@@ -124,6 +127,16 @@ func (c *Client) setRequestHeaders(req *http.Request, bodyData []byte, hashValue
 func (c *Client) doRequestWithRetry(ctx context.Context, method, endpoint string, body interface{}) ([]byte, error) {
 	var response []byte
 
+	// Ключ общий для всех попыток, чтобы сервер не применил батч повторно
+	var idempotencyKey string
+	if method == http.MethodPost {
+		key, err := idempotencyKeyFrom(ctx)
+		if err != nil {
+			return nil, err
+		}
+		idempotencyKey = key
+	}
+
 	retryDelays, err := c.cfg.GetRetryDelaysAsDuration()
 	if err != nil {
 		return nil, err
@@ -138,7 +151,7 @@ func (c *Client) doRequestWithRetry(ctx context.Context, method, endpoint string
 	}
 
 	err = retry.Do(ctx, cfg, func() error {
-		resp, err := c.doRequest(method, endpoint, body)
+		resp, err := c.doRequest(method, endpoint, body, idempotencyKey)
 		if err != nil {
 			return err
 		}
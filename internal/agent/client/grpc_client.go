@@ -0,0 +1,157 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/status"
+
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/config"
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/handler/interceptors"
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/handler/middlewares/signer"
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/model"
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/proto/metricspb"
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/retry"
+)
+
+// GRPCClient отправляет метрики через gRPC-сервис metrics.Metrics.
+// Реализует interfaces.HTTPClient, сопоставляя HTTP-эндпоинты с RPC:
+// POST /updates/ - UpdateBatch, POST /update/ - Update, GET /value/{type}/{name} - Get.
+type GRPCClient struct {
+	conn   *grpc.ClientConn
+	client metricspb.MetricsClient
+	logger *zap.Logger
+	cfg    *config.AgentFlags
+}
+
+// NewGRPCClient создает клиент gRPC. Запросы подписываются, если передан signer.
+func NewGRPCClient(
+	addr string,
+	signer signer.Signer,
+	logger *zap.Logger,
+	cfg *config.AgentFlags,
+) (*GRPCClient, error) {
+	conn, err := grpc.NewClient(
+		addr,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithUnaryInterceptor(interceptors.Signing(signer)),
+		grpc.WithDefaultCallOptions(grpc.UseCompressor(gzip.Name)),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("creating grpc client failed: %w", err)
+	}
+
+	return &GRPCClient{
+		conn:   conn,
+		client: metricspb.NewMetricsClient(conn),
+		logger: logger,
+		cfg:    cfg,
+	}, nil
+}
+
+// Post выполняет RPC, соответствующий HTTP-эндпоинту обновления метрик
+func (c *GRPCClient) Post(ctx context.Context, endpoint string, body interface{}) ([]byte, error) {
+	switch strings.TrimSuffix(endpoint, "/") {
+	case "/updates":
+		metrics, ok := body.([]model.Metrics)
+		if !ok {
+			return nil, fmt.Errorf("unexpected body type %T for %s", body, endpoint)
+		}
+
+		key, err := idempotencyKeyFrom(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		req := &metricspb.UpdateBatchRequest{
+			Metrics:        make([]*metricspb.Metric, 0, len(metrics)),
+			IdempotencyKey: key,
+		}
+		for _, metric := range metrics {
+			req.Metrics = append(req.Metrics, metricspb.FromModel(metric))
+		}
+
+		return nil, c.withRetry(ctx, func() error {
+			_, err := c.client.UpdateBatch(ctx, req)
+			return err
+		})
+
+	case "/update":
+		metric, ok := body.(model.Metrics)
+		if !ok {
+			return nil, fmt.Errorf("unexpected body type %T for %s", body, endpoint)
+		}
+
+		req := &metricspb.UpdateRequest{Metric: metricspb.FromModel(metric)}
+		return nil, c.withRetry(ctx, func() error {
+			_, err := c.client.Update(ctx, req)
+			return err
+		})
+	}
+
+	return nil, fmt.Errorf("endpoint %s is not supported by grpc transport", endpoint)
+}
+
+// Get выполняет RPC Get для эндпоинта /value/{type}/{name}
+// и возвращает значение метрики в текстовом виде, как HTTP-хендлер
+func (c *GRPCClient) Get(ctx context.Context, endpoint string) ([]byte, error) {
+	parts := strings.Split(strings.Trim(endpoint, "/"), "/")
+	if len(parts) != 3 || parts[0] != "value" {
+		return nil, fmt.Errorf("endpoint %s is not supported by grpc transport", endpoint)
+	}
+
+	req := &metricspb.GetRequest{Id: parts[2], Type: metricspb.MTypeFromModel(parts[1])}
+
+	var resp *metricspb.GetResponse
+	err := c.withRetry(ctx, func() error {
+		var err error
+		resp, err = c.client.Get(ctx, req)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	metric := resp.GetMetric()
+	if metric.GetType() == metricspb.MType_COUNTER {
+		return []byte(strconv.FormatInt(metric.GetDelta(), 10)), nil
+	}
+	return []byte(strconv.FormatFloat(metric.GetValue(), 'f', -1, 64)), nil
+}
+
+// Close закрывает соединение с сервером
+func (c *GRPCClient) Close() error {
+	return c.conn.Close()
+}
+
+// withRetry повторяет вызов при недоступности сервера
+func (c *GRPCClient) withRetry(ctx context.Context, call func() error) error {
+	retryDelays, err := c.cfg.GetRetryDelaysAsDuration()
+	if err != nil {
+		return err
+	}
+
+	cfg := retry.RetryConfig{
+		MaxRetries:    c.cfg.MaxRetries,
+		Delays:        retryDelays,
+		IsRetryableFn: isUnavailable,
+	}
+
+	return retry.Do(ctx, cfg, call)
+}
+
+// isUnavailable проверяет, что сервер недоступен или не ответил вовремя
+func isUnavailable(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,38 @@
+package client
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+)
+
+// idempotencyKeyHeader - заголовок с ключом идемпотентности батча
+const idempotencyKeyHeader = "Idempotency-Key"
+
+// idempotencyKeyCtx - ключ контекста с заданным ключом идемпотентности
+type idempotencyKeyCtx struct{}
+
+// NewIdempotencyKey возвращает случайный ключ для одного логического запроса.
+// Повторные попытки отправки используют тот же ключ.
+func NewIdempotencyKey() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("generating idempotency key failed: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// WithIdempotencyKey задает ключ идемпотентности для Post вместо нового.
+// Так повтор батча из спула сервер распознает как уже примененный.
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKeyCtx{}, key)
+}
+
+// idempotencyKeyFrom возвращает ключ из контекста или новый
+func idempotencyKeyFrom(ctx context.Context) (string, error) {
+	if key, ok := ctx.Value(idempotencyKeyCtx{}).(string); ok && key != "" {
+		return key, nil
+	}
+	return NewIdempotencyKey()
+}
@@ -0,0 +1,53 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/config"
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestClient_PostIdempotencyKey(t *testing.T) {
+	var mu sync.Mutex
+	var keys []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		keys = append(keys, r.Header.Get(idempotencyKeyHeader))
+		mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client, err := NewClient(server.URL, nil, zaptest.NewLogger(t), &config.AgentFlags{})
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	batch := []model.Metrics{{ID: "Alloc", MType: model.Gauge, Value: new(float64)}}
+
+	// Повтор батча из спула идет с исходным ключом
+	keyed := WithIdempotencyKey(ctx, "spooled-key")
+	_, err = client.Post(keyed, "/updates/", batch)
+	require.NoError(t, err)
+	_, err = client.Post(keyed, "/updates/", batch)
+	require.NoError(t, err)
+
+	// Без ключа в контексте каждый запрос получает новый
+	_, err = client.Post(ctx, "/updates/", batch)
+	require.NoError(t, err)
+	_, err = client.Post(ctx, "/updates/", batch)
+	require.NoError(t, err)
+
+	require.Len(t, keys, 4)
+	assert.Equal(t, "spooled-key", keys[0])
+	assert.Equal(t, "spooled-key", keys[1])
+	assert.NotEmpty(t, keys[2])
+	assert.NotEmpty(t, keys[3])
+	assert.NotEqual(t, keys[2], keys[3])
+}
@@ -2,33 +2,59 @@ package collector
 
 import (
 	"context"
+	"math"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/kazakovdmitriy/go-musthave-metrics/internal/agent/interfaces"
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/config"
 
 	"github.com/kazakovdmitriy/go-musthave-metrics/internal/model"
 	"go.uber.org/zap"
 )
 
+// sampleKey различает значения по типу и ряду: gauge и counter с одним именем независимы
+type sampleKey struct {
+	mtype  string
+	series string
+}
+
 // metricsCollector отвечает за сбор метрик
 type metricsCollector struct {
-	metrics   model.MemoryMetrics
-	mutex     sync.Mutex
-	pollCount int
-	ticker    *time.Ticker
-	logger    *zap.Logger
-	ctx       context.Context
-	providers []interfaces.MetricsProvider
+	samples map[sampleKey]model.Sample
+	// aggregation - режим агрегации gauge между отправками, см. config.Aggregation*
+	aggregation string
+	buckets     []float64
+	window      map[sampleKey]*windowStats
+	mutex       sync.Mutex
+	pollCount   int
+	ticker      *time.Ticker
+	logger      *zap.Logger
+	ctx         context.Context
+	providers   []interfaces.MetricsProvider
 }
 
-// NewMetricsCollector создает новый сборщик метрик
-func NewMetricsCollector(ctx context.Context, pollingInterval time.Duration, logger *zap.Logger, providers []interfaces.MetricsProvider) interfaces.MetricsCollector {
+// NewMetricsCollector создает новый сборщик метрик.
+// aggregation задает статистику gauge за окно между отправками,
+// buckets - границы корзин для режима config.AggregationHistogram.
+func NewMetricsCollector(
+	ctx context.Context,
+	pollingInterval time.Duration,
+	logger *zap.Logger,
+	providers []interfaces.MetricsProvider,
+	aggregation string,
+	buckets []float64,
+) interfaces.MetricsCollector {
 	return &metricsCollector{
-		ticker:    time.NewTicker(pollingInterval),
-		logger:    logger,
-		ctx:       ctx,
-		providers: providers,
+		samples:     make(map[sampleKey]model.Sample),
+		aggregation: aggregation,
+		buckets:     buckets,
+		window:      make(map[sampleKey]*windowStats),
+		ticker:      time.NewTicker(pollingInterval),
+		logger:      logger,
+		ctx:         ctx,
+		providers:   providers,
 	}
 }
 
@@ -66,125 +92,130 @@ func (mc *metricsCollector) collectFromAllProviders() {
 	mc.pollCount++
 }
 
-// mergeMetrics объединяет метрики от разных провайдеров
-func (mc *metricsCollector) mergeMetrics(newMetrics model.MemoryMetrics) {
-	if mc.metrics.IsZero() {
-		mc.metrics = newMetrics
-		return
+// mergeMetrics объединяет значения поставщика с собранными ранее.
+// Gauge заменяется последним значением, в том числе нулевым;
+// приращения counter складываются до отправки.
+func (mc *metricsCollector) mergeMetrics(samples []model.Sample) {
+	for _, sample := range samples {
+		key := sampleKey{mtype: sample.MType, series: sample.Key()}
+		switch sample.MType {
+		case model.Counter:
+			if prev, ok := mc.samples[key]; ok {
+				sample.Delta += prev.Delta
+			}
+		case model.Gauge:
+			mc.observe(key, sample)
+		}
+		mc.samples[key] = sample
 	}
+}
 
-	// Объединяем метрики, сохраняя не-zero значения
-	if newMetrics.Alloc != 0 {
-		mc.metrics.Alloc = newMetrics.Alloc
-	}
-	if newMetrics.BuckHashSys != 0 {
-		mc.metrics.BuckHashSys = newMetrics.BuckHashSys
-	}
-	if newMetrics.Frees != 0 {
-		mc.metrics.Frees = newMetrics.Frees
-	}
-	if newMetrics.GCCPUFraction != 0 {
-		mc.metrics.GCCPUFraction = newMetrics.GCCPUFraction
-	}
-	if newMetrics.GCSys != 0 {
-		mc.metrics.GCSys = newMetrics.GCSys
-	}
-	if newMetrics.HeapAlloc != 0 {
-		mc.metrics.HeapAlloc = newMetrics.HeapAlloc
-	}
-	if newMetrics.HeapIdle != 0 {
-		mc.metrics.HeapIdle = newMetrics.HeapIdle
-	}
-	if newMetrics.HeapInuse != 0 {
-		mc.metrics.HeapInuse = newMetrics.HeapInuse
-	}
-	if newMetrics.HeapObjects != 0 {
-		mc.metrics.HeapObjects = newMetrics.HeapObjects
-	}
-	if newMetrics.HeapReleased != 0 {
-		mc.metrics.HeapReleased = newMetrics.HeapReleased
-	}
-	if newMetrics.HeapSys != 0 {
-		mc.metrics.HeapSys = newMetrics.HeapSys
-	}
-	if newMetrics.LastGC != 0 {
-		mc.metrics.LastGC = newMetrics.LastGC
-	}
-	if newMetrics.Lookups != 0 {
-		mc.metrics.Lookups = newMetrics.Lookups
-	}
-	if newMetrics.MCacheInuse != 0 {
-		mc.metrics.MCacheInuse = newMetrics.MCacheInuse
-	}
-	if newMetrics.MCacheSys != 0 {
-		mc.metrics.MCacheSys = newMetrics.MCacheSys
-	}
-	if newMetrics.MSpanInuse != 0 {
-		mc.metrics.MSpanInuse = newMetrics.MSpanInuse
-	}
-	if newMetrics.MSpanSys != 0 {
-		mc.metrics.MSpanSys = newMetrics.MSpanSys
-	}
-	if newMetrics.Mallocs != 0 {
-		mc.metrics.Mallocs = newMetrics.Mallocs
-	}
-	if newMetrics.NextGC != 0 {
-		mc.metrics.NextGC = newMetrics.NextGC
-	}
-	if newMetrics.NumForcedGC != 0 {
-		mc.metrics.NumForcedGC = newMetrics.NumForcedGC
-	}
-	if newMetrics.NumGC != 0 {
-		mc.metrics.NumGC = newMetrics.NumGC
-	}
-	if newMetrics.OtherSys != 0 {
-		mc.metrics.OtherSys = newMetrics.OtherSys
-	}
-	if newMetrics.PauseTotalNs != 0 {
-		mc.metrics.PauseTotalNs = newMetrics.PauseTotalNs
-	}
-	if newMetrics.StackInuse != 0 {
-		mc.metrics.StackInuse = newMetrics.StackInuse
-	}
-	if newMetrics.StackSys != 0 {
-		mc.metrics.StackSys = newMetrics.StackSys
+// observe добавляет значение gauge в статистику текущего окна.
+// Нечисловые значения пропускаются: NaN испортил бы сумму и гистограмму.
+func (mc *metricsCollector) observe(key sampleKey, sample model.Sample) {
+	if mc.aggregation != config.AggregationGauges && mc.aggregation != config.AggregationHistogram {
+		return
 	}
-	if newMetrics.Sys != 0 {
-		mc.metrics.Sys = newMetrics.Sys
+	if math.IsNaN(sample.Value) || math.IsInf(sample.Value, 0) {
+		return
 	}
-	if newMetrics.TotalAlloc != 0 {
-		mc.metrics.TotalAlloc = newMetrics.TotalAlloc
+
+	stats, ok := mc.window[key]
+	if !ok {
+		stats = newWindowStats(sample, mc.aggregation == config.AggregationHistogram, mc.buckets)
+		mc.window[key] = stats
 	}
-	if newMetrics.RandomValue != 0 {
-		mc.metrics.RandomValue = newMetrics.RandomValue
+	stats.add(sample.Value)
+}
+
+// Take забирает значения для отправки: последние gauge, накопленные
+// приращения counter, итоги окна агрегации и число опросов. Приращения,
+// опросы и окно с этого момента "в полете", новые опросы копятся заново.
+// release(true) сообщает, что батч отправлен на сервер: значения больше
+// не нужны сборщику. release(false) возвращает их, чтобы они ушли
+// со следующей отправкой; так делается, только если батч на сервер
+// не отправлялся (переполнена очередь без спула), поэтому возвращенные
+// значения не учитываются дважды. Батч, отправленный без подтверждения,
+// отправитель повторяет как есть с тем же ключом идемпотентности до новых
+// батчей, и сервер учитывает его один раз. Так PollCount на сервере равен
+// числу опросов при ошибках отправки и переполнении очереди; теряются
+// только отправленные батчи, вытесненные из переполненного буфера
+// отправителя: они никогда не учитываются дважды.
+func (mc *metricsCollector) Take() ([]model.Sample, int64, func(sent bool)) {
+	mc.mutex.Lock()
+	defer mc.mutex.Unlock()
+
+	samples := make([]model.Sample, 0, len(mc.samples)+len(mc.window)*3)
+	var counters []model.Sample
+	for key, sample := range mc.samples {
+		if sample.MType == model.Counter {
+			counters = append(counters, sample)
+			delete(mc.samples, key)
+		}
+		samples = append(samples, sample)
 	}
+	sortSamples(samples)
+
+	pollCount := mc.pollCount
+	mc.pollCount = 0
+
+	window := mc.window
+	mc.window = make(map[sampleKey]*windowStats, len(window))
 
-	// Gopsutil метрики
-	if newMetrics.TotalMemory != 0 {
-		mc.metrics.TotalMemory = newMetrics.TotalMemory
+	keys := make([]sampleKey, 0, len(window))
+	for key := range window {
+		keys = append(keys, key)
 	}
-	if newMetrics.FreeMemory != 0 {
-		mc.metrics.FreeMemory = newMetrics.FreeMemory
+	sort.Slice(keys, func(i, j int) bool { return keys[i].series < keys[j].series })
+	for _, key := range keys {
+		samples = append(samples, window[key].samples(mc.aggregation)...)
 	}
-	if len(newMetrics.CPUutilization) > 0 {
-		mc.metrics.CPUutilization = newMetrics.CPUutilization
+
+	var once sync.Once
+	release := func(sent bool) {
+		once.Do(func() {
+			if !sent {
+				mc.restore(counters, pollCount, window)
+			}
+		})
 	}
+	return samples, int64(pollCount), release
 }
 
-// GetMetrics возвращает текущие метрики и счетчик
-func (mc *metricsCollector) GetMetrics() (model.MemoryMetrics, int) {
+// restore возвращает неотправленные приращения, опросы и окно в текущие
+func (mc *metricsCollector) restore(counters []model.Sample, pollCount int, window map[sampleKey]*windowStats) {
 	mc.mutex.Lock()
 	defer mc.mutex.Unlock()
 
-	return mc.metrics.Clone(), mc.pollCount
-}
+	mc.pollCount += pollCount
+	for _, sample := range counters {
+		key := sampleKey{mtype: sample.MType, series: sample.Key()}
+		if current, ok := mc.samples[key]; ok {
+			sample.Delta += current.Delta
+		}
+		mc.samples[key] = sample
+	}
 
-// ResetCount сбрасывает счетчик
-func (mc *metricsCollector) ResetCount() {
-	mc.mutex.Lock()
-	defer mc.mutex.Unlock()
+	for key, stats := range window {
+		if current, ok := mc.window[key]; ok {
+			current.merge(stats)
+			continue
+		}
+		mc.window[key] = stats
+	}
+}
 
-	mc.pollCount = 0
+// sortSamples упорядочивает значения по имени, типу и ключу ряда
+func sortSamples(samples []model.Sample) {
+	sort.Slice(samples, func(i, j int) bool {
+		if samples[i].Name != samples[j].Name {
+			return samples[i].Name < samples[j].Name
+		}
+		if samples[i].MType != samples[j].MType {
+			return samples[i].MType < samples[j].MType
+		}
+		return samples[i].Key() < samples[j].Key()
+	})
 }
 
 // Stop останавливает сбор метрик
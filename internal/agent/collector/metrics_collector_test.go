@@ -0,0 +1,554 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/agent/interfaces"
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/config"
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+// fakeProvider на каждом опросе возвращает следующие значения из polls
+type fakeProvider struct {
+	polls [][]model.Sample
+	calls int
+}
+
+func (p *fakeProvider) Collect(context.Context) ([]model.Sample, error) {
+	if p.calls >= len(p.polls) {
+		return nil, errors.New("no more polls")
+	}
+	samples := p.polls[p.calls]
+	p.calls++
+	return samples, nil
+}
+
+func newTestCollector(t *testing.T, aggregation string, buckets []float64, provider *fakeProvider) *metricsCollector {
+	t.Helper()
+	mc := NewMetricsCollector(context.Background(), time.Hour, zaptest.NewLogger(t),
+		nil, aggregation, buckets).(*metricsCollector)
+	if provider != nil {
+		mc.providers = append(mc.providers, provider)
+	}
+	t.Cleanup(mc.Stop)
+	return mc
+}
+
+// poll проводит n опросов
+func poll(mc *metricsCollector, n int) {
+	for i := 0; i < n; i++ {
+		mc.collectFromAllProviders()
+	}
+}
+
+// sendMode - как fakeSender обходится с батчем
+type sendMode int
+
+const (
+	// sendOK - отложенные батчи и новый батч доставлены
+	sendOK sendMode = iota
+	// sendFailed - батч отправлен, но ответ не получен; отправитель повторит его
+	sendFailed
+	// sendQueueFull - очередь переполнена, спула нет
+	sendQueueFull
+	// sendSpooled - батч отложен в спул без отправки, о доставке станет известно позже
+	sendSpooled
+)
+
+var (
+	errQueueFull = fmt.Errorf("%w: worker pool queue is full", interfaces.ErrNotSent)
+	errDropped   = errors.New("spooled batch dropped before delivery")
+)
+
+// pendingBatch - отложенный батч fakeSender
+type pendingBatch struct {
+	samples   []model.Sample
+	pollCount int64
+	done      func(error)
+	// posted - батч отправлялся на сервер
+	posted bool
+}
+
+// fakeSender ведет себя как отправитель в режиме mode: отложенные батчи
+// повторяются как есть перед новыми. Запоминает доставленные батчи.
+type fakeSender struct {
+	mode      sendMode
+	pending   []pendingBatch
+	delivered [][]model.Sample
+	polls     int64
+}
+
+func (s *fakeSender) Send(_ context.Context, samples []model.Sample, pollCount int64, done func(error)) error {
+	switch s.mode {
+	case sendFailed:
+		s.pending = append(s.pending, pendingBatch{samples: samples, pollCount: pollCount, done: done, posted: true})
+	case sendQueueFull:
+		done(errQueueFull)
+	case sendSpooled:
+		s.pending = append(s.pending, pendingBatch{samples: samples, pollCount: pollCount, done: done})
+	default:
+		s.replay()
+		s.deliver(samples, pollCount)
+		done(nil)
+	}
+	return nil
+}
+
+func (s *fakeSender) Stop() {}
+
+func (s *fakeSender) deliver(samples []model.Sample, pollCount int64) {
+	s.delivered = append(s.delivered, samples)
+	s.polls += pollCount
+}
+
+// replay доставляет отложенные батчи
+func (s *fakeSender) replay() {
+	for _, batch := range s.pending {
+		s.deliver(batch.samples, batch.pollCount)
+		batch.done(nil)
+	}
+	s.pending = nil
+}
+
+// drop удаляет отложенные батчи без доставки, как при вытеснении
+func (s *fakeSender) drop() {
+	for _, batch := range s.pending {
+		if batch.posted {
+			batch.done(errDropped)
+		} else {
+			batch.done(fmt.Errorf("%w: %w", interfaces.ErrNotSent, errDropped))
+		}
+	}
+	s.pending = nil
+}
+
+// report повторяет metricsReporter.report
+func report(mc *metricsCollector, sender *fakeSender) {
+	samples, pollCount, release := mc.Take()
+	err := sender.Send(context.Background(), samples, pollCount, func(err error) {
+		release(!errors.Is(err, interfaces.ErrNotSent))
+	})
+	if err != nil {
+		release(false)
+	}
+}
+
+// counterSum суммирует доставленные приращения counter по ключу ряда
+func counterSum(batches [][]model.Sample) map[string]int64 {
+	sums := make(map[string]int64)
+	for _, batch := range batches {
+		for _, sample := range batch {
+			if sample.MType == model.Counter {
+				sums[sample.Key()] += sample.Delta
+			}
+		}
+	}
+	return sums
+}
+
+// findSample возвращает значение с именем name из батча
+func findSample(t *testing.T, batch []model.Sample, name string) model.Sample {
+	t.Helper()
+	for _, sample := range batch {
+		if sample.Name == name {
+			return sample
+		}
+	}
+	require.Failf(t, "sample not found", "%s", name)
+	return model.Sample{}
+}
+
+// counterPolls возвращает провайдер, который на каждом опросе
+// дает gauge Alloc с номером опроса и приращение Requests на 2
+func counterPolls(n int) *fakeProvider {
+	provider := &fakeProvider{}
+	for i := 1; i <= n; i++ {
+		provider.polls = append(provider.polls, []model.Sample{
+			model.GaugeSample("Alloc", float64(i)),
+			model.CounterSample("Requests", 2),
+		})
+	}
+	return provider
+}
+
+func TestMetricsCollector_PollsDeliveredOnce(t *testing.T) {
+	// step - опросы перед отправкой и что делает с батчем отправитель
+	type step struct {
+		polls int
+		mode  sendMode
+	}
+
+	tests := []struct {
+		name  string
+		steps []step
+		// finish вызывается после всех шагов, до последней успешной отправки
+		finish func(s *fakeSender)
+	}{
+		{
+			name:  "failed send",
+			steps: []step{{polls: 3, mode: sendFailed}, {polls: 2, mode: sendOK}},
+		},
+		{
+			name:  "full queue without spool",
+			steps: []step{{polls: 2, mode: sendQueueFull}, {polls: 1, mode: sendQueueFull}, {polls: 4, mode: sendOK}},
+		},
+		{
+			name:   "full queue with spool delivered later",
+			steps:  []step{{polls: 2, mode: sendSpooled}, {polls: 3, mode: sendSpooled}},
+			finish: (*fakeSender).replay,
+		},
+		{
+			name:   "spooled batches dropped",
+			steps:  []step{{polls: 2, mode: sendSpooled}, {polls: 3, mode: sendSpooled}},
+			finish: (*fakeSender).drop,
+		},
+		{
+			name: "success after failure",
+			steps: []step{
+				{polls: 1, mode: sendOK},
+				{polls: 2, mode: sendFailed},
+				{polls: 1, mode: sendQueueFull},
+				{polls: 3, mode: sendOK},
+				{polls: 1, mode: sendOK},
+			},
+		},
+		{
+			name: "polls during pending spool",
+			steps: []step{
+				{polls: 2, mode: sendSpooled},
+				{polls: 3, mode: sendQueueFull},
+				{polls: 1, mode: sendSpooled},
+			},
+			finish: (*fakeSender).drop,
+		},
+		{
+			name: "failed batches resent before new ones",
+			steps: []step{
+				{polls: 2, mode: sendFailed},
+				{polls: 1, mode: sendFailed},
+				{polls: 3, mode: sendOK},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			total := 0
+			for _, st := range tt.steps {
+				total += st.polls
+			}
+			provider := counterPolls(total)
+			mc := newTestCollector(t, config.AggregationLast, nil, provider)
+			sender := &fakeSender{}
+
+			for _, st := range tt.steps {
+				poll(mc, st.polls)
+				sender.mode = st.mode
+				report(mc, sender)
+			}
+			if tt.finish != nil {
+				tt.finish(sender)
+			}
+			sender.mode = sendOK
+			report(mc, sender)
+
+			assert.Equal(t, int64(total), sender.polls)
+			assert.Equal(t, map[string]int64{"Requests": int64(2 * total)}, counterSum(sender.delivered))
+
+			// Все отправлено: следующий батч пуст
+			samples, pollCount, release := mc.Take()
+			release(true)
+			assert.Zero(t, pollCount)
+			assert.Empty(t, counterSum([][]model.Sample{samples}))
+		})
+	}
+}
+
+func TestMetricsCollector_RestoreMergesWindow(t *testing.T) {
+	mc := newTestCollector(t, config.AggregationGauges, nil, counterPolls(5))
+	sender := &fakeSender{}
+
+	// Окно с Alloc 1..3 не отправлено и возвращается в сборщик
+	poll(mc, 3)
+	sender.mode = sendQueueFull
+	report(mc, sender)
+
+	poll(mc, 2)
+	sender.mode = sendOK
+	report(mc, sender)
+
+	require.Len(t, sender.delivered, 1)
+	batch := sender.delivered[0]
+	assert.Equal(t, 1.0, findSample(t, batch, "Alloc_min").Value)
+	assert.Equal(t, 5.0, findSample(t, batch, "Alloc_max").Value)
+	assert.Equal(t, 3.0, findSample(t, batch, "Alloc_avg").Value)
+	assert.Equal(t, 5.0, findSample(t, batch, "Alloc").Value)
+	assert.Equal(t, int64(10), findSample(t, batch, "Requests").Delta)
+	assert.Equal(t, int64(5), sender.polls)
+}
+
+func TestMetricsCollector_FailedBatchResentAsIs(t *testing.T) {
+	mc := newTestCollector(t, config.AggregationLast, nil, counterPolls(5))
+	sender := &fakeSender{}
+
+	// Батч отправлен без ответа: сервер мог его применить, поэтому значения
+	// не возвращаются в сборщик, а батч повторяется отдельно
+	poll(mc, 3)
+	sender.mode = sendFailed
+	report(mc, sender)
+
+	poll(mc, 2)
+	sender.mode = sendOK
+	report(mc, sender)
+
+	require.Len(t, sender.delivered, 2)
+	assert.Equal(t, int64(6), findSample(t, sender.delivered[0], "Requests").Delta)
+	assert.Equal(t, int64(4), findSample(t, sender.delivered[1], "Requests").Delta)
+	assert.Equal(t, int64(5), sender.polls)
+}
+
+func TestMetricsCollector_PostedBatchDroppedNotCountedTwice(t *testing.T) {
+	mc := newTestCollector(t, config.AggregationLast, nil, counterPolls(5))
+	sender := &fakeSender{}
+
+	// Отправленный батч вытеснен: сервер мог его применить, повторно
+	// его значения не отправляются
+	poll(mc, 2)
+	sender.mode = sendFailed
+	report(mc, sender)
+	sender.drop()
+
+	poll(mc, 3)
+	sender.mode = sendOK
+	report(mc, sender)
+
+	assert.Equal(t, int64(3), sender.polls)
+	assert.Equal(t, map[string]int64{"Requests": 6}, counterSum(sender.delivered))
+}
+
+func TestMetricsCollector_ReleaseOnce(t *testing.T) {
+	mc := newTestCollector(t, config.AggregationLast, nil, counterPolls(2))
+
+	poll(mc, 2)
+	_, pollCount, release := mc.Take()
+	assert.Equal(t, int64(2), pollCount)
+
+	release(false)
+	release(false)
+	release(true)
+
+	_, pollCount, _ = mc.Take()
+	assert.Equal(t, int64(2), pollCount)
+}
+
+// gaugePolls возвращает провайдер, который на каждом опросе дает Alloc из values
+func gaugePolls(values ...float64) *fakeProvider {
+	provider := &fakeProvider{}
+	for _, value := range values {
+		provider.polls = append(provider.polls, []model.Sample{model.GaugeSample("Alloc", value)})
+	}
+	return provider
+}
+
+func TestMetricsCollector_Aggregation(t *testing.T) {
+	buckets := []float64{1, 2.5}
+
+	tests := []struct {
+		name        string
+		aggregation string
+		values      []float64
+		want        []model.Sample
+	}{
+		{
+			name:        "last",
+			aggregation: config.AggregationLast,
+			values:      []float64{3, 1, 2},
+			want:        []model.Sample{model.GaugeSample("Alloc", 2)},
+		},
+		{
+			name:        "gauges",
+			aggregation: config.AggregationGauges,
+			values:      []float64{3, 1, 2},
+			want: []model.Sample{
+				model.GaugeSample("Alloc", 2),
+				model.GaugeSample("Alloc_min", 1),
+				model.GaugeSample("Alloc_max", 3),
+				model.GaugeSample("Alloc_avg", 2),
+			},
+		},
+		{
+			name:        "gauges skip NaN and Inf",
+			aggregation: config.AggregationGauges,
+			values:      []float64{3, math.NaN(), 1, math.Inf(1), math.Inf(-1), 2},
+			want: []model.Sample{
+				model.GaugeSample("Alloc", 2),
+				model.GaugeSample("Alloc_min", 1),
+				model.GaugeSample("Alloc_max", 3),
+				model.GaugeSample("Alloc_avg", 2),
+			},
+		},
+		{
+			name:        "histogram",
+			aggregation: config.AggregationHistogram,
+			values:      []float64{3, 1, math.NaN(), 2, math.Inf(1), 0.5},
+			want: []model.Sample{
+				// Последнее значение gauge отправляется вместе с гистограммой
+				model.GaugeSample("Alloc", 0.5),
+				{
+					Name:  "Alloc",
+					MType: model.Histogram,
+					Histogram: &model.HistogramValue{
+						Buckets: buckets,
+						Counts:  []int64{2, 1, 1},
+						Sum:     6.5,
+						Count:   4,
+					},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mc := newTestCollector(t, tt.aggregation, buckets, gaugePolls(tt.values...))
+			poll(mc, len(tt.values))
+
+			samples, pollCount, release := mc.Take()
+			release(true)
+
+			assert.Equal(t, int64(len(tt.values)), pollCount)
+			assert.Equal(t, tt.want, samples)
+		})
+	}
+}
+
+func TestMetricsCollector_WindowResetsAfterDelivery(t *testing.T) {
+	mc := newTestCollector(t, config.AggregationGauges, nil, gaugePolls(1, 5, 7))
+
+	poll(mc, 2)
+	_, _, release := mc.Take()
+	release(true)
+
+	poll(mc, 1)
+	samples, _, release := mc.Take()
+	release(true)
+
+	assert.Equal(t, []model.Sample{
+		model.GaugeSample("Alloc", 7),
+		model.GaugeSample("Alloc_min", 7),
+		model.GaugeSample("Alloc_max", 7),
+		model.GaugeSample("Alloc_avg", 7),
+	}, samples)
+
+	// Новых опросов не было: окно пустое, остается последний gauge
+	samples, _, release = mc.Take()
+	release(true)
+	assert.Equal(t, []model.Sample{model.GaugeSample("Alloc", 7)}, samples)
+}
+
+func TestMetricsCollector_HistogramMergedBackOnFailure(t *testing.T) {
+	buckets := []float64{1, 2.5}
+	mc := newTestCollector(t, config.AggregationHistogram, buckets, gaugePolls(0.5, 2, 3))
+
+	poll(mc, 2)
+	_, _, release := mc.Take()
+	release(false)
+
+	poll(mc, 1)
+	samples, pollCount, release := mc.Take()
+	release(true)
+
+	assert.Equal(t, int64(3), pollCount)
+	histogram := findHistogram(t, samples, "Alloc")
+	assert.Equal(t, model.HistogramValue{
+		Buckets: buckets,
+		Counts:  []int64{1, 1, 1},
+		Sum:     5.5,
+		Count:   3,
+	}, *histogram)
+}
+
+// findHistogram возвращает гистограмму с именем name из батча
+func findHistogram(t *testing.T, batch []model.Sample, name string) *model.HistogramValue {
+	t.Helper()
+	for _, sample := range batch {
+		if sample.Name == name && sample.MType == model.Histogram {
+			require.NotNil(t, sample.Histogram)
+			return sample.Histogram
+		}
+	}
+	require.Failf(t, "histogram not found", "%s", name)
+	return nil
+}
+
+func TestMetricsCollector_MergeMetrics(t *testing.T) {
+	cpu := func(core string, value float64) model.Sample {
+		sample := model.GaugeSample("CPUutilization", value)
+		sample.Labels = model.Labels{"core": core}
+		return sample
+	}
+	requests := func(route string, delta int64) model.Sample {
+		sample := model.CounterSample("Requests", delta)
+		sample.Labels = model.Labels{"route": route}
+		return sample
+	}
+
+	tests := []struct {
+		name  string
+		polls [][]model.Sample
+		want  []model.Sample
+	}{
+		{
+			name: "zero gauge replaces previous value",
+			polls: [][]model.Sample{
+				{model.GaugeSample("Alloc", 42)},
+				{model.GaugeSample("Alloc", 0)},
+			},
+			want: []model.Sample{model.GaugeSample("Alloc", 0)},
+		},
+		{
+			name: "counter deltas summed by series",
+			polls: [][]model.Sample{
+				{requests("/a", 1), requests("/b", 10)},
+				{requests("/a", 2)},
+				{requests("/a", 3), requests("/b", 20)},
+			},
+			want: []model.Sample{requests("/a", 6), requests("/b", 30)},
+		},
+		{
+			name: "gauge and counter with same name are independent",
+			polls: [][]model.Sample{
+				{model.GaugeSample("Requests", 5), model.CounterSample("Requests", 1)},
+				{model.GaugeSample("Requests", 7), model.CounterSample("Requests", 2)},
+			},
+			want: []model.Sample{model.CounterSample("Requests", 3), model.GaugeSample("Requests", 7)},
+		},
+		{
+			name: "labeled series stay separate",
+			polls: [][]model.Sample{
+				{cpu("0", 10), cpu("1", 20)},
+				{cpu("0", 0), cpu("1", 25)},
+			},
+			want: []model.Sample{cpu("0", 0), cpu("1", 25)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mc := newTestCollector(t, config.AggregationLast, nil, &fakeProvider{polls: tt.polls})
+			poll(mc, len(tt.polls))
+
+			samples, _, release := mc.Take()
+			release(true)
+			assert.Equal(t, tt.want, samples)
+		})
+	}
+}
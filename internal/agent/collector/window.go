@@ -0,0 +1,70 @@
+package collector
+
+import (
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/config"
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/model"
+)
+
+// windowStats - статистика одного gauge за окно между отправками
+type windowStats struct {
+	name   string
+	labels model.Labels
+	min    float64
+	max    float64
+	sum    float64
+	count  int64
+	// histogram заполняется только в режиме config.AggregationHistogram
+	histogram *model.HistogramValue
+}
+
+func newWindowStats(sample model.Sample, withHistogram bool, buckets []float64) *windowStats {
+	stats := &windowStats{
+		name:   sample.Name,
+		labels: sample.Labels,
+		min:    sample.Value,
+		max:    sample.Value,
+	}
+	if withHistogram {
+		histogram := model.NewHistogram(buckets)
+		stats.histogram = &histogram
+	}
+	return stats
+}
+
+func (w *windowStats) add(value float64) {
+	w.min = min(w.min, value)
+	w.max = max(w.max, value)
+	w.sum += value
+	w.count++
+	if w.histogram != nil {
+		w.histogram.Observe(value)
+	}
+}
+
+// merge добавляет статистику другого окна того же gauge
+func (w *windowStats) merge(other *windowStats) {
+	w.min = min(w.min, other.min)
+	w.max = max(w.max, other.max)
+	w.sum += other.sum
+	w.count += other.count
+	if w.histogram != nil && other.histogram != nil {
+		// Границы корзин у окон сборщика общие, ошибки быть не может
+		if merged, err := w.histogram.Merge(*other.histogram); err == nil {
+			w.histogram = &merged
+		}
+	}
+}
+
+// samples возвращает итоги окна: gauge с суффиксами _min, _max, _avg
+// или гистограмму с именем исходного gauge
+func (w *windowStats) samples(aggregation string) []model.Sample {
+	if aggregation == config.AggregationHistogram {
+		return []model.Sample{{Name: w.name, MType: model.Histogram, Histogram: w.histogram, Labels: w.labels}}
+	}
+
+	return []model.Sample{
+		{Name: w.name + "_min", MType: model.Gauge, Value: w.min, Labels: w.labels},
+		{Name: w.name + "_max", MType: model.Gauge, Value: w.max, Labels: w.labels},
+		{Name: w.name + "_avg", MType: model.Gauge, Value: w.sum / float64(w.count), Labels: w.labels},
+	}
+}
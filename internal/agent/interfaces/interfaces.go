@@ -2,6 +2,7 @@ package interfaces
 
 import (
 	"context"
+	"errors"
 
 	"github.com/kazakovdmitriy/go-musthave-metrics/internal/model"
 )
@@ -12,18 +13,34 @@ type HTTPClient interface {
 	Get(ctx context.Context, endpoint string) ([]byte, error)
 }
 
-// MetricsSender интерфейс для отправителя метрик
+// ErrNotSent - батч не отправлялся на сервер, и его значения можно
+// вернуть в сборщик без риска учесть их дважды
+var ErrNotSent = errors.New("batch was not sent")
+
+// MetricsSender интерфейс для отправителя метрик.
+// Send может отправлять асинхронно; done вызывается один раз, когда батч
+// доставлен на сервер, в том числе повтором (nil), либо потерян (ошибка).
+// Батч, отправленный без подтверждения, отправитель повторяет сам с тем же
+// ключом идемпотентности; ошибка с ErrNotSent значит, что батч на сервер
+// не отправлялся. Если Send вернул ошибку, done не вызывается.
 type MetricsSender interface {
-	Send(ctx context.Context, metrics model.MemoryMetrics, deltaCounter int64) error
+	Send(ctx context.Context, samples []model.Sample, deltaCounter int64, done func(error)) error
 	Stop()
 }
 
+// MetricsSpool интерфейс для буфера неподтвержденных батчей.
+// Батч хранится с ключом идемпотентности и повторяется с ним же;
+// done вызывается, когда батч доставлен или удален без доставки.
+type MetricsSpool interface {
+	Append(key string, batch []model.Metrics, done func(error)) error
+	Replay(ctx context.Context, send func(key string, batch []model.Metrics) error) (int, error)
+}
+
 // MetricsCollector интерфейс для сборщика метрик
 type MetricsCollector interface {
 	Start()
 	Stop()
-	GetMetrics() (model.MemoryMetrics, int)
-	ResetCount()
+	Take() (samples []model.Sample, pollCount int64, release func(sent bool))
 }
 
 // MetricsReporter интерфейс для репортера метрик
@@ -32,7 +49,8 @@ type MetricsReporter interface {
 	Stop()
 }
 
-// MetricsProvider интерфейс для поставщика метрик
+// MetricsProvider интерфейс для поставщика метрик.
+// Поставщик возвращает gauge и приращения counter с прошлого вызова Collect.
 type MetricsProvider interface {
-	Collect(ctx context.Context) (model.MemoryMetrics, error)
+	Collect(ctx context.Context) ([]model.Sample, error)
 }
@@ -2,6 +2,7 @@ package provider
 
 import (
 	"context"
+	"strconv"
 
 	"github.com/kazakovdmitriy/go-musthave-metrics/internal/agent/interfaces"
 	"github.com/kazakovdmitriy/go-musthave-metrics/internal/model"
@@ -17,29 +18,34 @@ func NewGopsutilProvider() interfaces.MetricsProvider {
 	return &GopsutilProvider{}
 }
 
-// Collect собирает системные метрики
-func (p *GopsutilProvider) Collect(ctx context.Context) (model.MemoryMetrics, error) {
+// Collect собирает системные метрики. Загрузка каждого ядра - отдельный ряд
+// CPUutilization с меткой core, ядра нумеруются с 1.
+func (p *GopsutilProvider) Collect(ctx context.Context) ([]model.Sample, error) {
 	select {
 	case <-ctx.Done():
-		return model.MemoryMetrics{}, ctx.Err()
+		return nil, ctx.Err()
 	default:
-		metrics := model.MemoryMetrics{}
-
 		memInfo, err := mem.VirtualMemoryWithContext(ctx)
 		if err != nil {
-			return metrics, err
+			return nil, err
 		}
 
-		metrics.TotalMemory = float64(memInfo.Total)
-		metrics.FreeMemory = float64(memInfo.Free)
-
 		cpuPercent, err := cpu.PercentWithContext(ctx, 0, true)
 		if err != nil {
-			return metrics, err
+			return nil, err
 		}
 
-		metrics.CPUutilization = cpuPercent
+		samples := make([]model.Sample, 0, len(cpuPercent)+2)
+		samples = append(samples,
+			model.GaugeSample("TotalMemory", float64(memInfo.Total)),
+			model.GaugeSample("FreeMemory", float64(memInfo.Free)),
+		)
+		for i, utilization := range cpuPercent {
+			sample := model.GaugeSample("CPUutilization", utilization)
+			sample.Labels = model.Labels{"core": strconv.Itoa(i + 1)}
+			samples = append(samples, sample)
+		}
 
-		return metrics, nil
+		return samples, nil
 	}
 }
@@ -9,6 +9,40 @@ import (
 	"github.com/kazakovdmitriy/go-musthave-metrics/internal/model"
 )
 
+// runtimeGauges - gauge из runtime.MemStats по именам метрик
+var runtimeGauges = []struct {
+	name  string
+	value func(m *runtime.MemStats) float64
+}{
+	{"Alloc", func(m *runtime.MemStats) float64 { return float64(m.Alloc) }},
+	{"BuckHashSys", func(m *runtime.MemStats) float64 { return float64(m.BuckHashSys) }},
+	{"Frees", func(m *runtime.MemStats) float64 { return float64(m.Frees) }},
+	{"GCCPUFraction", func(m *runtime.MemStats) float64 { return m.GCCPUFraction }},
+	{"GCSys", func(m *runtime.MemStats) float64 { return float64(m.GCSys) }},
+	{"HeapAlloc", func(m *runtime.MemStats) float64 { return float64(m.HeapAlloc) }},
+	{"HeapIdle", func(m *runtime.MemStats) float64 { return float64(m.HeapIdle) }},
+	{"HeapInuse", func(m *runtime.MemStats) float64 { return float64(m.HeapInuse) }},
+	{"HeapObjects", func(m *runtime.MemStats) float64 { return float64(m.HeapObjects) }},
+	{"HeapReleased", func(m *runtime.MemStats) float64 { return float64(m.HeapReleased) }},
+	{"HeapSys", func(m *runtime.MemStats) float64 { return float64(m.HeapSys) }},
+	{"LastGC", func(m *runtime.MemStats) float64 { return float64(m.LastGC) }},
+	{"Lookups", func(m *runtime.MemStats) float64 { return float64(m.Lookups) }},
+	{"MCacheInuse", func(m *runtime.MemStats) float64 { return float64(m.MCacheInuse) }},
+	{"MCacheSys", func(m *runtime.MemStats) float64 { return float64(m.MCacheSys) }},
+	{"MSpanInuse", func(m *runtime.MemStats) float64 { return float64(m.MSpanInuse) }},
+	{"MSpanSys", func(m *runtime.MemStats) float64 { return float64(m.MSpanSys) }},
+	{"Mallocs", func(m *runtime.MemStats) float64 { return float64(m.Mallocs) }},
+	{"NextGC", func(m *runtime.MemStats) float64 { return float64(m.NextGC) }},
+	{"NumForcedGC", func(m *runtime.MemStats) float64 { return float64(m.NumForcedGC) }},
+	{"NumGC", func(m *runtime.MemStats) float64 { return float64(m.NumGC) }},
+	{"OtherSys", func(m *runtime.MemStats) float64 { return float64(m.OtherSys) }},
+	{"PauseTotalNs", func(m *runtime.MemStats) float64 { return float64(m.PauseTotalNs) }},
+	{"StackInuse", func(m *runtime.MemStats) float64 { return float64(m.StackInuse) }},
+	{"StackSys", func(m *runtime.MemStats) float64 { return float64(m.StackSys) }},
+	{"Sys", func(m *runtime.MemStats) float64 { return float64(m.Sys) }},
+	{"TotalAlloc", func(m *runtime.MemStats) float64 { return float64(m.TotalAlloc) }},
+}
+
 // RuntimeMetricsProvider поставщик метрик runtime
 type RuntimeMetricsProvider struct{}
 
@@ -18,43 +52,20 @@ func NewRuntimeMetricsProvider() interfaces.MetricsProvider {
 }
 
 // Collect собирает метрики runtime
-func (p *RuntimeMetricsProvider) Collect(ctx context.Context) (model.MemoryMetrics, error) {
+func (p *RuntimeMetricsProvider) Collect(ctx context.Context) ([]model.Sample, error) {
 	select {
 	case <-ctx.Done():
-		return model.MemoryMetrics{}, ctx.Err()
+		return nil, ctx.Err()
 	default:
 		var m runtime.MemStats
 		runtime.ReadMemStats(&m)
 
-		return model.MemoryMetrics{
-			Alloc:         float64(m.Alloc),
-			BuckHashSys:   float64(m.BuckHashSys),
-			Frees:         float64(m.Frees),
-			GCCPUFraction: m.GCCPUFraction,
-			GCSys:         float64(m.GCSys),
-			HeapAlloc:     float64(m.HeapAlloc),
-			HeapIdle:      float64(m.HeapIdle),
-			HeapInuse:     float64(m.HeapInuse),
-			HeapObjects:   float64(m.HeapObjects),
-			HeapReleased:  float64(m.HeapReleased),
-			HeapSys:       float64(m.HeapSys),
-			LastGC:        float64(m.LastGC),
-			Lookups:       float64(m.Lookups),
-			MCacheInuse:   float64(m.MCacheInuse),
-			MCacheSys:     float64(m.MCacheSys),
-			MSpanInuse:    float64(m.MSpanInuse),
-			MSpanSys:      float64(m.MSpanSys),
-			Mallocs:       float64(m.Mallocs),
-			NextGC:        float64(m.NextGC),
-			NumForcedGC:   float64(m.NumForcedGC),
-			NumGC:         float64(m.NumGC),
-			OtherSys:      float64(m.OtherSys),
-			PauseTotalNs:  float64(m.PauseTotalNs),
-			StackInuse:    float64(m.StackInuse),
-			StackSys:      float64(m.StackSys),
-			Sys:           float64(m.Sys),
-			TotalAlloc:    float64(m.TotalAlloc),
-			RandomValue:   rand.Float64(),
-		}, nil
+		samples := make([]model.Sample, 0, len(runtimeGauges)+1)
+		for _, gauge := range runtimeGauges {
+			samples = append(samples, model.GaugeSample(gauge.name, gauge.value(&m)))
+		}
+		samples = append(samples, model.GaugeSample("RandomValue", rand.Float64()))
+
+		return samples, nil
 	}
 }
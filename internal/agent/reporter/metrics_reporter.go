@@ -2,6 +2,7 @@ package reporter
 
 import (
 	"context"
+	"errors"
 	"sync"
 	"time"
 
@@ -54,15 +55,20 @@ func (mr *metricsReporter) Start() {
 	}()
 }
 
-// report выполняет отправку метрик
+// report выполняет отправку метрик.
+// Число опросов, приращения counter и окно агрегации возвращаются в сборщик
+// и уходят со следующим батчем, только если батч не отправлялся на сервер.
+// Отправленный без подтверждения батч отправитель повторяет сам.
 func (mr *metricsReporter) report() {
-	metrics, count := mr.collector.GetMetrics()
+	samples, pollCount, release := mr.collector.Take()
 
-	err := mr.sender.Send(mr.ctx, metrics, int64(count))
+	err := mr.sender.Send(mr.ctx, samples, pollCount, func(err error) {
+		release(!errors.Is(err, interfaces.ErrNotSent))
+	})
 	if err != nil {
+		release(false)
 		mr.logger.Error("error sending metrics", zap.Error(err))
 	} else {
-		mr.collector.ResetCount()
 		mr.logger.Info("metrics submitted to worker pool successfully")
 	}
 }
@@ -0,0 +1,97 @@
+package reporter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/agent/interfaces"
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/model"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zaptest"
+)
+
+// fakeCollector отдает pollCount опросов и запоминает вызовы release
+type fakeCollector struct {
+	pollCount int64
+	released  []bool
+}
+
+func (c *fakeCollector) Start() {}
+func (c *fakeCollector) Stop()  {}
+
+func (c *fakeCollector) Take() ([]model.Sample, int64, func(sent bool)) {
+	samples := []model.Sample{model.GaugeSample("Alloc", 1)}
+	return samples, c.pollCount, func(sent bool) {
+		c.released = append(c.released, sent)
+	}
+}
+
+// fakeSender возвращает sendErr или вызывает done с doneErr;
+// при spooled сохраняет done, как спул до доставки батча
+type fakeSender struct {
+	sendErr error
+	doneErr error
+	spooled bool
+	done    func(error)
+	polls   int64
+}
+
+func (s *fakeSender) Send(_ context.Context, _ []model.Sample, pollCount int64, done func(error)) error {
+	if s.sendErr != nil {
+		return s.sendErr
+	}
+	s.polls = pollCount
+	if s.spooled {
+		s.done = done
+		return nil
+	}
+	done(s.doneErr)
+	return nil
+}
+
+func (s *fakeSender) Stop() {}
+
+func TestMetricsReporter_Report(t *testing.T) {
+	errUnavailable := errors.New("server unavailable")
+	errNotSent := fmt.Errorf("%w: queue is full", interfaces.ErrNotSent)
+
+	tests := []struct {
+		name   string
+		sender *fakeSender
+		// later - результат отложенной доставки
+		later    error
+		released []bool
+	}{
+		{name: "delivered", sender: &fakeSender{}, released: []bool{true}},
+		{name: "not sent", sender: &fakeSender{doneErr: errNotSent}, released: []bool{false}},
+		{name: "send refused", sender: &fakeSender{sendErr: errUnavailable}, released: []bool{false}},
+		{name: "spooled and delivered", sender: &fakeSender{spooled: true}, released: []bool{true}},
+		{name: "dropped before sending", sender: &fakeSender{spooled: true}, later: errNotSent, released: []bool{false}},
+		// Сервер мог применить отправленный батч, его опросы не возвращаются
+		{name: "dropped after sending", sender: &fakeSender{spooled: true}, later: errUnavailable, released: []bool{true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			collector := &fakeCollector{pollCount: 4}
+			mr := NewMetricsReporter(context.Background(), collector, tt.sender,
+				time.Hour, zaptest.NewLogger(t)).(*metricsReporter)
+			defer mr.Stop()
+
+			mr.report()
+			if tt.sender.spooled {
+				// Пока батч в спуле, опросы не подтверждены
+				assert.Empty(t, collector.released)
+				tt.sender.done(tt.later)
+			}
+
+			assert.Equal(t, tt.released, collector.released)
+			if tt.sender.sendErr == nil {
+				assert.Equal(t, int64(4), tt.sender.polls)
+			}
+		})
+	}
+}
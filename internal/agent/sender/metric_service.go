@@ -2,73 +2,103 @@ package sender
 
 import (
 	"context"
+	"fmt"
+	"sync"
 
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/agent/client"
 	"github.com/kazakovdmitriy/go-musthave-metrics/internal/agent/interfaces"
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/agent/spool"
 	"github.com/kazakovdmitriy/go-musthave-metrics/internal/model"
 	"go.uber.org/zap"
 )
 
+// maxPendingBatches - сколько неподтвержденных батчей хранится в памяти,
+// если спул выключен или не принял батч
+const maxPendingBatches = 64
+
 // metricsService содержит общую логику отправки метрик
 type metricsService struct {
 	client    interfaces.HTTPClient
 	logger    *zap.Logger
 	batchPool *MetricsBatchPool
+	// labels добавляются ко всем метрикам; nil - метки не отправляются
+	labels model.Labels
+	// spool хранит на диске отложенные батчи; nil - спул выключен
+	spool interfaces.MetricsSpool
+	// pending хранит в памяти отложенные батчи, если спул выключен или не принял батч
+	pending *spool.Memory
+
+	mu sync.Mutex
+	// unposted - ключи отложенных батчей, которые еще не отправлялись на сервер
+	unposted map[string]struct{}
 }
 
-func newMetricsService(client interfaces.HTTPClient, logger *zap.Logger) *metricsService {
+func newMetricsService(
+	client interfaces.HTTPClient,
+	labels model.Labels,
+	metricsSpool interfaces.MetricsSpool,
+	logger *zap.Logger,
+) *metricsService {
 	return &metricsService{
 		client:    client,
 		logger:    logger,
 		batchPool: NewMetricsBatchPool(20),
+		labels:    labels,
+		spool:     metricsSpool,
+		pending:   spool.NewMemory(maxPendingBatches),
+		unposted:  make(map[string]struct{}),
 	}
 }
 
-// send - общая логика отправки, которую используют все отправители
-func (ms *metricsService) send(ctx context.Context, metrics model.MemoryMetrics, deltaCounter int64) error {
-	metricsMap := metrics.ToMap()
-
-	if len(metricsMap) == 0 && deltaCounter == 0 {
-		ms.logger.Info("no metricshandler to send")
-		return nil
-	}
-
+// send - общая логика отправки, которую используют все отправители.
+// Сначала повторяются отложенные батчи, чтобы старые значения gauge
+// не перезаписали новые. Батч, который не удалось отправить, откладывается
+// как есть со своим ключом идемпотентности и повторяется перед следующими:
+// если сервер его применил, но ответ не дошел, повтор не учтется дважды.
+// done вызывается, когда батч доставлен или потерян, для отложенного
+// батча - при повторе или вытеснении. Ошибка возвращается, только если
+// батч потерян.
+func (ms *metricsService) send(
+	ctx context.Context,
+	samples []model.Sample,
+	deltaCounter int64,
+	done func(error),
+) error {
 	// Берем батч из пула
 	batchWrapper := ms.batchPool.GetBatch()
 	defer ms.batchPool.PutBatch(batchWrapper)
 
-	batch := batchWrapper.Slice
+	batch := ms.appendBatch(batchWrapper.Slice, samples, deltaCounter)
+	batchWrapper.Slice = batch
 
-	for name, value := range metricsMap {
-		valueCopy := value
-		batch = append(batch, model.Metrics{
-			ID:    name,
-			MType: model.Gauge,
-			Value: &valueCopy,
-		})
+	if len(batch) == 0 {
+		ms.logger.Info("no metricshandler to send after filtering")
+		done(nil)
+		return nil
 	}
 
-	if deltaCounter != 0 {
-		deltaCopy := deltaCounter
-		batch = append(batch, model.Metrics{
-			ID:    "PollCount",
-			MType: model.Counter,
-			Delta: &deltaCopy,
-		})
+	// Ключ общий для первой отправки и повторов
+	key, err := client.NewIdempotencyKey()
+	if err != nil {
+		err = fmt.Errorf("%w: %w", interfaces.ErrNotSent, err)
+		done(err)
+		return err
 	}
 
-	if len(batch) == 0 {
-		ms.logger.Info("no metricshandler to send after filtering")
+	if err := ms.replay(ctx); err != nil {
+		ms.store(key, batch, false, done)
 		return nil
 	}
 
-	_, err := ms.client.Post(ctx, "/updates/", batch)
+	_, err = ms.client.Post(client.WithIdempotencyKey(ctx, key), "/updates/", batch)
 	if err != nil {
 		ms.logger.Error(
 			"failed to send metricshandler batch",
 			zap.Int("metrics_count", len(batch)),
 			zap.Error(err),
 		)
-		return err
+		ms.store(key, batch, true, done)
+		return nil
 	}
 
 	ms.logger.Debug(
@@ -76,5 +106,130 @@ func (ms *metricsService) send(ctx context.Context, metrics model.MemoryMetrics,
 		zap.Int("metrics_count", len(batch)),
 	)
 
+	done(nil)
+	return nil
+}
+
+// spoolMetrics откладывает метрики в спул без попытки отправки,
+// например когда очередь отправителя переполнена.
+// Возвращает false, если спул выключен; тогда done не вызывается.
+func (ms *metricsService) spoolMetrics(samples []model.Sample, deltaCounter int64, done func(error)) bool {
+	if ms.spool == nil {
+		return false
+	}
+
+	batch := ms.appendBatch(nil, samples, deltaCounter)
+	if len(batch) == 0 {
+		done(nil)
+		return true
+	}
+
+	key, err := client.NewIdempotencyKey()
+	if err != nil {
+		done(fmt.Errorf("%w: %w", interfaces.ErrNotSent, err))
+		return true
+	}
+	ms.store(key, batch, false, done)
+	return true
+}
+
+// appendBatch дописывает в batch метрики для отправки
+func (ms *metricsService) appendBatch(batch []model.Metrics, samples []model.Sample, deltaCounter int64) []model.Metrics {
+	batch = append(batch, model.SamplesToMetrics(samples, ms.labels)...)
+
+	if deltaCounter != 0 {
+		deltaCopy := deltaCounter
+		batch = append(batch, model.Metrics{
+			ID:     "PollCount",
+			MType:  model.Counter,
+			Delta:  &deltaCopy,
+			Labels: ms.labels,
+		})
+	}
+
+	return batch
+}
+
+// replay отправляет отложенные батчи от старых к новым с их исходными
+// ключами идемпотентности: сначала из спула, затем из памяти
+func (ms *metricsService) replay(ctx context.Context) error {
+	post := func(key string, batch []model.Metrics) error {
+		ms.markPosted(key)
+		_, err := ms.client.Post(client.WithIdempotencyKey(ctx, key), "/updates/", batch)
+		return err
+	}
+
+	var (
+		sent int
+		err  error
+	)
+	if ms.spool != nil {
+		sent, err = ms.spool.Replay(ctx, post)
+	}
+	if err == nil {
+		var n int
+		n, err = ms.pending.Replay(ctx, post)
+		sent += n
+	}
+	if sent > 0 {
+		ms.logger.Info("replayed pending batches", zap.Int("batches", sent))
+	}
+	if err != nil {
+		ms.logger.Error("failed to replay pending batches", zap.Error(err))
+		return err
+	}
 	return nil
 }
+
+// store откладывает батч с его ключом до следующей отправки: в спул,
+// а если спул выключен или не принял батч - в память. posted - батч уже
+// отправлялся на сервер и мог быть им применен. О доставке или потере
+// отложенного батча сообщает done.
+func (ms *metricsService) store(key string, batch []model.Metrics, posted bool, done func(error)) {
+	if !posted {
+		done = ms.trackUnposted(key, done)
+	}
+
+	if ms.spool != nil {
+		err := ms.spool.Append(key, batch, done)
+		if err == nil {
+			ms.logger.Info("metrics batch spooled", zap.Int("metrics_count", len(batch)))
+			return
+		}
+		ms.logger.Error("failed to spool metrics batch, keeping it in memory",
+			zap.Int("metrics_count", len(batch)),
+			zap.Error(err),
+		)
+	}
+
+	_ = ms.pending.Append(key, batch, done)
+	ms.logger.Info("metrics batch kept for retry", zap.Int("metrics_count", len(batch)))
+}
+
+// trackUnposted запоминает, что батч с ключом key еще не отправлялся.
+// Если такой батч потерян, done получает ошибку с interfaces.ErrNotSent:
+// его значения можно вернуть в сборщик.
+func (ms *metricsService) trackUnposted(key string, done func(error)) func(error) {
+	ms.mu.Lock()
+	ms.unposted[key] = struct{}{}
+	ms.mu.Unlock()
+
+	return func(err error) {
+		ms.mu.Lock()
+		_, unposted := ms.unposted[key]
+		delete(ms.unposted, key)
+		ms.mu.Unlock()
+
+		if err != nil && unposted {
+			err = fmt.Errorf("%w: %w", interfaces.ErrNotSent, err)
+		}
+		done(err)
+	}
+}
+
+// markPosted отмечает, что батч с ключом key отправлен на сервер
+func (ms *metricsService) markPosted(key string) {
+	ms.mu.Lock()
+	delete(ms.unposted, key)
+	ms.mu.Unlock()
+}
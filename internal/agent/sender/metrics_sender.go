@@ -2,12 +2,16 @@ package sender
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/kazakovdmitriy/go-musthave-metrics/internal/agent/interfaces"
 	"github.com/kazakovdmitriy/go-musthave-metrics/internal/model"
 	"go.uber.org/zap"
 )
 
+// errQueueFull - батч не отправлен: очередь worker pool переполнена, а спул выключен
+var errQueueFull = fmt.Errorf("%w: worker pool queue is full", interfaces.ErrNotSent)
+
 // metricsSender отправляет метрики на сервер используя worker pool
 type metricsSender struct {
 	workerPool     *WorkerPool
@@ -15,14 +19,24 @@ type metricsSender struct {
 	log            *zap.Logger
 }
 
-// NewMetricsSender создает новый отправитель метрик
-func NewMetricsSender(client interfaces.HTTPClient, workers int, queueSize int, logger *zap.Logger) interfaces.MetricsSender {
+// NewMetricsSender создает новый отправитель метрик.
+// Если labels не nil, они добавляются ко всем метрикам, а загрузка ядер отправляется с меткой core.
+// Если spool не nil, в него откладываются батчи, которые не удалось отправить,
+// иначе они хранятся в памяти.
+func NewMetricsSender(
+	client interfaces.HTTPClient,
+	workers int,
+	queueSize int,
+	labels model.Labels,
+	spool interfaces.MetricsSpool,
+	logger *zap.Logger,
+) interfaces.MetricsSender {
 	if workers <= 0 {
 		logger.Info("creating unlimited sender (no worker pool)")
-		return newUnlimitedSender(client, logger)
+		return newUnlimitedSender(client, labels, spool, logger)
 	}
 
-	metricsService := newMetricsService(client, logger)
+	metricsService := newMetricsService(client, labels, spool, logger)
 
 	workerPool := NewWorkerPool(workers, queueSize, logger)
 	workerPool.Start()
@@ -34,15 +48,22 @@ func NewMetricsSender(client interfaces.HTTPClient, workers int, queueSize int,
 	}
 }
 
-// Send отправляет метрики на сервер через worker pool
-func (ms *metricsSender) Send(ctx context.Context, metrics model.MemoryMetrics, deltaCounter int64) error {
+// Send отправляет метрики на сервер через worker pool.
+// Если очередь переполнена, метрики откладываются в спул, а без спула
+// возвращаются через done с ошибкой interfaces.ErrNotSent.
+func (ms *metricsSender) Send(ctx context.Context, samples []model.Sample, deltaCounter int64, done func(error)) error {
 	task := func() error {
-		return ms.metricsService.send(ctx, metrics, deltaCounter)
+		return ms.metricsService.send(ctx, samples, deltaCounter, done)
 	}
 
 	submitted := ms.workerPool.Submit(task)
 	if !submitted {
+		if ms.metricsService.spoolMetrics(samples, deltaCounter, done) {
+			ms.log.Warn("worker pool rejected metricshandler task, spooling batch")
+			return nil
+		}
 		ms.log.Warn("failed to submit metricshandler task to worker pool")
+		done(errQueueFull)
 	}
 	return nil
 }
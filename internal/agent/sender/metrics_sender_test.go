@@ -0,0 +1,293 @@
+package sender
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/agent/interfaces"
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+// stubClient запоминает отправленные батчи и отвечает ошибкой err
+type stubClient struct {
+	mu      sync.Mutex
+	err     error
+	batches [][]model.Metrics
+}
+
+func (c *stubClient) Post(_ context.Context, _ string, body interface{}) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// Батч возвращается в пул после отправки, храним копию
+	batch := append([]model.Metrics(nil), body.([]model.Metrics)...)
+	c.batches = append(c.batches, batch)
+	return nil, c.err
+}
+
+func (c *stubClient) Get(context.Context, string) ([]byte, error) {
+	return nil, nil
+}
+
+// spooledBatch - батч, отложенный в stubSpool
+type spooledBatch struct {
+	key   string
+	batch []model.Metrics
+	done  func(error)
+}
+
+// stubSpool хранит батчи в памяти; Append отвечает ошибкой appendErr,
+// Replay - ошибкой replayErr, не отправляя батчи
+type stubSpool struct {
+	appendErr error
+	replayErr error
+	batches   []spooledBatch
+}
+
+func (s *stubSpool) Append(key string, batch []model.Metrics, done func(error)) error {
+	if s.appendErr != nil {
+		return s.appendErr
+	}
+	batch = append([]model.Metrics(nil), batch...)
+	s.batches = append(s.batches, spooledBatch{key: key, batch: batch, done: done})
+	return nil
+}
+
+func (s *stubSpool) Replay(_ context.Context, send func(string, []model.Metrics) error) (int, error) {
+	if s.replayErr != nil {
+		return 0, s.replayErr
+	}
+	sent := 0
+	for len(s.batches) > 0 {
+		b := s.batches[0]
+		if err := send(b.key, b.batch); err != nil {
+			return sent, err
+		}
+		s.batches = s.batches[1:]
+		b.done(nil)
+		sent++
+	}
+	return sent, nil
+}
+
+// doneRecorder запоминает вызовы done
+type doneRecorder struct {
+	mu    sync.Mutex
+	calls []error
+}
+
+func (r *doneRecorder) done(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = append(r.calls, err)
+}
+
+func (r *doneRecorder) get() []error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]error(nil), r.calls...)
+}
+
+func pollCount(t *testing.T, batch []model.Metrics) int64 {
+	t.Helper()
+	for _, metric := range batch {
+		if metric.ID == "PollCount" {
+			require.NotNil(t, metric.Delta)
+			return *metric.Delta
+		}
+	}
+	return 0
+}
+
+// fullSender возвращает отправитель, очередь которого всегда переполнена
+func fullSender(t *testing.T, client *stubClient, spool *stubSpool) *metricsSender {
+	t.Helper()
+	logger := zaptest.NewLogger(t)
+	ms := newMetricsService(client, nil, nil, logger)
+	if spool != nil {
+		ms.spool = spool
+	}
+	// Воркеры не запущены, а очередь без буфера: Submit всегда отказывает
+	return &metricsSender{
+		workerPool:     NewWorkerPool(1, 0, logger),
+		metricsService: ms,
+		log:            logger,
+	}
+}
+
+func TestMetricsSender_FullQueueSpoolsBatch(t *testing.T) {
+	client := &stubClient{}
+	spool := &stubSpool{}
+	sender := fullSender(t, client, spool)
+	recorder := &doneRecorder{}
+
+	samples := []model.Sample{model.GaugeSample("Alloc", 1.5)}
+	require.NoError(t, sender.Send(context.Background(), samples, 3, recorder.done))
+
+	assert.Empty(t, client.batches)
+	require.Len(t, spool.batches, 1)
+	assert.NotEmpty(t, spool.batches[0].key)
+	assert.Equal(t, int64(3), pollCount(t, spool.batches[0].batch))
+	// Отложенный батч еще не доставлен
+	assert.Empty(t, recorder.get())
+
+	spool.batches[0].done(nil)
+	assert.Equal(t, []error{nil}, recorder.get())
+}
+
+func TestMetricsSender_FullQueueWithoutSpool(t *testing.T) {
+	client := &stubClient{}
+	sender := fullSender(t, client, nil)
+	recorder := &doneRecorder{}
+
+	samples := []model.Sample{model.GaugeSample("Alloc", 1.5)}
+	require.NoError(t, sender.Send(context.Background(), samples, 3, recorder.done))
+
+	assert.Empty(t, client.batches)
+	require.Len(t, recorder.get(), 1)
+	assert.ErrorIs(t, recorder.get()[0], interfaces.ErrNotSent)
+}
+
+// errDropped - батч вытеснен из буфера без доставки
+var errDropped = errors.New("batch dropped")
+
+func TestMetricsService_Send(t *testing.T) {
+	errUnavailable := errors.New("server unavailable")
+	errDisk := errors.New("disk full")
+
+	tests := []struct {
+		name      string
+		clientErr error
+		spool     *stubSpool
+		// wantCalled - done вызван сразу, wantDone - с какой ошибкой
+		wantCalled bool
+		wantDone   error
+		wantSent   int
+		wantSpool  int
+		// wantPending - сколько батчей отложено в памяти
+		wantPending int
+	}{
+		{name: "sent without spool", wantCalled: true, wantSent: 1},
+		{name: "failed without spool", clientErr: errUnavailable, wantSent: 1, wantPending: 1},
+		{name: "sent with spool", spool: &stubSpool{}, wantCalled: true, wantSent: 1},
+		{name: "failed and spooled", clientErr: errUnavailable, spool: &stubSpool{}, wantSent: 1, wantSpool: 1},
+		{
+			name:        "failed and spool refused",
+			clientErr:   errUnavailable,
+			spool:       &stubSpool{appendErr: errDisk},
+			wantSent:    1,
+			wantPending: 1,
+		},
+		{name: "replay failed", spool: &stubSpool{replayErr: errUnavailable}, wantSpool: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &stubClient{err: tt.clientErr}
+			ms := newMetricsService(client, nil, nil, zaptest.NewLogger(t))
+			if tt.spool != nil {
+				ms.spool = tt.spool
+			}
+			recorder := &doneRecorder{}
+
+			samples := []model.Sample{model.GaugeSample("Alloc", 1.5)}
+			_ = ms.send(context.Background(), samples, 2, recorder.done)
+
+			calls := recorder.get()
+			if tt.wantCalled {
+				require.Len(t, calls, 1)
+				if tt.wantDone == nil {
+					assert.NoError(t, calls[0])
+				} else {
+					assert.ErrorIs(t, calls[0], tt.wantDone)
+				}
+			} else {
+				assert.Empty(t, calls)
+			}
+			assert.Len(t, client.batches, tt.wantSent)
+			if tt.spool != nil {
+				assert.Len(t, tt.spool.batches, tt.wantSpool)
+			}
+			assert.Equal(t, tt.wantPending, ms.pending.Len())
+		})
+	}
+}
+
+func TestMetricsService_ResendsFailedBatchAsIs(t *testing.T) {
+	client := &stubClient{err: errors.New("server unavailable")}
+	ms := newMetricsService(client, nil, nil, zaptest.NewLogger(t))
+
+	first := &doneRecorder{}
+	_ = ms.send(context.Background(), []model.Sample{model.GaugeSample("Alloc", 1)}, 3, first.done)
+	// Батч отправлен без ответа и ждет повтора, сборщику о нем не сообщается
+	assert.Empty(t, first.get())
+
+	// Сервер снова доступен: батч уходит первым без изменений, новый - отдельно
+	client.err = nil
+	client.batches = nil
+	second := &doneRecorder{}
+	require.NoError(t, ms.send(context.Background(), []model.Sample{model.GaugeSample("Alloc", 2)}, 2, second.done))
+
+	require.Len(t, client.batches, 2)
+	assert.Equal(t, 1.0, *client.batches[0][0].Value)
+	assert.Equal(t, int64(3), pollCount(t, client.batches[0]))
+	assert.Equal(t, 2.0, *client.batches[1][0].Value)
+	assert.Equal(t, int64(2), pollCount(t, client.batches[1]))
+	assert.Equal(t, []error{nil}, first.get())
+	assert.Equal(t, []error{nil}, second.get())
+	assert.Zero(t, ms.pending.Len())
+}
+
+func TestMetricsService_DroppedBatchReportsNotSent(t *testing.T) {
+	client := &stubClient{err: errors.New("server unavailable")}
+	spool := &stubSpool{}
+	ms := newMetricsService(client, nil, nil, zaptest.NewLogger(t))
+	ms.spool = spool
+
+	// Батч отправлен без ответа и отложен
+	posted := &doneRecorder{}
+	_ = ms.send(context.Background(), []model.Sample{model.GaugeSample("Alloc", 1)}, 1, posted.done)
+
+	// Батч из переполненной очереди на сервер не отправлялся
+	unposted := &doneRecorder{}
+	require.True(t, ms.spoolMetrics([]model.Sample{model.GaugeSample("Alloc", 2)}, 1, unposted.done))
+	require.Len(t, spool.batches, 2)
+
+	for _, batch := range spool.batches {
+		batch.done(errDropped)
+	}
+
+	require.Len(t, unposted.get(), 1)
+	assert.ErrorIs(t, unposted.get()[0], interfaces.ErrNotSent)
+	require.Len(t, posted.get(), 1)
+	assert.ErrorIs(t, posted.get()[0], errDropped)
+	assert.NotErrorIs(t, posted.get()[0], interfaces.ErrNotSent)
+}
+
+func TestMetricsService_ReplaysSpoolBeforeBatch(t *testing.T) {
+	client := &stubClient{err: errors.New("server unavailable")}
+	spool := &stubSpool{}
+	ms := newMetricsService(client, nil, nil, zaptest.NewLogger(t))
+	ms.spool = spool
+
+	first := &doneRecorder{}
+	_ = ms.send(context.Background(), []model.Sample{model.GaugeSample("Alloc", 1)}, 1, first.done)
+	require.Len(t, spool.batches, 1)
+
+	// Сервер снова доступен: отложенный батч уходит первым и подтверждается
+	client.err = nil
+	client.batches = nil
+	second := &doneRecorder{}
+	require.NoError(t, ms.send(context.Background(), []model.Sample{model.GaugeSample("Alloc", 2)}, 1, second.done))
+
+	require.Len(t, client.batches, 2)
+	assert.Equal(t, 1.0, *client.batches[0][0].Value)
+	assert.Equal(t, 2.0, *client.batches[1][0].Value)
+	assert.Equal(t, []error{nil}, first.get())
+	assert.Equal(t, []error{nil}, second.get())
+	assert.Empty(t, spool.batches)
+}
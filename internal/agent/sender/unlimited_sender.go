@@ -17,9 +17,14 @@ type unlimitedSender struct {
 }
 
 // newUnlimitedSender создает неограниченный отправитель
-func newUnlimitedSender(client interfaces.HTTPClient, logger *zap.Logger) interfaces.MetricsSender {
+func newUnlimitedSender(
+	client interfaces.HTTPClient,
+	labels model.Labels,
+	spool interfaces.MetricsSpool,
+	logger *zap.Logger,
+) interfaces.MetricsSender {
 	return &unlimitedSender{
-		metricsService: newMetricsService(client, logger),
+		metricsService: newMetricsService(client, labels, spool, logger),
 		logger:         logger,
 	}
 }
@@ -27,15 +32,16 @@ func newUnlimitedSender(client interfaces.HTTPClient, logger *zap.Logger) interf
 // Send отправляет метрики немедленно в новой горутине
 func (us *unlimitedSender) Send(
 	ctx context.Context,
-	metrics model.MemoryMetrics,
+	samples []model.Sample,
 	deltaCounter int64,
+	done func(error),
 ) error {
 	us.wg.Add(1)
 
 	go func() {
 		defer us.wg.Done()
 
-		err := us.metricsService.send(ctx, metrics, deltaCounter)
+		err := us.metricsService.send(ctx, samples, deltaCounter, done)
 		if err != nil {
 			us.logger.Error("failed to send metrics in unlimited mode", zap.Error(err))
 		} else {
@@ -0,0 +1,106 @@
+package spool
+
+import (
+	"context"
+	"slices"
+	"sync"
+
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/model"
+)
+
+// memoryBatch - батч в памяти с ключом идемпотентности и done владельца
+type memoryBatch struct {
+	key     string
+	metrics []model.Metrics
+	done    func(error)
+}
+
+// Memory - ограниченный буфер батчей в памяти для агента без дискового
+// спула или когда спул не принял батч. Как и Spool, повторяет батчи от
+// старых к новым с их ключами идемпотентности. При переполнении вытесняется
+// самый старый батч, его done получает ErrDropped. Батчи не переживают
+// перезапуск агента.
+type Memory struct {
+	maxBatches int
+
+	mu      sync.Mutex
+	batches []memoryBatch
+
+	// replayMu не дает двум отправителям повторять буфер одновременно
+	replayMu sync.Mutex
+}
+
+// NewMemory создает буфер на maxBatches батчей, 0 - без ограничения
+func NewMemory(maxBatches int) *Memory {
+	return &Memory{maxBatches: maxBatches}
+}
+
+// Append добавляет батч с ключом key, при необходимости вытесняя самый
+// старый. Батч копируется, вызывающий может переиспользовать срез.
+// done вызывается один раз, когда батч доставлен или вытеснен.
+func (m *Memory) Append(key string, batch []model.Metrics, done func(error)) error {
+	m.mu.Lock()
+	var dropped []func(error)
+	for m.maxBatches > 0 && len(m.batches) >= m.maxBatches {
+		dropped = append(dropped, m.batches[0].done)
+		m.batches[0] = memoryBatch{}
+		m.batches = m.batches[1:]
+	}
+	m.batches = append(m.batches, memoryBatch{key: key, metrics: slices.Clone(batch), done: done})
+	m.mu.Unlock()
+
+	for _, done := range dropped {
+		if done != nil {
+			done(ErrDropped)
+		}
+	}
+	return nil
+}
+
+// Replay отправляет батчи от старых к новым. Отправленные батчи удаляются,
+// на первой ошибке send повтор останавливается. Возвращает число
+// отправленных батчей.
+func (m *Memory) Replay(ctx context.Context, send func(key string, batch []model.Metrics) error) (int, error) {
+	m.replayMu.Lock()
+	defer m.replayMu.Unlock()
+
+	sent := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return sent, err
+		}
+
+		m.mu.Lock()
+		if len(m.batches) == 0 {
+			m.mu.Unlock()
+			return sent, nil
+		}
+		batch := m.batches[0]
+		m.mu.Unlock()
+
+		if err := send(batch.key, batch.metrics); err != nil {
+			return sent, err
+		}
+		sent++
+
+		m.mu.Lock()
+		// Во время отправки батч мог быть вытеснен, тогда о нем уже сообщено
+		delivered := len(m.batches) > 0 && m.batches[0].key == batch.key
+		if delivered {
+			m.batches[0] = memoryBatch{}
+			m.batches = m.batches[1:]
+		}
+		m.mu.Unlock()
+
+		if delivered && batch.done != nil {
+			batch.done(nil)
+		}
+	}
+}
+
+// Len возвращает число батчей в буфере
+func (m *Memory) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.batches)
+}
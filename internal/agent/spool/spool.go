@@ -0,0 +1,539 @@
+// Package spool хранит на диске батчи метрик, которые агент не смог отправить.
+//
+// Батчи дописываются строками JSON в файлы-сегменты и повторно отправляются
+// от старых к новым, когда сервер снова доступен. Объем спула ограничен:
+// при переполнении удаляются самые старые сегменты целиком. Батчи старше
+// заданного возраста не отправляются и удаляются.
+//
+// Каждый батч хранится со своим ключом идемпотентности и повторяется с ним же,
+// поэтому батч, который сервер применил, но ответ не дошел, не учитывается
+// дважды, пока сервер помнит ключ. Владелец батча узнает о доставке через
+// done, переданный в Append; если батч удален без доставки (вытеснен,
+// устарел, поврежден), done получает ErrDropped.
+package spool
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/model"
+	"go.uber.org/zap"
+)
+
+// ErrDropped - батч удален из спула, не дойдя до сервера
+var ErrDropped = errors.New("spooled batch dropped before delivery")
+
+// segmentExt - расширение файлов-сегментов
+const segmentExt = ".seg"
+
+// segmentsPerSpool - на сколько сегментов делится лимит объема.
+// Вытеснение идет сегментами, поэтому при переполнении теряется
+// примерно 1/segmentsPerSpool самых старых данных.
+const segmentsPerSpool = 8
+
+// record - одна запись сегмента: время постановки в спул,
+// ключ идемпотентности и батч
+type record struct {
+	Time    time.Time       `json:"time"`
+	Key     string          `json:"key"`
+	Metrics []model.Metrics `json:"metrics"`
+}
+
+// segment описывает файл-сегмент. last - время последней записи,
+// по нему сегмент целиком считается устаревшим. keys - ключи батчей,
+// записанных в этом запуске.
+type segment struct {
+	path string
+	size int64
+	last time.Time
+	keys []string
+}
+
+// Spool - ограниченный дисковый буфер батчей метрик
+type Spool struct {
+	dir          string
+	maxBytes     int64
+	segmentBytes int64
+	maxAge       time.Duration
+	log          *zap.Logger
+
+	mu sync.Mutex
+	// segments упорядочены от старых к новым; в current дописывается последний
+	segments []segment
+	size     int64
+	current  *os.File
+	nextID   uint64
+	// pending - done недоставленных батчей по ключу
+	pending map[string]func(error)
+	// dropped - done удаленных батчей, вызываются после снятия mu
+	dropped []func(error)
+	// replaying - сегмент, который сейчас повторяется; при вытеснении
+	// о его батчах сообщает forget
+	replaying string
+
+	// replayMu не дает двум отправителям повторять спул одновременно
+	replayMu sync.Mutex
+}
+
+// Open открывает спул в каталоге dir и подхватывает сегменты, оставшиеся
+// с прошлого запуска. maxBytes - лимит суммарного размера сегментов,
+// maxAge - срок хранения батча, 0 - без ограничения.
+func Open(dir string, maxBytes int64, maxAge time.Duration, log *zap.Logger) (*Spool, error) {
+	if maxBytes <= 0 {
+		return nil, fmt.Errorf("spool size limit must be positive, got %d", maxBytes)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create spool dir: %w", err)
+	}
+
+	s := &Spool{
+		dir:          dir,
+		maxBytes:     maxBytes,
+		segmentBytes: max(maxBytes/segmentsPerSpool, 1),
+		maxAge:       maxAge,
+		log:          log,
+		pending:      make(map[string]func(error)),
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.dropExpired(time.Now())
+	s.evict(0)
+	s.unlock()
+
+	log.Info("spool opened",
+		zap.String("dir", dir),
+		zap.Int("segments", len(s.segments)),
+		zap.Int64("size", s.size),
+	)
+	return s, nil
+}
+
+// load находит сегменты в каталоге. Дописывать в них после перезапуска
+// не будем: последняя строка может быть оборвана.
+func (s *Spool) load() error {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return fmt.Errorf("failed to read spool dir: %w", err)
+	}
+
+	ids := make([]uint64, 0, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() {
+			continue
+		}
+		if strings.HasSuffix(name, segmentExt+".tmp") {
+			// Недописанная замена сегмента, исходный сегмент цел
+			s.removeFile(filepath.Join(s.dir, name))
+			continue
+		}
+		if !strings.HasSuffix(name, segmentExt) {
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimSuffix(name, segmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	for _, id := range ids {
+		path := s.segmentPath(id)
+		info, err := os.Stat(path)
+		if err != nil {
+			return fmt.Errorf("failed to stat spool segment: %w", err)
+		}
+		s.nextID = id + 1
+		if info.Size() == 0 {
+			s.removeFile(path)
+			continue
+		}
+		s.segments = append(s.segments, segment{path: path, size: info.Size(), last: info.ModTime()})
+		s.size += info.Size()
+	}
+	return nil
+}
+
+// Append дописывает батч с ключом key в спул, при необходимости вытесняя
+// самые старые сегменты. done вызывается один раз, когда батч доставлен
+// или удален без доставки; при ошибке Append не вызывается.
+func (s *Spool) Append(key string, batch []model.Metrics, done func(error)) error {
+	now := time.Now()
+	data, err := json.Marshal(record{Time: now, Key: key, Metrics: batch})
+	if err != nil {
+		return fmt.Errorf("failed to marshal spool record: %w", err)
+	}
+	data = append(data, '\n')
+
+	if int64(len(data)) > s.maxBytes {
+		return fmt.Errorf("batch of %d bytes exceeds spool size limit %d", len(data), s.maxBytes)
+	}
+
+	s.mu.Lock()
+	defer s.unlock()
+
+	s.dropExpired(now)
+	s.evict(int64(len(data)))
+
+	if s.current != nil && s.segments[len(s.segments)-1].size+int64(len(data)) > s.segmentBytes {
+		s.seal()
+	}
+	if s.current == nil {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+
+	last := &s.segments[len(s.segments)-1]
+	n, err := s.current.Write(data)
+	last.size += int64(n)
+	s.size += int64(n)
+	if err != nil {
+		// Сегмент мог остаться с оборванной строкой, новые записи пишем в следующий
+		s.seal()
+		return fmt.Errorf("failed to write spool record: %w", err)
+	}
+	last.last = now
+	if done != nil {
+		last.keys = append(last.keys, key)
+		s.pending[key] = done
+	}
+	return nil
+}
+
+// Replay отправляет батчи из спула от старых к новым.
+// Отправленные и устаревшие батчи удаляются. На первой ошибке send
+// повтор останавливается, неотправленные батчи остаются в спуле.
+// send получает ключ идемпотентности, с которым батч был отложен.
+// Возвращает число отправленных батчей.
+func (s *Spool) Replay(ctx context.Context, send func(key string, batch []model.Metrics) error) (int, error) {
+	s.replayMu.Lock()
+	defer s.replayMu.Unlock()
+
+	sent := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return sent, err
+		}
+
+		seg, ok := s.oldest()
+		if !ok {
+			return sent, nil
+		}
+
+		n, err := s.replaySegment(ctx, seg, send)
+		sent += n
+		if err != nil {
+			return sent, err
+		}
+	}
+}
+
+// oldest возвращает самый старый сегмент. Если это сегмент, в который идет
+// запись, он закрывается, и новые батчи пишутся уже в следующий.
+func (s *Spool) oldest() (segment, bool) {
+	s.mu.Lock()
+	defer s.unlock()
+
+	s.dropExpired(time.Now())
+	if len(s.segments) == 0 {
+		return segment{}, false
+	}
+	if len(s.segments) == 1 && s.current != nil {
+		s.seal()
+	}
+	s.replaying = s.segments[0].path
+	return s.segments[0], true
+}
+
+// replaySegment отправляет записи сегмента. При ошибке отправки
+// неотправленные строки переписываются в сегмент, иначе сегмент удаляется.
+func (s *Spool) replaySegment(
+	ctx context.Context,
+	seg segment,
+	send func(key string, batch []model.Metrics) error,
+) (int, error) {
+	lines, err := readLines(seg.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			// Сегмент успели вытеснить после выбора
+			s.forget(seg, nil)
+			return 0, nil
+		}
+		s.abandon(seg)
+		return 0, err
+	}
+
+	deadline := s.deadline(time.Now())
+	sent := 0
+	for i, line := range lines {
+		var rec record
+		if err := json.Unmarshal(line, &rec); err != nil {
+			s.log.Warn("corrupted spool record, dropping rest of segment",
+				zap.String("segment", seg.path), zap.Int("record", i+1), zap.Error(err))
+			break
+		}
+		if rec.Time.Before(deadline) {
+			s.resolve(rec.Key, ErrDropped)
+			continue
+		}
+
+		if err := ctx.Err(); err != nil {
+			s.forget(seg, lines[i:])
+			return sent, err
+		}
+		if err := send(rec.Key, rec.Metrics); err != nil {
+			s.forget(seg, lines[i:])
+			return sent, err
+		}
+		s.resolve(rec.Key, nil)
+		sent++
+	}
+
+	s.forget(seg, nil)
+	return sent, nil
+}
+
+// resolve сообщает владельцу батча с ключом key результат доставки
+func (s *Spool) resolve(key string, err error) {
+	s.mu.Lock()
+	done, ok := s.pending[key]
+	delete(s.pending, key)
+	s.mu.Unlock()
+
+	if ok {
+		done(err)
+	}
+}
+
+// forget удаляет сегмент после повтора или оставляет в нем только строки rest.
+// Недоставленные батчи удаленного сегмента получают ErrDropped.
+func (s *Spool) forget(seg segment, rest [][]byte) {
+	s.mu.Lock()
+	defer s.unlock()
+
+	s.replaying = ""
+	path := seg.path
+	i := s.index(path)
+	if i < 0 {
+		// Сегмент вытеснен во время повтора
+		s.drop(seg.keys)
+		return
+	}
+
+	if len(rest) == 0 {
+		s.size -= s.segments[i].size
+		s.segments = append(s.segments[:i], s.segments[i+1:]...)
+		s.removeFile(path)
+		s.drop(seg.keys)
+		return
+	}
+
+	size, err := rewrite(path, rest)
+	if err != nil {
+		// Старый файл цел, батчи будут отправлены повторно
+		s.log.Error("failed to rewrite spool segment", zap.String("segment", path), zap.Error(err))
+		return
+	}
+	s.size += size - s.segments[i].size
+	s.segments[i].size = size
+}
+
+// abandon завершает повтор сегмента, не меняя его
+func (s *Spool) abandon(seg segment) {
+	s.mu.Lock()
+	defer s.unlock()
+
+	s.replaying = ""
+	if s.index(seg.path) < 0 {
+		s.drop(seg.keys)
+	}
+}
+
+// Close закрывает сегмент, в который идет запись
+func (s *Spool) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.current == nil {
+		return nil
+	}
+	err := s.current.Sync()
+	if closeErr := s.current.Close(); err == nil {
+		err = closeErr
+	}
+	s.current = nil
+	return err
+}
+
+// dropExpired удаляет сегменты, все записи которых старше maxAge
+func (s *Spool) dropExpired(now time.Time) {
+	if s.maxAge <= 0 {
+		return
+	}
+	deadline := s.deadline(now)
+	for len(s.segments) > 0 && s.segments[0].last.Before(deadline) {
+		s.log.Info("dropping expired spool segment", zap.String("segment", s.segments[0].path))
+		s.dropOldest()
+	}
+}
+
+// evict вытесняет самые старые сегменты, пока в лимит не поместится еще incoming байт
+func (s *Spool) evict(incoming int64) {
+	for len(s.segments) > 0 && s.size+incoming > s.maxBytes {
+		s.log.Warn("spool is full, evicting oldest segment",
+			zap.String("segment", s.segments[0].path),
+			zap.Int64("segment_size", s.segments[0].size),
+		)
+		s.dropOldest()
+	}
+}
+
+func (s *Spool) dropOldest() {
+	if len(s.segments) == 1 && s.current != nil {
+		s.seal()
+	}
+	oldest := s.segments[0]
+	s.size -= oldest.size
+	s.removeFile(oldest.path)
+	s.segments = s.segments[1:]
+	if oldest.path != s.replaying {
+		s.drop(oldest.keys)
+	}
+}
+
+// drop откладывает ErrDropped для еще не доставленных батчей с ключами keys
+func (s *Spool) drop(keys []string) {
+	for _, key := range keys {
+		if done, ok := s.pending[key]; ok {
+			delete(s.pending, key)
+			s.dropped = append(s.dropped, done)
+		}
+	}
+}
+
+// unlock снимает mu и сообщает владельцам удаленных батчей.
+// done вызываются без блокировки, чтобы они могли обращаться к спулу.
+func (s *Spool) unlock() {
+	dropped := s.dropped
+	s.dropped = nil
+	s.mu.Unlock()
+
+	for _, done := range dropped {
+		done(ErrDropped)
+	}
+}
+
+// rotate создает новый сегмент для записи
+func (s *Spool) rotate() error {
+	path := s.segmentPath(s.nextID)
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create spool segment: %w", err)
+	}
+	s.nextID++
+	s.current = file
+	s.segments = append(s.segments, segment{path: path})
+	return nil
+}
+
+// seal закрывает сегмент для записи, он остается в очереди на повтор
+func (s *Spool) seal() {
+	if err := s.current.Close(); err != nil {
+		s.log.Error("failed to close spool segment", zap.Error(err))
+	}
+	s.current = nil
+}
+
+func (s *Spool) deadline(now time.Time) time.Time {
+	if s.maxAge <= 0 {
+		return time.Time{}
+	}
+	return now.Add(-s.maxAge)
+}
+
+func (s *Spool) index(path string) int {
+	for i := range s.segments {
+		if s.segments[i].path == path {
+			return i
+		}
+	}
+	return -1
+}
+
+func (s *Spool) segmentPath(id uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%020d%s", id, segmentExt))
+}
+
+func (s *Spool) removeFile(path string) {
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		s.log.Error("failed to remove spool segment", zap.String("segment", path), zap.Error(err))
+	}
+}
+
+// readLines читает строки сегмента. Оборванная последняя строка
+// после аварийного завершения пропускается.
+func readLines(path string) ([][]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var lines [][]byte
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			return lines, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read spool segment: %w", err)
+		}
+		lines = append(lines, line)
+	}
+}
+
+// rewrite атомарно заменяет содержимое сегмента строками lines
+func rewrite(path string, lines [][]byte) (int64, error) {
+	tmp := path + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return 0, err
+	}
+
+	var size int64
+	for _, line := range lines {
+		n, err := file.Write(line)
+		size += int64(n)
+		if err != nil {
+			file.Close()
+			os.Remove(tmp)
+			return 0, err
+		}
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(tmp)
+		return 0, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return 0, err
+	}
+	return size, nil
+}
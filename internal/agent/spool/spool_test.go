@@ -0,0 +1,445 @@
+package spool
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+// recordsPerSegment - сколько записей помещается в сегмент в testSpool
+const recordsPerSegment = 2
+
+// deliveries запоминает, с чем вызывался done каждого батча
+type deliveries struct {
+	mu     sync.Mutex
+	result map[string][]error
+}
+
+func newDeliveries() *deliveries {
+	return &deliveries{result: make(map[string][]error)}
+}
+
+func (d *deliveries) done(key string) func(error) {
+	return func(err error) {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		d.result[key] = append(d.result[key], err)
+	}
+}
+
+func (d *deliveries) get(key string) []error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.result[key]
+}
+
+// testBatch возвращает батч с длинным именем, чтобы разная длина
+// времени в записях не влияла на число записей в сегменте
+func testBatch(key string) []model.Metrics {
+	delta := int64(1)
+	id := key + "-" + strings.Repeat("x", 1000)
+	return []model.Metrics{{ID: id, MType: model.Counter, Delta: &delta}}
+}
+
+func recordLine(t *testing.T, key string, at time.Time) []byte {
+	t.Helper()
+	data, err := json.Marshal(record{Time: at, Key: key, Metrics: testBatch(key)})
+	require.NoError(t, err)
+	return append(data, '\n')
+}
+
+// testSpool открывает спул, в сегмент которого помещается recordsPerSegment
+// записей, а всего recordsPerSegment*segmentsPerSpool записей
+func testSpool(t *testing.T, dir string, maxAge time.Duration) *Spool {
+	t.Helper()
+	// Самая длинная запись: у времени все девять знаков наносекунд
+	longest := time.Now().Truncate(time.Second).Add(123456789 * time.Nanosecond)
+	line := int64(len(recordLine(t, "k00", longest)))
+	segmentBytes := line*recordsPerSegment + 1
+
+	s, err := Open(dir, segmentBytes*segmentsPerSpool, maxAge, zaptest.NewLogger(t))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = s.Close() })
+	return s
+}
+
+func appendKeys(t *testing.T, s *Spool, d *deliveries, n int) []string {
+	t.Helper()
+	keys := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		key := fmt.Sprintf("k%02d", i)
+		require.NoError(t, s.Append(key, testBatch(key), d.done(key)))
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// replayAll повторяет спул и возвращает ключи в порядке отправки
+func replayAll(t *testing.T, s *Spool) []string {
+	t.Helper()
+	var keys []string
+	_, err := s.Replay(context.Background(), func(key string, batch []model.Metrics) error {
+		assert.Equal(t, testBatch(key), batch)
+		keys = append(keys, key)
+		return nil
+	})
+	require.NoError(t, err)
+	return keys
+}
+
+func segmentFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	files, err := filepath.Glob(filepath.Join(dir, "*"+segmentExt))
+	require.NoError(t, err)
+	return files
+}
+
+func TestSpool_RotatesSegments(t *testing.T) {
+	dir := t.TempDir()
+	s := testSpool(t, dir, 0)
+
+	appendKeys(t, s, newDeliveries(), 5)
+
+	assert.Len(t, s.segments, 3)
+	assert.Len(t, segmentFiles(t, dir), 3)
+	for _, seg := range s.segments[:2] {
+		assert.Len(t, seg.keys, recordsPerSegment)
+	}
+}
+
+func TestSpool_ReplayOldestFirst(t *testing.T) {
+	dir := t.TempDir()
+	s := testSpool(t, dir, 0)
+	d := newDeliveries()
+
+	keys := appendKeys(t, s, d, 7)
+
+	assert.Equal(t, keys, replayAll(t, s))
+	for _, key := range keys {
+		assert.Equal(t, []error{nil}, d.get(key), key)
+	}
+	assert.Empty(t, s.segments)
+	assert.Zero(t, s.size)
+	assert.Empty(t, segmentFiles(t, dir))
+	assert.Empty(t, replayAll(t, s))
+}
+
+func TestSpool_SizeLimit(t *testing.T) {
+	tests := []struct {
+		name    string
+		batches int
+		dropped int
+	}{
+		{name: "fits", batches: recordsPerSegment * segmentsPerSpool, dropped: 0},
+		{name: "evicts one segment", batches: recordsPerSegment*segmentsPerSpool + 1, dropped: recordsPerSegment},
+		{name: "evicts several segments", batches: recordsPerSegment*segmentsPerSpool + 5, dropped: 3 * recordsPerSegment},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := testSpool(t, t.TempDir(), 0)
+			d := newDeliveries()
+
+			keys := appendKeys(t, s, d, tt.batches)
+			assert.LessOrEqual(t, s.size, s.maxBytes)
+
+			for _, key := range keys[:tt.dropped] {
+				assert.Equal(t, []error{ErrDropped}, d.get(key), key)
+			}
+			assert.Equal(t, keys[tt.dropped:], replayAll(t, s))
+			for _, key := range keys[tt.dropped:] {
+				assert.Equal(t, []error{nil}, d.get(key), key)
+			}
+		})
+	}
+}
+
+func TestSpool_BatchLargerThanLimit(t *testing.T) {
+	s := testSpool(t, t.TempDir(), 0)
+	called := false
+
+	big := make([]model.Metrics, 0, 100)
+	for i := 0; i < 100; i++ {
+		big = append(big, testBatch(fmt.Sprintf("k%02d", i))...)
+	}
+
+	assert.Error(t, s.Append("big", big, func(error) { called = true }))
+	assert.False(t, called)
+	assert.Empty(t, s.segments)
+}
+
+func TestSpool_DropExpired(t *testing.T) {
+	tests := []struct {
+		name string
+		// age - возраст записей по ключам
+		age     map[string]time.Duration
+		replay  []string
+		dropped []string
+	}{
+		{
+			name:   "fresh",
+			age:    map[string]time.Duration{"k00": 0, "k01": 0},
+			replay: []string{"k00", "k01"},
+		},
+		{
+			name:    "whole segment expired",
+			age:     map[string]time.Duration{"k00": 2 * time.Hour, "k01": 2 * time.Hour},
+			dropped: []string{"k00", "k01"},
+		},
+		{
+			name:    "expired record in fresh segment",
+			age:     map[string]time.Duration{"k00": 2 * time.Hour, "k01": 0},
+			replay:  []string{"k01"},
+			dropped: []string{"k00"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := testSpool(t, t.TempDir(), time.Hour)
+			d := newDeliveries()
+			keys := appendKeys(t, s, d, len(tt.age))
+
+			// Состариваем записи, переписывая сегмент
+			now := time.Now()
+			lines := make([][]byte, 0, len(keys))
+			last := time.Time{}
+			for _, key := range keys {
+				at := now.Add(-tt.age[key])
+				lines = append(lines, recordLine(t, key, at))
+				if at.After(last) {
+					last = at
+				}
+			}
+			s.seal()
+			_, err := rewrite(s.segments[0].path, lines)
+			require.NoError(t, err)
+			s.segments[0].last = last
+
+			assert.Equal(t, tt.replay, replayAll(t, s))
+			for _, key := range tt.replay {
+				assert.Equal(t, []error{nil}, d.get(key), key)
+			}
+			for _, key := range tt.dropped {
+				assert.Equal(t, []error{ErrDropped}, d.get(key), key)
+			}
+			assert.Empty(t, s.segments)
+		})
+	}
+}
+
+func TestSpool_PartialReplay(t *testing.T) {
+	dir := t.TempDir()
+	s := testSpool(t, dir, 0)
+	d := newDeliveries()
+	keys := appendKeys(t, s, d, 5)
+
+	errUnavailable := errors.New("server unavailable")
+	var sentKeys []string
+	sent, err := s.Replay(context.Background(), func(key string, _ []model.Metrics) error {
+		if key == "k03" {
+			return errUnavailable
+		}
+		sentKeys = append(sentKeys, key)
+		return nil
+	})
+	require.ErrorIs(t, err, errUnavailable)
+	assert.Equal(t, 3, sent)
+	assert.Equal(t, keys[:3], sentKeys)
+
+	for _, key := range keys[:3] {
+		assert.Equal(t, []error{nil}, d.get(key), key)
+	}
+	for _, key := range keys[3:] {
+		assert.Empty(t, d.get(key), key)
+	}
+
+	// Сегмент с k02 и k03 переписан, в нем остался только k03
+	require.Len(t, s.segments, 2)
+	lines, err := readLines(s.segments[0].path)
+	require.NoError(t, err)
+	assert.Len(t, lines, 1)
+	info, err := os.Stat(s.segments[0].path)
+	require.NoError(t, err)
+	assert.Equal(t, info.Size(), s.segments[0].size)
+
+	// Повтор продолжает с того же батча и с тем же ключом
+	assert.Equal(t, keys[3:], replayAll(t, s))
+	for _, key := range keys {
+		assert.Equal(t, []error{nil}, d.get(key), key)
+	}
+}
+
+func TestSpool_EvictedDuringReplay(t *testing.T) {
+	s := testSpool(t, t.TempDir(), 0)
+	d := newDeliveries()
+	keys := appendKeys(t, s, d, recordsPerSegment*segmentsPerSpool)
+
+	var sentKeys []string
+	_, err := s.Replay(context.Background(), func(key string, _ []model.Metrics) error {
+		if key == keys[0] {
+			// Новый батч вытесняет сегмент, который сейчас повторяется
+			require.NoError(t, s.Append("new", testBatch("new"), d.done("new")))
+		}
+		sentKeys = append(sentKeys, key)
+		return nil
+	})
+	require.NoError(t, err)
+
+	// Прочитанные записи сегмента все равно отправлены
+	assert.Equal(t, append(keys, "new"), sentKeys)
+	for _, key := range sentKeys {
+		assert.Equal(t, []error{nil}, d.get(key), key)
+	}
+}
+
+func TestSpool_Load(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name string
+		// files - содержимое файлов каталога по именам
+		files    func(t *testing.T) map[string][]byte
+		replay   []string
+		segments int
+	}{
+		{
+			name: "torn last line",
+			files: func(t *testing.T) map[string][]byte {
+				torn := recordLine(t, "k01", now)
+				return map[string][]byte{
+					"00000000000000000001.seg": append(recordLine(t, "k00", now), torn[:len(torn)/2]...),
+				}
+			},
+			replay:   []string{"k00"},
+			segments: 1,
+		},
+		{
+			name: "corrupt record drops rest of segment",
+			files: func(t *testing.T) map[string][]byte {
+				data := recordLine(t, "k00", now)
+				data = append(data, []byte("{not json\n")...)
+				data = append(data, recordLine(t, "k01", now)...)
+				return map[string][]byte{
+					"00000000000000000001.seg": data,
+					"00000000000000000002.seg": recordLine(t, "k02", now),
+				}
+			},
+			replay:   []string{"k00", "k02"},
+			segments: 2,
+		},
+		{
+			name: "leftover tmp and empty segments",
+			files: func(t *testing.T) map[string][]byte {
+				return map[string][]byte{
+					"00000000000000000001.seg":     {},
+					"00000000000000000002.seg":     recordLine(t, "k00", now),
+					"00000000000000000002.seg.tmp": []byte("partial"),
+					"notes.txt":                    []byte("not a segment"),
+				}
+			},
+			replay:   []string{"k00"},
+			segments: 1,
+		},
+		{
+			name: "segments ordered by id",
+			files: func(t *testing.T) map[string][]byte {
+				return map[string][]byte{
+					"00000000000000000010.seg": recordLine(t, "k02", now),
+					"00000000000000000002.seg": recordLine(t, "k01", now),
+					"00000000000000000001.seg": recordLine(t, "k00", now),
+				}
+			},
+			replay:   []string{"k00", "k01", "k02"},
+			segments: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, data := range tt.files(t) {
+				require.NoError(t, os.WriteFile(filepath.Join(dir, name), data, 0644))
+			}
+
+			s := testSpool(t, dir, 0)
+			assert.Len(t, s.segments, tt.segments)
+			_, err := os.Stat(filepath.Join(dir, "00000000000000000002.seg.tmp"))
+			assert.ErrorIs(t, err, os.ErrNotExist)
+
+			assert.Equal(t, tt.replay, replayAll(t, s))
+			assert.Empty(t, segmentFiles(t, dir))
+		})
+	}
+}
+
+func TestSpool_Reopen(t *testing.T) {
+	dir := t.TempDir()
+
+	first := testSpool(t, dir, 0)
+	keys := appendKeys(t, first, newDeliveries(), 3)
+	require.NoError(t, first.Close())
+
+	second := testSpool(t, dir, 0)
+	require.Len(t, second.segments, 2)
+	assert.Equal(t, first.size, second.size)
+
+	// Новые батчи идут в новый сегмент после оставшихся
+	d := newDeliveries()
+	require.NoError(t, second.Append("next", testBatch("next"), d.done("next")))
+	require.Len(t, second.segments, 3)
+	assert.Greater(t, second.segments[2].path, second.segments[1].path)
+
+	assert.Equal(t, append(keys, "next"), replayAll(t, second))
+	assert.Equal(t, []error{nil}, d.get("next"))
+}
+
+func TestOpen_InvalidLimit(t *testing.T) {
+	_, err := Open(t.TempDir(), 0, 0, zaptest.NewLogger(t))
+	assert.Error(t, err)
+}
+
+func TestMemory_ReplayWithKeys(t *testing.T) {
+	m := NewMemory(2)
+	d := newDeliveries()
+
+	for _, key := range []string{"a", "b", "c"} {
+		require.NoError(t, m.Append(key, testBatch(key), d.done(key)))
+	}
+	// Самый старый батч вытеснен
+	assert.Equal(t, []error{ErrDropped}, d.get("a"))
+	assert.Equal(t, 2, m.Len())
+
+	// Первая отправка не удалась: батчи остаются и повторяются с теми же ключами
+	errUnavailable := errors.New("server unavailable")
+	sent, err := m.Replay(context.Background(), func(string, []model.Metrics) error {
+		return errUnavailable
+	})
+	require.ErrorIs(t, err, errUnavailable)
+	assert.Zero(t, sent)
+	assert.Empty(t, d.get("b"))
+
+	var keys []string
+	sent, err = m.Replay(context.Background(), func(key string, batch []model.Metrics) error {
+		keys = append(keys, key)
+		assert.Equal(t, testBatch(key), batch)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, sent)
+	assert.Equal(t, []string{"b", "c"}, keys)
+	assert.Equal(t, []error{nil}, d.get("b"))
+	assert.Equal(t, []error{nil}, d.get("c"))
+	assert.Zero(t, m.Len())
+}
@@ -11,16 +11,38 @@ import (
 
 // generate:reset
 type AgentFlags struct {
-	ServerAddr      string   `env:"ADDRESS"`
-	ReportInterval  int      `env:"REPORT_INTERVAL"`
-	PollingInterval int      `env:"POLL_INTERVAL"`
-	LogLevel        string   `env:"LOGLEVEL" envDefault:"info"`
-	SecretKey       string   `env:"KEY"`
-	RateLimit       int      `env:"RATE_LIMIT"`
-	MaxRetries      int      `env:"MAX_RETRIES"`
-	RetryDelays     []string `env:"RETRY_DELAYS"`
+	ServerAddr         string    `env:"ADDRESS"`
+	ReportInterval     int       `env:"REPORT_INTERVAL"`
+	PollingInterval    int       `env:"POLL_INTERVAL"`
+	LogLevel           string    `env:"LOGLEVEL" envDefault:"info"`
+	SecretKey          string    `env:"KEY"`
+	RateLimit          int       `env:"RATE_LIMIT"`
+	MaxRetries         int       `env:"MAX_RETRIES"`
+	RetryDelays        []string  `env:"RETRY_DELAYS"`
+	Transport          string    `env:"TRANSPORT"`
+	GRPCAddr           string    `env:"GRPC_ADDRESS"`
+	Labels             bool      `env:"LABELS"`
+	SpoolDir           string    `env:"SPOOL_DIR"`
+	SpoolMaxBytes      int64     `env:"SPOOL_MAX_BYTES"`
+	SpoolMaxAge        int       `env:"SPOOL_MAX_AGE"`
+	Aggregation        string    `env:"AGGREGATION"`
+	AggregationBuckets []float64 `env:"AGGREGATION_BUCKETS"`
 }
 
+// Транспорты отправки метрик агентом
+const (
+	TransportHTTP = "http"
+	TransportGRPC = "grpc"
+)
+
+// Агрегация gauge между отправками: только последнее значение,
+// дополнительно gauge с суффиксами _min, _max, _avg или гистограмма наблюдений
+const (
+	AggregationLast      = "last"
+	AggregationGauges    = "gauges"
+	AggregationHistogram = "histogram"
+)
+
 func ParseAgentConfig() (*AgentFlags, error) {
 	var cfg AgentFlags
 
@@ -45,6 +67,11 @@ func setDefaultAgentFlag(cfg *AgentFlags) {
 	cfg.PollingInterval = 2
 	cfg.MaxRetries = 3
 	cfg.RetryDelays = []string{"1s", "3s", "5s"}
+	cfg.Transport = TransportHTTP
+	cfg.GRPCAddr = "localhost:3200"
+	cfg.SpoolMaxBytes = 64 << 20
+	cfg.SpoolMaxAge = 3600
+	cfg.Aggregation = AggregationLast
 }
 
 func parseEnvAgent(cfg *AgentFlags) {
@@ -64,6 +91,14 @@ func parseFlagsAgent(cfg *AgentFlags) error {
 	flags.IntVarP(&cfg.RateLimit, "ratelimit", "l", 0, "Rate limit")
 	flags.IntVarP(&cfg.MaxRetries, "max-retries", "m", 3, "Maximum number of retry attempts")
 	flags.StringArrayVarP(&cfg.RetryDelays, "retry-delays", "d", []string{"1s", "3s", "5s"}, "Retry delays between attempts")
+	flags.StringVarP(&cfg.Transport, "transport", "", TransportHTTP, "Transport for sending metrics: http or grpc")
+	flags.StringVarP(&cfg.GRPCAddr, "grpc-address", "", "localhost:3200", "gRPC server address, used with --transport=grpc")
+	flags.BoolVarP(&cfg.Labels, "labels", "", false, "Attach host and core labels instead of encoding them in metric names")
+	flags.StringVarP(&cfg.SpoolDir, "spool-dir", "", "", "Directory for batches that failed to send, disabled if empty")
+	flags.Int64VarP(&cfg.SpoolMaxBytes, "spool-max-bytes", "", 64<<20, "Spool size limit in bytes, oldest batches are evicted first")
+	flags.IntVarP(&cfg.SpoolMaxAge, "spool-max-age", "", 3600, "Discard spooled batches older than this, s, disabled if 0")
+	flags.StringVarP(&cfg.Aggregation, "aggregation", "", AggregationLast, "Gauge aggregation between reports: last, gauges (adds _min, _max, _avg) or histogram (sent alongside the last-value gauge)")
+	flags.Float64SliceVarP(&cfg.AggregationBuckets, "aggregation-buckets", "", nil, "Histogram bucket upper bounds for --aggregation=histogram, Prometheus defaults if empty")
 
 	if err := flags.Parse(os.Args[1:]); err != nil {
 		_, err := fmt.Fprintf(os.Stderr, "Error: %v\n", err)
@@ -12,18 +12,33 @@ import (
 
 // generate:reset
 type ServerFlags struct {
-	ServerAddr      string   `env:"ADDRESS"`
-	LogLevel        string   `env:"LOGLEVEL" envDefault:"info"`
-	StoreInterval   int      `env:"STORE_INTERVAL"`
-	FileStoragePath string   `env:"FILE_STORAGE_PATH"`
-	Restore         bool     `env:"RESTORE"`
-	DatabaseDSN     string   `env:"DATABASE_DSN"`
-	SecretKet       string   `env:"KEY"`
-	RateLimit       int      `env:"RATE_LIMIT"`
-	MaxRetries      int      `env:"MAX_RETRIES"`
-	RetryDelays     []string `env:"RETRY_DELAYS"`
-	AuditFile       string   `env:"AUDIT_FILE"`
-	AuditURL        string   `env:"AUDIT_URL"`
+	ServerAddr           string    `env:"ADDRESS"`
+	LogLevel             string    `env:"LOGLEVEL" envDefault:"info"`
+	StoreInterval        int       `env:"STORE_INTERVAL"`
+	FileStoragePath      string    `env:"FILE_STORAGE_PATH"`
+	Restore              bool      `env:"RESTORE"`
+	DatabaseDSN          string    `env:"DATABASE_DSN"`
+	SecretKet            string    `env:"KEY"`
+	RateLimit            int       `env:"RATE_LIMIT"`
+	MaxRetries           int       `env:"MAX_RETRIES"`
+	RetryDelays          []string  `env:"RETRY_DELAYS"`
+	AuditFile            string    `env:"AUDIT_FILE"`
+	AuditURL             string    `env:"AUDIT_URL"`
+	AlertRulesFile       string    `env:"ALERT_RULES_FILE"`
+	AlertInterval        int       `env:"ALERT_INTERVAL"`
+	HistorySize          int       `env:"HISTORY_SIZE"`
+	StatsDAddr           string    `env:"STATSD_ADDRESS"`
+	GraphiteAddr         string    `env:"GRAPHITE_ADDRESS"`
+	GRPCAddr             string    `env:"GRPC_ADDRESS"`
+	WALPath              string    `env:"WAL_PATH"`
+	WALSync              string    `env:"WAL_SYNC"`
+	WALSyncInterval      int       `env:"WAL_SYNC_INTERVAL"`
+	SnapshotGenerations  int       `env:"SNAPSHOT_GENERATIONS"`
+	FailoverInterval     int       `env:"FAILOVER_INTERVAL"`
+	FailoverJournalLimit int       `env:"FAILOVER_JOURNAL_LIMIT"`
+	BoltPath             string    `env:"BOLT_PATH"`
+	MetricTTL            int       `env:"METRIC_TTL"`
+	HistogramBuckets     []float64 `env:"HISTOGRAM_BUCKETS"`
 }
 
 func ParseServerConfig() *ServerFlags {
@@ -45,6 +60,13 @@ func setDefaultServerFlag(cfg *ServerFlags) {
 	cfg.Restore = false
 	cfg.MaxRetries = 3
 	cfg.RetryDelays = []string{"1s", "3s", "5s"}
+	cfg.AlertInterval = 10
+	cfg.HistorySize = 1000
+	cfg.WALSync = "interval"
+	cfg.WALSyncInterval = 1
+	cfg.SnapshotGenerations = 3
+	cfg.FailoverInterval = 5
+	cfg.FailoverJournalLimit = 100000
 }
 
 func parseServerEnv(cfg *ServerFlags) {
@@ -69,6 +91,21 @@ func parseServerFlag(cfg *ServerFlags) {
 	flags.StringArrayVarP(&cfg.RetryDelays, "retry-delays", "s", []string{"1s", "3s", "5s"}, "Retry delays between attempts")
 	flags.StringVarP(&cfg.AuditFile, "audit-file", "z", "", "Path to audit log file")
 	flags.StringVarP(&cfg.AuditURL, "audit-url", "u", "", "URL to audit log file")
+	flags.StringVarP(&cfg.AlertRulesFile, "alert-rules", "", "", "Path to JSON file with alert rules")
+	flags.IntVarP(&cfg.AlertInterval, "alert-interval", "", 10, "Alert rules evaluation interval, s")
+	flags.IntVarP(&cfg.HistorySize, "history-size", "", 1000, "Samples kept in memory per metric")
+	flags.StringVarP(&cfg.StatsDAddr, "statsd-address", "", "", "UDP address for StatsD listener, disabled if empty")
+	flags.StringVarP(&cfg.GraphiteAddr, "graphite-address", "", "", "TCP address for Graphite plaintext listener, disabled if empty")
+	flags.StringVarP(&cfg.GRPCAddr, "grpc-address", "", "", "TCP address for gRPC metrics API, disabled if empty")
+	flags.StringVarP(&cfg.WALPath, "wal-path", "", "", "Path to in-memory storage write-ahead log, disabled if empty")
+	flags.StringVarP(&cfg.WALSync, "wal-sync", "", "interval", "WAL fsync policy: always, interval or never")
+	flags.IntVarP(&cfg.WALSyncInterval, "wal-sync-interval", "", 1, "WAL fsync interval for interval policy, s")
+	flags.IntVarP(&cfg.SnapshotGenerations, "snapshot-generations", "", 3, "Number of snapshot file generations kept on disk")
+	flags.IntVarP(&cfg.FailoverInterval, "failover-interval", "", 5, "Database health check interval while writes are journaled, s")
+	flags.IntVarP(&cfg.FailoverJournalLimit, "failover-journal-limit", "", 100000, "Maximum series journaled while the database is unavailable, writes are rejected with 503 beyond it, unlimited if 0")
+	flags.StringVarP(&cfg.BoltPath, "bolt-path", "", "", "Path to embedded single-file storage, used when database DSN is empty, disabled if empty")
+	flags.IntVarP(&cfg.MetricTTL, "metric-ttl", "", 0, "Delete metrics not updated for this long, s, disabled if 0")
+	flags.Float64SliceVarP(&cfg.HistogramBuckets, "histogram-buckets", "", nil, "Bucket upper bounds for histograms created from single observations, Prometheus defaults if empty")
 
 	if err := flags.Parse(os.Args[1:]); err != nil {
 		log.Printf("Error parsing command-line flags: %v", err)
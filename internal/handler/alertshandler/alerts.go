@@ -0,0 +1,39 @@
+// Package alertshandler предоставляет HTTP-хендлер для просмотра
+// сработавших алертов через эндпоинт /api/alerts.
+package alertshandler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"go.uber.org/zap"
+)
+
+// AlertsHandler обрабатывает HTTP-запросы, связанные с алертами.
+type AlertsHandler struct {
+	service AlertsService
+	log     *zap.Logger
+}
+
+// NewAlertsHandler создаёт новый экземпляр AlertsHandler.
+// Принимает реализацию AlertsService и логгер zap.Logger.
+func NewAlertsHandler(service AlertsService, log *zap.Logger) *AlertsHandler {
+	return &AlertsHandler{
+		service: service,
+		log:     log,
+	}
+}
+
+// GetFiringAlerts обрабатывает GET-запрос к /api/alerts.
+// Возвращает JSON-массив алертов в состоянии firing.
+// Если сработавших алертов нет — возвращает пустой массив.
+func (h *AlertsHandler) GetFiringAlerts(w http.ResponseWriter, r *http.Request) {
+	alerts := h.service.FiringAlerts(r.Context())
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	if err := json.NewEncoder(w).Encode(alerts); err != nil {
+		h.log.Error("error encoding alerts response", zap.Error(err))
+	}
+}
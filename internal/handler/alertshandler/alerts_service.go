@@ -0,0 +1,13 @@
+package alertshandler
+
+import (
+	"context"
+
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/model"
+)
+
+// AlertsService определяет контракт для получения состояния алертов.
+type AlertsService interface {
+	// FiringAlerts возвращает список алертов, находящихся в состоянии firing.
+	FiringAlerts(ctx context.Context) []model.Alert
+}
@@ -0,0 +1,60 @@
+package alertshandler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/mocks"
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestAlertsHandler_GetFiringAlerts(t *testing.T) {
+	tests := []struct {
+		name     string
+		alerts   []model.Alert
+		expected int
+	}{
+		{
+			name: "firing alerts returned",
+			alerts: []model.Alert{
+				{Rule: model.AlertRule{Name: "high_heap", MetricID: "HeapAlloc"}, State: model.AlertFiring, Value: 42},
+			},
+			expected: 1,
+		},
+		{
+			name:     "no firing alerts",
+			alerts:   []model.Alert{},
+			expected: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockService := mocks.NewMockAlertsService(ctrl)
+			mockService.EXPECT().FiringAlerts(gomock.Any()).Return(tt.alerts)
+
+			handler := NewAlertsHandler(mockService, zap.NewNop())
+
+			req := httptest.NewRequest(http.MethodGet, "/api/alerts", nil)
+			w := httptest.NewRecorder()
+
+			handler.GetFiringAlerts(w, req)
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+			var got []model.Alert
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+			assert.Len(t, got, tt.expected)
+		})
+	}
+}
@@ -0,0 +1,205 @@
+// Package grpchandler реализует gRPC-сервис metrics.Metrics из api/metrics.proto.
+// Методы повторяют поведение HTTP-хендлеров metricshandler.
+package grpchandler
+
+import (
+	"context"
+	"errors"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/model"
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/proto/metricspb"
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/service"
+)
+
+// MetricsServer обрабатывает gRPC-вызовы получения и обновления метрик.
+type MetricsServer struct {
+	metricspb.UnimplementedMetricsServer
+
+	service MetricsService
+	log     *zap.Logger
+}
+
+// NewMetricsServer создаёт новый экземпляр MetricsServer.
+// Принимает реализацию MetricsService и логгер zap.Logger.
+func NewMetricsServer(service MetricsService, log *zap.Logger) *MetricsServer {
+	return &MetricsServer{
+		service: service,
+		log:     log,
+	}
+}
+
+// Update обновляет одну метрику, аналог POST /update/.
+// Возвращает InvalidArgument при неизвестном типе, отсутствии значения,
+// некорректной гистограмме или несовпадении границ ее корзин с сохраненными, Unavailable при недоступном хранилище и Internal при прочих ошибках сохранения.
+func (s *MetricsServer) Update(ctx context.Context, req *metricspb.UpdateRequest) (*metricspb.UpdateResponse, error) {
+	metric := req.GetMetric()
+	if metric == nil {
+		return nil, status.Error(codes.InvalidArgument, "metric is required")
+	}
+
+	var err error
+	switch metric.GetType() {
+	case metricspb.MType_GAUGE:
+		if metric.Value == nil {
+			return nil, status.Error(codes.InvalidArgument, "metric value is required for gauge")
+		}
+		err = s.service.UpdateGauge(ctx, metric.GetId(), metric.GetValue())
+
+	case metricspb.MType_COUNTER:
+		if metric.Delta == nil {
+			return nil, status.Error(codes.InvalidArgument, "metric delta is required for counter")
+		}
+		err = s.service.UpdateCounter(ctx, metric.GetId(), metric.GetDelta())
+
+	case metricspb.MType_HISTOGRAM:
+		histogram := metric.GetHistogram().ToModel()
+		if histogram == nil {
+			return nil, status.Error(codes.InvalidArgument, "metric histogram is required for histogram")
+		}
+		if validateErr := histogram.Validate(); validateErr != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid histogram: %v", validateErr)
+		}
+		err = s.service.UpdateHistogram(ctx, metric.GetId(), *histogram)
+
+	default:
+		return nil, status.Error(codes.InvalidArgument, "unknown metric type")
+	}
+
+	if err != nil {
+		s.log.Error("error updating metric",
+			zap.String("metric_name", metric.GetId()),
+			zap.String("metric_type", metric.GetType().ModelType()),
+			zap.Error(err))
+		return nil, status.Error(storageCode(err), "failed to update metric")
+	}
+
+	return &metricspb.UpdateResponse{}, nil
+}
+
+// UpdateBatch выполняет пакетное обновление метрик, аналог POST /updates/.
+// Адрес клиента передаётся в сервис для аудита.
+// Повторный пакет с тем же idempotency_key подтверждается без повторного применения.
+// Возвращает InvalidArgument, если в пакете есть некорректная гистограмма
+// или гистограмма с границами корзин, отличными от сохраненных.
+func (s *MetricsServer) UpdateBatch(ctx context.Context, req *metricspb.UpdateBatchRequest) (*metricspb.UpdateBatchResponse, error) {
+	metrics := make([]model.Metrics, 0, len(req.GetMetrics()))
+	for _, metric := range req.GetMetrics() {
+		m := metric.ToModel()
+		if m.MType == model.Histogram && m.Histogram != nil {
+			if err := m.Histogram.Validate(); err != nil {
+				return nil, status.Errorf(codes.InvalidArgument, "invalid histogram %s: %v", metric.GetId(), err)
+			}
+		}
+		metrics = append(metrics, m)
+	}
+
+	applied, err := s.service.UpdateMetricsOnce(ctx, req.GetIdempotencyKey(), metrics, peerAddr(ctx))
+	if err != nil {
+		s.log.Error("failed to save batch of metrics", zap.Int("metrics_count", len(metrics)), zap.Error(err))
+		return nil, status.Error(storageCode(err), "failed to save batch of metrics")
+	}
+
+	if !applied {
+		s.log.Info("batch with this idempotency key was already applied",
+			zap.String("idempotency_key", req.GetIdempotencyKey()))
+	}
+
+	return &metricspb.UpdateBatchResponse{}, nil
+}
+
+// Get возвращает текущее значение метрики, аналог POST /value/.
+// Возвращает InvalidArgument при неизвестном типе, NotFound, если метрика не найдена,
+// и Unavailable при недоступном хранилище.
+func (s *MetricsServer) Get(ctx context.Context, req *metricspb.GetRequest) (*metricspb.GetResponse, error) {
+	metric := &metricspb.Metric{Id: req.GetId(), Type: req.GetType()}
+
+	switch req.GetType() {
+	case metricspb.MType_GAUGE:
+		value, err := s.service.GetGauge(ctx, req.GetId())
+		if err != nil {
+			s.log.Debug("failed to get gauge metric", zap.String("metric_name", req.GetId()), zap.Error(err))
+			return nil, getError(err)
+		}
+		metric.Value = &value
+
+	case metricspb.MType_COUNTER:
+		delta, err := s.service.GetCounter(ctx, req.GetId())
+		if err != nil {
+			s.log.Debug("failed to get counter metric", zap.String("metric_name", req.GetId()), zap.Error(err))
+			return nil, getError(err)
+		}
+		metric.Delta = &delta
+
+	case metricspb.MType_HISTOGRAM:
+		histogram, err := s.service.GetHistogram(ctx, req.GetId())
+		if err != nil {
+			s.log.Debug("failed to get histogram metric", zap.String("metric_name", req.GetId()), zap.Error(err))
+			return nil, getError(err)
+		}
+		metric.Histogram = metricspb.HistogramFromModel(&histogram)
+
+	default:
+		return nil, status.Error(codes.InvalidArgument, "unknown metric type")
+	}
+
+	return &metricspb.GetResponse{Metric: metric}, nil
+}
+
+// List возвращает метрики по фильтру, аналог GET /values.
+func (s *MetricsServer) List(ctx context.Context, req *metricspb.ListRequest) (*metricspb.ListResponse, error) {
+	filter := model.MetricsFilter{
+		Prefix: req.GetPrefix(),
+		MType:  req.GetType().ModelType(),
+		Limit:  int(req.GetLimit()),
+		Offset: int(req.GetOffset()),
+	}
+
+	metrics, err := s.service.ListMetrics(ctx, filter)
+	if err != nil {
+		s.log.Error("error listing metrics", zap.Error(err))
+		return nil, status.Error(storageCode(err), "error listing metrics")
+	}
+
+	resp := &metricspb.ListResponse{Metrics: make([]*metricspb.Metric, 0, len(metrics))}
+	for _, metric := range metrics {
+		resp.Metrics = append(resp.Metrics, metricspb.FromModel(metric))
+	}
+
+	return resp, nil
+}
+
+// peerAddr возвращает адрес клиента или пустую строку, если он неизвестен
+func peerAddr(ctx context.Context) string {
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		return p.Addr.String()
+	}
+	return ""
+}
+
+// storageCode возвращает gRPC-код для ошибки хранилища
+func storageCode(err error) codes.Code {
+	switch {
+	case errors.Is(err, service.ErrNotFound):
+		return codes.NotFound
+	case errors.Is(err, model.ErrBucketsMismatch):
+		return codes.InvalidArgument
+	case errors.Is(err, service.ErrUnavailable):
+		return codes.Unavailable
+	default:
+		return codes.Internal
+	}
+}
+
+// getError формирует ответ на неудачное чтение метрики
+func getError(err error) error {
+	code := storageCode(err)
+	if code == codes.NotFound {
+		return status.Error(code, "metric not found")
+	}
+	return status.Error(code, "failed to get metric")
+}
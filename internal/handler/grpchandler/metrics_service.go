@@ -0,0 +1,38 @@
+package grpchandler
+
+import (
+	"context"
+
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/model"
+)
+
+// MetricsService определяет контракт сервиса метрик, используемого gRPC-сервером.
+type MetricsService interface {
+	// UpdateGauge устанавливает новое значение для метрики типа gauge.
+	UpdateGauge(ctx context.Context, name string, value float64) error
+
+	// UpdateCounter увеличивает значение метрики типа counter на указанную дельту.
+	UpdateCounter(ctx context.Context, name string, value int64) error
+
+	// UpdateHistogram добавляет к метрике типа histogram приращение распределения.
+	UpdateHistogram(ctx context.Context, name string, value model.HistogramValue) error
+
+	// UpdateMetrics обновляет несколько метрик за один вызов (пакетное обновление).
+	UpdateMetrics(ctx context.Context, metrics []model.Metrics, ipAddr string) error
+
+	// UpdateMetricsOnce выполняет пакетное обновление с ключом идемпотентности.
+	// Возвращает false, если батч с таким ключом уже был применен ранее.
+	UpdateMetricsOnce(ctx context.Context, key string, metrics []model.Metrics, ipAddr string) (bool, error)
+
+	// GetGauge возвращает текущее значение метрики типа gauge по её имени.
+	GetGauge(ctx context.Context, name string) (float64, error)
+
+	// GetCounter возвращает текущее значение метрики типа counter по её имени.
+	GetCounter(ctx context.Context, name string) (int64, error)
+
+	// GetHistogram возвращает текущее распределение метрики типа histogram по её имени.
+	GetHistogram(ctx context.Context, name string) (model.HistogramValue, error)
+
+	// ListMetrics возвращает метрики, подходящие под фильтр, отсортированные по имени и типу.
+	ListMetrics(ctx context.Context, filter model.MetricsFilter) ([]model.Metrics, error)
+}
@@ -0,0 +1,93 @@
+package grpchandler
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	_ "google.golang.org/grpc/encoding/gzip"
+
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/handler/interceptors"
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/handler/middlewares"
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/handler/middlewares/signer"
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/proto/metricspb"
+)
+
+// Server обслуживает gRPC-сервис метрик на отдельном TCP-адресе.
+// Цепочка интерсепторов повторяет мидлвари HTTP-сервера:
+// логирование, ограничение конкурентности и проверку подписи.
+type Server struct {
+	addr   string
+	server *grpc.Server
+	lis    net.Listener
+	log    *zap.Logger
+}
+
+func NewServer(
+	addr string,
+	service MetricsService,
+	signerService signer.Signer,
+	limiter *middlewares.Limiter,
+	log *zap.Logger,
+) *Server {
+	server := grpc.NewServer(grpc.ChainUnaryInterceptor(
+		interceptors.Logger(log),
+		interceptors.RateLimiter(limiter, log),
+		interceptors.HashValidation(signerService, log),
+	))
+	metricspb.RegisterMetricsServer(server, NewMetricsServer(service, log))
+
+	return &Server{
+		addr:   addr,
+		server: server,
+		log:    log,
+	}
+}
+
+// Start открывает TCP-сокет и запускает обработку вызовов
+func (s *Server) Start() error {
+	lis, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen grpc on %s: %w", s.addr, err)
+	}
+	s.lis = lis
+
+	go func() {
+		if err := s.server.Serve(lis); err != nil {
+			s.log.Error("grpc server failed", zap.Error(err))
+		}
+	}()
+
+	s.log.Info("grpc server started", zap.String("addr", lis.Addr().String()))
+	return nil
+}
+
+// Addr возвращает фактический адрес сокета
+func (s *Server) Addr() net.Addr {
+	return s.lis.Addr()
+}
+
+// Shutdown дожидается завершения текущих вызовов.
+// По истечении контекста оставшиеся вызовы прерываются.
+func (s *Server) Shutdown(ctx context.Context) error {
+	if s.lis == nil {
+		return nil
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.server.GracefulStop()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		s.log.Info("grpc server stopped")
+		return nil
+	case <-ctx.Done():
+		s.server.Stop()
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,230 @@
+package grpchandler
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/handler/interceptors"
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/handler/middlewares"
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/handler/middlewares/signer"
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/mocks"
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/model"
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/proto/metricspb"
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/service"
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/service/signerservice"
+)
+
+func newTestServer(t *testing.T, limiter *middlewares.Limiter, clientSigner signer.Signer) (*mocks.MockMetricsService, metricspb.MetricsClient) {
+	ctrl := gomock.NewController(t)
+	t.Cleanup(ctrl.Finish)
+
+	service := mocks.NewMockMetricsService(ctrl)
+	server := NewServer("127.0.0.1:0", service, signerservice.NewSHA256Signer("secret"), limiter, zap.NewNop())
+	require.NoError(t, server.Start())
+	t.Cleanup(func() {
+		require.NoError(t, server.Shutdown(context.Background()))
+	})
+
+	conn, err := grpc.NewClient(
+		server.Addr().String(),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithUnaryInterceptor(interceptors.Signing(clientSigner)),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return service, metricspb.NewMetricsClient(conn)
+}
+
+func TestServer_UpdateBatch(t *testing.T) {
+	service, client := newTestServer(t, middlewares.NewLimiter(0), signerservice.NewSHA256Signer("secret"))
+
+	delta := int64(5)
+	value := 1.5
+	expected := []model.Metrics{
+		{ID: "PollCount", MType: model.Counter, Delta: &delta},
+		{ID: "Alloc", MType: model.Gauge, Value: &value},
+	}
+	service.EXPECT().UpdateMetricsOnce(gomock.Any(), "batch-1", expected, gomock.Any()).Return(true, nil)
+
+	_, err := client.UpdateBatch(context.Background(), &metricspb.UpdateBatchRequest{
+		Metrics:        []*metricspb.Metric{metricspb.FromModel(expected[0]), metricspb.FromModel(expected[1])},
+		IdempotencyKey: "batch-1",
+	})
+	assert.NoError(t, err)
+}
+
+func TestServer_Update(t *testing.T) {
+	service, client := newTestServer(t, middlewares.NewLimiter(0), nil)
+	ctx := context.Background()
+
+	delta := int64(3)
+	service.EXPECT().UpdateCounter(gomock.Any(), "PollCount", int64(3)).Return(nil)
+
+	_, err := client.Update(ctx, &metricspb.UpdateRequest{
+		Metric: &metricspb.Metric{Id: "PollCount", Type: metricspb.MType_COUNTER, Delta: &delta},
+	})
+	assert.NoError(t, err)
+
+	_, err = client.Update(ctx, &metricspb.UpdateRequest{
+		Metric: &metricspb.Metric{Id: "Alloc", Type: metricspb.MType_GAUGE},
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = client.Update(ctx, &metricspb.UpdateRequest{
+		Metric: &metricspb.Metric{Id: "Alloc", Delta: &delta},
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestServer_Get(t *testing.T) {
+	svc, client := newTestServer(t, middlewares.NewLimiter(0), nil)
+	ctx := context.Background()
+
+	svc.EXPECT().GetGauge(gomock.Any(), "Alloc").Return(2.5, nil)
+	svc.EXPECT().GetCounter(gomock.Any(), "Unknown").Return(int64(0), service.ErrNotFound)
+	svc.EXPECT().GetCounter(gomock.Any(), "PollCount").Return(int64(0), service.ErrUnavailable)
+
+	resp, err := client.Get(ctx, &metricspb.GetRequest{Id: "Alloc", Type: metricspb.MType_GAUGE})
+	require.NoError(t, err)
+	assert.Equal(t, 2.5, resp.GetMetric().GetValue())
+
+	_, err = client.Get(ctx, &metricspb.GetRequest{Id: "Unknown", Type: metricspb.MType_COUNTER})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	_, err = client.Get(ctx, &metricspb.GetRequest{Id: "PollCount", Type: metricspb.MType_COUNTER})
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+
+	_, err = client.Get(ctx, &metricspb.GetRequest{Id: "Alloc"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestServer_List(t *testing.T) {
+	service, client := newTestServer(t, middlewares.NewLimiter(0), nil)
+
+	value := 1.0
+	service.EXPECT().
+		ListMetrics(gomock.Any(), model.MetricsFilter{Prefix: "A", MType: model.Gauge, Limit: 10}).
+		Return([]model.Metrics{{ID: "Alloc", MType: model.Gauge, Value: &value}}, nil)
+
+	resp, err := client.List(context.Background(), &metricspb.ListRequest{Prefix: "A", Type: metricspb.MType_GAUGE, Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, resp.GetMetrics(), 1)
+	assert.Equal(t, "Alloc", resp.GetMetrics()[0].GetId())
+}
+
+func TestServer_Histogram(t *testing.T) {
+	svc, client := newTestServer(t, middlewares.NewLimiter(0), nil)
+	ctx := context.Background()
+
+	histogram := model.HistogramValue{
+		Buckets: []float64{1, 2.5},
+		Counts:  []int64{2, 1, 1},
+		Sum:     6.5,
+		Count:   4,
+	}
+	metric := model.Metrics{
+		ID:        "Alloc",
+		MType:     model.Histogram,
+		Histogram: &histogram,
+		Labels:    model.Labels{"host": "a"},
+	}
+
+	svc.EXPECT().UpdateHistogram(gomock.Any(), "Alloc", histogram).Return(nil)
+	svc.EXPECT().UpdateMetricsOnce(gomock.Any(), "batch-1", []model.Metrics{metric}, gomock.Any()).Return(true, nil)
+	svc.EXPECT().GetHistogram(gomock.Any(), "Alloc").Return(histogram, nil)
+	svc.EXPECT().
+		ListMetrics(gomock.Any(), model.MetricsFilter{MType: model.Histogram}).
+		Return([]model.Metrics{metric}, nil)
+
+	_, err := client.Update(ctx, &metricspb.UpdateRequest{
+		Metric: &metricspb.Metric{Id: "Alloc", Type: metricspb.MType_HISTOGRAM, Histogram: metricspb.HistogramFromModel(&histogram)},
+	})
+	require.NoError(t, err)
+
+	_, err = client.UpdateBatch(ctx, &metricspb.UpdateBatchRequest{
+		Metrics:        []*metricspb.Metric{metricspb.FromModel(metric)},
+		IdempotencyKey: "batch-1",
+	})
+	require.NoError(t, err)
+
+	resp, err := client.Get(ctx, &metricspb.GetRequest{Id: "Alloc", Type: metricspb.MType_HISTOGRAM})
+	require.NoError(t, err)
+	assert.Equal(t, &histogram, resp.GetMetric().GetHistogram().ToModel())
+
+	list, err := client.List(ctx, &metricspb.ListRequest{Type: metricspb.MType_HISTOGRAM})
+	require.NoError(t, err)
+	require.Len(t, list.GetMetrics(), 1)
+	assert.Equal(t, metric, list.GetMetrics()[0].ToModel())
+}
+
+func TestServer_InvalidHistogram(t *testing.T) {
+	_, client := newTestServer(t, middlewares.NewLimiter(0), nil)
+	ctx := context.Background()
+
+	// Число корзин не совпадает с числом границ
+	invalid := &metricspb.Histogram{Buckets: []float64{1, 2.5}, Counts: []int64{1}, Count: 1}
+
+	_, err := client.Update(ctx, &metricspb.UpdateRequest{
+		Metric: &metricspb.Metric{Id: "Alloc", Type: metricspb.MType_HISTOGRAM, Histogram: invalid},
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = client.Update(ctx, &metricspb.UpdateRequest{
+		Metric: &metricspb.Metric{Id: "Alloc", Type: metricspb.MType_HISTOGRAM},
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = client.UpdateBatch(ctx, &metricspb.UpdateBatchRequest{
+		Metrics: []*metricspb.Metric{{Id: "Alloc", Type: metricspb.MType_HISTOGRAM, Histogram: invalid}},
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestServer_HistogramBucketsMismatch(t *testing.T) {
+	service, client := newTestServer(t, middlewares.NewLimiter(0), nil)
+	ctx := context.Background()
+
+	histogram := model.HistogramValue{Buckets: []float64{1}, Counts: []int64{1, 0}, Sum: 0.5, Count: 1}
+	metric := model.Metrics{ID: "latency", MType: model.Histogram, Histogram: &histogram}
+	mismatch := fmt.Errorf("latency: %w", model.ErrBucketsMismatch)
+
+	service.EXPECT().UpdateHistogram(gomock.Any(), "latency", histogram).Return(mismatch)
+	_, err := client.Update(ctx, &metricspb.UpdateRequest{Metric: metricspb.FromModel(metric)})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	service.EXPECT().UpdateMetricsOnce(gomock.Any(), "batch-1", gomock.Any(), gomock.Any()).Return(false, mismatch)
+	_, err = client.UpdateBatch(ctx, &metricspb.UpdateBatchRequest{
+		Metrics:        []*metricspb.Metric{metricspb.FromModel(metric)},
+		IdempotencyKey: "batch-1",
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestServer_InvalidSignature(t *testing.T) {
+	_, client := newTestServer(t, middlewares.NewLimiter(0), signerservice.NewSHA256Signer("wrong"))
+
+	_, err := client.UpdateBatch(context.Background(), &metricspb.UpdateBatchRequest{})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestServer_RateLimit(t *testing.T) {
+	limiter := middlewares.NewLimiter(1)
+	_, client := newTestServer(t, limiter, nil)
+
+	require.True(t, limiter.TryAcquire())
+	defer limiter.Release()
+
+	_, err := client.List(context.Background(), &metricspb.ListRequest{})
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+}
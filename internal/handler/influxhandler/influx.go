@@ -0,0 +1,123 @@
+// Package influxhandler предоставляет HTTP-хендлер, принимающий метрики
+// в текстовом формате InfluxDB line protocol через эндпоинт /write.
+// Это позволяет использовать Telegraf и другие совместимые агенты без изменений.
+package influxhandler
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/model"
+)
+
+// maxLineSize - максимальная длина одной строки line protocol
+const maxLineSize = 1 << 20
+
+// LineError - ошибка разбора отдельной строки запроса
+type LineError struct {
+	Line    int    `json:"line"`
+	Message string `json:"message"`
+}
+
+// ErrorResponse - тело ответа при ошибках разбора, совместимое с InfluxDB
+type ErrorResponse struct {
+	Code    string      `json:"code"`
+	Message string      `json:"message"`
+	Lines   []LineError `json:"lines,omitempty"`
+}
+
+// InfluxHandler обрабатывает запросы записи в формате InfluxDB line protocol.
+type InfluxHandler struct {
+	updater MetricsUpdater
+	log     *zap.Logger
+}
+
+// NewInfluxHandler создаёт новый экземпляр InfluxHandler.
+// Принимает сервис сохранения метрик MetricsUpdater и логгер zap.Logger.
+func NewInfluxHandler(updater MetricsUpdater, log *zap.Logger) *InfluxHandler {
+	return &InfluxHandler{
+		updater: updater,
+		log:     log,
+	}
+}
+
+// Write обрабатывает POST-запрос к /write.
+// Каждое числовое поле строки сохраняется как метрика с именем measurement_field:
+// целые поля (123i, 123u) - как counter, дробные - как gauge.
+// Строковые и логические поля, теги и метки времени игнорируются.
+// Корректные строки сохраняются одним пакетом даже при наличии ошибочных.
+// Возвращает 204 при успехе, 400 со списком ошибок по строкам,
+// 500 при ошибке сохранения.
+func (h *InfluxHandler) Write(w http.ResponseWriter, r *http.Request) {
+	var (
+		metrics    []model.Metrics
+		lineErrors []LineError
+	)
+
+	scanner := bufio.NewScanner(r.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		parsed, err := parseLine(line)
+		if err != nil {
+			lineErrors = append(lineErrors, LineError{Line: lineNum, Message: err.Error()})
+			continue
+		}
+		metrics = append(metrics, parsed...)
+	}
+
+	if err := scanner.Err(); err != nil {
+		h.log.Error("failed to read line protocol body", zap.Error(err))
+		h.writeError(w, http.StatusBadRequest, ErrorResponse{
+			Code:    "invalid",
+			Message: fmt.Sprintf("failed to read body: %v", err),
+		})
+		return
+	}
+
+	if len(metrics) > 0 {
+		if err := h.updater.UpdateMetrics(r.Context(), metrics, r.RemoteAddr); err != nil {
+			h.log.Error("failed to save line protocol metrics", zap.Error(err))
+			h.writeError(w, http.StatusInternalServerError, ErrorResponse{
+				Code:    "internal error",
+				Message: "failed to save metrics",
+			})
+			return
+		}
+	}
+
+	if len(lineErrors) > 0 {
+		h.log.Warn("line protocol parse errors",
+			zap.Int("failed_lines", len(lineErrors)),
+			zap.Int("saved_metrics", len(metrics)))
+		h.writeError(w, http.StatusBadRequest, ErrorResponse{
+			Code:    "invalid",
+			Message: fmt.Sprintf("failed to parse %d line(s)", len(lineErrors)),
+			Lines:   lineErrors,
+		})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *InfluxHandler) writeError(w http.ResponseWriter, status int, resp ErrorResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		h.log.Error("failed to write error response", zap.Error(err))
+	}
+}
@@ -0,0 +1,158 @@
+package influxhandler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/mocks"
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func int64Ptr(v int64) *int64       { return &v }
+func float64Ptr(v float64) *float64 { return &v }
+
+func TestParseLine(t *testing.T) {
+	tests := []struct {
+		name     string
+		line     string
+		expected []model.Metrics
+		wantErr  bool
+	}{
+		{
+			name: "float and integer fields with tags and timestamp",
+			line: "cpu,host=a,region=eu usage_idle=98.5,procs=12i 1700000000000000000",
+			expected: []model.Metrics{
+				{ID: "cpu_usage_idle", MType: model.Gauge, Value: float64Ptr(98.5)},
+				{ID: "cpu_procs", MType: model.Counter, Delta: int64Ptr(12)},
+			},
+		},
+		{
+			name: "unsigned integer",
+			line: "net bytes_recv=100u",
+			expected: []model.Metrics{
+				{ID: "net_bytes_recv", MType: model.Counter, Delta: int64Ptr(100)},
+			},
+		},
+		{
+			name: "string and boolean fields are skipped",
+			line: `system uptime_format="1 day, 2:03",online=true,load1=0.5`,
+			expected: []model.Metrics{
+				{ID: "system_load1", MType: model.Gauge, Value: float64Ptr(0.5)},
+			},
+		},
+		{
+			name: "escaped measurement and field key",
+			line: `disk\ io,path=/var read\,bytes=1i`,
+			expected: []model.Metrics{
+				{ID: "disk io_read,bytes", MType: model.Counter, Delta: int64Ptr(1)},
+			},
+		},
+		{name: "missing fields", line: "cpu", wantErr: true},
+		{name: "invalid float", line: "cpu usage=abc", wantErr: true},
+		{name: "invalid integer", line: "cpu procs=1.5i", wantErr: true},
+		{name: "invalid timestamp", line: "cpu usage=1 soon", wantErr: true},
+		{name: "field without value", line: "cpu usage", wantErr: true},
+		{name: "unterminated string", line: `cpu msg="oops`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metrics, err := parseLine(tt.line)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, metrics)
+		})
+	}
+}
+
+func TestInfluxHandler_Write(t *testing.T) {
+	t.Run("all lines valid", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		updater := mocks.NewMockMetricsUpdater(ctrl)
+		updater.EXPECT().
+			UpdateMetrics(gomock.Any(), []model.Metrics{
+				{ID: "mem_used", MType: model.Gauge, Value: float64Ptr(1024)},
+				{ID: "requests_total", MType: model.Counter, Delta: int64Ptr(5)},
+			}, gomock.Any()).
+			Return(nil)
+
+		handler := NewInfluxHandler(updater, zap.NewNop())
+		body := "# comment\nmem used=1024\n\nrequests total=5i\n"
+		req := httptest.NewRequest(http.MethodPost, "/write", strings.NewReader(body))
+		w := httptest.NewRecorder()
+
+		handler.Write(w, req)
+
+		assert.Equal(t, http.StatusNoContent, w.Code)
+	})
+
+	t.Run("invalid lines are reported and valid ones saved", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		updater := mocks.NewMockMetricsUpdater(ctrl)
+		updater.EXPECT().
+			UpdateMetrics(gomock.Any(), []model.Metrics{
+				{ID: "mem_used", MType: model.Gauge, Value: float64Ptr(1)},
+			}, gomock.Any()).
+			Return(nil)
+
+		handler := NewInfluxHandler(updater, zap.NewNop())
+		body := "mem used=1\ncpu\nmem free=x\n"
+		req := httptest.NewRequest(http.MethodPost, "/write", strings.NewReader(body))
+		w := httptest.NewRecorder()
+
+		handler.Write(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		var resp ErrorResponse
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+		assert.Equal(t, "invalid", resp.Code)
+		require.Len(t, resp.Lines, 2)
+		assert.Equal(t, 2, resp.Lines[0].Line)
+		assert.Equal(t, 3, resp.Lines[1].Line)
+	})
+
+	t.Run("nothing to save", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		handler := NewInfluxHandler(mocks.NewMockMetricsUpdater(ctrl), zap.NewNop())
+		req := httptest.NewRequest(http.MethodPost, "/write", strings.NewReader(""))
+		w := httptest.NewRecorder()
+
+		handler.Write(w, req)
+
+		assert.Equal(t, http.StatusNoContent, w.Code)
+	})
+
+	t.Run("storage error", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		updater := mocks.NewMockMetricsUpdater(ctrl)
+		updater.EXPECT().UpdateMetrics(gomock.Any(), gomock.Any(), gomock.Any()).Return(errors.New("db down"))
+
+		handler := NewInfluxHandler(updater, zap.NewNop())
+		req := httptest.NewRequest(http.MethodPost, "/write", strings.NewReader("mem used=1"))
+		w := httptest.NewRecorder()
+
+		handler.Write(w, req)
+
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+	})
+}
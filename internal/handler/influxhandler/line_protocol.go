@@ -0,0 +1,168 @@
+package influxhandler
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/model"
+)
+
+// errNoFields - строка не содержит ни одного поля
+var errNoFields = errors.New("no fields")
+
+// parseLine разбирает строку line protocol вида
+// measurement[,tag=value...] field=value[,field=value...] [timestamp]
+// и возвращает по одной метрике на каждое числовое поле.
+// Целые поля (суффикс i или u) становятся counter, дробные - gauge.
+// Строковые и логические поля пропускаются. Теги и метка времени не сохраняются.
+func parseLine(line string) ([]model.Metrics, error) {
+	keyEnd := indexUnescaped(line, ' ', false)
+	if keyEnd <= 0 {
+		return nil, errors.New("missing fields")
+	}
+
+	key := line[:keyEnd]
+	rest := strings.TrimLeft(line[keyEnd:], " ")
+
+	measurementEnd := indexUnescaped(key, ',', false)
+	if measurementEnd < 0 {
+		measurementEnd = len(key)
+	}
+	measurement := unescape(key[:measurementEnd])
+	if measurement == "" {
+		return nil, errors.New("missing measurement")
+	}
+
+	fieldsEnd := indexUnescaped(rest, ' ', true)
+	if fieldsEnd < 0 {
+		fieldsEnd = len(rest)
+	}
+	fieldSet := rest[:fieldsEnd]
+
+	if ts := strings.TrimSpace(rest[fieldsEnd:]); ts != "" {
+		if _, err := strconv.ParseInt(ts, 10, 64); err != nil {
+			return nil, fmt.Errorf("invalid timestamp %q", ts)
+		}
+	}
+
+	if fieldSet == "" {
+		return nil, errNoFields
+	}
+
+	var metrics []model.Metrics
+	for _, field := range splitUnescaped(fieldSet, ',', true) {
+		eq := indexUnescaped(field, '=', false)
+		if eq <= 0 {
+			return nil, fmt.Errorf("invalid field %q", field)
+		}
+
+		name := measurement + "_" + unescape(field[:eq])
+		metric, ok, err := parseFieldValue(name, field[eq+1:])
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			metrics = append(metrics, metric)
+		}
+	}
+
+	return metrics, nil
+}
+
+// parseFieldValue преобразует значение поля в метрику.
+// Возвращает ok = false для строковых и логических полей.
+func parseFieldValue(id, raw string) (model.Metrics, bool, error) {
+	if raw == "" {
+		return model.Metrics{}, false, fmt.Errorf("field %q: empty value", id)
+	}
+
+	switch {
+	case raw[0] == '"':
+		if len(raw) < 2 || raw[len(raw)-1] != '"' {
+			return model.Metrics{}, false, fmt.Errorf("field %q: unterminated string", id)
+		}
+		return model.Metrics{}, false, nil
+
+	case isBool(raw):
+		return model.Metrics{}, false, nil
+
+	case raw[len(raw)-1] == 'i':
+		delta, err := strconv.ParseInt(raw[:len(raw)-1], 10, 64)
+		if err != nil {
+			return model.Metrics{}, false, fmt.Errorf("field %q: invalid integer %q", id, raw)
+		}
+		return model.Metrics{ID: id, MType: model.Counter, Delta: &delta}, true, nil
+
+	case raw[len(raw)-1] == 'u':
+		unsigned, err := strconv.ParseUint(raw[:len(raw)-1], 10, 64)
+		if err != nil || unsigned > math.MaxInt64 {
+			return model.Metrics{}, false, fmt.Errorf("field %q: invalid unsigned integer %q", id, raw)
+		}
+		delta := int64(unsigned)
+		return model.Metrics{ID: id, MType: model.Counter, Delta: &delta}, true, nil
+	}
+
+	value, err := strconv.ParseFloat(raw, 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		return model.Metrics{}, false, fmt.Errorf("field %q: invalid float %q", id, raw)
+	}
+	return model.Metrics{ID: id, MType: model.Gauge, Value: &value}, true, nil
+}
+
+func isBool(raw string) bool {
+	switch raw {
+	case "t", "T", "true", "True", "TRUE", "f", "F", "false", "False", "FALSE":
+		return true
+	}
+	return false
+}
+
+// indexUnescaped возвращает индекс первого неэкранированного символа sep.
+// При inQuotes = true символы внутри двойных кавычек пропускаются.
+func indexUnescaped(s string, sep byte, inQuotes bool) int {
+	quoted := false
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\':
+			i++
+		case inQuotes && s[i] == '"':
+			quoted = !quoted
+		case !quoted && s[i] == sep:
+			return i
+		}
+	}
+	return -1
+}
+
+// splitUnescaped делит строку по неэкранированному символу sep
+func splitUnescaped(s string, sep byte, inQuotes bool) []string {
+	var parts []string
+	for {
+		i := indexUnescaped(s, sep, inQuotes)
+		if i < 0 {
+			return append(parts, s)
+		}
+		parts = append(parts, s[:i])
+		s = s[i+1:]
+	}
+}
+
+// unescape снимает экранирование с запятых, пробелов и знаков равенства
+func unescape(s string) string {
+	if !strings.Contains(s, "\\") {
+		return s
+	}
+
+	var builder strings.Builder
+	builder.Grow(len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) && (s[i+1] == ',' || s[i+1] == ' ' || s[i+1] == '=') {
+			i++
+		}
+		builder.WriteByte(s[i])
+	}
+	return builder.String()
+}
@@ -0,0 +1,26 @@
+package interceptors
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/handler/middlewares"
+)
+
+// RateLimiter делит с HTTP-сервером общий лимит одновременных запросов.
+// При исчерпании лимита вызов отклоняется с кодом ResourceExhausted.
+func RateLimiter(limiter *middlewares.Limiter, log *zap.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if !limiter.TryAcquire() {
+			log.Warn("gRPC request rejected by rate limiter", zap.String("method", info.FullMethod))
+			return nil, status.Error(codes.ResourceExhausted, "too many requests")
+		}
+		defer limiter.Release()
+
+		return handler(ctx, req)
+	}
+}
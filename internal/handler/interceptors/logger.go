@@ -0,0 +1,27 @@
+// Package interceptors содержит gRPC-интерсепторы, повторяющие цепочку
+// chi-мидлварей HTTP-сервера: логирование, проверку подписи и ограничение конкурентности.
+package interceptors
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// Logger логирует метод, длительность и код ответа каждого вызова
+func Logger(log *zap.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		log.Debug(
+			"got incoming gRPC request",
+			zap.String("method", info.FullMethod),
+			zap.String("duration", time.Since(start).String()),
+			zap.String("code", status.Code(err).String()),
+		)
+		return resp, err
+	}
+}
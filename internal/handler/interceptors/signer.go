@@ -0,0 +1,80 @@
+package interceptors
+
+import (
+	"context"
+	"fmt"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/handler/middlewares/signer"
+)
+
+// SignatureMetadataKey - ключ метаданных с подписью запроса, аналог заголовка HashSHA256
+const SignatureMetadataKey = "hashsha256"
+
+// signaturePayload возвращает детерминированное protobuf-представление сообщения,
+// по которому считается подпись
+func signaturePayload(msg any) ([]byte, error) {
+	message, ok := msg.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("unexpected message type %T", msg)
+	}
+	return proto.MarshalOptions{Deterministic: true}.Marshal(message)
+}
+
+// HashValidation проверяет подпись запроса так же, как signer.HashValidationMiddleware:
+// запросы без подписи или с подписью "none" пропускаются,
+// неверная подпись отклоняется с кодом InvalidArgument.
+func HashValidation(s signer.Signer, log *zap.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if s == nil {
+			return handler(ctx, req)
+		}
+
+		var givenHash string
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			if values := md.Get(SignatureMetadataKey); len(values) > 0 {
+				givenHash = values[0]
+			}
+		}
+
+		if givenHash == "" || givenHash == "none" {
+			return handler(ctx, req)
+		}
+
+		payload, err := signaturePayload(req)
+		if err != nil {
+			log.Error("failed to marshal request for signature check", zap.Error(err))
+			return nil, status.Error(codes.Internal, "failed to verify signature")
+		}
+
+		if !s.Verify(payload, givenHash) {
+			log.Warn("invalid request signature", zap.String("method", info.FullMethod))
+			return nil, status.Error(codes.InvalidArgument, "invalid signature")
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// Signing подписывает исходящие запросы клиента и передаёт подпись в метаданных
+func Signing(s signer.Signer) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if s == nil {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+
+		payload, err := signaturePayload(req)
+		if err != nil {
+			return fmt.Errorf("signing request failed: %w", err)
+		}
+
+		ctx = metadata.AppendToOutgoingContext(ctx, SignatureMetadataKey, s.Sign(payload))
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"go.uber.org/zap"
 	"net/http"
 	"net/http/httptest"
+	"time"
 )
 
 type mockMetricsService struct{}
@@ -25,9 +26,33 @@ func (m mockMetricsService) UpdateGauge(_ context.Context, name string, value fl
 func (m mockMetricsService) UpdateCounter(_ context.Context, name string, delta int64) error {
 	return nil
 }
+func (m mockMetricsService) ObserveHistogram(_ context.Context, name string, value float64) error {
+	return nil
+}
+func (m mockMetricsService) UpdateHistogram(_ context.Context, name string, value model.HistogramValue) error {
+	return nil
+}
+func (m mockMetricsService) GetHistogram(_ context.Context, name string) (model.HistogramValue, error) {
+	return model.HistogramValue{}, nil
+}
 func (m mockMetricsService) UpdateMetrics(_ context.Context, metrics []model.Metrics, remoteAddr string) error {
 	return nil
 }
+func (m mockMetricsService) UpdateMetricsOnce(_ context.Context, key string, metrics []model.Metrics, remoteAddr string) (bool, error) {
+	return true, nil
+}
+func (m mockMetricsService) ListMetrics(_ context.Context, filter model.MetricsFilter) ([]model.Metrics, error) {
+	return nil, nil
+}
+func (m mockMetricsService) GetHistory(_ context.Context, metricType, name string, from, to time.Time, step time.Duration) ([]model.MetricSample, error) {
+	return nil, nil
+}
+func (m mockMetricsService) DeleteMetric(_ context.Context, metricType, name, remoteAddr string) error {
+	return nil
+}
+func (m mockMetricsService) DeleteMetrics(_ context.Context, filter model.MetricsFilter, remoteAddr string) ([]model.Metrics, error) {
+	return nil, nil
+}
 
 func ExampleMetricsHandler_GetMetric_gauge() {
 	log, _ := zap.NewDevelopment()
@@ -1,21 +1,34 @@
 // Package metricshandler предоставляет HTTP-хендлеры для работы с метриками приложения:
-// получение, обновление и пакетное сохранение значений типа gauge и counter.
+// получение, обновление и пакетное сохранение значений типа gauge, counter и histogram.
 package metricshandler
 
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"go.uber.org/zap"
 
 	"github.com/kazakovdmitriy/go-musthave-metrics/internal/model"
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/service"
 )
 
+// Заголовки идемпотентного пакетного обновления
+const (
+	IdempotencyKeyHeader     = "Idempotency-Key"
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+)
+
+// retryAfterSeconds - значение Retry-After в ответе 503 при недоступном хранилище
+const retryAfterSeconds = 5
+
 // MetricsHandler обрабатывает HTTP-запросы, связанные с получением и обновлением метрик.
 // Поддерживает как URL-параметры, так и JSON-тело запроса.
 type MetricsHandler struct {
@@ -34,7 +47,10 @@ func NewMetricsHandler(service MetricsService, log *zap.Logger) *MetricsHandler
 }
 
 // GetMetric обрабатывает GET-запрос вида /value/{metricType}/{metricName}.
+// metricName может адресовать ряд с метками: CPUutilization{core="1"} в URL-кодировке.
 // Возвращает текстовое представление значения метрики (gauge или counter).
+// Для histogram возвращает строки "count N", "sum S" и по строке "<квантиль> <значение>"
+// на каждый квантиль из параметра q (например, q=0.5,0.99), по умолчанию model.DefaultQuantiles.
 // Устанавливает Content-Type: text/plain.
 // В случае ошибки (неверный тип метрики, метрика не найдена) логирует событие и возвращает соответствующий HTTP-статус.
 func (h *MetricsHandler) GetMetric(w http.ResponseWriter, r *http.Request) {
@@ -59,7 +75,7 @@ func (h *MetricsHandler) GetMetric(w http.ResponseWriter, r *http.Request) {
 	case model.Gauge:
 		gaugeValue, err := h.service.GetGauge(r.Context(), metricName)
 		if err != nil {
-			h.logAndWriteError(w, err, http.StatusNotFound, "error getting gauge metric",
+			h.logAndWriteError(w, err, storageErrorStatus(w, err), "error getting gauge metric",
 				zap.String("metric_type", metricType), zap.String("metric_name", metricName))
 			return
 		}
@@ -68,11 +84,25 @@ func (h *MetricsHandler) GetMetric(w http.ResponseWriter, r *http.Request) {
 	case model.Counter:
 		counterValue, err := h.service.GetCounter(r.Context(), metricName)
 		if err != nil {
-			h.logAndWriteError(w, err, http.StatusNotFound, "error getting counter metric",
+			h.logAndWriteError(w, err, storageErrorStatus(w, err), "error getting counter metric",
 				zap.String("metric_type", metricType), zap.String("metric_name", metricName))
 			return
 		}
 		valueStr = strconv.FormatInt(counterValue, 10)
+
+	case model.Histogram:
+		quantiles, err := parseQuantiles(r.URL.Query().Get("q"))
+		if err != nil {
+			h.logAndWriteError(w, err, http.StatusBadRequest, "invalid q parameter")
+			return
+		}
+		histogram, err := h.service.GetHistogram(r.Context(), metricName)
+		if err != nil {
+			h.logAndWriteError(w, err, storageErrorStatus(w, err), "error getting histogram metric",
+				zap.String("metric_type", metricType), zap.String("metric_name", metricName))
+			return
+		}
+		valueStr = formatHistogram(histogram, quantiles)
 	}
 
 	w.Header().Set("Content-Type", "text/plain")
@@ -82,7 +112,7 @@ func (h *MetricsHandler) GetMetric(w http.ResponseWriter, r *http.Request) {
 
 // UpdateMetric обрабатывает PUT-запрос вида /update/{metricType}/{metricName}/{value}.
 // Обновляет значение метрики на основе переданного строкового значения.
-// Поддерживает только gauge (float64) и counter (int64).
+// Поддерживает gauge (float64), counter (int64) и histogram (float64 - одно наблюдение).
 // При ошибке парсинга или сохранения логирует событие и возвращает соответствующий HTTP-статус.
 func (h *MetricsHandler) UpdateMetric(w http.ResponseWriter, r *http.Request) {
 	metricType := chi.URLParam(r, "metricType")
@@ -100,7 +130,7 @@ func (h *MetricsHandler) UpdateMetric(w http.ResponseWriter, r *http.Request) {
 
 // UpdatePost обрабатывает POST-запрос к эндпоинту /update.
 // Ожидает тело запроса в формате JSON, соответствующее структуре model.Metrics.
-// Обновляет одну метрику (gauge или counter) в зависимости от переданного MType.
+// Обновляет одну метрику (gauge, counter или histogram) в зависимости от переданного MType.
 // Требует Content-Type: application/json.
 // В случае ошибки декодирования JSON, отсутствия значения или ошибки сохранения — логирует и возвращает ошибку.
 func (h *MetricsHandler) UpdatePost(w http.ResponseWriter, r *http.Request) {
@@ -142,6 +172,8 @@ func (h *MetricsHandler) UpdatePost(w http.ResponseWriter, r *http.Request) {
 
 // UpdateMetrics обрабатывает POST-запрос к эндпоинту /updates.
 // Принимает массив метрик в формате JSON и выполняет их пакетное обновление через сервис.
+// Если передан заголовок Idempotency-Key, повторный батч с тем же ключом не применяется,
+// а подтверждается статусом 200 с заголовком Idempotent-Replayed: true.
 // Требует Content-Type: application/json.
 // В случае ошибки декодирования или сохранения — логирует и возвращает ошибку.
 func (h *MetricsHandler) UpdateMetrics(w http.ResponseWriter, r *http.Request) {
@@ -163,17 +195,38 @@ func (h *MetricsHandler) UpdateMetrics(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.service.UpdateMetrics(r.Context(), data, r.RemoteAddr); err != nil {
-		h.logAndWriteError(w, err, http.StatusInternalServerError, "failed to save batch of metrics", zap.Error(err))
+	for _, metric := range data {
+		if err := metric.Labels.Validate(); err != nil {
+			h.logAndWriteError(w, err, http.StatusBadRequest, "invalid labels", zap.String("metric_name", metric.ID))
+			return
+		}
+		if metric.MType == model.Histogram && metric.Histogram != nil {
+			if err := metric.Histogram.Validate(); err != nil {
+				h.logAndWriteError(w, err, http.StatusBadRequest, "invalid histogram", zap.String("metric_name", metric.ID))
+				return
+			}
+		}
+	}
+
+	applied, err := h.service.UpdateMetricsOnce(r.Context(), r.Header.Get(IdempotencyKeyHeader), data, r.RemoteAddr)
+	if err != nil {
+		h.logAndWriteError(w, err, storageErrorStatus(w, err), "failed to save batch of metrics", zap.Error(err))
 		return
 	}
 
+	if !applied {
+		h.log.Info("batch with this idempotency key was already applied",
+			zap.String("idempotency_key", r.Header.Get(IdempotencyKeyHeader)))
+		w.Header().Set(IdempotentReplayedHeader, "true")
+	}
+
 	w.WriteHeader(http.StatusOK)
 }
 
 // SentMetricPost обрабатывает POST-запрос к эндпоинту /value.
 // Принимает описание метрики в формате JSON и возвращает её текущее значение в том же формате.
 // Используется для получения актуального состояния метрики после её возможного обновления.
+// Для histogram ответ содержит распределение и квантили из параметра q, как в GetMetric.
 // Требует Content-Type: application/json.
 // В случае ошибки — логирует и возвращает соответствующий HTTP-статус.
 // Ответ сериализуется в JSON с Content-Type: application/json.
@@ -196,7 +249,13 @@ func (h *MetricsHandler) SentMetricPost(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	resp, err := h.getMetricForJSONResponse(w, r.Context(), data)
+	quantiles, err := parseQuantiles(r.URL.Query().Get("q"))
+	if err != nil {
+		h.logAndWriteError(w, err, http.StatusBadRequest, "invalid q parameter")
+		return
+	}
+
+	resp, err := h.getMetricForJSONResponse(w, r.Context(), data, quantiles)
 	if err != nil {
 		// getMetricForJSONResponse уже логирует ошибки и вызывает http.Error.
 		return
@@ -210,12 +269,266 @@ func (h *MetricsHandler) SentMetricPost(w http.ResponseWriter, r *http.Request)
 	}
 }
 
+// ListMetrics обрабатывает GET-запрос вида /values?prefix=&type=&labels=&limit=&offset=.
+// Возвращает JSON-массив model.Metrics, отсортированный по имени, типу и меткам метрики.
+// prefix ограничивает выборку метриками с указанным префиксом имени, type - типом метрики,
+// labels - условиями на метки вида host="a",core=~"1|2" (операторы =, !=, =~, !~).
+// limit и offset задают страницу выборки; limit = 0 означает отсутствие лимита.
+// При неверных параметрах возвращает 400, при недоступном хранилище - 503 с заголовком
+// Retry-After, при прочих ошибках хранилища - 500.
+func (h *MetricsHandler) ListMetrics(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	filter := model.MetricsFilter{
+		Prefix: query.Get("prefix"),
+		MType:  query.Get("type"),
+	}
+
+	if filter.MType != "" && !isValidMetricType(filter.MType) {
+		h.logAndWriteError(w, fmt.Errorf("invalid metric type: %s", filter.MType), http.StatusBadRequest,
+			"invalid metric type", zap.String("metric_type", filter.MType))
+		return
+	}
+
+	var err error
+	if filter.Labels, err = model.ParseLabelMatchers(query.Get("labels")); err != nil {
+		h.logAndWriteError(w, err, http.StatusBadRequest, "invalid labels parameter")
+		return
+	}
+	if filter.Limit, err = parseNonNegativeInt(query.Get("limit")); err != nil {
+		h.logAndWriteError(w, err, http.StatusBadRequest, "invalid limit parameter")
+		return
+	}
+	if filter.Offset, err = parseNonNegativeInt(query.Get("offset")); err != nil {
+		h.logAndWriteError(w, err, http.StatusBadRequest, "invalid offset parameter")
+		return
+	}
+
+	metrics, err := h.service.ListMetrics(r.Context(), filter)
+	if err != nil {
+		h.logAndWriteError(w, err, storageErrorStatus(w, err), "error listing metrics")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	if err := json.NewEncoder(w).Encode(metrics); err != nil {
+		h.log.Error("error encoding metrics list", zap.Error(err))
+	}
+}
+
+// GetHistory обрабатывает GET-запрос вида /history/{metricType}/{metricName}?from=&to=&step=.
+// from и to принимают Unix-время в секундах или RFC3339; по умолчанию from не ограничен, to - текущее время.
+// step задаётся в формате time.ParseDuration ("10s", "1m") и прореживает точки до одной на интервал.
+// Возвращает JSON-массив точек model.MetricSample с Content-Type: application/json.
+// При неверных параметрах возвращает 400, при недоступном хранилище - 503 с заголовком
+// Retry-After, при прочих ошибках хранилища - 500.
+func (h *MetricsHandler) GetHistory(w http.ResponseWriter, r *http.Request) {
+	metricType := chi.URLParam(r, "metricType")
+	metricName := chi.URLParam(r, "metricName")
+
+	if !isValidMetricType(metricType) {
+		h.logAndWriteError(
+			w,
+			fmt.Errorf("invalid metric type: %s", metricType),
+			http.StatusBadRequest,
+			"invalid metric type",
+			zap.String("metric_type", metricType),
+			zap.String("metric_name", metricName),
+		)
+		return
+	}
+
+	query := r.URL.Query()
+
+	from, err := parseTimeParam(query.Get("from"), time.Unix(0, 0))
+	if err != nil {
+		h.logAndWriteError(w, err, http.StatusBadRequest, "invalid from parameter")
+		return
+	}
+
+	to, err := parseTimeParam(query.Get("to"), time.Now())
+	if err != nil {
+		h.logAndWriteError(w, err, http.StatusBadRequest, "invalid to parameter")
+		return
+	}
+
+	var step time.Duration
+	if stepStr := query.Get("step"); stepStr != "" {
+		step, err = time.ParseDuration(stepStr)
+		if err != nil || step < 0 {
+			h.logAndWriteError(w, fmt.Errorf("invalid step: %q", stepStr), http.StatusBadRequest, "invalid step parameter")
+			return
+		}
+	}
+
+	samples, err := h.service.GetHistory(r.Context(), metricType, metricName, from, to, step)
+	if err != nil {
+		h.logAndWriteError(w, err, storageErrorStatus(w, err), "error getting metric history",
+			zap.String("metric_type", metricType), zap.String("metric_name", metricName))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	if err := json.NewEncoder(w).Encode(samples); err != nil {
+		h.log.Error("error encoding history response", zap.Error(err))
+	}
+}
+
+// DeleteMetric обрабатывает DELETE-запрос вида /value/{metricType}/{metricName}.
+// Удаляет метрику вместе с историей и возвращает 200.
+// Если метрики нет, возвращает 404, при недоступном хранилище - 503.
+func (h *MetricsHandler) DeleteMetric(w http.ResponseWriter, r *http.Request) {
+	metricType := chi.URLParam(r, "metricType")
+	metricName := chi.URLParam(r, "metricName")
+
+	if !isValidMetricType(metricType) {
+		h.logAndWriteError(
+			w,
+			fmt.Errorf("invalid metric type: %s", metricType),
+			http.StatusBadRequest,
+			"invalid metric type",
+			zap.String("metric_type", metricType),
+			zap.String("metric_name", metricName),
+		)
+		return
+	}
+
+	if err := h.service.DeleteMetric(r.Context(), metricType, metricName, r.RemoteAddr); err != nil {
+		h.logAndWriteError(w, err, storageErrorStatus(w, err), "error deleting metric",
+			zap.String("metric_type", metricType), zap.String("metric_name", metricName))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// DeleteMetrics обрабатывает DELETE-запрос вида /values?prefix=&type=&labels=.
+// Удаляет все метрики с указанным префиксом имени, type ограничивает удаление одним типом,
+// labels - условиями на метки в том же виде, что и для ListMetrics.
+// Пустой prefix не принимается, чтобы случайный запрос не удалил все метрики.
+// Возвращает JSON-массив удаленных метрик (id, тип и метки).
+func (h *MetricsHandler) DeleteMetrics(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	filter := model.MetricsFilter{
+		Prefix: query.Get("prefix"),
+		MType:  query.Get("type"),
+	}
+
+	if filter.Prefix == "" {
+		h.logAndWriteError(w, errors.New("empty prefix"), http.StatusBadRequest, "prefix parameter is required")
+		return
+	}
+
+	if filter.MType != "" && !isValidMetricType(filter.MType) {
+		h.logAndWriteError(w, fmt.Errorf("invalid metric type: %s", filter.MType), http.StatusBadRequest,
+			"invalid metric type", zap.String("metric_type", filter.MType))
+		return
+	}
+
+	var err error
+	if filter.Labels, err = model.ParseLabelMatchers(query.Get("labels")); err != nil {
+		h.logAndWriteError(w, err, http.StatusBadRequest, "invalid labels parameter")
+		return
+	}
+
+	deleted, err := h.service.DeleteMetrics(r.Context(), filter, r.RemoteAddr)
+	if err != nil {
+		h.logAndWriteError(w, err, storageErrorStatus(w, err), "error deleting metrics",
+			zap.String("prefix", filter.Prefix))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	if err := json.NewEncoder(w).Encode(deleted); err != nil {
+		h.log.Error("error encoding deleted metrics", zap.Error(err))
+	}
+}
+
 // --- Helper functions ---
 
+// parseNonNegativeInt разбирает неотрицательное целое число. Пустая строка означает 0.
+func parseNonNegativeInt(value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %q: %w", value, err)
+	}
+	if parsed < 0 {
+		return 0, fmt.Errorf("negative number %d", parsed)
+	}
+	return parsed, nil
+}
+
+// parseTimeParam разбирает параметр времени: Unix-время в секундах или RFC3339.
+// Для пустой строки возвращает значение по умолчанию.
+func parseTimeParam(value string, def time.Time) (time.Time, error) {
+	if value == "" {
+		return def, nil
+	}
+
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q: %w", value, err)
+	}
+	return parsed, nil
+}
+
+// parseQuantiles разбирает список квантилей через запятую, каждый из [0, 1].
+// Пустая строка означает model.DefaultQuantiles.
+func parseQuantiles(value string) ([]float64, error) {
+	if value == "" {
+		return model.DefaultQuantiles, nil
+	}
+
+	parts := strings.Split(value, ",")
+	quantiles := make([]float64, 0, len(parts))
+	for _, part := range parts {
+		q, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil || math.IsNaN(q) || q < 0 || q > 1 {
+			return nil, fmt.Errorf("invalid quantile %q", part)
+		}
+		quantiles = append(quantiles, q)
+	}
+	return quantiles, nil
+}
+
+// formatHistogram форматирует гистограмму для текстового ответа /value.
+// Квантили пустой гистограммы не выводятся.
+func formatHistogram(histogram model.HistogramValue, quantiles []float64) string {
+	var builder strings.Builder
+	builder.WriteString("count ")
+	builder.WriteString(strconv.FormatInt(histogram.Count, 10))
+	builder.WriteString("\nsum ")
+	builder.WriteString(strconv.FormatFloat(histogram.Sum, 'f', -1, 64))
+	if histogram.Count > 0 {
+		for _, q := range quantiles {
+			builder.WriteByte('\n')
+			builder.WriteString(strconv.FormatFloat(q, 'f', -1, 64))
+			builder.WriteByte(' ')
+			builder.WriteString(strconv.FormatFloat(histogram.Quantile(q), 'f', -1, 64))
+		}
+	}
+	return builder.String()
+}
+
 // isValidMetricType проверяет, является ли переданная строка допустимым типом метрики.
-// Допустимые значения: model.Gauge ("gauge") и model.Counter ("counter").
+// Допустимые значения: model.Gauge ("gauge"), model.Counter ("counter") и model.Histogram ("histogram").
 func isValidMetricType(metricType string) bool {
-	return metricType == model.Gauge || metricType == model.Counter
+	return metricType == model.Gauge || metricType == model.Counter || metricType == model.Histogram
 }
 
 // updateMetricByType обновляет метрику по типу, имени и строковому значению.
@@ -247,7 +560,7 @@ func (h *MetricsHandler) updateMetricByType(
 				zap.String("metric_name", metricName),
 				zap.Float64("metric_value", parsedValue),
 				zap.Error(err))
-			http.Error(w, "failed to update gauge metric", http.StatusInternalServerError)
+			http.Error(w, "failed to update gauge metric", storageErrorStatus(w, err))
 			return err
 		}
 
@@ -268,7 +581,31 @@ func (h *MetricsHandler) updateMetricByType(
 				zap.String("metric_name", metricName),
 				zap.Int64("metric_value", parsedValue),
 				zap.Error(err))
-			http.Error(w, "failed to update counter metric", http.StatusInternalServerError)
+			http.Error(w, "failed to update counter metric", storageErrorStatus(w, err))
+			return err
+		}
+
+	case model.Histogram:
+		parsedValue, parseErr := strconv.ParseFloat(metricValueStr, 64)
+		if parseErr == nil && (math.IsNaN(parsedValue) || math.IsInf(parsedValue, 0)) {
+			parseErr = fmt.Errorf("observation %q is not finite", metricValueStr)
+		}
+		if parseErr != nil {
+			err = parseErr
+			h.log.Error("invalid histogram value format",
+				zap.String("metric_name", metricName),
+				zap.String("metric_value", metricValueStr),
+				zap.Error(err))
+			http.Error(w, "invalid histogram value format", http.StatusBadRequest)
+			return err
+		}
+		err = h.service.ObserveHistogram(ctx, metricName, parsedValue)
+		if err != nil {
+			h.log.Error("error updating histogram metric",
+				zap.String("metric_name", metricName),
+				zap.Float64("metric_value", parsedValue),
+				zap.Error(err))
+			http.Error(w, "failed to update histogram metric", storageErrorStatus(w, err))
 			return err
 		}
 
@@ -284,7 +621,7 @@ func (h *MetricsHandler) updateMetricByType(
 }
 
 // updateMetricFromJSON обновляет одну метрику на основе структуры model.Metrics.
-// Проверяет наличие обязательных полей (Value для gauge, Delta для counter).
+// Проверяет наличие обязательных полей (Value для gauge, Delta для counter, Histogram для histogram).
 // При ошибках логирует и отправляет HTTP-ответ клиенту.
 func (h *MetricsHandler) updateMetricFromJSON(
 	w http.ResponseWriter,
@@ -292,7 +629,7 @@ func (h *MetricsHandler) updateMetricFromJSON(
 	data model.Metrics,
 ) error {
 	metricType := strings.ToLower(data.MType)
-	metricName := data.ID
+	metricName := data.Key()
 
 	if !isValidMetricType(metricType) {
 		err := fmt.Errorf("unknown metric type: %s", data.MType)
@@ -303,6 +640,14 @@ func (h *MetricsHandler) updateMetricFromJSON(
 		return err
 	}
 
+	if err := data.Labels.Validate(); err != nil {
+		h.log.Error("invalid labels in JSON",
+			zap.String("metric_name", data.ID),
+			zap.Error(err))
+		http.Error(w, "invalid labels", http.StatusBadRequest)
+		return err
+	}
+
 	switch metricType {
 	case model.Gauge:
 		if data.Value == nil {
@@ -318,7 +663,7 @@ func (h *MetricsHandler) updateMetricFromJSON(
 				zap.String("metric_name", metricName),
 				zap.Float64("metric_value", *data.Value),
 				zap.Error(err))
-			http.Error(w, "failed to update gauge metric", http.StatusInternalServerError)
+			http.Error(w, "failed to update gauge metric", storageErrorStatus(w, err))
 			return err
 		}
 
@@ -336,7 +681,31 @@ func (h *MetricsHandler) updateMetricFromJSON(
 				zap.String("metric_name", metricName),
 				zap.Int64("metric_delta", *data.Delta),
 				zap.Error(err))
-			http.Error(w, "failed to update counter metric", http.StatusInternalServerError)
+			http.Error(w, "failed to update counter metric", storageErrorStatus(w, err))
+			return err
+		}
+
+	case model.Histogram:
+		if data.Histogram == nil {
+			err := fmt.Errorf("histogram metric value is nil")
+			h.log.Error("histogram metric value is nil",
+				zap.String("metric_name", metricName))
+			http.Error(w, "metric histogram is required for histogram", http.StatusBadRequest)
+			return err
+		}
+		if err := data.Histogram.Validate(); err != nil {
+			h.log.Error("invalid histogram in JSON",
+				zap.String("metric_name", metricName),
+				zap.Error(err))
+			http.Error(w, "invalid histogram", http.StatusBadRequest)
+			return err
+		}
+		err := h.service.UpdateHistogram(ctx, metricName, *data.Histogram)
+		if err != nil {
+			h.log.Error("error updating histogram metric from JSON",
+				zap.String("metric_name", metricName),
+				zap.Error(err))
+			http.Error(w, "failed to update histogram metric", storageErrorStatus(w, err))
 			return err
 		}
 	}
@@ -345,11 +714,13 @@ func (h *MetricsHandler) updateMetricFromJSON(
 
 // getMetricForJSONResponse извлекает текущее значение метрики по данным из запроса
 // и формирует ответ в виде model.Metrics для последующей сериализации в JSON.
+// Для histogram в ответ добавляются квантили quantiles.
 // При ошибках логирует и отправляет HTTP-ответ клиенту.
 func (h *MetricsHandler) getMetricForJSONResponse(
 	w http.ResponseWriter,
 	ctx context.Context,
 	data model.Metrics,
+	quantiles []float64,
 ) (model.Metrics, error) {
 	var resp model.Metrics
 	var err error
@@ -365,41 +736,88 @@ func (h *MetricsHandler) getMetricForJSONResponse(
 
 	switch metricType {
 	case model.Gauge:
-		gaugeValue, getErr := h.service.GetGauge(ctx, data.ID)
+		gaugeValue, getErr := h.service.GetGauge(ctx, data.Key())
 		if getErr != nil {
 			err = getErr
 			h.log.Error("error getting gauge metric",
 				zap.String("metric_name", data.ID),
 				zap.Error(err))
-			http.Error(w, "metric not found", http.StatusNotFound)
+			writeGetError(w, err)
 			return resp, err
 		}
 		resp = model.Metrics{
-			ID:    data.ID,
-			MType: data.MType,
-			Value: &gaugeValue,
+			ID:     data.ID,
+			MType:  data.MType,
+			Value:  &gaugeValue,
+			Labels: data.Labels,
 		}
 
 	case model.Counter:
-		counterValue, getErr := h.service.GetCounter(ctx, data.ID)
+		counterValue, getErr := h.service.GetCounter(ctx, data.Key())
 		if getErr != nil {
 			err = getErr
 			h.log.Error("error getting counter metric",
 				zap.String("metric_name", data.ID),
 				zap.Error(err))
-			http.Error(w, "metric not found", http.StatusNotFound)
+			writeGetError(w, err)
 			return resp, err
 		}
 		resp = model.Metrics{
-			ID:    data.ID,
-			MType: data.MType,
-			Delta: &counterValue,
+			ID:     data.ID,
+			MType:  data.MType,
+			Delta:  &counterValue,
+			Labels: data.Labels,
+		}
+
+	case model.Histogram:
+		histogram, getErr := h.service.GetHistogram(ctx, data.Key())
+		if getErr != nil {
+			err = getErr
+			h.log.Error("error getting histogram metric",
+				zap.String("metric_name", data.ID),
+				zap.Error(err))
+			writeGetError(w, err)
+			return resp, err
+		}
+		resp = model.Metrics{
+			ID:        data.ID,
+			MType:     data.MType,
+			Histogram: &histogram,
+			Quantiles: histogram.Quantiles(quantiles),
+			Labels:    data.Labels,
 		}
 	}
 
 	return resp, nil
 }
 
+// storageErrorStatus возвращает HTTP-статус для ошибки хранилища:
+// 404 для service.ErrNotFound, 400 для model.ErrBucketsMismatch,
+// 503 с заголовком Retry-After для service.ErrUnavailable, иначе 500.
+func storageErrorStatus(w http.ResponseWriter, err error) int {
+	switch {
+	case errors.Is(err, service.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, model.ErrBucketsMismatch):
+		return http.StatusBadRequest
+	case errors.Is(err, service.ErrUnavailable):
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfterSeconds))
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// writeGetError отправляет клиенту ответ на неудачное чтение метрики
+func writeGetError(w http.ResponseWriter, err error) {
+	status := storageErrorStatus(w, err)
+	if status == http.StatusNotFound {
+		http.Error(w, "metric not found", status)
+		return
+	}
+	http.Error(w, "failed to get metric", status)
+}
+
 // logAndWriteError логирует ошибку с дополнительными полями и отправляет HTTP-ошибку клиенту.
 func (h *MetricsHandler) logAndWriteError(
 	w http.ResponseWriter,
@@ -2,6 +2,7 @@ package metricshandler
 
 import (
 	"context"
+	"time"
 
 	"github.com/kazakovdmitriy/go-musthave-metrics/internal/model"
 )
@@ -15,12 +16,38 @@ type MetricsService interface {
 	// UpdateCounter увеличивает значение метрики типа counter на указанную дельту.
 	UpdateCounter(ctx context.Context, name string, value int64) error
 
+	// ObserveHistogram добавляет одно наблюдение в метрику типа histogram.
+	ObserveHistogram(ctx context.Context, name string, value float64) error
+
+	// UpdateHistogram добавляет к метрике типа histogram приращение распределения.
+	UpdateHistogram(ctx context.Context, name string, value model.HistogramValue) error
+
 	// UpdateMetrics обновляет несколько метрик за один вызов (пакетное обновление).
 	UpdateMetrics(ctx context.Context, metrics []model.Metrics, ipAddr string) error
 
+	// UpdateMetricsOnce выполняет пакетное обновление с ключом идемпотентности.
+	// Возвращает false, если батч с таким ключом уже был применен ранее.
+	UpdateMetricsOnce(ctx context.Context, key string, metrics []model.Metrics, ipAddr string) (bool, error)
+
 	// GetGauge возвращает текущее значение метрики типа gauge по её имени.
 	GetGauge(ctx context.Context, name string) (float64, error)
 
 	// GetCounter возвращает текущее значение метрики типа counter по её имени.
 	GetCounter(ctx context.Context, name string) (int64, error)
+
+	// GetHistogram возвращает текущее распределение метрики типа histogram по её имени.
+	GetHistogram(ctx context.Context, name string) (model.HistogramValue, error)
+
+	// ListMetrics возвращает метрики, подходящие под фильтр, отсортированные по имени и типу.
+	ListMetrics(ctx context.Context, filter model.MetricsFilter) ([]model.Metrics, error)
+
+	// GetHistory возвращает сэмплы метрики в интервале [from, to].
+	// Если step больше нуля, сэмплы прореживаются до одной точки на интервал step.
+	GetHistory(ctx context.Context, metricType, name string, from, to time.Time, step time.Duration) ([]model.MetricSample, error)
+
+	// DeleteMetric удаляет метрику вместе с историей.
+	DeleteMetric(ctx context.Context, metricType, name, ipAddr string) error
+
+	// DeleteMetrics удаляет метрики, подходящие под префикс и тип фильтра, и возвращает удаленные.
+	DeleteMetrics(ctx context.Context, filter model.MetricsFilter, ipAddr string) ([]model.Metrics, error)
 }
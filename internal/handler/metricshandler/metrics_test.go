@@ -7,12 +7,15 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"testing"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/golang/mock/gomock"
 	"github.com/kazakovdmitriy/go-musthave-metrics/internal/mocks"
 	"github.com/kazakovdmitriy/go-musthave-metrics/internal/model"
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/service"
 
 	"go.uber.org/zap"
 )
@@ -26,12 +29,13 @@ func TestMetricsHandler_GetMetric(t *testing.T) {
 	handler := NewMetricsHandler(mockService, logger)
 
 	tests := []struct {
-		name           string
-		metricType     string
-		metricName     string
-		setupMock      func()
-		expectedStatus int
-		expectedBody   string
+		name               string
+		metricType         string
+		metricName         string
+		setupMock          func()
+		expectedStatus     int
+		expectedBody       string
+		expectedRetryAfter string
 	}{
 		{
 			name:       "success gauge",
@@ -53,6 +57,34 @@ func TestMetricsHandler_GetMetric(t *testing.T) {
 			expectedStatus: http.StatusOK,
 			expectedBody:   "42",
 		},
+		{
+			name:       "success histogram with quantiles",
+			metricType: "histogram",
+			metricName: "latency?q=0.5,0.99",
+			setupMock: func() {
+				mockService.EXPECT().GetHistogram(gomock.Any(), "latency").Return(model.HistogramValue{
+					Buckets: []float64{1, 2, 4}, Counts: []int64{2, 2, 0, 1}, Sum: 7, Count: 5,
+				}, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   "count 5\nsum 7\n0.5 1.25\n0.99 4",
+		},
+		{
+			name:           "invalid quantile",
+			metricType:     "histogram",
+			metricName:     "latency?q=1.5",
+			setupMock:      func() {},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "invalid q parameter\n",
+		},
+		{
+			name:           "NaN quantile",
+			metricType:     "histogram",
+			metricName:     "latency?q=NaN",
+			setupMock:      func() {},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "invalid q parameter\n",
+		},
 		{
 			name:           "invalid metric type",
 			metricType:     "invalid",
@@ -66,7 +98,7 @@ func TestMetricsHandler_GetMetric(t *testing.T) {
 			metricType: "gauge",
 			metricName: "nonexistent",
 			setupMock: func() {
-				mockService.EXPECT().GetGauge(gomock.Any(), "nonexistent").Return(0.0, errors.New("not found"))
+				mockService.EXPECT().GetGauge(gomock.Any(), "nonexistent").Return(0.0, service.ErrNotFound)
 			},
 			expectedStatus: http.StatusNotFound,
 			expectedBody:   "error getting gauge metric\n",
@@ -76,11 +108,23 @@ func TestMetricsHandler_GetMetric(t *testing.T) {
 			metricType: "counter",
 			metricName: "nonexistent",
 			setupMock: func() {
-				mockService.EXPECT().GetCounter(gomock.Any(), "nonexistent").Return(int64(0), errors.New("not found"))
+				mockService.EXPECT().GetCounter(gomock.Any(), "nonexistent").Return(int64(0), service.ErrNotFound)
 			},
 			expectedStatus: http.StatusNotFound,
 			expectedBody:   "error getting counter metric\n",
 		},
+		{
+			name:       "storage unavailable",
+			metricType: "counter",
+			metricName: "PollCount",
+			setupMock: func() {
+				mockService.EXPECT().GetCounter(gomock.Any(), "PollCount").
+					Return(int64(0), fmt.Errorf("failed to get counter metric: %w", service.ErrUnavailable))
+			},
+			expectedStatus:     http.StatusServiceUnavailable,
+			expectedBody:       "error getting counter metric\n",
+			expectedRetryAfter: "5",
+		},
 	}
 
 	for _, tt := range tests {
@@ -102,6 +146,10 @@ func TestMetricsHandler_GetMetric(t *testing.T) {
 			if w.Body.String() != tt.expectedBody {
 				t.Errorf("expected body %q, got %q", tt.expectedBody, w.Body.String())
 			}
+
+			if got := w.Header().Get("Retry-After"); got != tt.expectedRetryAfter {
+				t.Errorf("expected Retry-After %q, got %q", tt.expectedRetryAfter, got)
+			}
 		})
 	}
 }
@@ -143,6 +191,25 @@ func TestMetricsHandler_UpdateMetric(t *testing.T) {
 			},
 			expectedStatus: http.StatusOK,
 		},
+		{
+			name:       "success histogram",
+			metricType: "histogram",
+			metricName: "latency",
+			value:      "0.25",
+			setupMock: func() {
+				mockService.EXPECT().ObserveHistogram(gomock.Any(), "latency", 0.25).Return(nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "histogram value not finite",
+			metricType:     "histogram",
+			metricName:     "latency",
+			value:          "NaN",
+			setupMock:      func() {},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "invalid histogram value format\n",
+		},
 		{
 			name:           "invalid metric type",
 			metricType:     "invalid",
@@ -259,6 +326,86 @@ func TestMetricsHandler_UpdatePost(t *testing.T) {
 			},
 			expectedStatus: http.StatusOK,
 		},
+		{
+			name:        "success gauge with labels",
+			contentType: "application/json",
+			body: model.Metrics{
+				ID:     "CPUutilization",
+				MType:  "gauge",
+				Value:  float64Ptr(12.5),
+				Labels: model.Labels{"host": "a", "core": "1"},
+			},
+			setupMock: func() {
+				mockService.EXPECT().UpdateGauge(gomock.Any(), `CPUutilization{core="1",host="a"}`, 12.5).Return(nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:        "success histogram",
+			contentType: "application/json",
+			body: model.Metrics{
+				ID:        "latency",
+				MType:     "histogram",
+				Histogram: &model.HistogramValue{Buckets: []float64{1}, Counts: []int64{1, 1}, Sum: 3, Count: 2},
+			},
+			setupMock: func() {
+				mockService.EXPECT().UpdateHistogram(gomock.Any(), "latency", model.HistogramValue{
+					Buckets: []float64{1}, Counts: []int64{1, 1}, Sum: 3, Count: 2,
+				}).Return(nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:        "histogram without value",
+			contentType: "application/json",
+			body: model.Metrics{
+				ID:    "latency",
+				MType: "histogram",
+			},
+			setupMock:      func() {},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "metric histogram is required for histogram\n",
+		},
+		{
+			name:        "histogram counts do not match buckets",
+			contentType: "application/json",
+			body: model.Metrics{
+				ID:        "latency",
+				MType:     "histogram",
+				Histogram: &model.HistogramValue{Buckets: []float64{1}, Counts: []int64{1}, Count: 1},
+			},
+			setupMock:      func() {},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "invalid histogram\n",
+		},
+		{
+			name:        "histogram buckets do not match stored",
+			contentType: "application/json",
+			body: model.Metrics{
+				ID:        "latency",
+				MType:     "histogram",
+				Histogram: &model.HistogramValue{Buckets: []float64{1}, Counts: []int64{1, 1}, Sum: 3, Count: 2},
+			},
+			setupMock: func() {
+				mockService.EXPECT().UpdateHistogram(gomock.Any(), "latency", gomock.Any()).
+					Return(fmt.Errorf("latency: %w", model.ErrBucketsMismatch))
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "failed to update histogram metric\n",
+		},
+		{
+			name:        "invalid label name",
+			contentType: "application/json",
+			body: model.Metrics{
+				ID:     "CPUutilization",
+				MType:  "gauge",
+				Value:  float64Ptr(12.5),
+				Labels: model.Labels{"cpu core": "1"},
+			},
+			setupMock:      func() {},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "invalid labels\n",
+		},
 		{
 			name:           "unsupported content type",
 			contentType:    "text/plain",
@@ -432,6 +579,32 @@ func TestMetricsHandler_SentMetricPost(t *testing.T) {
 				}
 			},
 		},
+		{
+			name:        "success histogram",
+			contentType: "application/json",
+			body: model.Metrics{
+				ID:    "latency",
+				MType: "histogram",
+			},
+			setupMock: func() {
+				mockService.EXPECT().GetHistogram(gomock.Any(), "latency").Return(model.HistogramValue{
+					Buckets: []float64{1, 2, 4}, Counts: []int64{2, 2, 0, 1}, Sum: 7, Count: 5,
+				}, nil)
+			},
+			expectedStatus: http.StatusOK,
+			checkResponse: func(t *testing.T, body string) {
+				var resp model.Metrics
+				if err := json.Unmarshal([]byte(body), &resp); err != nil {
+					t.Errorf("failed to unmarshal response: %v", err)
+				}
+				if resp.Histogram == nil || resp.Histogram.Count != 5 {
+					t.Errorf("expected histogram with count 5, got %v", resp.Histogram)
+				}
+				if resp.Quantiles["0.5"] != 1.25 || resp.Quantiles["0.99"] != 4 {
+					t.Errorf("unexpected quantiles %v", resp.Quantiles)
+				}
+			},
+		},
 		{
 			name:           "unsupported content type",
 			contentType:    "text/plain",
@@ -467,7 +640,7 @@ func TestMetricsHandler_SentMetricPost(t *testing.T) {
 				MType: "gauge",
 			},
 			setupMock: func() {
-				mockService.EXPECT().GetGauge(gomock.Any(), "test_gauge").Return(0.0, errors.New("not found"))
+				mockService.EXPECT().GetGauge(gomock.Any(), "test_gauge").Return(0.0, service.ErrNotFound)
 			},
 			expectedStatus: http.StatusNotFound,
 			expectedBody:   "metric not found\n",
@@ -480,11 +653,24 @@ func TestMetricsHandler_SentMetricPost(t *testing.T) {
 				MType: "counter",
 			},
 			setupMock: func() {
-				mockService.EXPECT().GetCounter(gomock.Any(), "test_counter").Return(int64(0), errors.New("not found"))
+				mockService.EXPECT().GetCounter(gomock.Any(), "test_counter").Return(int64(0), service.ErrNotFound)
 			},
 			expectedStatus: http.StatusNotFound,
 			expectedBody:   "metric not found\n",
 		},
+		{
+			name:        "storage unavailable",
+			contentType: "application/json",
+			body: model.Metrics{
+				ID:    "test_gauge",
+				MType: "gauge",
+			},
+			setupMock: func() {
+				mockService.EXPECT().GetGauge(gomock.Any(), "test_gauge").Return(0.0, service.ErrUnavailable)
+			},
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedBody:   "failed to get metric\n",
+		},
 	}
 
 	for _, tt := range tests {
@@ -524,6 +710,435 @@ func TestMetricsHandler_SentMetricPost(t *testing.T) {
 	}
 }
 
+func TestMetricsHandler_ListMetrics(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockService := mocks.NewMockMetricsService(ctrl)
+	logger := zap.NewNop()
+	handler := NewMetricsHandler(mockService, logger)
+
+	tests := []struct {
+		name           string
+		url            string
+		setupMock      func()
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name: "success without filter",
+			url:  "/values",
+			setupMock: func() {
+				mockService.EXPECT().
+					ListMetrics(gomock.Any(), model.MetricsFilter{}).
+					Return([]model.Metrics{
+						{ID: "PollCount", MType: model.Counter, Delta: int64Ptr(5)},
+						{ID: "HeapAlloc", MType: model.Gauge, Value: float64Ptr(1.5)},
+					}, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   "[{\"id\":\"PollCount\",\"type\":\"counter\",\"delta\":5},{\"id\":\"HeapAlloc\",\"type\":\"gauge\",\"value\":1.5}]\n",
+		},
+		{
+			name: "success with filter and pagination",
+			url:  "/values?prefix=CPU&type=gauge&limit=10&offset=20",
+			setupMock: func() {
+				mockService.EXPECT().
+					ListMetrics(gomock.Any(), model.MetricsFilter{Prefix: "CPU", MType: model.Gauge, Limit: 10, Offset: 20}).
+					Return([]model.Metrics{}, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   "[]\n",
+		},
+		{
+			name: "success with label matchers",
+			url:  "/values?labels=" + url.QueryEscape(`host="a"`),
+			setupMock: func() {
+				mockService.EXPECT().
+					ListMetrics(gomock.Any(), model.MetricsFilter{
+						Labels: []model.LabelMatcher{{Name: "host", Op: model.MatchEqual, Value: "a"}},
+					}).
+					Return([]model.Metrics{
+						{ID: "CPUutilization", MType: model.Gauge, Value: float64Ptr(1.5), Labels: model.Labels{"host": "a"}},
+					}, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   "[{\"id\":\"CPUutilization\",\"type\":\"gauge\",\"value\":1.5,\"labels\":{\"host\":\"a\"}}]\n",
+		},
+		{
+			name:           "invalid label matchers",
+			url:            "/values?labels=host",
+			setupMock:      func() {},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "invalid labels parameter\n",
+		},
+		{
+			name:           "invalid metric type",
+			url:            "/values?type=invalid",
+			setupMock:      func() {},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "invalid metric type\n",
+		},
+		{
+			name:           "negative limit",
+			url:            "/values?limit=-1",
+			setupMock:      func() {},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "invalid limit parameter\n",
+		},
+		{
+			name:           "invalid offset",
+			url:            "/values?offset=abc",
+			setupMock:      func() {},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "invalid offset parameter\n",
+		},
+		{
+			name: "storage error",
+			url:  "/values",
+			setupMock: func() {
+				mockService.EXPECT().
+					ListMetrics(gomock.Any(), gomock.Any()).
+					Return(nil, errors.New("db error"))
+			},
+			expectedStatus: http.StatusInternalServerError,
+			expectedBody:   "error listing metrics\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.setupMock()
+
+			req := httptest.NewRequest("GET", tt.url, nil)
+			w := httptest.NewRecorder()
+
+			handler.ListMetrics(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+
+			if w.Body.String() != tt.expectedBody {
+				t.Errorf("expected body %q, got %q", tt.expectedBody, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestMetricsHandler_UpdateMetrics_Idempotency(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockService := mocks.NewMockMetricsService(ctrl)
+	handler := NewMetricsHandler(mockService, zap.NewNop())
+
+	body := `[{"id":"PollCount","type":"counter","delta":1}]`
+	batch := []model.Metrics{{ID: "PollCount", MType: model.Counter, Delta: int64Ptr(1)}}
+
+	tests := []struct {
+		name             string
+		key              string
+		applied          bool
+		expectedReplayed string
+	}{
+		{name: "first attempt", key: "batch-1", applied: true, expectedReplayed: ""},
+		{name: "replayed batch", key: "batch-1", applied: false, expectedReplayed: "true"},
+		{name: "without key", key: "", applied: true, expectedReplayed: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService.EXPECT().
+				UpdateMetricsOnce(gomock.Any(), tt.key, batch, gomock.Any()).
+				Return(tt.applied, nil)
+
+			req := httptest.NewRequest("POST", "/updates/", bytes.NewBufferString(body))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.key != "" {
+				req.Header.Set(IdempotencyKeyHeader, tt.key)
+			}
+			w := httptest.NewRecorder()
+
+			handler.UpdateMetrics(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Errorf("expected status %d, got %d", http.StatusOK, w.Code)
+			}
+			if got := w.Header().Get(IdempotentReplayedHeader); got != tt.expectedReplayed {
+				t.Errorf("expected %s header %q, got %q", IdempotentReplayedHeader, tt.expectedReplayed, got)
+			}
+		})
+	}
+}
+
+func TestMetricsHandler_GetHistory(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockService := mocks.NewMockMetricsService(ctrl)
+	logger := zap.NewNop()
+	handler := NewMetricsHandler(mockService, logger)
+
+	tests := []struct {
+		name           string
+		url            string
+		setupMock      func()
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name: "success with range and step",
+			url:  "/history/gauge/HeapAlloc?from=100&to=200&step=10s",
+			setupMock: func() {
+				mockService.EXPECT().
+					GetHistory(gomock.Any(), "gauge", "HeapAlloc", time.Unix(100, 0), time.Unix(200, 0), 10*time.Second).
+					Return([]model.MetricSample{{TS: 100_000, Value: float64Ptr(1.5)}}, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   "[{\"ts\":100000,\"value\":1.5}]\n",
+		},
+		{
+			name: "success with RFC3339 range",
+			url:  "/history/counter/PollCount?from=2024-01-01T00:00:00Z&to=2024-01-01T01:00:00Z",
+			setupMock: func() {
+				from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+				mockService.EXPECT().
+					GetHistory(gomock.Any(), "counter", "PollCount", from, from.Add(time.Hour), time.Duration(0)).
+					Return([]model.MetricSample{}, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   "[]\n",
+		},
+		{
+			name:           "invalid metric type",
+			url:            "/history/invalid/HeapAlloc",
+			setupMock:      func() {},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "invalid metric type\n",
+		},
+		{
+			name:           "invalid from",
+			url:            "/history/gauge/HeapAlloc?from=yesterday",
+			setupMock:      func() {},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "invalid from parameter\n",
+		},
+		{
+			name:           "invalid step",
+			url:            "/history/gauge/HeapAlloc?step=often",
+			setupMock:      func() {},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "invalid step parameter\n",
+		},
+		{
+			name: "storage error",
+			url:  "/history/gauge/HeapAlloc?from=100&to=200",
+			setupMock: func() {
+				mockService.EXPECT().
+					GetHistory(gomock.Any(), "gauge", "HeapAlloc", gomock.Any(), gomock.Any(), gomock.Any()).
+					Return(nil, errors.New("db error"))
+			},
+			expectedStatus: http.StatusInternalServerError,
+			expectedBody:   "error getting metric history\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.setupMock()
+
+			r := chi.NewRouter()
+			r.Get("/history/{metricType}/{metricName}", handler.GetHistory)
+
+			req := httptest.NewRequest("GET", tt.url, nil)
+			w := httptest.NewRecorder()
+
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+
+			if w.Body.String() != tt.expectedBody {
+				t.Errorf("expected body %q, got %q", tt.expectedBody, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestMetricsHandler_DeleteMetric(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockService := mocks.NewMockMetricsService(ctrl)
+	handler := NewMetricsHandler(mockService, zap.NewNop())
+
+	tests := []struct {
+		name               string
+		metricType         string
+		metricName         string
+		setupMock          func()
+		expectedStatus     int
+		expectedBody       string
+		expectedRetryAfter string
+	}{
+		{
+			name:       "success",
+			metricType: "gauge",
+			metricName: "CPUutilization7",
+			setupMock: func() {
+				mockService.EXPECT().DeleteMetric(gomock.Any(), model.Gauge, "CPUutilization7", gomock.Any()).Return(nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   "",
+		},
+		{
+			name:           "invalid metric type",
+			metricType:     "invalid",
+			metricName:     "test",
+			setupMock:      func() {},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "invalid metric type\n",
+		},
+		{
+			name:       "not found",
+			metricType: "counter",
+			metricName: "nonexistent",
+			setupMock: func() {
+				mockService.EXPECT().DeleteMetric(gomock.Any(), model.Counter, "nonexistent", gomock.Any()).
+					Return(fmt.Errorf("failed to delete metric: %w", service.ErrNotFound))
+			},
+			expectedStatus: http.StatusNotFound,
+			expectedBody:   "error deleting metric\n",
+		},
+		{
+			name:       "storage unavailable",
+			metricType: "counter",
+			metricName: "PollCount",
+			setupMock: func() {
+				mockService.EXPECT().DeleteMetric(gomock.Any(), model.Counter, "PollCount", gomock.Any()).
+					Return(fmt.Errorf("failed to delete metric: %w", service.ErrUnavailable))
+			},
+			expectedStatus:     http.StatusServiceUnavailable,
+			expectedBody:       "error deleting metric\n",
+			expectedRetryAfter: "5",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.setupMock()
+
+			r := chi.NewRouter()
+			r.Delete("/value/{metricType}/{metricName}", handler.DeleteMetric)
+
+			req := httptest.NewRequest("DELETE", fmt.Sprintf("/value/%s/%s", tt.metricType, tt.metricName), nil)
+			w := httptest.NewRecorder()
+
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+
+			if w.Body.String() != tt.expectedBody {
+				t.Errorf("expected body %q, got %q", tt.expectedBody, w.Body.String())
+			}
+
+			if got := w.Header().Get("Retry-After"); got != tt.expectedRetryAfter {
+				t.Errorf("expected Retry-After %q, got %q", tt.expectedRetryAfter, got)
+			}
+		})
+	}
+}
+
+func TestMetricsHandler_DeleteMetrics(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockService := mocks.NewMockMetricsService(ctrl)
+	handler := NewMetricsHandler(mockService, zap.NewNop())
+
+	tests := []struct {
+		name           string
+		url            string
+		setupMock      func()
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name: "success by prefix",
+			url:  "/values?prefix=CPUutilization",
+			setupMock: func() {
+				mockService.EXPECT().
+					DeleteMetrics(gomock.Any(), model.MetricsFilter{Prefix: "CPUutilization"}, gomock.Any()).
+					Return([]model.Metrics{
+						{ID: "CPUutilization1", MType: model.Gauge},
+						{ID: "CPUutilization7", MType: model.Gauge},
+					}, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   "[{\"id\":\"CPUutilization1\",\"type\":\"gauge\"},{\"id\":\"CPUutilization7\",\"type\":\"gauge\"}]\n",
+		},
+		{
+			name: "success by prefix and type",
+			url:  "/values?prefix=Poll&type=counter",
+			setupMock: func() {
+				mockService.EXPECT().
+					DeleteMetrics(gomock.Any(), model.MetricsFilter{Prefix: "Poll", MType: model.Counter}, gomock.Any()).
+					Return([]model.Metrics{}, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   "[]\n",
+		},
+		{
+			name:           "missing prefix",
+			url:            "/values",
+			setupMock:      func() {},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "prefix parameter is required\n",
+		},
+		{
+			name:           "invalid metric type",
+			url:            "/values?prefix=CPU&type=invalid",
+			setupMock:      func() {},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   "invalid metric type\n",
+		},
+		{
+			name: "storage error",
+			url:  "/values?prefix=CPU",
+			setupMock: func() {
+				mockService.EXPECT().
+					DeleteMetrics(gomock.Any(), gomock.Any(), gomock.Any()).
+					Return(nil, errors.New("db error"))
+			},
+			expectedStatus: http.StatusInternalServerError,
+			expectedBody:   "error deleting metrics\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.setupMock()
+
+			req := httptest.NewRequest("DELETE", tt.url, nil)
+			w := httptest.NewRecorder()
+
+			handler.DeleteMetrics(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+
+			if w.Body.String() != tt.expectedBody {
+				t.Errorf("expected body %q, got %q", tt.expectedBody, w.Body.String())
+			}
+		})
+	}
+}
+
 func Test_isValidMetricType(t *testing.T) {
 	tests := []struct {
 		name       string
@@ -532,6 +1147,7 @@ func Test_isValidMetricType(t *testing.T) {
 	}{
 		{"gauge valid", "gauge", true},
 		{"counter valid", "counter", true},
+		{"histogram valid", "histogram", true},
 		{"invalid type", "invalid", false},
 		{"empty type", "", false},
 	}
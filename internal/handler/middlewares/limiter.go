@@ -1,27 +1,82 @@
 package middlewares
 
 import (
+	"context"
 	"net/http"
 
 	"go.uber.org/zap"
 )
 
-func RateLimiter(maxConcurrent int, log *zap.Logger) func(next http.Handler) http.Handler {
-	semaphore := make(chan struct{}, maxConcurrent)
+// Limiter - общий бюджет одновременно обрабатываемых запросов.
+// Используется HTTP-мидлварью и сетевыми приемниками метрик,
+// чтобы все источники нагрузки делили один лимит RateLimit.
+// Лимит <= 0 означает отсутствие ограничения.
+type Limiter struct {
+	semaphore chan struct{}
+}
+
+func NewLimiter(maxConcurrent int) *Limiter {
+	if maxConcurrent <= 0 {
+		return &Limiter{}
+	}
+	return &Limiter{semaphore: make(chan struct{}, maxConcurrent)}
+}
+
+// Enabled сообщает, ограничено ли число одновременных запросов
+func (l *Limiter) Enabled() bool {
+	return l.semaphore != nil
+}
+
+// TryAcquire занимает слот без ожидания
+func (l *Limiter) TryAcquire() bool {
+	if !l.Enabled() {
+		return true
+	}
+
+	select {
+	case l.semaphore <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// Acquire ждет освобождения слота или отмены контекста
+func (l *Limiter) Acquire(ctx context.Context) error {
+	if !l.Enabled() {
+		return nil
+	}
+
+	select {
+	case l.semaphore <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Release освобождает слот, занятый TryAcquire или Acquire
+func (l *Limiter) Release() {
+	if !l.Enabled() {
+		return
+	}
+	<-l.semaphore
+}
+
+func RateLimiter(limiter *Limiter, log *zap.Logger) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
-			if maxConcurrent <= 0 {
+			if !limiter.Enabled() {
 				log.Warn("Rate limit set to 0 - all requests will be rejected")
 				next.ServeHTTP(w, r)
 				return
 			}
 
-			select {
-			case semaphore <- struct{}{}:
-				defer func() { <-semaphore }()
+			if limiter.TryAcquire() {
+				defer limiter.Release()
 				next.ServeHTTP(w, r)
-			default:
+			} else {
 				http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
 			}
 		})
@@ -0,0 +1,312 @@
+package otlphandler
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/model"
+)
+
+// Ограничения состояния кумулятивных сумм
+const (
+	// seriesTTL - ряд без точек дольше seriesTTL забывается
+	seriesTTL = time.Hour
+	// sweepInterval - как часто ищутся забытые ряды
+	sweepInterval = time.Minute
+	// maxSeries - сколько рядов хранится; при превышении вытесняются давно не обновлявшиеся
+	maxSeries = 100000
+)
+
+// cumulativeState - последнее сохраненное значение кумулятивной суммы для одного ряда
+type cumulativeState struct {
+	start int64
+	value int64
+	seen  time.Time
+}
+
+// baselines - новые значения кумулятивных сумм, которые запоминаются
+// только после сохранения приращений
+type baselines map[string]cumulativeState
+
+// converter преобразует метрики OTLP в модель хранилища.
+// Для кумулятивных монотонных сумм хранит последнее сохраненное значение
+// каждого ряда, чтобы сохранять в counter только приращение.
+type converter struct {
+	// exportMu выполняет экспорты по очереди: иначе два запроса посчитали бы
+	// приращение от одной базы и сохранили его дважды
+	exportMu sync.Mutex
+
+	mu     sync.Mutex
+	series map[string]cumulativeState
+	// since - с этого момента известны все ряды. Неизвестный ряд со стартом
+	// не раньше since новый и сохраняется целиком; более ранний мог быть
+	// учтен до перезапуска сервера или вытеснения, его точка становится базой.
+	since     time.Time
+	lastSweep time.Time
+	limit     int
+	now       func() time.Time
+}
+
+func newConverter() *converter {
+	now := time.Now()
+	return &converter{
+		series:    make(map[string]cumulativeState),
+		since:     now,
+		lastSweep: now,
+		limit:     maxSeries,
+		now:       time.Now,
+	}
+}
+
+// export преобразует метрики, сохраняет их через save и после успешного
+// сохранения запоминает новые значения кумулятивных сумм. При ошибке save
+// состояние не меняется, и повтор того же запроса даст те же приращения.
+// Возвращает число отброшенных точек.
+func (c *converter) export(resourceMetrics []*metricspb.ResourceMetrics, save func([]model.Metrics) error) (int64, error) {
+	c.exportMu.Lock()
+	defer c.exportMu.Unlock()
+
+	metrics, next, rejected := c.convert(resourceMetrics)
+	if len(metrics) > 0 {
+		if err := save(metrics); err != nil {
+			return rejected, err
+		}
+	}
+
+	c.commit(next)
+	return rejected, nil
+}
+
+// commit запоминает сохраненные значения кумулятивных сумм и забывает
+// ряды, не обновлявшиеся дольше seriesTTL или не помещающиеся в limit
+func (c *converter) commit(next baselines) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	for id, state := range next {
+		state.seen = now
+		c.series[id] = state
+	}
+
+	if now.Sub(c.lastSweep) >= sweepInterval {
+		c.lastSweep = now
+		for id, state := range c.series {
+			if now.Sub(state.seen) > seriesTTL {
+				delete(c.series, id)
+				c.since = now
+			}
+		}
+	}
+
+	if len(c.series) > c.limit {
+		ids := make([]string, 0, len(c.series))
+		for id := range c.series {
+			ids = append(ids, id)
+		}
+		sort.Slice(ids, func(i, j int) bool {
+			return c.series[ids[i]].seen.Before(c.series[ids[j]].seen)
+		})
+		for _, id := range ids[:len(ids)-c.limit] {
+			delete(c.series, id)
+		}
+		c.since = now
+	}
+}
+
+// convert возвращает метрики хранилища, новые значения кумулятивных сумм
+// для commit и число отброшенных точек. Состояние converter не меняется.
+// Gauge становится gauge, монотонная сумма - counter (кумулятивная переводится в дельты),
+// немонотонная кумулятивная сумма - gauge. Остальные типы отбрасываются.
+func (c *converter) convert(resourceMetrics []*metricspb.ResourceMetrics) ([]model.Metrics, baselines, int64) {
+	var (
+		result   []model.Metrics
+		rejected int64
+	)
+	next := make(baselines)
+
+	for _, rm := range resourceMetrics {
+		prefix := formatAttributes(rm.GetResource().GetAttributes())
+
+		for _, sm := range rm.GetScopeMetrics() {
+			for _, metric := range sm.GetMetrics() {
+				converted, dropped := c.convertMetric(prefix, metric, next)
+				result = append(result, converted...)
+				rejected += dropped
+			}
+		}
+	}
+
+	return result, next, rejected
+}
+
+func (c *converter) convertMetric(prefix string, metric *metricspb.Metric, next baselines) ([]model.Metrics, int64) {
+	switch data := metric.GetData().(type) {
+	case *metricspb.Metric_Gauge:
+		return convertGauges(prefix, metric.GetName(), data.Gauge.GetDataPoints()), 0
+
+	case *metricspb.Metric_Sum:
+		sum := data.Sum
+		cumulative := sum.GetAggregationTemporality() == metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE
+		delta := sum.GetAggregationTemporality() == metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA
+
+		switch {
+		case sum.GetIsMonotonic() && cumulative:
+			return c.convertCumulative(prefix, metric.GetName(), sum.GetDataPoints(), next), 0
+		case sum.GetIsMonotonic() && delta:
+			return convertDeltas(prefix, metric.GetName(), sum.GetDataPoints()), 0
+		case cumulative:
+			return convertGauges(prefix, metric.GetName(), sum.GetDataPoints()), 0
+		}
+		return nil, int64(len(sum.GetDataPoints()))
+
+	case *metricspb.Metric_Histogram:
+		return nil, int64(len(data.Histogram.GetDataPoints()))
+	case *metricspb.Metric_ExponentialHistogram:
+		return nil, int64(len(data.ExponentialHistogram.GetDataPoints()))
+	case *metricspb.Metric_Summary:
+		return nil, int64(len(data.Summary.GetDataPoints()))
+	}
+
+	return nil, 0
+}
+
+func convertGauges(prefix, name string, points []*metricspb.NumberDataPoint) []model.Metrics {
+	result := make([]model.Metrics, 0, len(points))
+	for _, point := range points {
+		value := pointFloat(point)
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			continue
+		}
+		result = append(result, model.Metrics{
+			ID:    metricID(prefix, name, point.GetAttributes()),
+			MType: model.Gauge,
+			Value: &value,
+		})
+	}
+	return result
+}
+
+func convertDeltas(prefix, name string, points []*metricspb.NumberDataPoint) []model.Metrics {
+	result := make([]model.Metrics, 0, len(points))
+	for _, point := range points {
+		delta := pointInt(point)
+		if delta <= 0 {
+			continue
+		}
+		result = append(result, model.Metrics{
+			ID:    metricID(prefix, name, point.GetAttributes()),
+			MType: model.Counter,
+			Delta: &delta,
+		})
+	}
+	return result
+}
+
+// convertCumulative переводит кумулятивные значения в приращения и складывает
+// новые значения рядов в next. Уменьшение значения или смена start_time_unix_nano
+// считаются сбросом счётчика, и значение сохраняется целиком. Первая точка
+// неизвестного ряда сохраняется целиком, только если ряд начат не раньше since,
+// иначе она лишь запоминается как база.
+func (c *converter) convertCumulative(prefix, name string, points []*metricspb.NumberDataPoint, next baselines) []model.Metrics {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	result := make([]model.Metrics, 0, len(points))
+	for _, point := range points {
+		id := metricID(prefix, name, point.GetAttributes())
+		current := pointInt(point)
+		start := int64(point.GetStartTimeUnixNano())
+
+		prev, ok := next[id]
+		if !ok {
+			prev, ok = c.series[id]
+		}
+
+		var delta int64
+		switch {
+		case ok && prev.start == start && current >= prev.value:
+			delta = current - prev.value
+		case ok:
+			delta = current
+		case start >= c.since.UnixNano():
+			delta = current
+		}
+		next[id] = cumulativeState{start: start, value: current}
+
+		if delta <= 0 {
+			continue
+		}
+		result = append(result, model.Metrics{
+			ID:    id,
+			MType: model.Counter,
+			Delta: &delta,
+		})
+	}
+	return result
+}
+
+func pointFloat(point *metricspb.NumberDataPoint) float64 {
+	if v, ok := point.GetValue().(*metricspb.NumberDataPoint_AsInt); ok {
+		return float64(v.AsInt)
+	}
+	return point.GetAsDouble()
+}
+
+func pointInt(point *metricspb.NumberDataPoint) int64 {
+	if v, ok := point.GetValue().(*metricspb.NumberDataPoint_AsDouble); ok {
+		if math.IsNaN(v.AsDouble) || math.IsInf(v.AsDouble, 0) {
+			return 0
+		}
+		return int64(v.AsDouble)
+	}
+	return point.GetAsInt()
+}
+
+// metricID собирает имя метрики: атрибуты ресурса в префиксе,
+// атрибуты точки - в суффиксе, например {service.name=api}http.requests{method=GET}
+func metricID(prefix, name string, attributes []*commonpb.KeyValue) string {
+	return prefix + name + formatAttributes(attributes)
+}
+
+// formatAttributes возвращает отсортированные по ключу атрибуты в виде {k1=v1,k2=v2}
+// или пустую строку, если атрибутов нет
+func formatAttributes(attributes []*commonpb.KeyValue) string {
+	if len(attributes) == 0 {
+		return ""
+	}
+
+	sorted := make([]*commonpb.KeyValue, len(attributes))
+	copy(sorted, attributes)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].GetKey() < sorted[j].GetKey()
+	})
+
+	pairs := make([]string, 0, len(sorted))
+	for _, kv := range sorted {
+		pairs = append(pairs, kv.GetKey()+"="+formatValue(kv.GetValue()))
+	}
+
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatValue(value *commonpb.AnyValue) string {
+	switch v := value.GetValue().(type) {
+	case *commonpb.AnyValue_StringValue:
+		return v.StringValue
+	case *commonpb.AnyValue_IntValue:
+		return strconv.FormatInt(v.IntValue, 10)
+	case *commonpb.AnyValue_DoubleValue:
+		return strconv.FormatFloat(v.DoubleValue, 'g', -1, 64)
+	case *commonpb.AnyValue_BoolValue:
+		return strconv.FormatBool(v.BoolValue)
+	}
+	return ""
+}
@@ -0,0 +1,13 @@
+package otlphandler
+
+import (
+	"context"
+
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/model"
+)
+
+// MetricsUpdater определяет контракт для пакетного сохранения метрик.
+type MetricsUpdater interface {
+	// UpdateMetrics сохраняет пакет метрик, ipAddr - адрес отправителя для аудита.
+	UpdateMetrics(ctx context.Context, metrics []model.Metrics, ipAddr string) error
+}
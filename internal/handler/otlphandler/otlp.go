@@ -0,0 +1,121 @@
+// Package otlphandler предоставляет HTTP-хендлер приёма метрик по протоколу OTLP/HTTP
+// через эндпоинт /v1/metrics. Поддерживаются кодировки protobuf и JSON.
+package otlphandler
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/model"
+)
+
+// Типы содержимого OTLP/HTTP
+const (
+	ContentTypeProtobuf = "application/x-protobuf"
+	ContentTypeJSON     = "application/json"
+)
+
+// OTLPHandler принимает экспорт метрик от OpenTelemetry SDK и коллекторов.
+type OTLPHandler struct {
+	updater   MetricsUpdater
+	converter *converter
+	log       *zap.Logger
+}
+
+// NewOTLPHandler создаёт новый экземпляр OTLPHandler.
+// Принимает сервис сохранения метрик MetricsUpdater и логгер zap.Logger.
+func NewOTLPHandler(updater MetricsUpdater, log *zap.Logger) *OTLPHandler {
+	return &OTLPHandler{
+		updater:   updater,
+		converter: newConverter(),
+		log:       log,
+	}
+}
+
+// ExportMetrics обрабатывает POST-запрос к /v1/metrics.
+// Тело - ExportMetricsServiceRequest в кодировке protobuf или JSON, ответ возвращается в той же кодировке.
+// Gauge сохраняются как gauge; монотонные суммы - как counter,
+// при этом кумулятивные значения переводятся в приращения. Значения рядов
+// запоминаются только после сохранения, поэтому повтор запроса после 500
+// не теряет приращение. Ряд, начатый до запуска сервера, при первой точке
+// только запоминается: его значение могло быть сохранено до перезапуска.
+// Атрибуты ресурса становятся префиксом имени метрики, атрибуты точки - суффиксом.
+// Точки неподдерживаемых типов учитываются в partial_success ответа.
+// Возвращает 415 для неизвестного Content-Type, 400 для некорректного тела,
+// 500 при ошибке сохранения.
+func (h *OTLPHandler) ExportMetrics(w http.ResponseWriter, r *http.Request) {
+	contentType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || (contentType != ContentTypeProtobuf && contentType != ContentTypeJSON) {
+		h.log.Error("unsupported content type", zap.String("content_type", r.Header.Get("Content-Type")))
+		http.Error(w, "unsupported content type", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		h.log.Error("failed to read otlp request", zap.Error(err))
+		http.Error(w, "failed to read request body", http.StatusBadRequest)
+		return
+	}
+
+	var req colmetricspb.ExportMetricsServiceRequest
+	if contentType == ContentTypeJSON {
+		err = protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(body, &req)
+	} else {
+		err = proto.Unmarshal(body, &req)
+	}
+	if err != nil {
+		h.log.Error("failed to decode otlp request", zap.Error(err))
+		http.Error(w, "invalid OTLP request", http.StatusBadRequest)
+		return
+	}
+
+	rejected, err := h.converter.export(req.GetResourceMetrics(), func(metrics []model.Metrics) error {
+		return h.updater.UpdateMetrics(r.Context(), metrics, r.RemoteAddr)
+	})
+	if errors.Is(err, model.ErrBucketsMismatch) {
+		h.log.Warn("otlp histogram buckets do not match stored histogram", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		h.log.Error("failed to save otlp metrics", zap.Error(err))
+		http.Error(w, "failed to save metrics", http.StatusInternalServerError)
+		return
+	}
+
+	resp := &colmetricspb.ExportMetricsServiceResponse{}
+	if rejected > 0 {
+		h.log.Warn("otlp data points rejected", zap.Int64("rejected", rejected))
+		resp.PartialSuccess = &colmetricspb.ExportMetricsPartialSuccess{
+			RejectedDataPoints: rejected,
+			ErrorMessage:       fmt.Sprintf("%d data point(s) of unsupported type", rejected),
+		}
+	}
+
+	var data []byte
+	if contentType == ContentTypeJSON {
+		data, err = protojson.Marshal(resp)
+	} else {
+		data, err = proto.Marshal(resp)
+	}
+	if err != nil {
+		h.log.Error("failed to encode otlp response", zap.Error(err))
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(data); err != nil {
+		h.log.Error("failed to write otlp response", zap.Error(err))
+	}
+}
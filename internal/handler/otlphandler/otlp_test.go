@@ -0,0 +1,336 @@
+package otlphandler
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/mocks"
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/model"
+)
+
+func int64Ptr(v int64) *int64       { return &v }
+func float64Ptr(v float64) *float64 { return &v }
+
+func stringAttr(key, value string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{
+		Key:   key,
+		Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: value}},
+	}
+}
+
+func cumulativeSum(name string, start uint64, value int64) *metricspb.Metric {
+	return &metricspb.Metric{
+		Name: name,
+		Data: &metricspb.Metric_Sum{Sum: &metricspb.Sum{
+			AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+			IsMonotonic:            true,
+			DataPoints: []*metricspb.NumberDataPoint{{
+				StartTimeUnixNano: start,
+				Value:             &metricspb.NumberDataPoint_AsInt{AsInt: value},
+			}},
+		}},
+	}
+}
+
+func exportRequest(metrics ...*metricspb.Metric) *colmetricspb.ExportMetricsServiceRequest {
+	return &colmetricspb.ExportMetricsServiceRequest{
+		ResourceMetrics: []*metricspb.ResourceMetrics{{
+			Resource: &resourcepb.Resource{
+				Attributes: []*commonpb.KeyValue{
+					stringAttr("service.name", "api"),
+					stringAttr("host.name", "h1"),
+				},
+			},
+			ScopeMetrics: []*metricspb.ScopeMetrics{{Metrics: metrics}},
+		}},
+	}
+}
+
+// convertAndCommit преобразует метрики и запоминает значения рядов, как после успешного сохранения
+func convertAndCommit(c *converter, resourceMetrics []*metricspb.ResourceMetrics) ([]model.Metrics, int64) {
+	metrics, next, rejected := c.convert(resourceMetrics)
+	c.commit(next)
+	return metrics, rejected
+}
+
+// startAfter возвращает время старта ряда, начатого после создания converter
+func startAfter(c *converter) uint64 {
+	return uint64(c.since.Add(time.Second).UnixNano())
+}
+
+func TestConverter_Convert(t *testing.T) {
+	c := newConverter()
+	start := startAfter(c)
+
+	gauge := &metricspb.Metric{
+		Name: "memory.usage",
+		Data: &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{
+			DataPoints: []*metricspb.NumberDataPoint{{
+				Attributes: []*commonpb.KeyValue{stringAttr("state", "used")},
+				Value:      &metricspb.NumberDataPoint_AsDouble{AsDouble: 1.5},
+			}},
+		}},
+	}
+	histogram := &metricspb.Metric{
+		Name: "latency",
+		Data: &metricspb.Metric_Histogram{Histogram: &metricspb.Histogram{
+			DataPoints: []*metricspb.HistogramDataPoint{{}, {}},
+		}},
+	}
+
+	metrics, rejected := convertAndCommit(c, exportRequest(gauge, cumulativeSum("requests", start, 10), histogram).ResourceMetrics)
+	assert.Equal(t, int64(2), rejected)
+	assert.Equal(t, []model.Metrics{
+		{ID: "{host.name=h1,service.name=api}memory.usage{state=used}", MType: model.Gauge, Value: float64Ptr(1.5)},
+		{ID: "{host.name=h1,service.name=api}requests", MType: model.Counter, Delta: int64Ptr(10)},
+	}, metrics)
+
+	// Следующее кумулятивное значение сохраняется как приращение
+	metrics, _ = convertAndCommit(c, exportRequest(cumulativeSum("requests", start, 25)).ResourceMetrics)
+	assert.Equal(t, []model.Metrics{
+		{ID: "{host.name=h1,service.name=api}requests", MType: model.Counter, Delta: int64Ptr(15)},
+	}, metrics)
+
+	// Неизменившееся значение не порождает метрик
+	metrics, _ = convertAndCommit(c, exportRequest(cumulativeSum("requests", start, 25)).ResourceMetrics)
+	assert.Empty(t, metrics)
+
+	// Сброс счётчика: новое время старта, значение сохраняется целиком
+	metrics, _ = convertAndCommit(c, exportRequest(cumulativeSum("requests", start+1, 4)).ResourceMetrics)
+	assert.Equal(t, []model.Metrics{
+		{ID: "{host.name=h1,service.name=api}requests", MType: model.Counter, Delta: int64Ptr(4)},
+	}, metrics)
+}
+
+func TestConverter_DeltaAndNonMonotonicSums(t *testing.T) {
+	c := newConverter()
+
+	deltaSum := &metricspb.Metric{
+		Name: "bytes",
+		Data: &metricspb.Metric_Sum{Sum: &metricspb.Sum{
+			AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA,
+			IsMonotonic:            true,
+			DataPoints: []*metricspb.NumberDataPoint{{
+				Value: &metricspb.NumberDataPoint_AsInt{AsInt: 7},
+			}},
+		}},
+	}
+	upDown := &metricspb.Metric{
+		Name: "queue.size",
+		Data: &metricspb.Metric_Sum{Sum: &metricspb.Sum{
+			AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+			DataPoints: []*metricspb.NumberDataPoint{{
+				Value: &metricspb.NumberDataPoint_AsInt{AsInt: -3},
+			}},
+		}},
+	}
+
+	metrics, rejected := convertAndCommit(c, []*metricspb.ResourceMetrics{{
+		ScopeMetrics: []*metricspb.ScopeMetrics{{Metrics: []*metricspb.Metric{deltaSum, upDown}}},
+	}})
+
+	assert.Zero(t, rejected)
+	assert.Equal(t, []model.Metrics{
+		{ID: "bytes", MType: model.Counter, Delta: int64Ptr(7)},
+		{ID: "queue.size", MType: model.Gauge, Value: float64Ptr(-3)},
+	}, metrics)
+}
+
+func TestConverter_SeriesStartedBeforeRestart(t *testing.T) {
+	c := newConverter()
+	before := uint64(c.since.Add(-time.Hour).UnixNano())
+
+	// Значение могло быть сохранено до перезапуска: первая точка только запоминается
+	metrics, _ := convertAndCommit(c, exportRequest(cumulativeSum("requests", before, 100)).ResourceMetrics)
+	assert.Empty(t, metrics)
+
+	metrics, _ = convertAndCommit(c, exportRequest(cumulativeSum("requests", before, 104)).ResourceMetrics)
+	assert.Equal(t, []model.Metrics{
+		{ID: "{host.name=h1,service.name=api}requests", MType: model.Counter, Delta: int64Ptr(4)},
+	}, metrics)
+}
+
+func TestConverter_ForgetsSeries(t *testing.T) {
+	c := newConverter()
+	now := c.since
+	c.now = func() time.Time { return now }
+	c.limit = 2
+
+	start := startAfter(c)
+	convertAndCommit(c, exportRequest(
+		cumulativeSum("a", start, 1),
+		cumulativeSum("b", start, 1),
+	).ResourceMetrics)
+
+	now = now.Add(time.Minute)
+	convertAndCommit(c, exportRequest(cumulativeSum("c", start, 1)).ResourceMetrics)
+	assert.Len(t, c.series, 2)
+	assert.Contains(t, c.series, "{host.name=h1,service.name=api}c")
+
+	// Вытесненный ряд, начатый раньше вытеснения, при возвращении становится базой
+	metrics, _ := convertAndCommit(c, exportRequest(cumulativeSum("a", start, 3)).ResourceMetrics)
+	assert.Empty(t, metrics)
+
+	// Ряды без точек дольше seriesTTL забываются
+	now = now.Add(seriesTTL + sweepInterval)
+	convertAndCommit(c, nil)
+	assert.Empty(t, c.series)
+}
+
+func TestOTLPHandler_RetryAfterStorageError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	updater := mocks.NewMockMetricsUpdater(ctrl)
+	handler := NewOTLPHandler(updater, zap.NewNop())
+	start := startAfter(handler.converter)
+
+	export := func(value int64) int {
+		body, err := proto.Marshal(exportRequest(cumulativeSum("requests", start, value)))
+		require.NoError(t, err)
+		req := httptest.NewRequest(http.MethodPost, "/v1/metrics", bytes.NewReader(body))
+		req.Header.Set("Content-Type", ContentTypeProtobuf)
+		w := httptest.NewRecorder()
+		handler.ExportMetrics(w, req)
+		return w.Code
+	}
+	expect := func(delta int64) *gomock.Call {
+		return updater.EXPECT().UpdateMetrics(gomock.Any(), []model.Metrics{
+			{ID: "{host.name=h1,service.name=api}requests", MType: model.Counter, Delta: int64Ptr(delta)},
+		}, gomock.Any())
+	}
+
+	gomock.InOrder(
+		expect(10).Return(nil),
+		expect(5).Return(errors.New("db down")),
+		// Повтор той же точки дает то же приращение
+		expect(5).Return(nil),
+		expect(2).Return(nil),
+	)
+
+	assert.Equal(t, http.StatusOK, export(10))
+	assert.Equal(t, http.StatusInternalServerError, export(15))
+	assert.Equal(t, http.StatusOK, export(15))
+	assert.Equal(t, http.StatusOK, export(17))
+}
+
+func TestOTLPHandler_ExportMetrics(t *testing.T) {
+	expected := []model.Metrics{
+		{ID: "{host.name=h1,service.name=api}requests", MType: model.Counter, Delta: int64Ptr(10)},
+	}
+
+	// Ряд начат после запуска сервера и сохраняется целиком
+	start := uint64(time.Now().Add(time.Hour).UnixNano())
+	protoBody, err := proto.Marshal(exportRequest(cumulativeSum("requests", start, 10)))
+	require.NoError(t, err)
+	jsonBody, err := protojson.Marshal(exportRequest(cumulativeSum("requests", start, 10)))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        []byte
+	}{
+		{"protobuf", ContentTypeProtobuf, protoBody},
+		{"json", ContentTypeJSON, jsonBody},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			updater := mocks.NewMockMetricsUpdater(ctrl)
+			updater.EXPECT().UpdateMetrics(gomock.Any(), expected, gomock.Any()).Return(nil)
+
+			handler := NewOTLPHandler(updater, zap.NewNop())
+			req := httptest.NewRequest(http.MethodPost, "/v1/metrics", bytes.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			w := httptest.NewRecorder()
+
+			handler.ExportMetrics(w, req)
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, tt.contentType, w.Header().Get("Content-Type"))
+		})
+	}
+
+	t.Run("unsupported content type", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		handler := NewOTLPHandler(mocks.NewMockMetricsUpdater(ctrl), zap.NewNop())
+		req := httptest.NewRequest(http.MethodPost, "/v1/metrics", strings.NewReader("x"))
+		req.Header.Set("Content-Type", "text/plain")
+		w := httptest.NewRecorder()
+
+		handler.ExportMetrics(w, req)
+
+		assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+	})
+
+	t.Run("invalid body", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		handler := NewOTLPHandler(mocks.NewMockMetricsUpdater(ctrl), zap.NewNop())
+		req := httptest.NewRequest(http.MethodPost, "/v1/metrics", strings.NewReader("{not json"))
+		req.Header.Set("Content-Type", ContentTypeJSON)
+		w := httptest.NewRecorder()
+
+		handler.ExportMetrics(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("storage error", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		updater := mocks.NewMockMetricsUpdater(ctrl)
+		updater.EXPECT().UpdateMetrics(gomock.Any(), gomock.Any(), gomock.Any()).Return(errors.New("db down"))
+
+		handler := NewOTLPHandler(updater, zap.NewNop())
+		req := httptest.NewRequest(http.MethodPost, "/v1/metrics", bytes.NewReader(protoBody))
+		req.Header.Set("Content-Type", ContentTypeProtobuf)
+		w := httptest.NewRecorder()
+
+		handler.ExportMetrics(w, req)
+
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+	})
+	t.Run("histogram buckets mismatch", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		updater := mocks.NewMockMetricsUpdater(ctrl)
+		updater.EXPECT().UpdateMetrics(gomock.Any(), gomock.Any(), gomock.Any()).
+			Return(fmt.Errorf("latency: %w", model.ErrBucketsMismatch))
+
+		handler := NewOTLPHandler(updater, zap.NewNop())
+		req := httptest.NewRequest(http.MethodPost, "/v1/metrics", bytes.NewReader(protoBody))
+		req.Header.Set("Content-Type", ContentTypeProtobuf)
+		w := httptest.NewRecorder()
+
+		handler.ExportMetrics(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
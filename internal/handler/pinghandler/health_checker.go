@@ -9,3 +9,10 @@ type HealthChecker interface {
 	// Возвращает ошибку, если проверка не удалась (например, соединение недоступно).
 	Ping(ctx context.Context) error
 }
+
+// DegradationReporter реализуется хранилищами, которые продолжают принимать запись
+// при недоступной базе данных, но в ограниченном режиме.
+type DegradationReporter interface {
+	// Degraded сообщает, работает ли хранилище в деградированном режиме.
+	Degraded() bool
+}
@@ -28,10 +28,18 @@ func NewPingHandler(log *zap.Logger, storage service.Storage) *PingHandler {
 	}
 }
 
+// StorageStateHeader - заголовок ответа с состоянием хранилища
+const StorageStateHeader = "X-Storage-State"
+
+// StorageStateDegraded - значение StorageStateHeader, когда записи копятся в журнале
+const StorageStateDegraded = "degraded"
+
 // GetPingDB обрабатывает GET-запрос к /pinghandler.
 // Пытается выполнить health-check хранилища с таймаутом 3 секунды.
 // Если хранилище не реализует HealthChecker — возвращает 500 Internal Server Error.
 // Если проверка завершилась ошибкой — логирует предупреждение и возвращает 500.
+// Если хранилище работает в деградированном режиме (см. DegradationReporter) —
+// возвращает 200 OK с заголовком X-Storage-State: degraded и телом "degraded".
 // В случае успеха возвращает HTTP 200 OK без тела ответа.
 func (h *PingHandler) GetPingDB(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
@@ -42,5 +50,13 @@ func (h *PingHandler) GetPingDB(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
+
+	if reporter, ok := h.storage.(DegradationReporter); ok && reporter.Degraded() {
+		w.Header().Set(StorageStateHeader, StorageStateDegraded)
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(StorageStateDegraded))
+		return
+	}
 	w.WriteHeader(http.StatusOK)
 }
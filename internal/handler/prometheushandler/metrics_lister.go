@@ -0,0 +1,13 @@
+package prometheushandler
+
+import (
+	"context"
+
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/model"
+)
+
+// MetricsLister определяет контракт для получения всех сохранённых метрик.
+type MetricsLister interface {
+	// ListMetrics возвращает метрики, подходящие под фильтр, отсортированные по имени и типу.
+	ListMetrics(ctx context.Context, filter model.MetricsFilter) ([]model.Metrics, error)
+}
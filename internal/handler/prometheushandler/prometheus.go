@@ -0,0 +1,226 @@
+// Package prometheushandler предоставляет HTTP-хендлер, отдающий сохранённые метрики
+// в текстовом формате экспозиции Prometheus 0.0.4 через эндпоинт /metrics.
+package prometheushandler
+
+import (
+	"bufio"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/model"
+)
+
+// ContentType - тип содержимого текстового формата экспозиции Prometheus
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// PrometheusHandler обрабатывает запросы Prometheus на сбор метрик.
+type PrometheusHandler struct {
+	lister MetricsLister
+	log    *zap.Logger
+}
+
+// NewPrometheusHandler создаёт новый экземпляр PrometheusHandler.
+// Принимает источник метрик MetricsLister и логгер zap.Logger.
+func NewPrometheusHandler(lister MetricsLister, log *zap.Logger) *PrometheusHandler {
+	return &PrometheusHandler{
+		lister: lister,
+		log:    log,
+	}
+}
+
+// GetMetrics обрабатывает GET-запрос к /metrics.
+// Отдаёт все метрики в текстовом формате Prometheus:
+// counter публикуется с типом counter, gauge - с типом gauge,
+// histogram - с типом histogram рядами name_bucket, name_sum и name_count.
+// Имена метрик приводятся к допустимому в Prometheus виду функцией SanitizeName,
+// метки публикуются как метки Prometheus. Метрики группируются по имени после
+// SanitizeName в порядке первого появления, поэтому ряды одного имени идут подряд
+// под одной строкой # TYPE, даже если исходные ID различаются.
+// Если несколько метрик дают одинаковое имя и метки или одно имя с разными типами,
+// публикуется только первая из них.
+// При ошибке хранилища возвращает 500.
+func (h *PrometheusHandler) GetMetrics(w http.ResponseWriter, r *http.Request) {
+	metrics, err := h.lister.ListMetrics(r.Context(), model.MetricsFilter{})
+	if err != nil {
+		h.log.Error("failed to list metrics for prometheus", zap.Error(err))
+		http.Error(w, "failed to list metrics", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", ContentType)
+	w.WriteHeader(http.StatusOK)
+
+	names, order := groupByName(metrics)
+
+	bw := bufio.NewWriter(w)
+	seen := make(map[string]struct{}, len(metrics))
+	types := make(map[string]string, len(metrics))
+
+	for _, i := range order {
+		metric, name := metrics[i], names[i]
+		labels := formatLabels(metric.Labels)
+		mtype, typed := types[name]
+		if _, exists := seen[name+labels]; exists || (typed && mtype != metric.MType) {
+			h.log.Warn("duplicate prometheus metric name, skipping",
+				zap.String("metric_id", metric.ID),
+				zap.String("metric_type", metric.MType),
+				zap.String("prometheus_name", name+labels))
+			continue
+		}
+
+		var value string
+		switch {
+		case metric.MType == model.Counter && metric.Delta != nil:
+			value = strconv.FormatInt(*metric.Delta, 10)
+		case metric.MType == model.Gauge && metric.Value != nil:
+			value = strconv.FormatFloat(*metric.Value, 'g', -1, 64)
+		case metric.MType == model.Histogram && metric.Histogram != nil:
+			// Ряды гистограммы пишет writeHistogram
+		default:
+			continue
+		}
+		seen[name+labels] = struct{}{}
+
+		if !typed {
+			types[name] = metric.MType
+			bw.WriteString("# TYPE ")
+			bw.WriteString(name)
+			bw.WriteByte(' ')
+			bw.WriteString(metric.MType)
+			bw.WriteByte('\n')
+		}
+		if metric.MType == model.Histogram {
+			writeHistogram(bw, name, metric.Labels, *metric.Histogram)
+			continue
+		}
+		writeSample(bw, name, labels, value)
+	}
+
+	if err := bw.Flush(); err != nil {
+		h.log.Error("failed to write prometheus response", zap.Error(err))
+	}
+}
+
+// groupByName возвращает имена метрик после SanitizeName и порядок вывода,
+// в котором метрики одного имени идут подряд, а имена - в порядке первого появления
+func groupByName(metrics []model.Metrics) ([]string, []int) {
+	names := make([]string, len(metrics))
+	first := make(map[string]int, len(metrics))
+	order := make([]int, len(metrics))
+	for i, metric := range metrics {
+		names[i] = SanitizeName(metric.ID)
+		if _, ok := first[names[i]]; !ok {
+			first[names[i]] = i
+		}
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return first[names[order[a]]] < first[names[order[b]]]
+	})
+	return names, order
+}
+
+// writeSample пишет одну строку экспозиции: имя, метки и значение
+func writeSample(bw *bufio.Writer, name, labels, value string) {
+	bw.WriteString(name)
+	bw.WriteString(labels)
+	bw.WriteByte(' ')
+	bw.WriteString(value)
+	bw.WriteByte('\n')
+}
+
+// writeHistogram пишет ряды гистограммы: накопленные значения корзин name_bucket
+// с меткой le, последняя корзина - le="+Inf", затем name_sum и name_count.
+// Собственная метка le переименовывается в exported_le, как это делает Prometheus
+// при конфликте меток, чтобы не смешиваться с границами корзин.
+func writeHistogram(bw *bufio.Writer, name string, labels model.Labels, histogram model.HistogramValue) {
+	if value, ok := labels["le"]; ok {
+		renamed := make(model.Labels, len(labels))
+		for label, v := range labels {
+			renamed[label] = v
+		}
+		delete(renamed, "le")
+		renamed["exported_le"] = value
+		labels = renamed
+	}
+
+	bucketLabels := make(model.Labels, len(labels)+1)
+	for label, value := range labels {
+		bucketLabels[label] = value
+	}
+
+	var cumulative int64
+	for i, count := range histogram.Counts {
+		cumulative += count
+		bucketLabels["le"] = "+Inf"
+		if i < len(histogram.Buckets) {
+			bucketLabels["le"] = strconv.FormatFloat(histogram.Buckets[i], 'g', -1, 64)
+		}
+		writeSample(bw, name+"_bucket", formatLabels(bucketLabels), strconv.FormatInt(cumulative, 10))
+	}
+
+	formatted := formatLabels(labels)
+	writeSample(bw, name+"_sum", formatted, strconv.FormatFloat(histogram.Sum, 'g', -1, 64))
+	writeSample(bw, name+"_count", formatted, strconv.FormatInt(histogram.Count, 10))
+}
+
+// formatLabels возвращает метки в виде {name="value",...}, отсортированные по имени,
+// или пустую строку, если меток нет. В значениях экранируются обратная косая черта, кавычка и перевод строки.
+func formatLabels(labels model.Labels) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var builder strings.Builder
+	builder.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			builder.WriteByte(',')
+		}
+		builder.WriteString(SanitizeName(name))
+		builder.WriteString(`="`)
+		builder.WriteString(labelValueReplacer.Replace(labels[name]))
+		builder.WriteByte('"')
+	}
+	builder.WriteByte('}')
+	return builder.String()
+}
+
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// SanitizeName приводит имя метрики к виду [a-zA-Z_:][a-zA-Z0-9_:]*.
+// Недопустимые символы заменяются на '_', перед ведущей цифрой добавляется '_'.
+func SanitizeName(id string) string {
+	if id == "" {
+		return "_"
+	}
+
+	var builder strings.Builder
+	builder.Grow(len(id) + 1)
+
+	for i, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c == '_', c == ':':
+			builder.WriteRune(c)
+		case c >= '0' && c <= '9':
+			if i == 0 {
+				builder.WriteByte('_')
+			}
+			builder.WriteRune(c)
+		default:
+			builder.WriteByte('_')
+		}
+	}
+
+	return builder.String()
+}
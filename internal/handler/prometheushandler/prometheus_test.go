@@ -0,0 +1,160 @@
+package prometheushandler
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/mocks"
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/model"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestPrometheusHandler_GetMetrics(t *testing.T) {
+	delta := int64(42)
+	value := 1.5
+	dupValue := 2.5
+	histogram := model.HistogramValue{Buckets: []float64{0.1, 1}, Counts: []int64{1, 2, 1}, Sum: 3.7, Count: 4}
+
+	tests := []struct {
+		name           string
+		metrics        []model.Metrics
+		err            error
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name: "counters and gauges",
+			metrics: []model.Metrics{
+				{ID: "PollCount", MType: model.Counter, Delta: &delta},
+				{ID: "HeapAlloc", MType: model.Gauge, Value: &value},
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody: "# TYPE PollCount counter\n" +
+				"PollCount 42\n" +
+				"# TYPE HeapAlloc gauge\n" +
+				"HeapAlloc 1.5\n",
+		},
+		{
+			name: "names are sanitized and duplicates skipped",
+			metrics: []model.Metrics{
+				{ID: "cpu.load-1", MType: model.Gauge, Value: &value},
+				{ID: "cpu_load_1", MType: model.Gauge, Value: &dupValue},
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody: "# TYPE cpu_load_1 gauge\n" +
+				"cpu_load_1 1.5\n",
+		},
+		{
+			name: "labeled series share one type line",
+			metrics: []model.Metrics{
+				{ID: "CPUutilization", MType: model.Gauge, Value: &value},
+				{ID: "CPUutilization", MType: model.Gauge, Value: &dupValue, Labels: model.Labels{"host": "a\"b", "core": "1"}},
+				{ID: "CPUutilization", MType: model.Gauge, Value: &dupValue, Labels: model.Labels{"host": "a\"b", "core": "1"}},
+				{ID: "CPUutilization", MType: model.Counter, Delta: &delta, Labels: model.Labels{"core": "2"}},
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody: "# TYPE CPUutilization gauge\n" +
+				"CPUutilization 1.5\n" +
+				"CPUutilization{core=\"1\",host=\"a\\\"b\"} 2.5\n",
+		},
+		{
+			name: "histogram buckets are cumulative",
+			metrics: []model.Metrics{
+				{ID: "latency", MType: model.Histogram, Histogram: &histogram, Labels: model.Labels{"path": "/"}},
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody: "# TYPE latency histogram\n" +
+				"latency_bucket{le=\"0.1\",path=\"/\"} 1\n" +
+				"latency_bucket{le=\"1\",path=\"/\"} 3\n" +
+				"latency_bucket{le=\"+Inf\",path=\"/\"} 4\n" +
+				"latency_sum{path=\"/\"} 3.7\n" +
+				"latency_count{path=\"/\"} 4\n",
+		},
+		{
+			name: "series of one sanitized name are grouped",
+			metrics: []model.Metrics{
+				{ID: "cpu.load", MType: model.Gauge, Value: &value},
+				{ID: "PollCount", MType: model.Counter, Delta: &delta},
+				{ID: "cpu_load", MType: model.Gauge, Value: &dupValue, Labels: model.Labels{"core": "1"}},
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody: "# TYPE cpu_load gauge\n" +
+				"cpu_load 1.5\n" +
+				"cpu_load{core=\"1\"} 2.5\n" +
+				"# TYPE PollCount counter\n" +
+				"PollCount 42\n",
+		},
+		{
+			name: "histogram le label is renamed",
+			metrics: []model.Metrics{
+				{ID: "latency", MType: model.Histogram, Histogram: &histogram, Labels: model.Labels{"le": "x"}},
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody: "# TYPE latency histogram\n" +
+				"latency_bucket{exported_le=\"x\",le=\"0.1\"} 1\n" +
+				"latency_bucket{exported_le=\"x\",le=\"1\"} 3\n" +
+				"latency_bucket{exported_le=\"x\",le=\"+Inf\"} 4\n" +
+				"latency_sum{exported_le=\"x\"} 3.7\n" +
+				"latency_count{exported_le=\"x\"} 4\n",
+		},
+		{
+			name:           "empty storage",
+			metrics:        []model.Metrics{},
+			expectedStatus: http.StatusOK,
+			expectedBody:   "",
+		},
+		{
+			name:           "storage error",
+			err:            errors.New("db error"),
+			expectedStatus: http.StatusInternalServerError,
+			expectedBody:   "failed to list metrics\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			lister := mocks.NewMockMetricsService(ctrl)
+			lister.EXPECT().ListMetrics(gomock.Any(), model.MetricsFilter{}).Return(tt.metrics, tt.err)
+
+			handler := NewPrometheusHandler(lister, zap.NewNop())
+
+			req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			w := httptest.NewRecorder()
+
+			handler.GetMetrics(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			assert.Equal(t, tt.expectedBody, w.Body.String())
+			if tt.err == nil {
+				assert.Equal(t, ContentType, w.Header().Get("Content-Type"))
+			}
+		})
+	}
+}
+
+func TestSanitizeName(t *testing.T) {
+	tests := []struct {
+		id       string
+		expected string
+	}{
+		{"HeapAlloc", "HeapAlloc"},
+		{"http:requests_total", "http:requests_total"},
+		{"cpu.load-1", "cpu_load_1"},
+		{"1st_metric", "_1st_metric"},
+		{"temp °C", "temp__C"},
+		{"", "_"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			assert.Equal(t, tt.expected, SanitizeName(tt.id))
+		})
+	}
+}
@@ -0,0 +1,50 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: internal/handler/alertshandler/alerts_service.go
+
+// Package mocks is a generated GoMock package.
+package mocks
+
+import (
+	context "context"
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+	model "github.com/kazakovdmitriy/go-musthave-metrics/internal/model"
+)
+
+// MockAlertsService is a mock of AlertsService interface.
+type MockAlertsService struct {
+	ctrl     *gomock.Controller
+	recorder *MockAlertsServiceMockRecorder
+}
+
+// MockAlertsServiceMockRecorder is the mock recorder for MockAlertsService.
+type MockAlertsServiceMockRecorder struct {
+	mock *MockAlertsService
+}
+
+// NewMockAlertsService creates a new mock instance.
+func NewMockAlertsService(ctrl *gomock.Controller) *MockAlertsService {
+	mock := &MockAlertsService{ctrl: ctrl}
+	mock.recorder = &MockAlertsServiceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockAlertsService) EXPECT() *MockAlertsServiceMockRecorder {
+	return m.recorder
+}
+
+// FiringAlerts mocks base method.
+func (m *MockAlertsService) FiringAlerts(ctx context.Context) []model.Alert {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FiringAlerts", ctx)
+	ret0, _ := ret[0].([]model.Alert)
+	return ret0
+}
+
+// FiringAlerts indicates an expected call of FiringAlerts.
+func (mr *MockAlertsServiceMockRecorder) FiringAlerts(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FiringAlerts", reflect.TypeOf((*MockAlertsService)(nil).FiringAlerts), ctx)
+}
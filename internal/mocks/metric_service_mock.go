@@ -7,6 +7,7 @@ package mocks
 import (
 	context "context"
 	reflect "reflect"
+	time "time"
 
 	gomock "github.com/golang/mock/gomock"
 	model "github.com/kazakovdmitriy/go-musthave-metrics/internal/model"
@@ -35,6 +36,35 @@ func (m *MockMetricsService) EXPECT() *MockMetricsServiceMockRecorder {
 	return m.recorder
 }
 
+// DeleteMetric mocks base method.
+func (m *MockMetricsService) DeleteMetric(ctx context.Context, metricType, name, ipAddr string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteMetric", ctx, metricType, name, ipAddr)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteMetric indicates an expected call of DeleteMetric.
+func (mr *MockMetricsServiceMockRecorder) DeleteMetric(ctx, metricType, name, ipAddr interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteMetric", reflect.TypeOf((*MockMetricsService)(nil).DeleteMetric), ctx, metricType, name, ipAddr)
+}
+
+// DeleteMetrics mocks base method.
+func (m *MockMetricsService) DeleteMetrics(ctx context.Context, filter model.MetricsFilter, ipAddr string) ([]model.Metrics, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteMetrics", ctx, filter, ipAddr)
+	ret0, _ := ret[0].([]model.Metrics)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteMetrics indicates an expected call of DeleteMetrics.
+func (mr *MockMetricsServiceMockRecorder) DeleteMetrics(ctx, filter, ipAddr interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteMetrics", reflect.TypeOf((*MockMetricsService)(nil).DeleteMetrics), ctx, filter, ipAddr)
+}
+
 // GetCounter mocks base method.
 func (m *MockMetricsService) GetCounter(ctx context.Context, name string) (int64, error) {
 	m.ctrl.T.Helper()
@@ -65,6 +95,65 @@ func (mr *MockMetricsServiceMockRecorder) GetGauge(ctx, name interface{}) *gomoc
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetGauge", reflect.TypeOf((*MockMetricsService)(nil).GetGauge), ctx, name)
 }
 
+// GetHistogram mocks base method.
+func (m *MockMetricsService) GetHistogram(ctx context.Context, name string) (model.HistogramValue, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetHistogram", ctx, name)
+	ret0, _ := ret[0].(model.HistogramValue)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetHistogram indicates an expected call of GetHistogram.
+func (mr *MockMetricsServiceMockRecorder) GetHistogram(ctx, name interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetHistogram", reflect.TypeOf((*MockMetricsService)(nil).GetHistogram), ctx, name)
+}
+
+// GetHistory mocks base method.
+func (m *MockMetricsService) GetHistory(ctx context.Context, metricType, name string, from, to time.Time, step time.Duration) ([]model.MetricSample, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetHistory", ctx, metricType, name, from, to, step)
+	ret0, _ := ret[0].([]model.MetricSample)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetHistory indicates an expected call of GetHistory.
+func (mr *MockMetricsServiceMockRecorder) GetHistory(ctx, metricType, name, from, to, step interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetHistory", reflect.TypeOf((*MockMetricsService)(nil).GetHistory), ctx, metricType, name, from, to, step)
+}
+
+// ListMetrics mocks base method.
+func (m *MockMetricsService) ListMetrics(ctx context.Context, filter model.MetricsFilter) ([]model.Metrics, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListMetrics", ctx, filter)
+	ret0, _ := ret[0].([]model.Metrics)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListMetrics indicates an expected call of ListMetrics.
+func (mr *MockMetricsServiceMockRecorder) ListMetrics(ctx, filter interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListMetrics", reflect.TypeOf((*MockMetricsService)(nil).ListMetrics), ctx, filter)
+}
+
+// ObserveHistogram mocks base method.
+func (m *MockMetricsService) ObserveHistogram(ctx context.Context, name string, value float64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ObserveHistogram", ctx, name, value)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ObserveHistogram indicates an expected call of ObserveHistogram.
+func (mr *MockMetricsServiceMockRecorder) ObserveHistogram(ctx, name, value interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ObserveHistogram", reflect.TypeOf((*MockMetricsService)(nil).ObserveHistogram), ctx, name, value)
+}
+
 // UpdateCounter mocks base method.
 func (m *MockMetricsService) UpdateCounter(ctx context.Context, name string, value int64) error {
 	m.ctrl.T.Helper()
@@ -93,6 +182,20 @@ func (mr *MockMetricsServiceMockRecorder) UpdateGauge(ctx, name, value interface
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateGauge", reflect.TypeOf((*MockMetricsService)(nil).UpdateGauge), ctx, name, value)
 }
 
+// UpdateHistogram mocks base method.
+func (m *MockMetricsService) UpdateHistogram(ctx context.Context, name string, value model.HistogramValue) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateHistogram", ctx, name, value)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateHistogram indicates an expected call of UpdateHistogram.
+func (mr *MockMetricsServiceMockRecorder) UpdateHistogram(ctx, name, value interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateHistogram", reflect.TypeOf((*MockMetricsService)(nil).UpdateHistogram), ctx, name, value)
+}
+
 // UpdateMetrics mocks base method.
 func (m *MockMetricsService) UpdateMetrics(ctx context.Context, metrics []model.Metrics, ipAddr string) error {
 	m.ctrl.T.Helper()
@@ -106,3 +209,18 @@ func (mr *MockMetricsServiceMockRecorder) UpdateMetrics(ctx, metrics, ipAddr int
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateMetrics", reflect.TypeOf((*MockMetricsService)(nil).UpdateMetrics), ctx, metrics, ipAddr)
 }
+
+// UpdateMetricsOnce mocks base method.
+func (m *MockMetricsService) UpdateMetricsOnce(ctx context.Context, key string, metrics []model.Metrics, ipAddr string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateMetricsOnce", ctx, key, metrics, ipAddr)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UpdateMetricsOnce indicates an expected call of UpdateMetricsOnce.
+func (mr *MockMetricsServiceMockRecorder) UpdateMetricsOnce(ctx, key, metrics, ipAddr interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateMetricsOnce", reflect.TypeOf((*MockMetricsService)(nil).UpdateMetricsOnce), ctx, key, metrics, ipAddr)
+}
@@ -0,0 +1,50 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: internal/handler/influxhandler/metrics_updater.go
+
+// Package mocks is a generated GoMock package.
+package mocks
+
+import (
+	context "context"
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+	model "github.com/kazakovdmitriy/go-musthave-metrics/internal/model"
+)
+
+// MockMetricsUpdater is a mock of MetricsUpdater interface.
+type MockMetricsUpdater struct {
+	ctrl     *gomock.Controller
+	recorder *MockMetricsUpdaterMockRecorder
+}
+
+// MockMetricsUpdaterMockRecorder is the mock recorder for MockMetricsUpdater.
+type MockMetricsUpdaterMockRecorder struct {
+	mock *MockMetricsUpdater
+}
+
+// NewMockMetricsUpdater creates a new mock instance.
+func NewMockMetricsUpdater(ctrl *gomock.Controller) *MockMetricsUpdater {
+	mock := &MockMetricsUpdater{ctrl: ctrl}
+	mock.recorder = &MockMetricsUpdaterMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockMetricsUpdater) EXPECT() *MockMetricsUpdaterMockRecorder {
+	return m.recorder
+}
+
+// UpdateMetrics mocks base method.
+func (m *MockMetricsUpdater) UpdateMetrics(ctx context.Context, metrics []model.Metrics, ipAddr string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateMetrics", ctx, metrics, ipAddr)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateMetrics indicates an expected call of UpdateMetrics.
+func (mr *MockMetricsUpdaterMockRecorder) UpdateMetrics(ctx, metrics, ipAddr interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateMetrics", reflect.TypeOf((*MockMetricsUpdater)(nil).UpdateMetrics), ctx, metrics, ipAddr)
+}
@@ -7,6 +7,7 @@ package mocks
 import (
 	context "context"
 	reflect "reflect"
+	time "time"
 
 	gomock "github.com/golang/mock/gomock"
 	model "github.com/kazakovdmitriy/go-musthave-metrics/internal/model"
@@ -49,27 +50,56 @@ func (mr *MockStorageMockRecorder) Close() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Close", reflect.TypeOf((*MockStorage)(nil).Close))
 }
 
-// GetAllMetrics mocks base method.
-func (m *MockStorage) GetAllMetrics(ctx context.Context) (string, error) {
+// DeleteMetric mocks base method.
+func (m *MockStorage) DeleteMetric(ctx context.Context, mtype, name string) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetAllMetrics", ctx)
-	ret0, _ := ret[0].(string)
+	ret := m.ctrl.Call(m, "DeleteMetric", ctx, mtype, name)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteMetric indicates an expected call of DeleteMetric.
+func (mr *MockStorageMockRecorder) DeleteMetric(ctx, mtype, name interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteMetric", reflect.TypeOf((*MockStorage)(nil).DeleteMetric), ctx, mtype, name)
+}
+
+// DeleteMetrics mocks base method.
+func (m *MockStorage) DeleteMetrics(ctx context.Context, filter model.MetricsFilter) ([]model.Metrics, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteMetrics", ctx, filter)
+	ret0, _ := ret[0].([]model.Metrics)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// GetAllMetrics indicates an expected call of GetAllMetrics.
-func (mr *MockStorageMockRecorder) GetAllMetrics(ctx interface{}) *gomock.Call {
+// DeleteMetrics indicates an expected call of DeleteMetrics.
+func (mr *MockStorageMockRecorder) DeleteMetrics(ctx, filter interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAllMetrics", reflect.TypeOf((*MockStorage)(nil).GetAllMetrics), ctx)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteMetrics", reflect.TypeOf((*MockStorage)(nil).DeleteMetrics), ctx, filter)
+}
+
+// DeleteStale mocks base method.
+func (m *MockStorage) DeleteStale(ctx context.Context, before time.Time) ([]model.Metrics, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteStale", ctx, before)
+	ret0, _ := ret[0].([]model.Metrics)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteStale indicates an expected call of DeleteStale.
+func (mr *MockStorageMockRecorder) DeleteStale(ctx, before interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteStale", reflect.TypeOf((*MockStorage)(nil).DeleteStale), ctx, before)
 }
 
 // GetCounter mocks base method.
-func (m *MockStorage) GetCounter(ctx context.Context, name string) (int64, bool) {
+func (m *MockStorage) GetCounter(ctx context.Context, name string) (int64, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "GetCounter", ctx, name)
 	ret0, _ := ret[0].(int64)
-	ret1, _ := ret[1].(bool)
+	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
@@ -80,11 +110,11 @@ func (mr *MockStorageMockRecorder) GetCounter(ctx, name interface{}) *gomock.Cal
 }
 
 // GetGauge mocks base method.
-func (m *MockStorage) GetGauge(ctx context.Context, name string) (float64, bool) {
+func (m *MockStorage) GetGauge(ctx context.Context, name string) (float64, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "GetGauge", ctx, name)
 	ret0, _ := ret[0].(float64)
-	ret1, _ := ret[1].(bool)
+	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
@@ -94,6 +124,51 @@ func (mr *MockStorageMockRecorder) GetGauge(ctx, name interface{}) *gomock.Call
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetGauge", reflect.TypeOf((*MockStorage)(nil).GetGauge), ctx, name)
 }
 
+// GetHistogram mocks base method.
+func (m *MockStorage) GetHistogram(ctx context.Context, name string) (model.HistogramValue, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetHistogram", ctx, name)
+	ret0, _ := ret[0].(model.HistogramValue)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetHistogram indicates an expected call of GetHistogram.
+func (mr *MockStorageMockRecorder) GetHistogram(ctx, name interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetHistogram", reflect.TypeOf((*MockStorage)(nil).GetHistogram), ctx, name)
+}
+
+// GetHistory mocks base method.
+func (m *MockStorage) GetHistory(ctx context.Context, mtype, name string, from, to time.Time) ([]model.MetricSample, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetHistory", ctx, mtype, name, from, to)
+	ret0, _ := ret[0].([]model.MetricSample)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetHistory indicates an expected call of GetHistory.
+func (mr *MockStorageMockRecorder) GetHistory(ctx, mtype, name, from, to interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetHistory", reflect.TypeOf((*MockStorage)(nil).GetHistory), ctx, mtype, name, from, to)
+}
+
+// ListMetrics mocks base method.
+func (m *MockStorage) ListMetrics(ctx context.Context, filter model.MetricsFilter) ([]model.Metrics, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListMetrics", ctx, filter)
+	ret0, _ := ret[0].([]model.Metrics)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListMetrics indicates an expected call of ListMetrics.
+func (mr *MockStorageMockRecorder) ListMetrics(ctx, filter interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListMetrics", reflect.TypeOf((*MockStorage)(nil).ListMetrics), ctx, filter)
+}
+
 // Ping mocks base method.
 func (m *MockStorage) Ping(ctx context.Context) error {
 	m.ctrl.T.Helper()
@@ -136,6 +211,20 @@ func (mr *MockStorageMockRecorder) UpdateGauge(ctx, name, value interface{}) *go
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateGauge", reflect.TypeOf((*MockStorage)(nil).UpdateGauge), ctx, name, value)
 }
 
+// UpdateHistogram mocks base method.
+func (m *MockStorage) UpdateHistogram(ctx context.Context, name string, value model.HistogramValue) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateHistogram", ctx, name, value)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateHistogram indicates an expected call of UpdateHistogram.
+func (mr *MockStorageMockRecorder) UpdateHistogram(ctx, name, value interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateHistogram", reflect.TypeOf((*MockStorage)(nil).UpdateHistogram), ctx, name, value)
+}
+
 // UpdateMetrics mocks base method.
 func (m *MockStorage) UpdateMetrics(ctx context.Context, metrics []model.Metrics) error {
 	m.ctrl.T.Helper()
@@ -149,3 +238,18 @@ func (mr *MockStorageMockRecorder) UpdateMetrics(ctx, metrics interface{}) *gomo
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateMetrics", reflect.TypeOf((*MockStorage)(nil).UpdateMetrics), ctx, metrics)
 }
+
+// UpdateMetricsOnce mocks base method.
+func (m *MockStorage) UpdateMetricsOnce(ctx context.Context, key string, metrics []model.Metrics) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateMetricsOnce", ctx, key, metrics)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UpdateMetricsOnce indicates an expected call of UpdateMetricsOnce.
+func (mr *MockStorageMockRecorder) UpdateMetricsOnce(ctx, key, metrics interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateMetricsOnce", reflect.TypeOf((*MockStorage)(nil).UpdateMetricsOnce), ctx, key, metrics)
+}
@@ -0,0 +1,44 @@
+package model
+
+import "time"
+
+// Состояния алерта
+const (
+	AlertInactive = "inactive"
+	AlertPending  = "pending"
+	AlertFiring   = "firing"
+	AlertResolved = "resolved"
+)
+
+// AlertRule - декларативное правило алертинга.
+// For задаётся строкой в формате time.ParseDuration ("30s", "5m")
+// и определяет, сколько условие должно держаться до перехода в firing.
+type AlertRule struct {
+	Name      string  `json:"name"`
+	MetricID  string  `json:"metric_id"`
+	MType     string  `json:"type"`
+	Operator  string  `json:"operator"`
+	Threshold float64 `json:"threshold"`
+	For       string  `json:"for,omitempty"`
+}
+
+// Alert - текущее состояние правила алертинга.
+// Время перехода в состояние nil, пока алерт в него не переходил.
+type Alert struct {
+	Rule       AlertRule  `json:"rule"`
+	State      string     `json:"state"`
+	Value      float64    `json:"value"`
+	ActiveAt   *time.Time `json:"active_at,omitempty"`
+	FiredAt    *time.Time `json:"fired_at,omitempty"`
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+}
+
+// AlertEvent - сведения о смене состояния алерта для аудита
+type AlertEvent struct {
+	Name      string  `json:"name"`
+	MetricID  string  `json:"metric_id"`
+	State     string  `json:"state"`
+	PrevState string  `json:"prev_state"`
+	Value     float64 `json:"value"`
+	Threshold float64 `json:"threshold"`
+}
@@ -2,11 +2,25 @@ package model
 
 import "time"
 
+// Действия аудита при удалении метрик
+const (
+	// AuditActionDelete - метрики удалены запросом клиента
+	AuditActionDelete = "delete"
+	// AuditActionExpire - метрики удалены по истечении TTL
+	AuditActionExpire = "expire"
+)
+
 // MetricProcessedEvent - событие обработки метрики
 // generate:reset
 type MetricProcessedEvent struct {
-	Timestamp time.Time `json:"-"`  // Внутреннее представление времени
-	TS        int64     `json:"ts"` // Unix timestamp в миллисекундах
-	Metrics   []string  `json:"metrics"`
+	Timestamp time.Time `json:"-"`       // Внутреннее представление времени
+	TS        int64     `json:"ts"`      // Unix timestamp в миллисекундах
+	Metrics   []string  `json:"metrics"` // Имена метрик, для рядов с метками - ключ ряда
 	IPAddr    string    `json:"ip_address"`
+
+	// Action заполняется только для удаления метрик
+	Action string `json:"action,omitempty"`
+
+	// Alert заполняется только для событий смены состояния алерта
+	Alert *AlertEvent `json:"alert,omitempty"`
 }
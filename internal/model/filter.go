@@ -0,0 +1,36 @@
+package model
+
+import "strings"
+
+// MetricsFilter - параметры выборки списка метрик.
+// Пустые поля не ограничивают выборку, Limit = 0 означает отсутствие лимита.
+// Все условия Labels должны выполняться одновременно.
+type MetricsFilter struct {
+	Prefix string
+	MType  string
+	Labels []LabelMatcher
+	Limit  int
+	Offset int
+}
+
+// Match проверяет, подходит ли метрика под фильтр по префиксу имени, типу и меткам
+func (f MetricsFilter) Match(id, mtype string, labels Labels) bool {
+	if f.MType != "" && f.MType != mtype {
+		return false
+	}
+	if !strings.HasPrefix(id, f.Prefix) {
+		return false
+	}
+	for _, matcher := range f.Labels {
+		if !matcher.Matches(labels[matcher.Name]) {
+			return false
+		}
+	}
+	return true
+}
+
+// MatchKey разбирает ключ ряда и проверяет метрику фильтром
+func (f MetricsFilter) MatchKey(key, mtype string) bool {
+	id, labels := ParseSeriesKey(key)
+	return f.Match(id, mtype, labels)
+}
@@ -0,0 +1,211 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// DefaultBuckets - границы корзин гистограммы по умолчанию, как в клиенте Prometheus
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// ErrBucketsMismatch - границы корзин приращения не совпадают с границами
+// сохраненной гистограммы, распределения несопоставимы
+var ErrBucketsMismatch = errors.New("histogram buckets do not match stored histogram")
+
+// DefaultQuantiles - квантили, которые /value возвращает для гистограммы, если они не заданы в запросе
+var DefaultQuantiles = []float64{0.5, 0.9, 0.95, 0.99}
+
+// HistogramValue - распределение наблюдений по корзинам.
+// Buckets - верхние границы корзин по возрастанию. Counts[i] - число наблюдений
+// в корзине (Buckets[i-1], Buckets[i]], последний элемент Counts - наблюдения
+// больше последней границы, поэтому len(Counts) = len(Buckets)+1.
+// Sum - сумма наблюдений, Count - их количество.
+type HistogramValue struct {
+	Buckets []float64 `json:"buckets"`
+	Counts  []int64   `json:"counts"`
+	Sum     float64   `json:"sum"`
+	Count   int64     `json:"count"`
+}
+
+// NewHistogram создает пустую гистограмму с границами buckets
+func NewHistogram(buckets []float64) HistogramValue {
+	return HistogramValue{
+		Buckets: append([]float64(nil), buckets...),
+		Counts:  make([]int64, len(buckets)+1),
+	}
+}
+
+// ValidateBuckets проверяет, что границы корзин конечны и строго возрастают
+func ValidateBuckets(buckets []float64) error {
+	if len(buckets) == 0 {
+		return errors.New("histogram buckets are empty")
+	}
+	for i, bound := range buckets {
+		if math.IsNaN(bound) || math.IsInf(bound, 0) {
+			return fmt.Errorf("histogram bucket %v is not finite", bound)
+		}
+		if i > 0 && bound <= buckets[i-1] {
+			return fmt.Errorf("histogram buckets are not increasing at %v", bound)
+		}
+	}
+	return nil
+}
+
+// Validate проверяет границы корзин и согласованность счетчиков
+func (h HistogramValue) Validate() error {
+	if err := ValidateBuckets(h.Buckets); err != nil {
+		return err
+	}
+	if len(h.Counts) != len(h.Buckets)+1 {
+		return fmt.Errorf("histogram has %d counts for %d buckets, want %d",
+			len(h.Counts), len(h.Buckets), len(h.Buckets)+1)
+	}
+
+	var total int64
+	for _, count := range h.Counts {
+		if count < 0 {
+			return errors.New("histogram bucket count is negative")
+		}
+		total += count
+	}
+	if total != h.Count {
+		return fmt.Errorf("histogram count %d does not match bucket counts sum %d", h.Count, total)
+	}
+	if math.IsNaN(h.Sum) || math.IsInf(h.Sum, 0) {
+		return errors.New("histogram sum is not finite")
+	}
+	return nil
+}
+
+// Observe добавляет одно наблюдение
+func (h *HistogramValue) Observe(value float64) {
+	i := sort.SearchFloat64s(h.Buckets, value)
+	h.Counts[i]++
+	h.Sum += value
+	h.Count++
+}
+
+// Merge возвращает сумму гистограмм или ErrBucketsMismatch, если границы корзин различаются
+func (h HistogramValue) Merge(delta HistogramValue) (HistogramValue, error) {
+	if err := h.CheckBuckets(delta); err != nil {
+		return HistogramValue{}, err
+	}
+
+	merged := HistogramValue{
+		Buckets: h.Buckets,
+		Counts:  make([]int64, len(h.Counts)),
+		Sum:     h.Sum + delta.Sum,
+		Count:   h.Count + delta.Count,
+	}
+	for i := range merged.Counts {
+		merged.Counts[i] = h.Counts[i] + delta.Counts[i]
+	}
+	return merged, nil
+}
+
+// CheckBuckets возвращает ErrBucketsMismatch, если delta нельзя добавить к h
+func (h HistogramValue) CheckBuckets(delta HistogramValue) error {
+	if !h.sameBuckets(delta) {
+		return fmt.Errorf("%w: stored %v, got %v", ErrBucketsMismatch, h.Buckets, delta.Buckets)
+	}
+	return nil
+}
+
+// CheckBatchBuckets проверяет, что гистограммы батча можно добавить
+// к сохраненным и друг к другу. stored возвращает сохраненную гистограмму
+// по ключу ряда. Возвращает ErrBucketsMismatch с ключом ряда.
+func CheckBatchBuckets(metrics []Metrics, stored func(key string) (HistogramValue, bool)) error {
+	var seen map[string]HistogramValue
+	for _, metric := range metrics {
+		if metric.MType != Histogram || metric.Histogram == nil {
+			continue
+		}
+		key := metric.Key()
+		current, ok := seen[key]
+		if !ok {
+			current, ok = stored(key)
+		}
+		if ok {
+			if err := current.CheckBuckets(*metric.Histogram); err != nil {
+				return fmt.Errorf("%s: %w", key, err)
+			}
+			continue
+		}
+		if seen == nil {
+			seen = make(map[string]HistogramValue)
+		}
+		seen[key] = *metric.Histogram
+	}
+	return nil
+}
+
+func (h HistogramValue) sameBuckets(other HistogramValue) bool {
+	if len(h.Buckets) != len(other.Buckets) || len(h.Counts) != len(other.Counts) {
+		return false
+	}
+	for i := range h.Buckets {
+		if h.Buckets[i] != other.Buckets[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Clone создает глубокую копию гистограммы
+func (h HistogramValue) Clone() HistogramValue {
+	return HistogramValue{
+		Buckets: append([]float64(nil), h.Buckets...),
+		Counts:  append([]int64(nil), h.Counts...),
+		Sum:     h.Sum,
+		Count:   h.Count,
+	}
+}
+
+// Quantile оценивает квантиль q из [0, 1] линейной интерполяцией внутри корзины,
+// как histogram_quantile в Prometheus. Нижняя граница первой корзины считается нулем,
+// для наблюдений выше последней границы возвращается последняя граница.
+// Для пустой гистограммы возвращает NaN.
+func (h HistogramValue) Quantile(q float64) float64 {
+	if h.Count == 0 || len(h.Buckets) == 0 {
+		return math.NaN()
+	}
+
+	rank := q * float64(h.Count)
+	var cumulative int64
+	for i, count := range h.Counts {
+		if count == 0 || float64(cumulative+count) < rank {
+			cumulative += count
+			continue
+		}
+		if i == len(h.Buckets) {
+			return h.Buckets[len(h.Buckets)-1]
+		}
+
+		upper := h.Buckets[i]
+		lower := 0.0
+		if i > 0 {
+			lower = h.Buckets[i-1]
+		} else if upper <= 0 {
+			return upper
+		}
+		return lower + (upper-lower)*(rank-float64(cumulative))/float64(count)
+	}
+	return h.Buckets[len(h.Buckets)-1]
+}
+
+// Quantiles оценивает квантили qs. Ключ - квантиль в виде строки, например "0.99".
+// Для пустой гистограммы возвращает nil.
+func (h HistogramValue) Quantiles(qs []float64) map[string]float64 {
+	if h.Count == 0 {
+		return nil
+	}
+
+	result := make(map[string]float64, len(qs))
+	for _, q := range qs {
+		result[strconv.FormatFloat(q, 'f', -1, 64)] = h.Quantile(q)
+	}
+	return result
+}
@@ -0,0 +1,105 @@
+package model
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistogramValue_Observe(t *testing.T) {
+	h := NewHistogram([]float64{0.1, 1})
+	for _, v := range []float64{0.05, 0.1, 0.5, 3} {
+		h.Observe(v)
+	}
+
+	// Граница корзины включается в нее
+	assert.Equal(t, []int64{2, 1, 1}, h.Counts)
+	assert.Equal(t, int64(4), h.Count)
+	assert.InDelta(t, 3.65, h.Sum, 1e-9)
+	assert.NoError(t, h.Validate())
+}
+
+func TestHistogramValue_Merge(t *testing.T) {
+	h := HistogramValue{Buckets: []float64{1}, Counts: []int64{1, 2}, Sum: 5, Count: 3}
+
+	merged, err := h.Merge(HistogramValue{Buckets: []float64{1}, Counts: []int64{1, 0}, Sum: 0.5, Count: 1})
+	require.NoError(t, err)
+	assert.Equal(t, HistogramValue{Buckets: []float64{1}, Counts: []int64{2, 2}, Sum: 5.5, Count: 4}, merged)
+	assert.Equal(t, []int64{1, 2}, h.Counts)
+
+	_, err = h.Merge(HistogramValue{Buckets: []float64{2}, Counts: []int64{0, 1}, Sum: 3, Count: 1})
+	assert.ErrorIs(t, err, ErrBucketsMismatch)
+}
+
+func TestCheckBatchBuckets(t *testing.T) {
+	stored := map[string]HistogramValue{"a": NewHistogram([]float64{1})}
+	lookup := func(key string) (HistogramValue, bool) {
+		h, ok := stored[key]
+		return h, ok
+	}
+	histogram := func(id string, buckets ...float64) Metrics {
+		h := NewHistogram(buckets)
+		return Metrics{ID: id, MType: Histogram, Histogram: &h}
+	}
+
+	tests := []struct {
+		name    string
+		metrics []Metrics
+		wantErr bool
+	}{
+		{name: "same as stored", metrics: []Metrics{histogram("a", 1)}},
+		{name: "new series", metrics: []Metrics{histogram("b", 1, 2), histogram("b", 1, 2)}},
+		{name: "differs from stored", metrics: []Metrics{histogram("a", 2)}, wantErr: true},
+		{name: "differs within batch", metrics: []Metrics{histogram("b", 1), histogram("b", 2)}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckBatchBuckets(tt.metrics, lookup)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrBucketsMismatch)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestHistogramValue_Validate(t *testing.T) {
+	tests := []struct {
+		name string
+		h    HistogramValue
+	}{
+		{name: "no buckets", h: HistogramValue{Counts: []int64{0}}},
+		{name: "not increasing", h: HistogramValue{Buckets: []float64{1, 1}, Counts: []int64{0, 0, 0}}},
+		{name: "infinite bucket", h: HistogramValue{Buckets: []float64{math.Inf(1)}, Counts: []int64{0, 0}}},
+		{name: "counts length", h: HistogramValue{Buckets: []float64{1}, Counts: []int64{0}}},
+		{name: "negative count", h: HistogramValue{Buckets: []float64{1}, Counts: []int64{-1, 1}}},
+		{name: "count mismatch", h: HistogramValue{Buckets: []float64{1}, Counts: []int64{1, 1}, Count: 1}},
+		{name: "sum not finite", h: HistogramValue{Buckets: []float64{1}, Counts: []int64{0, 0}, Sum: math.NaN()}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Error(t, tt.h.Validate())
+		})
+	}
+}
+
+func TestHistogramValue_Quantile(t *testing.T) {
+	h := HistogramValue{Buckets: []float64{1, 2, 4}, Counts: []int64{2, 2, 0, 1}, Count: 5}
+
+	assert.InDelta(t, 0.5, h.Quantile(0.2), 1e-9)
+	assert.InDelta(t, 1.25, h.Quantile(0.5), 1e-9)
+	// Наблюдения выше последней границы оцениваются последней границей
+	assert.Equal(t, 4.0, h.Quantile(0.99))
+
+	assert.True(t, math.IsNaN(NewHistogram([]float64{1}).Quantile(0.5)))
+	assert.Nil(t, NewHistogram([]float64{1}).Quantiles(DefaultQuantiles))
+
+	quantiles := h.Quantiles([]float64{0.5, 0.99})
+	require.Len(t, quantiles, 2)
+	assert.InDelta(t, 1.25, quantiles["0.5"], 1e-9)
+	assert.Equal(t, 4.0, quantiles["0.99"])
+}
@@ -0,0 +1,10 @@
+package model
+
+// MetricSample - значение метрики в момент времени.
+// Для counter хранится накопленное значение после обновления,
+// для histogram - накопленные количество наблюдений в Delta и их сумма в Value.
+type MetricSample struct {
+	TS    int64    `json:"ts"` // Unix timestamp в миллисекундах
+	Delta *int64   `json:"delta,omitempty"`
+	Value *float64 `json:"value,omitempty"`
+}
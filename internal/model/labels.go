@@ -0,0 +1,216 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Операторы сравнения меток, как в селекторах Prometheus
+const (
+	MatchEqual     = "="
+	MatchNotEqual  = "!="
+	MatchRegexp    = "=~"
+	MatchNotRegexp = "!~"
+)
+
+var labelNameRe = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// Labels - метки метрики: хост, ядро процессора и т.п.
+// Метрики с одним именем и разными метками хранятся как разные ряды.
+type Labels map[string]string
+
+// Validate проверяет имена меток: [a-zA-Z_][a-zA-Z0-9_]*
+func (l Labels) Validate() error {
+	for name := range l {
+		if !labelNameRe.MatchString(name) {
+			return fmt.Errorf("invalid label name %q", name)
+		}
+	}
+	return nil
+}
+
+// String возвращает метки в каноническом виде: пары name="value" через запятую,
+// отсортированные по имени. Значения экранируются strconv.Quote.
+func (l Labels) String() string {
+	names := make([]string, 0, len(l))
+	for name := range l {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var builder strings.Builder
+	for i, name := range names {
+		if i > 0 {
+			builder.WriteByte(',')
+		}
+		builder.WriteString(name)
+		builder.WriteByte('=')
+		builder.WriteString(strconv.Quote(l[name]))
+	}
+	return builder.String()
+}
+
+// SeriesKey возвращает ключ ряда, под которым хранилища держат метрику:
+// имя без изменений, если меток нет, иначе имя{метки в каноническом виде}.
+func SeriesKey(id string, labels Labels) string {
+	if len(labels) == 0 {
+		return id
+	}
+	return id + "{" + labels.String() + "}"
+}
+
+// NormalizeSeriesKey приводит ключ ряда к каноническому виду: метки сортируются по имени
+func NormalizeSeriesKey(key string) string {
+	return SeriesKey(ParseSeriesKey(key))
+}
+
+// ParseSeriesKey разбирает ключ ряда на имя и метки.
+// Ключ без корректного блока меток в конце целиком считается именем.
+func ParseSeriesKey(key string) (string, Labels) {
+	if !strings.HasSuffix(key, "}") {
+		return key, nil
+	}
+
+	// Имя само может содержать '{', поэтому блоком меток считается
+	// первый '{', с которого остаток ключа разбирается целиком
+	for i := strings.IndexByte(key, '{'); i >= 0; {
+		if labels, err := parseLabels(key[i+1 : len(key)-1]); err == nil {
+			return key[:i], labels
+		}
+		next := strings.IndexByte(key[i+1:], '{')
+		if next < 0 {
+			break
+		}
+		i += next + 1
+	}
+	return key, nil
+}
+
+// parseLabels разбирает метки в каноническом виде name="value",...
+func parseLabels(s string) (Labels, error) {
+	labels := make(Labels)
+	for s != "" {
+		name, op, value, rest, err := parseLabelPair(s)
+		if err != nil {
+			return nil, err
+		}
+		if op != MatchEqual {
+			return nil, fmt.Errorf("unexpected operator %q", op)
+		}
+		labels[name] = value
+		s = rest
+	}
+	if len(labels) == 0 {
+		return nil, errors.New("empty labels")
+	}
+	return labels, nil
+}
+
+// parseLabelPair разбирает одну пару name<op>"value" и возвращает остаток строки после запятой
+func parseLabelPair(s string) (name, op, value, rest string, err error) {
+	end := strings.IndexAny(s, "=!")
+	if end < 0 {
+		return "", "", "", "", fmt.Errorf("missing operator in %q", s)
+	}
+	name = strings.TrimSpace(s[:end])
+	if !labelNameRe.MatchString(name) {
+		return "", "", "", "", fmt.Errorf("invalid label name %q", name)
+	}
+
+	s = s[end:]
+	switch {
+	case strings.HasPrefix(s, MatchRegexp), strings.HasPrefix(s, MatchNotRegexp), strings.HasPrefix(s, MatchNotEqual):
+		op, s = s[:2], s[2:]
+	case strings.HasPrefix(s, MatchEqual):
+		op, s = s[:1], s[1:]
+	default:
+		return "", "", "", "", fmt.Errorf("invalid operator in %q", s)
+	}
+
+	s = strings.TrimSpace(s)
+	quoted, err := strconv.QuotedPrefix(s)
+	if err != nil {
+		return "", "", "", "", fmt.Errorf("invalid value for label %q: %w", name, err)
+	}
+	if value, err = strconv.Unquote(quoted); err != nil {
+		return "", "", "", "", fmt.Errorf("invalid value for label %q: %w", name, err)
+	}
+
+	rest = strings.TrimSpace(s[len(quoted):])
+	if rest != "" {
+		if rest[0] != ',' {
+			return "", "", "", "", fmt.Errorf("expected ',' after label %q", name)
+		}
+		rest = rest[1:]
+	}
+	return name, op, value, rest, nil
+}
+
+// LabelMatcher - условие на значение метки.
+// Отсутствующая метка считается пустой строкой, регулярные выражения
+// должны совпадать со значением целиком.
+type LabelMatcher struct {
+	Name  string
+	Op    string
+	Value string
+
+	re *regexp.Regexp
+}
+
+// NewLabelMatcher создает условие и компилирует регулярное выражение для =~ и !~
+func NewLabelMatcher(name, op, value string) (LabelMatcher, error) {
+	if !labelNameRe.MatchString(name) {
+		return LabelMatcher{}, fmt.Errorf("invalid label name %q", name)
+	}
+
+	matcher := LabelMatcher{Name: name, Op: op, Value: value}
+	switch op {
+	case MatchEqual, MatchNotEqual:
+	case MatchRegexp, MatchNotRegexp:
+		re, err := regexp.Compile("^(?:" + value + ")$")
+		if err != nil {
+			return LabelMatcher{}, fmt.Errorf("invalid regexp for label %q: %w", name, err)
+		}
+		matcher.re = re
+	default:
+		return LabelMatcher{}, fmt.Errorf("unknown label operator %q", op)
+	}
+	return matcher, nil
+}
+
+// ParseLabelMatchers разбирает условия вида host="a",core=~"1|2",env!="dev"
+func ParseLabelMatchers(s string) ([]LabelMatcher, error) {
+	var matchers []LabelMatcher
+	for s = strings.TrimSpace(s); s != ""; {
+		name, op, value, rest, err := parseLabelPair(s)
+		if err != nil {
+			return nil, err
+		}
+		matcher, err := NewLabelMatcher(name, op, value)
+		if err != nil {
+			return nil, err
+		}
+		matchers = append(matchers, matcher)
+		s = rest
+	}
+	return matchers, nil
+}
+
+// Matches проверяет значение метки
+func (m LabelMatcher) Matches(value string) bool {
+	switch m.Op {
+	case MatchEqual:
+		return value == m.Value
+	case MatchNotEqual:
+		return value != m.Value
+	case MatchRegexp:
+		return m.re.MatchString(value)
+	case MatchNotRegexp:
+		return !m.re.MatchString(value)
+	}
+	return false
+}
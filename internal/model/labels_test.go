@@ -0,0 +1,137 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSeriesKey(t *testing.T) {
+	tests := []struct {
+		name   string
+		id     string
+		labels Labels
+		key    string
+	}{
+		{name: "no labels", id: "Alloc", key: "Alloc"},
+		{name: "sorted labels", id: "CPUutilization", labels: Labels{"host": "a", "core": "1"}, key: `CPUutilization{core="1",host="a"}`},
+		{name: "escaped value", id: "Path", labels: Labels{"dir": `C:\tmp "x",{y}`}, key: `Path{dir="C:\\tmp \"x\",{y}"}`},
+		{name: "brace in name", id: "odd{name", labels: Labels{"a": "b"}, key: `odd{name{a="b"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := SeriesKey(tt.id, tt.labels)
+			assert.Equal(t, tt.key, key)
+
+			id, labels := ParseSeriesKey(key)
+			assert.Equal(t, tt.id, id)
+			assert.Equal(t, tt.labels, labels)
+		})
+	}
+}
+
+func TestParseSeriesKey_NotLabels(t *testing.T) {
+	for _, key := range []string{"odd}", "odd{}", "odd{name}", `odd{a="b}`, `odd{a="b" c="d"}`, `odd{1a="b"}`} {
+		id, labels := ParseSeriesKey(key)
+		assert.Equal(t, key, id)
+		assert.Nil(t, labels)
+	}
+}
+
+func TestParseLabelMatchers(t *testing.T) {
+	matchers, err := ParseLabelMatchers(`host="a", core=~"1|2",env!="dev",rack!~"r.*"`)
+	require.NoError(t, err)
+	require.Len(t, matchers, 4)
+
+	assert.Equal(t, "host", matchers[0].Name)
+	assert.Equal(t, MatchEqual, matchers[0].Op)
+	assert.Equal(t, MatchRegexp, matchers[1].Op)
+	assert.Equal(t, MatchNotEqual, matchers[2].Op)
+	assert.Equal(t, MatchNotRegexp, matchers[3].Op)
+
+	assert.True(t, matchers[0].Matches("a"))
+	assert.False(t, matchers[0].Matches("ab"))
+	// Регулярное выражение должно совпасть со значением целиком
+	assert.True(t, matchers[1].Matches("2"))
+	assert.False(t, matchers[1].Matches("12"))
+	assert.True(t, matchers[2].Matches(""))
+	assert.False(t, matchers[3].Matches("r1"))
+
+	matchers, err = ParseLabelMatchers("")
+	require.NoError(t, err)
+	assert.Empty(t, matchers)
+
+	for _, invalid := range []string{`host`, `host=a`, `1host="a"`, `host=="a"`, `host="a" core="1"`, `core=~"("`} {
+		_, err := ParseLabelMatchers(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestMetricsFilter_Match(t *testing.T) {
+	matchers, err := ParseLabelMatchers(`host="a"`)
+	require.NoError(t, err)
+	filter := MetricsFilter{Prefix: "CPU", MType: Gauge, Labels: matchers}
+
+	assert.True(t, filter.Match("CPUutilization", Gauge, Labels{"host": "a", "core": "1"}))
+	assert.False(t, filter.Match("CPUutilization", Gauge, Labels{"host": "b"}))
+	assert.False(t, filter.Match("CPUutilization", Gauge, nil))
+	assert.False(t, filter.Match("CPUutilization", Counter, Labels{"host": "a"}))
+	assert.False(t, filter.Match("Alloc", Gauge, Labels{"host": "a"}))
+
+	assert.True(t, filter.MatchKey(`CPUutilization{host="a"}`, Gauge))
+}
+
+func TestSamplesToMetrics(t *testing.T) {
+	host := Labels{"host": "a"}
+	samples := []Sample{
+		GaugeSample("Alloc", 1),
+		{Name: "CPUutilization", MType: Gauge, Value: 10, Labels: Labels{"core": "1"}},
+		{Name: "CPUutilization", MType: Gauge, Value: 20, Labels: Labels{"core": "2"}},
+		CounterSample("PollCount", 3),
+	}
+	metrics := SamplesToMetrics(samples, host)
+
+	keys := make(map[string]float64, len(metrics))
+	for _, metric := range metrics {
+		if metric.MType == Counter {
+			require.NotNil(t, metric.Delta)
+			keys[metric.Key()] = float64(*metric.Delta)
+			continue
+		}
+		require.NotNil(t, metric.Value)
+		keys[metric.Key()] = *metric.Value
+	}
+
+	assert.Len(t, keys, len(metrics))
+	assert.Equal(t, 1.0, keys[`Alloc{host="a"}`])
+	assert.Equal(t, 10.0, keys[`CPUutilization{core="1",host="a"}`])
+	assert.Equal(t, 20.0, keys[`CPUutilization{core="2",host="a"}`])
+	assert.Equal(t, 3.0, keys[`PollCount{host="a"}`])
+	assert.NotContains(t, keys, `CPUutilization1{host="a"}`)
+	// Метки хоста не должны меняться при добавлении core
+	assert.Equal(t, Labels{"host": "a"}, host)
+}
+
+func TestSamplesToMetrics_NoLabels(t *testing.T) {
+	samples := []Sample{
+		GaugeSample("NumForcedGC", 0),
+		{Name: "CPUutilization", MType: Gauge, Value: 10, Labels: Labels{"core": "2"}},
+		CounterSample("PollCount", 0),
+		{Name: "Alloc", MType: Histogram, Histogram: &HistogramValue{Buckets: []float64{1}, Counts: []int64{0, 0}}},
+		{Name: "Alloc", MType: Histogram, Histogram: &HistogramValue{Buckets: []float64{1}, Counts: []int64{0, 1}, Sum: 2, Count: 1}},
+	}
+	metrics := SamplesToMetrics(samples, nil)
+
+	require.Len(t, metrics, 3)
+	// Нулевой gauge отправляется, нулевое приращение counter - нет
+	assert.Equal(t, "NumForcedGC", metrics[0].ID)
+	assert.Equal(t, 0.0, *metrics[0].Value)
+	assert.Equal(t, "CPUutilization2", metrics[1].ID)
+	assert.Nil(t, metrics[1].Labels)
+	// Пустая гистограмма не отправляется
+	assert.Equal(t, Histogram, metrics[2].MType)
+	require.NotNil(t, metrics[2].Histogram)
+	assert.Equal(t, int64(1), metrics[2].Histogram.Count)
+}
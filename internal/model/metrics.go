@@ -1,8 +1,11 @@
 package model
 
+import "sort"
+
 const (
-	Counter = "counter"
-	Gauge   = "gauge"
+	Counter   = "counter"
+	Gauge     = "gauge"
+	Histogram = "histogram"
 )
 
 // Metrics NOTE: Не усложняем пример, вводя иерархическую вложенность структур.
@@ -10,11 +13,35 @@ const (
 // Delta и Value объявлены через указатели,
 // что бы отличать значение "0", от не заданного значения
 // и соответственно не кодировать в структуру.
+// Labels необязательны: метрика без меток - отдельный ряд с тем же именем.
+// Для histogram заполняется Histogram, в обновлениях он содержит приращение распределения.
+// Quantiles заполняется только в ответе /value для histogram.
 // generate:reset
 type Metrics struct {
-	ID    string   `json:"id"`
-	MType string   `json:"type"`
-	Delta *int64   `json:"delta,omitempty"`
-	Value *float64 `json:"value,omitempty"`
-	Hash  string   `json:"hash,omitempty"`
+	ID        string             `json:"id"`
+	MType     string             `json:"type"`
+	Delta     *int64             `json:"delta,omitempty"`
+	Value     *float64           `json:"value,omitempty"`
+	Histogram *HistogramValue    `json:"histogram,omitempty"`
+	Quantiles map[string]float64 `json:"quantiles,omitempty"`
+	Hash      string             `json:"hash,omitempty"`
+	Labels    Labels             `json:"labels,omitempty"`
+}
+
+// Key возвращает ключ ряда метрики, см. SeriesKey
+func (m Metrics) Key() string {
+	return SeriesKey(m.ID, m.Labels)
+}
+
+// SortMetrics сортирует метрики по имени, типу и меткам, в порядке выдачи ListMetrics
+func SortMetrics(metrics []Metrics) {
+	sort.Slice(metrics, func(i, j int) bool {
+		if metrics[i].ID != metrics[j].ID {
+			return metrics[i].ID < metrics[j].ID
+		}
+		if metrics[i].MType != metrics[j].MType {
+			return metrics[i].MType < metrics[j].MType
+		}
+		return metrics[i].Key() < metrics[j].Key()
+	})
 }
@@ -0,0 +1,111 @@
+package model
+
+import (
+	"sort"
+	"strings"
+)
+
+// Sample - значение одной метрики, собранное поставщиком агента.
+// Для gauge значение в Value, для counter приращение с прошлого сбора в Delta,
+// для histogram распределение наблюдений за окно отправки в Histogram.
+// Labels различают ряды одной метрики, например загрузку ядер по метке core.
+type Sample struct {
+	Name      string
+	MType     string
+	Value     float64
+	Delta     int64
+	Histogram *HistogramValue
+	Labels    Labels
+}
+
+// GaugeSample создает значение gauge
+func GaugeSample(name string, value float64) Sample {
+	return Sample{Name: name, MType: Gauge, Value: value}
+}
+
+// CounterSample создает приращение counter
+func CounterSample(name string, delta int64) Sample {
+	return Sample{Name: name, MType: Counter, Delta: delta}
+}
+
+// Key возвращает ключ ряда значения, см. SeriesKey
+func (s Sample) Key() string {
+	return SeriesKey(s.Name, s.Labels)
+}
+
+// FlatName возвращает имя, в котором метки закодированы значениями
+// по порядку имен меток: CPUutilization с core="1" дает CPUutilization1.
+// Так агент передает ряды серверу, когда метки выключены.
+func (s Sample) FlatName() string {
+	if len(s.Labels) == 0 {
+		return s.Name
+	}
+
+	names := make([]string, 0, len(s.Labels))
+	for name := range s.Labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var builder strings.Builder
+	builder.WriteString(s.Name)
+	for _, name := range names {
+		builder.WriteString(s.Labels[name])
+	}
+	return builder.String()
+}
+
+// SamplesToMetrics преобразует значения в метрики для отправки.
+// Если labels nil, метки значений кодируются в имени (см. FlatName),
+// иначе labels добавляются к меткам каждого значения.
+// Нулевые приращения counter и пустые гистограммы не отправляются.
+func SamplesToMetrics(samples []Sample, labels Labels) []Metrics {
+	result := make([]Metrics, 0, len(samples))
+	for _, sample := range samples {
+		metric := Metrics{ID: sample.Name, MType: sample.MType}
+		if labels == nil {
+			metric.ID = sample.FlatName()
+		} else {
+			metric.Labels = mergeLabels(labels, sample.Labels)
+		}
+
+		switch sample.MType {
+		case Gauge:
+			value := sample.Value
+			metric.Value = &value
+		case Counter:
+			if sample.Delta == 0 {
+				continue
+			}
+			delta := sample.Delta
+			metric.Delta = &delta
+		case Histogram:
+			if sample.Histogram == nil || sample.Histogram.Count == 0 {
+				continue
+			}
+			histogram := sample.Histogram.Clone()
+			metric.Histogram = &histogram
+		default:
+			continue
+		}
+
+		result = append(result, metric)
+	}
+	return result
+}
+
+// mergeLabels объединяет метки, не меняя исходные; при совпадении имен побеждает extra
+func mergeLabels(base, extra Labels) Labels {
+	if len(extra) == 0 {
+		return base
+	}
+
+	merged := make(Labels, len(base)+len(extra))
+	for name, value := range base {
+		merged[name] = value
+	}
+	for name, value := range extra {
+		merged[name] = value
+	}
+	return merged
+}
@@ -0,0 +1,85 @@
+package metricspb
+
+import (
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/model"
+)
+
+// MTypeFromModel преобразует строковый тип метрики в MType.
+// Неизвестный тип возвращается как MTYPE_UNSPECIFIED.
+func MTypeFromModel(mtype string) MType {
+	switch mtype {
+	case model.Gauge:
+		return MType_GAUGE
+	case model.Counter:
+		return MType_COUNTER
+	case model.Histogram:
+		return MType_HISTOGRAM
+	}
+	return MType_MTYPE_UNSPECIFIED
+}
+
+// ModelType возвращает строковый тип метрики или пустую строку для MTYPE_UNSPECIFIED
+func (t MType) ModelType() string {
+	switch t {
+	case MType_GAUGE:
+		return model.Gauge
+	case MType_COUNTER:
+		return model.Counter
+	case MType_HISTOGRAM:
+		return model.Histogram
+	}
+	return ""
+}
+
+// FromModel преобразует model.Metrics в сообщение Metric.
+// В Metric нет поля меток, поэтому метки передаются в id как ключ ряда.
+func FromModel(metric model.Metrics) *Metric {
+	return &Metric{
+		Id:        metric.Key(),
+		Type:      MTypeFromModel(metric.MType),
+		Delta:     metric.Delta,
+		Value:     metric.Value,
+		Histogram: HistogramFromModel(metric.Histogram),
+	}
+}
+
+// ToModel преобразует сообщение Metric в model.Metrics, разбирая метки из id
+func (m *Metric) ToModel() model.Metrics {
+	id, labels := model.ParseSeriesKey(m.GetId())
+	return model.Metrics{
+		ID:        id,
+		Labels:    labels,
+		MType:     m.GetType().ModelType(),
+		Delta:     m.Delta,
+		Value:     m.Value,
+		Histogram: m.GetHistogram().ToModel(),
+	}
+}
+
+// HistogramFromModel преобразует гистограмму в сообщение Histogram, nil - в nil
+func HistogramFromModel(histogram *model.HistogramValue) *Histogram {
+	if histogram == nil {
+		return nil
+	}
+	clone := histogram.Clone()
+	return &Histogram{
+		Buckets: clone.Buckets,
+		Counts:  clone.Counts,
+		Sum:     clone.Sum,
+		Count:   clone.Count,
+	}
+}
+
+// ToModel преобразует сообщение Histogram в model.HistogramValue, nil - в nil
+func (h *Histogram) ToModel() *model.HistogramValue {
+	if h == nil {
+		return nil
+	}
+	histogram := model.HistogramValue{
+		Buckets: h.GetBuckets(),
+		Counts:  h.GetCounts(),
+		Sum:     h.GetSum(),
+		Count:   h.GetCount(),
+	}.Clone()
+	return &histogram
+}
@@ -0,0 +1,5 @@
+// Package metricspb содержит сгенерированный из api/metrics.proto код gRPC-сервиса метрик
+// и функции преобразования между сообщениями protobuf и model.Metrics.
+package metricspb
+
+//go:generate protoc --proto_path=../../../api --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative metrics.proto
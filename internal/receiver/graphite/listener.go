@@ -0,0 +1,275 @@
+// Package graphite реализует приём метрик по plaintext-протоколу Graphite поверх TCP.
+// Каждая строка сохраняется в хранилище как gauge; строки одного соединения
+// накапливаются в батчи и записываются одним вызовом UpdateMetrics.
+package graphite
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/model"
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/service"
+	"go.uber.org/zap"
+)
+
+const (
+	// defaultBatchSize - количество строк, после которого батч записывается немедленно
+	defaultBatchSize = 500
+	// defaultFlushInterval - максимальное время накопления батча
+	defaultFlushInterval = time.Second
+	// defaultMaxLineSize - максимальная длина строки; соединение с более длинной строкой закрывается
+	defaultMaxLineSize = 64 << 10
+)
+
+// ConcurrencyLimiter - общий с HTTP-сервером бюджет одновременной обработки
+type ConcurrencyLimiter interface {
+	Acquire(ctx context.Context) error
+	Release()
+}
+
+// Listener принимает TCP-соединения с plaintext-протоколом Graphite
+type Listener struct {
+	addr    string
+	storage service.Storage
+	limiter ConcurrencyLimiter
+	log     *zap.Logger
+
+	batchSize     int
+	flushInterval time.Duration
+	maxLineSize   int
+
+	listener net.Listener
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+
+	mu    sync.Mutex
+	conns map[net.Conn]struct{}
+}
+
+func NewListener(
+	addr string,
+	storage service.Storage,
+	limiter ConcurrencyLimiter,
+	log *zap.Logger,
+) *Listener {
+	return &Listener{
+		addr:          addr,
+		storage:       storage,
+		limiter:       limiter,
+		log:           log,
+		batchSize:     defaultBatchSize,
+		flushInterval: defaultFlushInterval,
+		maxLineSize:   defaultMaxLineSize,
+		conns:         make(map[net.Conn]struct{}),
+	}
+}
+
+// Start открывает TCP-сокет и начинает принимать соединения
+func (l *Listener) Start() error {
+	listener, err := net.Listen("tcp", l.addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen graphite on %s: %w", l.addr, err)
+	}
+
+	l.listener = listener
+	l.ctx, l.cancel = context.WithCancel(context.Background())
+
+	l.wg.Add(1)
+	go l.acceptLoop()
+
+	l.log.Info("graphite listener started", zap.String("addr", listener.Addr().String()))
+	return nil
+}
+
+// Addr возвращает фактический адрес сокета
+func (l *Listener) Addr() net.Addr {
+	return l.listener.Addr()
+}
+
+// Shutdown перестает принимать соединения, дописывает накопленные батчи
+// и закрывает активные соединения
+func (l *Listener) Shutdown(ctx context.Context) error {
+	if l.listener == nil {
+		return nil
+	}
+
+	err := l.listener.Close()
+	l.cancel()
+
+	// Прерываем блокирующие чтения, соединения сами допишут батчи и закроются
+	l.mu.Lock()
+	for conn := range l.conns {
+		conn.SetReadDeadline(time.Now())
+	}
+	l.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		l.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		l.log.Info("graphite listener stopped")
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	if err != nil && !errors.Is(err, net.ErrClosed) {
+		return err
+	}
+	return nil
+}
+
+func (l *Listener) acceptLoop() {
+	defer l.wg.Done()
+
+	for {
+		conn, err := l.listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			l.log.Warn("graphite accept failed", zap.Error(err))
+			continue
+		}
+
+		l.mu.Lock()
+		l.conns[conn] = struct{}{}
+		l.mu.Unlock()
+
+		l.wg.Add(1)
+		go l.handleConn(conn)
+	}
+}
+
+// handleConn читает строки соединения и записывает их батчами.
+// Батч записывается при достижении batchSize, по истечении flushInterval
+// без новых данных и при закрытии соединения. Строка длиннее maxLineSize
+// не накапливается: накопленный батч записывается, соединение закрывается.
+func (l *Listener) handleConn(conn net.Conn) {
+	defer l.wg.Done()
+	defer func() {
+		l.mu.Lock()
+		delete(l.conns, conn)
+		l.mu.Unlock()
+		conn.Close()
+	}()
+
+	remoteAddr := conn.RemoteAddr().String()
+	reader := bufio.NewReader(conn)
+	batch := make([]model.Metrics, 0, l.batchSize)
+	var partial strings.Builder
+
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		l.flush(batch, remoteAddr)
+		batch = batch[:0]
+	}
+
+	for {
+		if l.ctx.Err() != nil {
+			flush()
+			return
+		}
+
+		conn.SetReadDeadline(time.Now().Add(l.flushInterval))
+		chunk, err := reader.ReadSlice('\n')
+		if partial.Len()+len(chunk) > l.maxLineSize {
+			flush()
+			l.log.Warn("graphite line too long, closing connection",
+				zap.String("remote_addr", remoteAddr),
+				zap.Int("max_line_size", l.maxLineSize))
+			return
+		}
+		partial.Write(chunk)
+
+		if errors.Is(err, bufio.ErrBufferFull) {
+			// Строка длиннее буфера чтения, дочитываем ее продолжение
+			continue
+		}
+		if err == nil {
+			if metric, ok := l.parse(partial.String(), remoteAddr); ok {
+				batch = append(batch, metric)
+			}
+			partial.Reset()
+
+			if len(batch) >= l.batchSize {
+				flush()
+			}
+			continue
+		}
+
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			// Новых данных нет - записываем накопленное, незавершенная строка ждет продолжения
+			flush()
+			continue
+		}
+
+		// Последняя строка может прийти без завершающего перевода строки
+		if partial.Len() > 0 {
+			if metric, ok := l.parse(partial.String(), remoteAddr); ok {
+				batch = append(batch, metric)
+			}
+		}
+		flush()
+
+		if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+			l.log.Warn("graphite connection read failed", zap.String("remote_addr", remoteAddr), zap.Error(err))
+		}
+		return
+	}
+}
+
+func (l *Listener) parse(line, remoteAddr string) (model.Metrics, bool) {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return model.Metrics{}, false
+	}
+
+	metric, err := parseLine(line)
+	if err != nil {
+		l.log.Debug("skipping graphite line",
+			zap.String("remote_addr", remoteAddr),
+			zap.String("line", line),
+			zap.Error(err))
+		return model.Metrics{}, false
+	}
+	return metric, true
+}
+
+// flush записывает батч, занимая слот общего лимита конкурентности
+func (l *Listener) flush(batch []model.Metrics, remoteAddr string) {
+	// Запись должна завершиться и при остановке, поэтому контекст не отменяется вместе с listener
+	ctx := context.Background()
+
+	if err := l.limiter.Acquire(ctx); err != nil {
+		l.log.Error("failed to acquire concurrency slot", zap.Error(err))
+		return
+	}
+	defer l.limiter.Release()
+
+	if err := l.storage.UpdateMetrics(ctx, batch); err != nil {
+		l.log.Error("failed to save graphite metrics",
+			zap.String("remote_addr", remoteAddr),
+			zap.Int("metrics_count", len(batch)),
+			zap.Error(err))
+		return
+	}
+
+	l.log.Debug("graphite batch saved",
+		zap.String("remote_addr", remoteAddr),
+		zap.Int("metrics_count", len(batch)))
+}
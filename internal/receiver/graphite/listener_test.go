@@ -0,0 +1,173 @@
+package graphite
+
+import (
+	"context"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/handler/middlewares"
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/mocks"
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestParseLine(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		id      string
+		value   float64
+		wantErr bool
+	}{
+		{"valid", "servers.web1.cpu 42.5 1700000000", "servers.web1.cpu", 42.5, false},
+		{"negative timestamp", "load.shortterm 0.25 -1", "load.shortterm", 0.25, false},
+		{"fractional timestamp", "disk.free 100 1700000000.5", "disk.free", 100, false},
+		{"missing timestamp", "servers.web1.cpu 42.5", "", 0, true},
+		{"invalid value", "servers.web1.cpu abc 1700000000", "", 0, true},
+		{"invalid timestamp", "servers.web1.cpu 1 now", "", 0, true},
+		{"nan value", "servers.web1.cpu NaN 1700000000", "", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metric, err := parseLine(tt.line)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.id, metric.ID)
+			assert.Equal(t, model.Gauge, metric.MType)
+			assert.Equal(t, tt.value, *metric.Value)
+		})
+	}
+}
+
+// recordingStorage собирает батчи, записанные через UpdateMetrics
+type recordingStorage struct {
+	mu      sync.Mutex
+	batches [][]model.Metrics
+	saved   chan struct{}
+}
+
+func (r *recordingStorage) record(_ context.Context, metrics []model.Metrics) error {
+	r.mu.Lock()
+	batch := make([]model.Metrics, len(metrics))
+	copy(batch, metrics)
+	r.batches = append(r.batches, batch)
+	r.mu.Unlock()
+
+	r.saved <- struct{}{}
+	return nil
+}
+
+func newTestListener(t *testing.T, batchSize int, flushInterval time.Duration) (*Listener, *recordingStorage) {
+	ctrl := gomock.NewController(t)
+	t.Cleanup(ctrl.Finish)
+
+	recorder := &recordingStorage{saved: make(chan struct{}, 10)}
+	storage := mocks.NewMockStorage(ctrl)
+	storage.EXPECT().UpdateMetrics(gomock.Any(), gomock.Any()).DoAndReturn(recorder.record).AnyTimes()
+
+	listener := NewListener("127.0.0.1:0", storage, middlewares.NewLimiter(1), zap.NewNop())
+	listener.batchSize = batchSize
+	listener.flushInterval = flushInterval
+	require.NoError(t, listener.Start())
+
+	return listener, recorder
+}
+
+func waitSaved(t *testing.T, recorder *recordingStorage) {
+	select {
+	case <-recorder.saved:
+	case <-time.After(2 * time.Second):
+		t.Fatal("graphite batch was not saved")
+	}
+}
+
+func TestListener_BatchesBySize(t *testing.T) {
+	listener, recorder := newTestListener(t, 2, 50*time.Millisecond)
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	require.NoError(t, err)
+
+	_, err = conn.Write([]byte("a 1 -1\nbroken line\nb 2 -1\nc 3 -1\n"))
+	require.NoError(t, err)
+
+	waitSaved(t, recorder)
+	waitSaved(t, recorder)
+
+	conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, listener.Shutdown(ctx))
+
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	require.Len(t, recorder.batches, 2)
+	assert.Len(t, recorder.batches[0], 2)
+	assert.Equal(t, "a", recorder.batches[0][0].ID)
+	assert.Equal(t, "b", recorder.batches[0][1].ID)
+	require.Len(t, recorder.batches[1], 1)
+	assert.Equal(t, "c", recorder.batches[1][0].ID)
+}
+
+func TestListener_FlushesOnShutdown(t *testing.T) {
+	listener, recorder := newTestListener(t, 100, time.Hour)
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("a 1 -1\nb 2 -1\n"))
+	require.NoError(t, err)
+
+	// Даем соединению прочитать данные до остановки
+	time.Sleep(100 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	require.NoError(t, listener.Shutdown(ctx))
+
+	waitSaved(t, recorder)
+
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	require.Len(t, recorder.batches, 1)
+	assert.Len(t, recorder.batches[0], 2)
+}
+
+func TestListener_ClosesConnectionOnLongLine(t *testing.T) {
+	listener, recorder := newTestListener(t, 100, 50*time.Millisecond)
+	listener.maxLineSize = 16
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("a 1 -1\n" + strings.Repeat("x", 100)))
+	require.NoError(t, err)
+
+	// Накопленная строка записана, соединение закрыто сервером
+	waitSaved(t, recorder)
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(2*time.Second)))
+	_, err = conn.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, io.EOF)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, listener.Shutdown(ctx))
+
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	require.Len(t, recorder.batches, 1)
+	require.Len(t, recorder.batches[0], 1)
+	assert.Equal(t, "a", recorder.batches[0][0].ID)
+}
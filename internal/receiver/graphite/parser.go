@@ -0,0 +1,38 @@
+package graphite
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/model"
+)
+
+// parseLine разбирает строку plaintext-протокола Graphite вида "path value timestamp".
+// Метка времени проверяется, но не используется: хранилище держит последнее значение.
+func parseLine(line string) (model.Metrics, error) {
+	fields := strings.Fields(line)
+	if len(fields) != 3 {
+		return model.Metrics{}, errors.New("expected \"path value timestamp\"")
+	}
+
+	path, rawValue, rawTS := fields[0], fields[1], fields[2]
+
+	value, err := strconv.ParseFloat(rawValue, 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		return model.Metrics{}, fmt.Errorf("invalid value %q", rawValue)
+	}
+
+	// collectd и carbon допускают -1 и дробные секунды в качестве метки времени
+	if _, err := strconv.ParseFloat(rawTS, 64); err != nil {
+		return model.Metrics{}, fmt.Errorf("invalid timestamp %q", rawTS)
+	}
+
+	return model.Metrics{
+		ID:    path,
+		MType: model.Gauge,
+		Value: &value,
+	}, nil
+}
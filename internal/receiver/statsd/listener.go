@@ -0,0 +1,186 @@
+// Package statsd реализует приём метрик по протоколу StatsD поверх UDP.
+// Пакеты преобразуются в model.Metrics и сохраняются через сервис метрик,
+// поэтому хранилище и аудит работают так же, как при приёме по HTTP.
+package statsd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"sync"
+
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/model"
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/service"
+	"go.uber.org/zap"
+)
+
+// maxPacketSize - максимальный размер UDP-датаграммы
+const maxPacketSize = 65535
+
+// MetricsService определяет методы сервиса метрик, нужные приёмнику StatsD.
+type MetricsService interface {
+	UpdateMetrics(ctx context.Context, metrics []model.Metrics, ipAddr string) error
+	GetGauge(ctx context.Context, name string) (float64, error)
+}
+
+// Listener принимает пакеты StatsD на UDP-адресе
+type Listener struct {
+	addr    string
+	service MetricsService
+	log     *zap.Logger
+
+	conn   net.PacketConn
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewListener(addr string, service MetricsService, log *zap.Logger) *Listener {
+	return &Listener{
+		addr:    addr,
+		service: service,
+		log:     log,
+	}
+}
+
+// Start открывает UDP-сокет и запускает обработку пакетов
+func (l *Listener) Start() error {
+	conn, err := net.ListenPacket("udp", l.addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen statsd on %s: %w", l.addr, err)
+	}
+
+	l.conn = conn
+	l.ctx, l.cancel = context.WithCancel(context.Background())
+
+	l.wg.Add(1)
+	go l.serve()
+
+	l.log.Info("statsd listener started", zap.String("addr", conn.LocalAddr().String()))
+	return nil
+}
+
+// Addr возвращает фактический адрес сокета
+func (l *Listener) Addr() net.Addr {
+	return l.conn.LocalAddr()
+}
+
+// Shutdown закрывает сокет и ждёт завершения обработки текущего пакета
+func (l *Listener) Shutdown(ctx context.Context) error {
+	if l.conn == nil {
+		return nil
+	}
+
+	err := l.conn.Close()
+	l.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		l.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		l.log.Info("statsd listener stopped")
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	if err != nil && !errors.Is(err, net.ErrClosed) {
+		return err
+	}
+	return nil
+}
+
+func (l *Listener) serve() {
+	defer l.wg.Done()
+
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, remote, err := l.conn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			l.log.Warn("statsd read failed", zap.Error(err))
+			continue
+		}
+
+		l.handlePacket(string(buf[:n]), remote.String())
+	}
+}
+
+// handlePacket разбирает пакет и сохраняет метрики одним батчем
+func (l *Listener) handlePacket(packet, remoteAddr string) {
+	samples, errs := parsePacket(packet)
+	for _, err := range errs {
+		l.log.Debug("skipping statsd line", zap.String("remote_addr", remoteAddr), zap.Error(err))
+	}
+
+	if len(samples) == 0 {
+		return
+	}
+
+	metrics := l.toMetrics(samples)
+	if len(metrics) == 0 {
+		return
+	}
+
+	if err := l.service.UpdateMetrics(l.ctx, metrics, remoteAddr); err != nil {
+		l.log.Error("failed to save statsd metrics",
+			zap.String("remote_addr", remoteAddr),
+			zap.Int("metrics_count", len(metrics)),
+			zap.Error(err))
+	}
+}
+
+// toMetrics преобразует сэмплы в батч model.Metrics.
+// Относительные gauge применяются к текущему значению: сначала из этого же пакета,
+// затем из хранилища. Отсутствующий gauge считается равным нулю; если хранилище
+// не вернуло значение по другой причине, изменение пропускается.
+func (l *Listener) toMetrics(samples []sample) []model.Metrics {
+	metrics := make([]model.Metrics, 0, len(samples))
+	gauges := make(map[string]float64)
+
+	for _, s := range samples {
+		switch s.mtype {
+		case typeCounter:
+			delta := int64(math.Round(s.value))
+			metrics = append(metrics, model.Metrics{
+				ID:    s.name,
+				MType: model.Counter,
+				Delta: &delta,
+			})
+
+		case typeGauge:
+			value := s.value
+			if s.relative {
+				current, ok := gauges[s.name]
+				if !ok {
+					stored, err := l.service.GetGauge(l.ctx, s.name)
+					switch {
+					case err == nil:
+						current = stored
+					case !errors.Is(err, service.ErrNotFound):
+						l.log.Warn("skipping statsd relative gauge: failed to get current value",
+							zap.String("metric_name", s.name), zap.Error(err))
+						continue
+					}
+				}
+				value += current
+			}
+			gauges[s.name] = value
+
+			metrics = append(metrics, model.Metrics{
+				ID:    s.name,
+				MType: model.Gauge,
+				Value: &value,
+			})
+		}
+	}
+
+	return metrics
+}
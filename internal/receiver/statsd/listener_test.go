@@ -0,0 +1,133 @@
+package statsd
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/mocks"
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/model"
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestParseLine(t *testing.T) {
+	tests := []struct {
+		name     string
+		line     string
+		expected sample
+		wantErr  bool
+	}{
+		{"counter", "requests:1|c", sample{name: "requests", mtype: typeCounter, value: 1}, false},
+		{"counter with sample rate", "requests:1|c|@0.1", sample{name: "requests", mtype: typeCounter, value: 10}, false},
+		{"gauge", "temp:21.5|g", sample{name: "temp", mtype: typeGauge, value: 21.5}, false},
+		{"gauge increment", "temp:+3|g", sample{name: "temp", mtype: typeGauge, value: 3, relative: true}, false},
+		{"gauge decrement", "temp:-2|g", sample{name: "temp", mtype: typeGauge, value: -2, relative: true}, false},
+		{"name with colon and tags", "app:hits:2|c|#env:prod", sample{name: "app:hits", mtype: typeCounter, value: 2}, false},
+		{"timer is unsupported", "latency:320|ms", sample{}, true},
+		{"missing type", "requests:1", sample{}, true},
+		{"missing name", ":1|c", sample{}, true},
+		{"invalid value", "requests:abc|c", sample{}, true},
+		{"invalid sample rate", "requests:1|c|@2", sample{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseLine(tt.line)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, got)
+		})
+	}
+}
+
+func TestParsePacket_SkipsInvalidLines(t *testing.T) {
+	samples, errs := parsePacket("a:1|c\nbroken\n\nb:2|g\n")
+
+	assert.Len(t, samples, 2)
+	assert.Len(t, errs, 1)
+}
+
+func TestListener_HandlePacket(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	metricsService := mocks.NewMockMetricsService(ctrl)
+	listener := NewListener("127.0.0.1:0", metricsService, zap.NewNop())
+	listener.ctx = context.Background()
+
+	metricsService.EXPECT().GetGauge(gomock.Any(), "temp").Return(20.0, nil)
+	metricsService.EXPECT().GetGauge(gomock.Any(), "fresh").Return(0.0, service.ErrNotFound)
+	// Текущее значение неизвестно: изменение пропускается, а не применяется к нулю
+	metricsService.EXPECT().GetGauge(gomock.Any(), "busy").
+		Return(0.0, fmt.Errorf("failed to get gauge: %w", service.ErrUnavailable))
+	metricsService.EXPECT().
+		UpdateMetrics(gomock.Any(), gomock.Any(), "10.0.0.1:1234").
+		DoAndReturn(func(_ context.Context, metrics []model.Metrics, _ string) error {
+			require.Len(t, metrics, 5)
+
+			assert.Equal(t, "hits", metrics[0].ID)
+			assert.Equal(t, int64(4), *metrics[0].Delta)
+
+			assert.Equal(t, "temp", metrics[1].ID)
+			assert.Equal(t, 23.0, *metrics[1].Value)
+
+			assert.Equal(t, "temp", metrics[2].ID)
+			assert.Equal(t, 22.0, *metrics[2].Value)
+
+			assert.Equal(t, "fresh", metrics[3].ID)
+			assert.Equal(t, -5.0, *metrics[3].Value)
+
+			assert.Equal(t, "level", metrics[4].ID)
+			assert.Equal(t, 7.5, *metrics[4].Value)
+			return nil
+		})
+
+	listener.handlePacket("hits:2|c|@0.5\ntemp:+3|g\ntemp:-1|g\nfresh:-5|g\nbusy:+1|g\nlevel:7.5|g\nlatency:3|ms",
+		"10.0.0.1:1234")
+}
+
+func TestListener_ReceivesAndShutsDown(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	service := mocks.NewMockMetricsService(ctrl)
+	listener := NewListener("127.0.0.1:0", service, zap.NewNop())
+	require.NoError(t, listener.Start())
+
+	received := make(chan []model.Metrics, 1)
+	service.EXPECT().
+		UpdateMetrics(gomock.Any(), gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, metrics []model.Metrics, _ string) error {
+			received <- metrics
+			return nil
+		})
+
+	conn, err := net.Dial("udp", listener.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("PollCount:1|c"))
+	require.NoError(t, err)
+
+	select {
+	case metrics := <-received:
+		require.Len(t, metrics, 1)
+		assert.Equal(t, "PollCount", metrics[0].ID)
+		assert.Equal(t, model.Counter, metrics[0].MType)
+	case <-time.After(2 * time.Second):
+		t.Fatal("statsd packet was not processed")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NoError(t, listener.Shutdown(ctx))
+}
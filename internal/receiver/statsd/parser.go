@@ -0,0 +1,101 @@
+package statsd
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Типы метрик StatsD, которые поддерживает сервер
+const (
+	typeCounter = "c"
+	typeGauge   = "g"
+)
+
+// errUnsupportedType - тип метрики StatsD, который сервер не хранит (ms, h, s и т.д.)
+var errUnsupportedType = errors.New("unsupported statsd metric type")
+
+// sample - одна разобранная строка StatsD
+type sample struct {
+	name  string
+	mtype string
+	value float64
+	// relative - gauge со знаком (+N/-N) изменяет текущее значение, а не заменяет его
+	relative bool
+}
+
+// parsePacket разбирает пакет StatsD: по одной метрике на строку.
+// Строки с ошибками пропускаются, ошибки возвращаются отдельно.
+func parsePacket(packet string) ([]sample, []error) {
+	var samples []sample
+	var errs []error
+
+	for _, line := range strings.Split(packet, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		s, err := parseLine(line)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("line %q: %w", line, err))
+			continue
+		}
+		samples = append(samples, s)
+	}
+
+	return samples, errs
+}
+
+// parseLine разбирает строку вида name:value|type[|@rate]
+func parseLine(line string) (sample, error) {
+	pipe := strings.IndexByte(line, '|')
+	if pipe < 0 {
+		return sample{}, errors.New("missing metric type")
+	}
+
+	// Имя может содержать ':', поэтому значение ищем по последнему ':' до первого '|'
+	colon := strings.LastIndexByte(line[:pipe], ':')
+	if colon <= 0 {
+		return sample{}, errors.New("missing metric name")
+	}
+
+	name := line[:colon]
+	parts := strings.Split(line[colon+1:], "|")
+
+	rawValue, mtype := parts[0], parts[1]
+	if mtype != typeCounter && mtype != typeGauge {
+		return sample{}, fmt.Errorf("%w: %s", errUnsupportedType, mtype)
+	}
+
+	value, err := strconv.ParseFloat(rawValue, 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		return sample{}, fmt.Errorf("invalid value %q", rawValue)
+	}
+
+	rate := 1.0
+	for _, part := range parts[2:] {
+		if !strings.HasPrefix(part, "@") {
+			// Теги (#tag) и прочие расширения игнорируются
+			continue
+		}
+		rate, err = strconv.ParseFloat(part[1:], 64)
+		if err != nil || rate <= 0 || rate > 1 {
+			return sample{}, fmt.Errorf("invalid sample rate %q", part)
+		}
+	}
+
+	s := sample{name: name, mtype: mtype, value: value}
+
+	switch mtype {
+	case typeCounter:
+		// Счётчик со sample rate масштабируется до полного количества событий
+		s.value = value / rate
+	case typeGauge:
+		s.relative = rawValue[0] == '+' || rawValue[0] == '-'
+	}
+
+	return s, nil
+}
@@ -0,0 +1,656 @@
+// Package boltstorage хранит метрики во встроенной базе bbolt в одном файле.
+// Подходит для установок без Postgres: каждая запись фиксируется транзакцией с fsync,
+// поэтому данные переживают перезапуск без периодического снапшота.
+package boltstorage
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"go.uber.org/zap"
+
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/config"
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/handler/pinghandler"
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/model"
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/service"
+)
+
+var _ service.Storage = (*boltstorage)(nil)
+var _ pinghandler.HealthChecker = (*boltstorage)(nil)
+
+// defaultHistorySize - сколько сэмплов хранится на метрику, если размер не задан
+const defaultHistorySize = 1000
+
+// openTimeout - сколько ждать блокировку файла, занятого другим процессом
+const openTimeout = time.Second
+
+var (
+	// gaugesBucket, countersBucket и histogramsBucket хранят значения по ключу ряда model.SeriesKey,
+	// гистограммы - в JSON
+	gaugesBucket     = []byte("gauges")
+	countersBucket   = []byte("counters")
+	histogramsBucket = []byte("histograms")
+	// samplesBucket содержит по вложенному бакету на метрику:
+	// ключ - порядковый номер сэмпла, значение - время и значение,
+	// для гистограммы - время, количество и сумма
+	samplesBucket = []byte("samples")
+	// keysBucket хранит ключи идемпотентности и время применения,
+	// keysByTimeBucket - те же ключи, упорядоченные по времени, для очистки устаревших
+	keysBucket       = []byte("idempotency_keys")
+	keysByTimeBucket = []byte("idempotency_keys_by_time")
+	// updatedBucket хранит время последнего обновления метрики по ключу historyKey
+	updatedBucket = []byte("updated_at")
+)
+
+type boltstorage struct {
+	db          *bolt.DB
+	log         *zap.Logger
+	historySize uint64
+}
+
+func NewBoltStorage(cfg *config.ServerFlags, log *zap.Logger) (*boltstorage, error) {
+	db, err := bolt.Open(cfg.BoltPath, 0600, &bolt.Options{Timeout: openTimeout})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open bolt file %s: %w", cfg.BoltPath, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{gaugesBucket, countersBucket, histogramsBucket, samplesBucket, keysBucket, keysByTimeBucket, updatedBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create buckets: %w", err)
+	}
+
+	historySize := cfg.HistorySize
+	if historySize <= 0 {
+		historySize = defaultHistorySize
+	}
+
+	return &boltstorage{
+		db:          db,
+		log:         log,
+		historySize: uint64(historySize),
+	}, nil
+}
+
+func (s *boltstorage) UpdateGauge(ctx context.Context, name string, value float64) error {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		return s.putGauge(tx, name, value, time.Now())
+	})
+	if err != nil {
+		s.log.Error("failed to update gauge",
+			zap.Error(err),
+			zap.String("metric name", name),
+			zap.Float64("value", value))
+		return wrapError(err)
+	}
+	return nil
+}
+
+func (s *boltstorage) UpdateCounter(ctx context.Context, name string, value int64) error {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		return s.addCounter(tx, name, value, time.Now())
+	})
+	if err != nil {
+		s.log.Error("failed to update counter",
+			zap.Error(err),
+			zap.String("metric name", name),
+			zap.Int64("metric value", value))
+		return wrapError(err)
+	}
+	return nil
+}
+
+func (s *boltstorage) UpdateHistogram(ctx context.Context, name string, value model.HistogramValue) error {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		return s.mergeHistogram(tx, name, value, time.Now())
+	})
+	if err != nil {
+		s.log.Error("failed to update histogram",
+			zap.Error(err),
+			zap.String("metric name", name))
+		return wrapError(err)
+	}
+	return nil
+}
+
+// UpdateMetrics применяет батч в одной транзакции: при ошибке не сохраняется ничего
+func (s *boltstorage) UpdateMetrics(ctx context.Context, metrics []model.Metrics) error {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		return s.applyMetrics(tx, metrics, time.Now())
+	})
+	if err != nil {
+		s.log.Error("failed to update metrics batch", zap.Error(err))
+		return wrapError(err)
+	}
+	return nil
+}
+
+// UpdateMetricsOnce применяет батч в одной транзакции с записью ключа идемпотентности
+func (s *boltstorage) UpdateMetricsOnce(ctx context.Context, key string, metrics []model.Metrics) (bool, error) {
+	var applied bool
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		now := time.Now()
+		if err := pruneKeys(tx, now.Add(-service.IdempotencyKeyTTL)); err != nil {
+			return fmt.Errorf("failed to prune idempotency keys: %w", err)
+		}
+
+		keys := tx.Bucket(keysBucket)
+		if keys.Get([]byte(key)) != nil {
+			return nil
+		}
+
+		if err := s.applyMetrics(tx, metrics, now); err != nil {
+			return err
+		}
+
+		appliedAt := encodeInt(now.UnixNano())
+		if err := keys.Put([]byte(key), appliedAt); err != nil {
+			return fmt.Errorf("failed to save idempotency key: %w", err)
+		}
+		if err := tx.Bucket(keysByTimeBucket).Put(append(appliedAt, key...), nil); err != nil {
+			return fmt.Errorf("failed to save idempotency key: %w", err)
+		}
+		applied = true
+		return nil
+	})
+	if err != nil {
+		s.log.Error("failed to update idempotent metrics batch",
+			zap.Error(err), zap.String("idempotency_key", key))
+		return false, wrapError(err)
+	}
+
+	if !applied {
+		s.log.Info("metrics batch already applied, skipping",
+			zap.String("idempotency_key", key))
+	}
+	return applied, nil
+}
+
+// pruneKeys удаляет ключи идемпотентности, примененные раньше before
+func pruneKeys(tx *bolt.Tx, before time.Time) error {
+	byTime := tx.Bucket(keysByTimeBucket)
+	keys := tx.Bucket(keysBucket)
+	cutoff := encodeInt(before.UnixNano())
+
+	c := byTime.Cursor()
+	for k, _ := c.First(); k != nil && bytes.Compare(k[:8], cutoff) < 0; k, _ = c.First() {
+		if err := keys.Delete(k[8:]); err != nil {
+			return err
+		}
+		if err := c.Delete(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyMetrics записывает батч метрик в рамках транзакции tx
+func (s *boltstorage) applyMetrics(tx *bolt.Tx, metrics []model.Metrics, now time.Time) error {
+	for _, metric := range metrics {
+		key := metric.Key()
+		// bbolt не принимает пустой ключ
+		if metric.ID == "" {
+			s.log.Warn("metric id is empty, skipping", zap.String("metric_type", metric.MType))
+			continue
+		}
+
+		switch metric.MType {
+		case model.Gauge:
+			if metric.Value == nil {
+				s.log.Warn("gauge metric value is nil, skipping",
+					zap.String("metric_id", metric.ID))
+				continue
+			}
+			if err := s.putGauge(tx, key, *metric.Value, now); err != nil {
+				return fmt.Errorf("failed to update gauge %s: %w", key, err)
+			}
+		case model.Counter:
+			if metric.Delta == nil {
+				s.log.Warn("counter metric delta is nil, skipping",
+					zap.String("metric_id", metric.ID))
+				continue
+			}
+			if err := s.addCounter(tx, key, *metric.Delta, now); err != nil {
+				return fmt.Errorf("failed to update counter %s: %w", key, err)
+			}
+		case model.Histogram:
+			if metric.Histogram == nil {
+				s.log.Warn("histogram metric value is nil, skipping",
+					zap.String("metric_id", metric.ID))
+				continue
+			}
+			if err := s.mergeHistogram(tx, key, *metric.Histogram, now); err != nil {
+				return fmt.Errorf("failed to update histogram %s: %w", key, err)
+			}
+		default:
+			s.log.Warn("unknown metric type, skipping",
+				zap.String("metric_type", metric.MType),
+				zap.String("metric_id", metric.ID))
+		}
+	}
+	return nil
+}
+
+func (s *boltstorage) putGauge(tx *bolt.Tx, name string, value float64, now time.Time) error {
+	encoded := encodeFloat(value)
+	if err := tx.Bucket(gaugesBucket).Put([]byte(name), encoded); err != nil {
+		return err
+	}
+	return s.appendSample(tx, model.Gauge, name, now, encoded)
+}
+
+func (s *boltstorage) addCounter(tx *bolt.Tx, name string, delta int64, now time.Time) error {
+	counters := tx.Bucket(countersBucket)
+	if existing := counters.Get([]byte(name)); existing != nil {
+		delta += decodeInt(existing)
+	}
+	encoded := encodeInt(delta)
+	if err := counters.Put([]byte(name), encoded); err != nil {
+		return err
+	}
+	return s.appendSample(tx, model.Counter, name, now, encoded)
+}
+
+func (s *boltstorage) mergeHistogram(tx *bolt.Tx, name string, delta model.HistogramValue, now time.Time) error {
+	histograms := tx.Bucket(histogramsBucket)
+	merged := delta
+	if existing := histograms.Get([]byte(name)); existing != nil {
+		current, err := decodeHistogram(existing)
+		if err != nil {
+			return err
+		}
+		if merged, err = current.Merge(delta); err != nil {
+			return err
+		}
+	}
+
+	encoded, err := json.Marshal(merged)
+	if err != nil {
+		return fmt.Errorf("failed to encode histogram: %w", err)
+	}
+	if err := histograms.Put([]byte(name), encoded); err != nil {
+		return err
+	}
+	return s.appendSample(tx, model.Histogram, name, now, append(encodeInt(merged.Count), encodeFloat(merged.Sum)...))
+}
+
+// appendSample добавляет сэмпл в историю метрики, обновляет время изменения
+// и удаляет самый старый сэмпл, если история длиннее historySize
+func (s *boltstorage) appendSample(tx *bolt.Tx, mtype, name string, now time.Time, value []byte) error {
+	key := []byte(historyKey(mtype, name))
+	if err := tx.Bucket(updatedBucket).Put(key, encodeInt(now.UnixNano())); err != nil {
+		return err
+	}
+
+	history, err := tx.Bucket(samplesBucket).CreateBucketIfNotExists(key)
+	if err != nil {
+		return err
+	}
+
+	seq, err := history.NextSequence()
+	if err != nil {
+		return err
+	}
+
+	sample := make([]byte, 0, 8+len(value))
+	sample = append(sample, encodeInt(now.UnixMilli())...)
+	sample = append(sample, value...)
+	if err := history.Put(encodeUint(seq), sample); err != nil {
+		return err
+	}
+
+	if seq > s.historySize {
+		return history.Delete(encodeUint(seq - s.historySize))
+	}
+	return nil
+}
+
+func (s *boltstorage) GetGauge(ctx context.Context, name string) (float64, error) {
+	var value []byte
+	err := s.db.View(func(tx *bolt.Tx) error {
+		value = bytes.Clone(tx.Bucket(gaugesBucket).Get([]byte(name)))
+		return nil
+	})
+	if err != nil {
+		s.log.Error("failed to get gauge", zap.Error(err), zap.String("metric_name", name))
+		return 0, wrapError(err)
+	}
+	if value == nil {
+		return 0, service.ErrNotFound
+	}
+	return decodeFloat(value), nil
+}
+
+func (s *boltstorage) GetCounter(ctx context.Context, name string) (int64, error) {
+	var delta []byte
+	err := s.db.View(func(tx *bolt.Tx) error {
+		delta = bytes.Clone(tx.Bucket(countersBucket).Get([]byte(name)))
+		return nil
+	})
+	if err != nil {
+		s.log.Error("failed to get counter", zap.Error(err), zap.String("metric_name", name))
+		return 0, wrapError(err)
+	}
+	if delta == nil {
+		return 0, service.ErrNotFound
+	}
+	return decodeInt(delta), nil
+}
+
+func (s *boltstorage) GetHistogram(ctx context.Context, name string) (model.HistogramValue, error) {
+	var value []byte
+	err := s.db.View(func(tx *bolt.Tx) error {
+		value = bytes.Clone(tx.Bucket(histogramsBucket).Get([]byte(name)))
+		return nil
+	})
+	if err != nil {
+		s.log.Error("failed to get histogram", zap.Error(err), zap.String("metric_name", name))
+		return model.HistogramValue{}, wrapError(err)
+	}
+	if value == nil {
+		return model.HistogramValue{}, service.ErrNotFound
+	}
+	return decodeHistogram(value)
+}
+
+func (s *boltstorage) ListMetrics(ctx context.Context, filter model.MetricsFilter) ([]model.Metrics, error) {
+	metrics := make([]model.Metrics, 0)
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		prefix := []byte(filter.Prefix)
+
+		if filter.MType == "" || filter.MType == model.Counter {
+			c := tx.Bucket(countersBucket).Cursor()
+			for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+				id, labels := model.ParseSeriesKey(string(k))
+				if !filter.Match(id, model.Counter, labels) {
+					continue
+				}
+				delta := decodeInt(v)
+				metrics = append(metrics, model.Metrics{ID: id, MType: model.Counter, Delta: &delta, Labels: labels})
+			}
+		}
+
+		if filter.MType == "" || filter.MType == model.Gauge {
+			c := tx.Bucket(gaugesBucket).Cursor()
+			for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+				id, labels := model.ParseSeriesKey(string(k))
+				if !filter.Match(id, model.Gauge, labels) {
+					continue
+				}
+				value := decodeFloat(v)
+				metrics = append(metrics, model.Metrics{ID: id, MType: model.Gauge, Value: &value, Labels: labels})
+			}
+		}
+
+		if filter.MType == "" || filter.MType == model.Histogram {
+			c := tx.Bucket(histogramsBucket).Cursor()
+			for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+				id, labels := model.ParseSeriesKey(string(k))
+				if !filter.Match(id, model.Histogram, labels) {
+					continue
+				}
+				histogram, err := decodeHistogram(v)
+				if err != nil {
+					return err
+				}
+				metrics = append(metrics, model.Metrics{ID: id, MType: model.Histogram, Histogram: &histogram, Labels: labels})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		s.log.Error("failed to list metrics", zap.Error(err))
+		return nil, wrapError(err)
+	}
+
+	// Бакеты отсортированы по ключу ряда, а не по имени, поэтому сортировка нужна заново
+	model.SortMetrics(metrics)
+
+	return paginate(metrics, filter.Limit, filter.Offset), nil
+}
+
+// paginate возвращает страницу отсортированного списка
+func paginate(metrics []model.Metrics, limit, offset int) []model.Metrics {
+	if offset >= len(metrics) {
+		return []model.Metrics{}
+	}
+	if offset > 0 {
+		metrics = metrics[offset:]
+	}
+	if limit > 0 && limit < len(metrics) {
+		metrics = metrics[:limit]
+	}
+	return metrics
+}
+
+func (s *boltstorage) GetHistory(ctx context.Context, mtype, name string, from, to time.Time) ([]model.MetricSample, error) {
+	samples := make([]model.MetricSample, 0)
+	fromMs, toMs := from.UnixMilli(), to.UnixMilli()
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		history := tx.Bucket(samplesBucket).Bucket([]byte(historyKey(mtype, name)))
+		if history == nil {
+			return nil
+		}
+
+		return history.ForEach(func(_, v []byte) error {
+			ts := decodeInt(v[:8])
+			if ts < fromMs || ts > toMs {
+				return nil
+			}
+
+			sample := model.MetricSample{TS: ts}
+			switch mtype {
+			case model.Gauge:
+				value := decodeFloat(v[8:])
+				sample.Value = &value
+			case model.Counter:
+				delta := decodeInt(v[8:])
+				sample.Delta = &delta
+			case model.Histogram:
+				count, sum := decodeInt(v[8:16]), decodeFloat(v[16:])
+				sample.Delta, sample.Value = &count, &sum
+			}
+			samples = append(samples, sample)
+			return nil
+		})
+	})
+	if err != nil {
+		s.log.Error("failed to get metric history",
+			zap.Error(err),
+			zap.String("metric_type", mtype),
+			zap.String("metric_name", name))
+		return nil, wrapError(err)
+	}
+
+	return samples, nil
+}
+
+func (s *boltstorage) DeleteMetric(ctx context.Context, mtype, name string) error {
+	var found bool
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		values := valuesBucket(tx, mtype)
+		found = values != nil && values.Get([]byte(name)) != nil
+		if !found {
+			return nil
+		}
+		return removeMetric(tx, mtype, name)
+	})
+	if err != nil {
+		s.log.Error("failed to delete metric",
+			zap.Error(err),
+			zap.String("metric_type", mtype),
+			zap.String("metric_name", name))
+		return wrapError(err)
+	}
+	if !found {
+		return service.ErrNotFound
+	}
+	return nil
+}
+
+func (s *boltstorage) DeleteMetrics(ctx context.Context, filter model.MetricsFilter) ([]model.Metrics, error) {
+	deleted := make([]model.Metrics, 0)
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		prefix := []byte(filter.Prefix)
+		for _, mtype := range []string{model.Counter, model.Gauge, model.Histogram} {
+			if filter.MType != "" && filter.MType != mtype {
+				continue
+			}
+			c := valuesBucket(tx, mtype).Cursor()
+			for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+				id, labels := model.ParseSeriesKey(string(k))
+				if filter.Match(id, mtype, labels) {
+					deleted = append(deleted, model.Metrics{ID: id, MType: mtype, Labels: labels})
+				}
+			}
+		}
+		return removeMetrics(tx, deleted)
+	})
+	if err != nil {
+		s.log.Error("failed to delete metrics", zap.Error(err), zap.String("prefix", filter.Prefix))
+		return nil, wrapError(err)
+	}
+
+	model.SortMetrics(deleted)
+	return deleted, nil
+}
+
+func (s *boltstorage) DeleteStale(ctx context.Context, before time.Time) ([]model.Metrics, error) {
+	deleted := make([]model.Metrics, 0)
+	cutoff := before.UnixNano()
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		err := tx.Bucket(updatedBucket).ForEach(func(k, v []byte) error {
+			if decodeInt(v) >= cutoff {
+				return nil
+			}
+			mtype, key, ok := strings.Cut(string(k), "/")
+			if ok {
+				id, labels := model.ParseSeriesKey(key)
+				deleted = append(deleted, model.Metrics{ID: id, MType: mtype, Labels: labels})
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return removeMetrics(tx, deleted)
+	})
+	if err != nil {
+		s.log.Error("failed to delete stale metrics", zap.Error(err))
+		return nil, wrapError(err)
+	}
+
+	model.SortMetrics(deleted)
+	return deleted, nil
+}
+
+// removeMetrics удаляет метрики вместе с историей и временем обновления
+func removeMetrics(tx *bolt.Tx, metrics []model.Metrics) error {
+	for _, metric := range metrics {
+		if err := removeMetric(tx, metric.MType, metric.Key()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func removeMetric(tx *bolt.Tx, mtype, name string) error {
+	if err := valuesBucket(tx, mtype).Delete([]byte(name)); err != nil {
+		return err
+	}
+
+	key := []byte(historyKey(mtype, name))
+	if err := tx.Bucket(updatedBucket).Delete(key); err != nil {
+		return err
+	}
+
+	samples := tx.Bucket(samplesBucket)
+	if samples.Bucket(key) == nil {
+		return nil
+	}
+	return samples.DeleteBucket(key)
+}
+
+// valuesBucket возвращает бакет значений для типа метрики или nil для неизвестного типа
+func valuesBucket(tx *bolt.Tx, mtype string) *bolt.Bucket {
+	switch mtype {
+	case model.Gauge:
+		return tx.Bucket(gaugesBucket)
+	case model.Counter:
+		return tx.Bucket(countersBucket)
+	case model.Histogram:
+		return tx.Bucket(histogramsBucket)
+	}
+	return nil
+}
+
+// Ping проверяет, что файл базы открыт
+func (s *boltstorage) Ping(ctx context.Context) error {
+	return wrapError(s.db.View(func(tx *bolt.Tx) error { return nil }))
+}
+
+func (s *boltstorage) Close() error {
+	return s.db.Close()
+}
+
+// wrapError помечает ошибку закрытой базы как service.ErrUnavailable
+func wrapError(err error) error {
+	if errors.Is(err, bolt.ErrDatabaseNotOpen) {
+		return fmt.Errorf("%w: %w", service.ErrUnavailable, err)
+	}
+	return err
+}
+
+// historyKey - имя бакета истории метрики
+func historyKey(mtype, name string) string {
+	return mtype + "/" + name
+}
+
+func decodeHistogram(b []byte) (model.HistogramValue, error) {
+	var histogram model.HistogramValue
+	if err := json.Unmarshal(b, &histogram); err != nil {
+		return model.HistogramValue{}, fmt.Errorf("failed to decode histogram: %w", err)
+	}
+	return histogram, nil
+}
+
+func encodeUint(v uint64) []byte {
+	return binary.BigEndian.AppendUint64(make([]byte, 0, 8), v)
+}
+
+// encodeInt кодирует число со сдвигом знака, чтобы порядок байтов совпадал с порядком чисел
+func encodeInt(v int64) []byte {
+	return encodeUint(uint64(v) ^ (1 << 63))
+}
+
+func decodeInt(b []byte) int64 {
+	return int64(binary.BigEndian.Uint64(b) ^ (1 << 63))
+}
+
+func encodeFloat(v float64) []byte {
+	return encodeUint(math.Float64bits(v))
+}
+
+func decodeFloat(b []byte) float64 {
+	return math.Float64frombits(binary.BigEndian.Uint64(b))
+}
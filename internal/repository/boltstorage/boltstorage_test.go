@@ -0,0 +1,173 @@
+package boltstorage
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+	"go.uber.org/zap/zaptest"
+
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/config"
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/model"
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/repository/storagetest"
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/service"
+)
+
+func newTestStorage(t *testing.T, cfg *config.ServerFlags) *boltstorage {
+	t.Helper()
+	if cfg.BoltPath == "" {
+		cfg.BoltPath = filepath.Join(t.TempDir(), "metrics.db")
+	}
+
+	storage, err := NewBoltStorage(cfg, zaptest.NewLogger(t))
+	require.NoError(t, err)
+	t.Cleanup(func() { storage.Close() })
+	return storage
+}
+
+func TestBoltStorage_SameNameDifferentTypes(t *testing.T) {
+	storagetest.SameNameDifferentTypes(t, newTestStorage(t, &config.ServerFlags{}))
+}
+
+func TestBoltStorage_DuplicateIDsInBatch(t *testing.T) {
+	storagetest.DuplicateIDsInBatch(t, newTestStorage(t, &config.ServerFlags{}))
+}
+
+func TestBoltStorage_DeleteAndExpire(t *testing.T) {
+	storagetest.DeleteAndExpire(t, newTestStorage(t, &config.ServerFlags{}))
+}
+
+func TestBoltStorage_Labels(t *testing.T) {
+	storagetest.Labels(t, newTestStorage(t, &config.ServerFlags{}))
+}
+
+func TestBoltStorage_Histograms(t *testing.T) {
+	storagetest.Histograms(t, newTestStorage(t, &config.ServerFlags{}))
+}
+
+func TestBoltStorage_RestoreAfterRestart(t *testing.T) {
+	cfg := &config.ServerFlags{BoltPath: filepath.Join(t.TempDir(), "metrics.db")}
+	ctx := context.Background()
+
+	storage, err := NewBoltStorage(cfg, zaptest.NewLogger(t))
+	require.NoError(t, err)
+
+	delta := int64(3)
+	value := 1.5
+	require.NoError(t, storage.UpdateMetrics(ctx, []model.Metrics{
+		{ID: "PollCount", MType: model.Counter, Delta: &delta},
+		{ID: "Alloc", MType: model.Gauge, Value: &value},
+	}))
+	applied, err := storage.UpdateMetricsOnce(ctx, "batch-1", []model.Metrics{
+		{ID: "PollCount", MType: model.Counter, Delta: &delta},
+	})
+	require.NoError(t, err)
+	require.True(t, applied)
+	require.NoError(t, storage.Close())
+
+	restored := newTestStorage(t, cfg)
+
+	counter, err := restored.GetCounter(ctx, "PollCount")
+	require.NoError(t, err)
+	assert.Equal(t, int64(6), counter)
+
+	gauge, err := restored.GetGauge(ctx, "Alloc")
+	require.NoError(t, err)
+	assert.Equal(t, 1.5, gauge)
+
+	// Ключ идемпотентности тоже переживает перезапуск
+	applied, err = restored.UpdateMetricsOnce(ctx, "batch-1", []model.Metrics{
+		{ID: "PollCount", MType: model.Counter, Delta: &delta},
+	})
+	require.NoError(t, err)
+	assert.False(t, applied)
+}
+
+func TestBoltStorage_UpdateMetricsOnce(t *testing.T) {
+	storage := newTestStorage(t, &config.ServerFlags{})
+	ctx := context.Background()
+	delta := int64(2)
+	batch := []model.Metrics{{ID: "PollCount", MType: model.Counter, Delta: &delta}}
+
+	applied, err := storage.UpdateMetricsOnce(ctx, "key", batch)
+	require.NoError(t, err)
+	assert.True(t, applied)
+
+	applied, err = storage.UpdateMetricsOnce(ctx, "key", batch)
+	require.NoError(t, err)
+	assert.False(t, applied)
+
+	counter, err := storage.GetCounter(ctx, "PollCount")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), counter)
+}
+
+func TestBoltStorage_ListMetricsFilter(t *testing.T) {
+	storage := newTestStorage(t, &config.ServerFlags{})
+	ctx := context.Background()
+
+	require.NoError(t, storage.UpdateGauge(ctx, "HeapAlloc", 1))
+	require.NoError(t, storage.UpdateGauge(ctx, "HeapInuse", 2))
+	require.NoError(t, storage.UpdateGauge(ctx, "Alloc", 3))
+	require.NoError(t, storage.UpdateCounter(ctx, "HeapCount", 4))
+
+	metrics, err := storage.ListMetrics(ctx, model.MetricsFilter{Prefix: "Heap"})
+	require.NoError(t, err)
+	require.Len(t, metrics, 3)
+	assert.Equal(t, "HeapAlloc", metrics[0].ID)
+	assert.Equal(t, "HeapCount", metrics[1].ID)
+	assert.Equal(t, "HeapInuse", metrics[2].ID)
+
+	metrics, err = storage.ListMetrics(ctx, model.MetricsFilter{Prefix: "Heap", MType: model.Gauge, Limit: 1, Offset: 1})
+	require.NoError(t, err)
+	require.Len(t, metrics, 1)
+	assert.Equal(t, "HeapInuse", metrics[0].ID)
+}
+
+func TestBoltStorage_HistoryIsBounded(t *testing.T) {
+	storage := newTestStorage(t, &config.ServerFlags{HistorySize: 3})
+	ctx := context.Background()
+	from := time.Now().Add(-time.Second)
+
+	for i := 1; i <= 5; i++ {
+		require.NoError(t, storage.UpdateGauge(ctx, "Alloc", float64(i)))
+	}
+
+	samples, err := storage.GetHistory(ctx, model.Gauge, "Alloc", from, time.Now().Add(time.Second))
+	require.NoError(t, err)
+	require.Len(t, samples, 3)
+	assert.Equal(t, 3.0, *samples[0].Value)
+	assert.Equal(t, 5.0, *samples[2].Value)
+}
+
+func TestBoltStorage_PruneKeys(t *testing.T) {
+	storage := newTestStorage(t, &config.ServerFlags{})
+	ctx := context.Background()
+
+	_, err := storage.UpdateMetricsOnce(ctx, "old", nil)
+	require.NoError(t, err)
+
+	// Ключ, примененный раньше границы, удаляется из обоих бакетов
+	require.NoError(t, storage.db.Update(func(tx *bolt.Tx) error {
+		return pruneKeys(tx, time.Now().Add(time.Second))
+	}))
+
+	applied, err := storage.UpdateMetricsOnce(ctx, "old", nil)
+	require.NoError(t, err)
+	assert.True(t, applied)
+}
+
+func TestBoltStorage_ClosedIsUnavailable(t *testing.T) {
+	storage := newTestStorage(t, &config.ServerFlags{})
+	ctx := context.Background()
+	require.NoError(t, storage.Close())
+
+	assert.ErrorIs(t, storage.Ping(ctx), service.ErrUnavailable)
+	_, err := storage.GetGauge(ctx, "Alloc")
+	assert.ErrorIs(t, err, service.ErrUnavailable)
+	assert.ErrorIs(t, storage.UpdateGauge(ctx, "Alloc", 1), service.ErrUnavailable)
+}
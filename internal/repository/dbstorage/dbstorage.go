@@ -3,10 +3,11 @@ package dbstorage
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
-	"strconv"
 	"strings"
+	"time"
 
 	"github.com/jackc/pgconn"
 	"github.com/jackc/pgerrcode"
@@ -27,6 +28,9 @@ type dbstorage struct {
 	db       *pgxpool.Pool
 	log      *zap.Logger
 	retryCfg retry.RetryConfig
+	// writeRetryCfg повторяет запись, только если она точно не сохранена:
+	// повтор после неоднозначной ошибки применил бы запись дважды
+	writeRetryCfg retry.RetryConfig
 }
 
 func NewDBStorage(db *pgxpool.Pool, log *zap.Logger, cfg *config.ServerFlags) (*dbstorage, error) {
@@ -43,21 +47,31 @@ func NewDBStorage(db *pgxpool.Pool, log *zap.Logger, cfg *config.ServerFlags) (*
 			Delays:        retryDelays,
 			IsRetryableFn: isConnectionError,
 		},
+		writeRetryCfg: retry.RetryConfig{
+			MaxRetries:    cfg.MaxRetries,
+			Delays:        retryDelays,
+			IsRetryableFn: isRetryableWrite,
+		},
 	}
 	return storage, nil
 }
 
 func (db *dbstorage) UpdateGauge(ctx context.Context, name string, value float64) error {
 	query := `
-		INSERT INTO metrics (id, mtype, value)
-		VALUES ($1, 'gauge', $2)
-		ON CONFLICT (id) DO UPDATE
-		SET value = EXCLUDED.value;
+		WITH upserted AS (
+			INSERT INTO metrics (id, mtype, value, name, labels)
+			VALUES ($1, 'gauge', $2, $3, $4::jsonb)
+			ON CONFLICT (id, mtype) DO UPDATE
+			SET value = EXCLUDED.value, updated_at = now()
+			RETURNING id, mtype, value
+		)
+		INSERT INTO metric_samples (id, mtype, value)
+		SELECT id, mtype, value FROM upserted;
 	`
 
-	err := retry.Do(ctx, db.retryCfg, func() error {
-		_, execErr := db.db.Exec(ctx, query, name, value)
-		return execErr
+	id, labels := model.ParseSeriesKey(name)
+	err := retry.Do(ctx, db.writeRetryCfg, func() error {
+		return db.execWrite(ctx, query, name, value, id, labelsJSON(labels))
 	})
 
 	if err != nil {
@@ -67,7 +81,7 @@ func (db *dbstorage) UpdateGauge(ctx context.Context, name string, value float64
 			zap.String("metric name", name),
 			zap.Float64("value", value),
 		)
-		return err
+		return wrapError(err)
 	}
 
 	return nil
@@ -75,15 +89,20 @@ func (db *dbstorage) UpdateGauge(ctx context.Context, name string, value float64
 
 func (db *dbstorage) UpdateCounter(ctx context.Context, name string, value int64) error {
 	query := `
-		INSERT INTO metrics (id, mtype, delta)
-		VALUES ($1, 'counter', $2)
-		ON CONFLICT (id) DO UPDATE
-		SET delta = metrics.delta + $2;
+		WITH upserted AS (
+			INSERT INTO metrics (id, mtype, delta, name, labels)
+			VALUES ($1, 'counter', $2, $3, $4::jsonb)
+			ON CONFLICT (id, mtype) DO UPDATE
+			SET delta = metrics.delta + $2, updated_at = now()
+			RETURNING id, mtype, delta
+		)
+		INSERT INTO metric_samples (id, mtype, delta)
+		SELECT id, mtype, delta FROM upserted;
 	`
 
-	err := retry.Do(ctx, db.retryCfg, func() error {
-		_, execErr := db.db.Exec(ctx, query, name, value)
-		return execErr
+	id, labels := model.ParseSeriesKey(name)
+	err := retry.Do(ctx, db.writeRetryCfg, func() error {
+		return db.execWrite(ctx, query, name, value, id, labelsJSON(labels))
 	})
 
 	if err != nil {
@@ -94,77 +113,75 @@ func (db *dbstorage) UpdateCounter(ctx context.Context, name string, value int64
 			zap.Int64("metric value", value),
 		)
 
-		return err
+		return wrapError(err)
+	}
+
+	return nil
+}
+
+// histogramQuery добавляет приращение к гистограмме: delta - количество наблюдений, value - сумма.
+// Корзины складываются поэлементно. Если границы изменились, строка не обновляется
+// и сэмпл истории не добавляется: запрос затрагивает ноль строк.
+const histogramQuery = `
+	WITH upserted AS (
+		INSERT INTO metrics (id, mtype, delta, value, buckets, bucket_counts, name, labels)
+		VALUES ($1, 'histogram', $2, $3, $4, $5, $6, $7::jsonb)
+		ON CONFLICT (id, mtype) DO UPDATE
+		SET delta = metrics.delta + EXCLUDED.delta,
+			value = metrics.value + EXCLUDED.value,
+			bucket_counts = ARRAY(
+				SELECT old + new
+				FROM unnest(metrics.bucket_counts, EXCLUDED.bucket_counts) WITH ORDINALITY AS c(old, new, n)
+				ORDER BY n),
+			updated_at = now()
+		WHERE metrics.buckets = EXCLUDED.buckets
+		RETURNING id, mtype, delta, value
+	)
+	INSERT INTO metric_samples (id, mtype, delta, value)
+	SELECT id, mtype, delta, value FROM upserted;`
+
+// histogramArgs возвращает параметры histogramQuery для ключа ряда name
+func histogramArgs(name string, value model.HistogramValue) []any {
+	id, labels := model.ParseSeriesKey(name)
+	return []any{name, value.Count, value.Sum, value.Buckets, value.Counts, id, labelsJSON(labels)}
+}
+
+func (db *dbstorage) UpdateHistogram(ctx context.Context, name string, value model.HistogramValue) error {
+	args := histogramArgs(name, value)
+	err := retry.Do(ctx, db.writeRetryCfg, func() error {
+		return db.updateHistogram(ctx, name, args)
+	})
+
+	if err != nil {
+		db.log.Error(
+			"failed to update histogram",
+			zap.Error(err),
+			zap.String("metric name", name),
+		)
+		return wrapError(err)
 	}
 
 	return nil
 }
 
 func (db *dbstorage) UpdateMetrics(ctx context.Context, metrics []model.Metrics) error {
-	err := retry.Do(ctx, db.retryCfg, func() error {
+	err := retry.Do(ctx, db.writeRetryCfg, func() error {
 		tx, txErr := db.db.Begin(ctx)
 		if txErr != nil {
-			return txErr
+			return notApplied(txErr)
 		}
 		defer tx.Rollback(ctx)
 
-		gaugeQuery := `
-			INSERT INTO metrics (id, mtype, value)
-			VALUES ($1, 'gauge', $2)
-			ON CONFLICT (id) DO UPDATE
-			SET value = EXCLUDED.value;`
-
-		counterQuery := `
-			INSERT INTO metrics (id, mtype, delta)
-			VALUES ($1, 'counter', $2)
-			ON CONFLICT (id) DO UPDATE
-			SET delta = metrics.delta + EXCLUDED.delta;`
-
-		for _, metric := range metrics {
-			switch metric.MType {
-			case model.Gauge:
-				if metric.Value == nil {
-					db.log.Warn("gauge metric value is nil, skipping",
-						zap.String("metric_id", metric.ID))
-					continue
-				}
-				_, err := tx.Exec(ctx, gaugeQuery, metric.ID, *metric.Value)
-				if err != nil {
-					db.log.Error("failed to update gauge metric in batch",
-						zap.Error(err),
-						zap.String("metric_id", metric.ID),
-						zap.Float64("value", *metric.Value))
-					return fmt.Errorf("failed to update gauge metric %s: %w", metric.ID, err)
-				}
-
-			case model.Counter:
-				if metric.Delta == nil {
-					db.log.Warn("counter metric delta is nil, skipping",
-						zap.String("metric_id", metric.ID))
-					continue
-				}
-				_, err := tx.Exec(ctx, counterQuery, metric.ID, *metric.Delta)
-				if err != nil {
-					db.log.Error("failed to update counter metric in batch",
-						zap.Error(err),
-						zap.String("metric_id", metric.ID),
-						zap.Int64("delta", *metric.Delta))
-					return fmt.Errorf("failed to update counter metric %s: %w", metric.ID, err)
-				}
-
-			default:
-				db.log.Warn("unknown metric type, skipping",
-					zap.String("metric_type", metric.MType),
-					zap.String("metric_id", metric.ID))
-			}
+		if err := db.applyMetrics(ctx, tx, metrics); err != nil {
+			return notApplied(err)
 		}
 
-		return tx.Commit(ctx)
+		return classifyWriteError(tx.Commit(ctx))
 	})
 
 	if err != nil {
 		db.log.Error("failed to update metrics batch after retries", zap.Error(err))
-		return err
+		return wrapError(err)
 	}
 
 	db.log.Info("successfully updated metrics batch",
@@ -172,113 +189,527 @@ func (db *dbstorage) UpdateMetrics(ctx context.Context, metrics []model.Metrics)
 	return nil
 }
 
-func (db *dbstorage) GetGauge(ctx context.Context, name string) (float64, bool) {
-	var value float64
-	var found bool
+// UpdateMetricsOnce применяет батч в одной транзакции с записью ключа в idempotency_keys.
+// Если ключ уже записан, транзакция откатывается и батч не применяется повторно.
+// Повтор после неоднозначной ошибки безопасен: ключ не даст применить батч дважды.
+func (db *dbstorage) UpdateMetricsOnce(ctx context.Context, key string, metrics []model.Metrics) (bool, error) {
+	var applied bool
 
 	err := retry.Do(ctx, db.retryCfg, func() error {
-		err := db.db.QueryRow(ctx, `SELECT value FROM metrics WHERE id = $1 AND mtype = 'gauge';`, name).Scan(&value)
+		applied = false
+
+		tx, txErr := db.db.Begin(ctx)
+		if txErr != nil {
+			return notApplied(txErr)
+		}
+		defer tx.Rollback(ctx)
+
+		_, err := tx.Exec(ctx,
+			`DELETE FROM idempotency_keys WHERE applied_at < $1;`,
+			time.Now().Add(-service.IdempotencyKeyTTL))
 		if err != nil {
-			if errors.Is(err, pgx.ErrNoRows) {
-				return nil
-			}
-			return err
+			return notApplied(fmt.Errorf("failed to prune idempotency keys: %w", err))
+		}
+
+		tag, err := tx.Exec(ctx,
+			`INSERT INTO idempotency_keys (key) VALUES ($1) ON CONFLICT (key) DO NOTHING;`,
+			key)
+		if err != nil {
+			return notApplied(fmt.Errorf("failed to save idempotency key: %w", err))
+		}
+		if tag.RowsAffected() == 0 {
+			return nil
+		}
+
+		if err := db.applyMetrics(ctx, tx, metrics); err != nil {
+			return notApplied(err)
 		}
-		found = true
+
+		if err := tx.Commit(ctx); err != nil {
+			return classifyWriteError(err)
+		}
+		applied = true
 		return nil
 	})
 
 	if err != nil {
-		db.log.Error("failed to get gauge after retries", zap.Error(err), zap.String("metric_name", name))
-		return 0.0, false
+		db.log.Error("failed to update idempotent metrics batch after retries",
+			zap.Error(err), zap.String("idempotency_key", key))
+		return false, wrapError(err)
 	}
 
-	if !found {
-		return 0.0, false
+	if !applied {
+		db.log.Info("metrics batch already applied, skipping",
+			zap.String("idempotency_key", key))
 	}
-	return value, true
+	return applied, nil
 }
 
-func (db *dbstorage) GetCounter(ctx context.Context, name string) (int64, bool) {
-	var delta int64
+// gaugeBatchQuery обновляет все gauge батча одним запросом
+const gaugeBatchQuery = `
+	WITH upserted AS (
+		INSERT INTO metrics (id, mtype, value, name, labels)
+		SELECT id, 'gauge', value, name, labels::jsonb
+		FROM unnest($1::text[], $2::double precision[], $3::text[], $4::text[]) AS batch(id, value, name, labels)
+		ON CONFLICT (id, mtype) DO UPDATE
+		SET value = EXCLUDED.value, updated_at = now()
+		RETURNING id, mtype, value
+	)
+	INSERT INTO metric_samples (id, mtype, value)
+	SELECT id, mtype, value FROM upserted;`
+
+// counterBatchQuery обновляет все counter батча одним запросом
+const counterBatchQuery = `
+	WITH upserted AS (
+		INSERT INTO metrics (id, mtype, delta, name, labels)
+		SELECT id, 'counter', delta, name, labels::jsonb
+		FROM unnest($1::text[], $2::bigint[], $3::text[], $4::text[]) AS batch(id, delta, name, labels)
+		ON CONFLICT (id, mtype) DO UPDATE
+		SET delta = metrics.delta + EXCLUDED.delta, updated_at = now()
+		RETURNING id, mtype, delta
+	)
+	INSERT INTO metric_samples (id, mtype, delta)
+	SELECT id, mtype, delta FROM upserted;`
+
+// metricsBatch - батч, сгруппированный по типам для запросов с unnest.
+// ID - ключи рядов (model.SeriesKey), Names и Labels - имена и метки в JSON для колонок name и labels.
+// ON CONFLICT DO UPDATE не может обновить одну строку дважды за запрос,
+// поэтому повторы ключа схлопываются заранее: counter суммируются, для gauge берется последнее значение,
+// гистограммы объединяются model.HistogramValue.Merge.
+// Корзины гистограмм не разворачиваются через unnest, поэтому гистограммы пишутся отдельными запросами.
+type metricsBatch struct {
+	gaugeIDs      []string
+	gaugeValues   []float64
+	gaugeNames    []string
+	gaugeLabels   []string
+	counterIDs    []string
+	counterDeltas []int64
+	counterNames  []string
+	counterLabels []string
+	histogramIDs  []string
+	histograms    []model.HistogramValue
+}
 
-	err := retry.Do(ctx, db.retryCfg, func() error {
-		err := db.db.QueryRow(ctx, `SELECT delta FROM metrics WHERE id = $1 AND mtype = 'counter';`, name).Scan(&delta)
-		if err != nil {
-			if errors.Is(err, pgx.ErrNoRows) {
-				return nil
+// newMetricsBatch группирует метрики по типам, сохраняя порядок первого появления ключа.
+// Возвращает model.ErrBucketsMismatch, если у гистограмм одного ряда разные границы.
+func (db *dbstorage) newMetricsBatch(metrics []model.Metrics) (metricsBatch, error) {
+	var batch metricsBatch
+	gauges := make(map[string]int)
+	counters := make(map[string]int)
+	histograms := make(map[string]int)
+
+	for _, metric := range metrics {
+		key := metric.Key()
+		switch metric.MType {
+		case model.Gauge:
+			if metric.Value == nil {
+				db.log.Warn("gauge metric value is nil, skipping",
+					zap.String("metric_id", key))
+				continue
 			}
-			return err
+			if i, ok := gauges[key]; ok {
+				batch.gaugeValues[i] = *metric.Value
+				continue
+			}
+			id, labels := model.ParseSeriesKey(key)
+			gauges[key] = len(batch.gaugeIDs)
+			batch.gaugeIDs = append(batch.gaugeIDs, key)
+			batch.gaugeValues = append(batch.gaugeValues, *metric.Value)
+			batch.gaugeNames = append(batch.gaugeNames, id)
+			batch.gaugeLabels = append(batch.gaugeLabels, labelsJSON(labels))
+
+		case model.Counter:
+			if metric.Delta == nil {
+				db.log.Warn("counter metric delta is nil, skipping",
+					zap.String("metric_id", key))
+				continue
+			}
+			if i, ok := counters[key]; ok {
+				batch.counterDeltas[i] += *metric.Delta
+				continue
+			}
+			id, labels := model.ParseSeriesKey(key)
+			counters[key] = len(batch.counterIDs)
+			batch.counterIDs = append(batch.counterIDs, key)
+			batch.counterDeltas = append(batch.counterDeltas, *metric.Delta)
+			batch.counterNames = append(batch.counterNames, id)
+			batch.counterLabels = append(batch.counterLabels, labelsJSON(labels))
+
+		case model.Histogram:
+			if metric.Histogram == nil {
+				db.log.Warn("histogram metric value is nil, skipping",
+					zap.String("metric_id", key))
+				continue
+			}
+			if i, ok := histograms[key]; ok {
+				merged, err := batch.histograms[i].Merge(*metric.Histogram)
+				if err != nil {
+					return metricsBatch{}, fmt.Errorf("%s: %w", key, err)
+				}
+				batch.histograms[i] = merged
+				continue
+			}
+			histograms[key] = len(batch.histogramIDs)
+			batch.histogramIDs = append(batch.histogramIDs, key)
+			batch.histograms = append(batch.histograms, *metric.Histogram)
+
+		default:
+			db.log.Warn("unknown metric type, skipping",
+				zap.String("metric_type", metric.MType),
+				zap.String("metric_id", metric.ID))
 		}
-		return nil
+	}
+
+	return batch, nil
+}
+
+// applyMetrics записывает батч метрик в рамках транзакции tx:
+// не больше одного запроса на gauge и одного на counter, плюс по запросу на гистограмму
+func (db *dbstorage) applyMetrics(ctx context.Context, tx pgx.Tx, metrics []model.Metrics) error {
+	batch, err := db.newMetricsBatch(metrics)
+	if err != nil {
+		return err
+	}
+
+	if len(batch.gaugeIDs) > 0 {
+		if _, err := tx.Exec(ctx, gaugeBatchQuery,
+			batch.gaugeIDs, batch.gaugeValues, batch.gaugeNames, batch.gaugeLabels); err != nil {
+			db.log.Error("failed to update gauge metrics in batch",
+				zap.Error(err),
+				zap.Int("metrics_count", len(batch.gaugeIDs)))
+			return fmt.Errorf("failed to update gauge metrics: %w", err)
+		}
+	}
+
+	if len(batch.counterIDs) > 0 {
+		if _, err := tx.Exec(ctx, counterBatchQuery,
+			batch.counterIDs, batch.counterDeltas, batch.counterNames, batch.counterLabels); err != nil {
+			db.log.Error("failed to update counter metrics in batch",
+				zap.Error(err),
+				zap.Int("metrics_count", len(batch.counterIDs)))
+			return fmt.Errorf("failed to update counter metrics: %w", err)
+		}
+	}
+
+	for i, key := range batch.histogramIDs {
+		if err := execHistogram(ctx, tx, key, histogramArgs(key, batch.histograms[i])); err != nil {
+			db.log.Error("failed to update histogram metric in batch",
+				zap.Error(err),
+				zap.String("metric_id", key))
+			return fmt.Errorf("failed to update histogram metric %s: %w", key, err)
+		}
+	}
+
+	return nil
+}
+
+func (db *dbstorage) GetGauge(ctx context.Context, name string) (float64, error) {
+	var value float64
+
+	err := retry.Do(ctx, db.retryCfg, func() error {
+		return db.db.QueryRow(ctx, `SELECT value FROM metrics WHERE id = $1 AND mtype = 'gauge';`, name).Scan(&value)
 	})
 
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, service.ErrNotFound
+	}
+	if err != nil {
+		db.log.Error("failed to get gauge after retries", zap.Error(err), zap.String("metric_name", name))
+		return 0, wrapError(err)
+	}
+
+	return value, nil
+}
+
+func (db *dbstorage) GetCounter(ctx context.Context, name string) (int64, error) {
+	var delta int64
+
+	err := retry.Do(ctx, db.retryCfg, func() error {
+		return db.db.QueryRow(ctx, `SELECT delta FROM metrics WHERE id = $1 AND mtype = 'counter';`, name).Scan(&delta)
+	})
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, service.ErrNotFound
+	}
 	if err != nil {
 		db.log.Error("failed to get counter after retries", zap.Error(err), zap.String("metric_name", name))
-		return 0, false
+		return 0, wrapError(err)
 	}
 
-	return delta, true
+	return delta, nil
 }
 
-func (db *dbstorage) GetAllMetrics(ctx context.Context) (string, error) {
-	var builder strings.Builder
+func (db *dbstorage) GetHistogram(ctx context.Context, name string) (model.HistogramValue, error) {
+	var histogram model.HistogramValue
+
+	err := retry.Do(ctx, db.retryCfg, func() error {
+		return db.db.QueryRow(ctx, `
+			SELECT buckets, bucket_counts, value, delta
+			FROM metrics WHERE id = $1 AND mtype = 'histogram';`, name).
+			Scan(&histogram.Buckets, &histogram.Counts, &histogram.Sum, &histogram.Count)
+	})
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return model.HistogramValue{}, service.ErrNotFound
+	}
+	if err != nil {
+		db.log.Error("failed to get histogram after retries", zap.Error(err), zap.String("metric_name", name))
+		return model.HistogramValue{}, wrapError(err)
+	}
+
+	return histogram, nil
+}
+
+func (db *dbstorage) ListMetrics(ctx context.Context, filter model.MetricsFilter) ([]model.Metrics, error) {
+	// LIMIT NULL в Postgres означает отсутствие лимита.
+	// Для одного имени id отличается только метками, поэтому задает порядок рядов.
+	labelsCond, labelsArgs := labelConditions(filter.Labels, 5)
+	query := fmt.Sprintf(`
+		SELECT name, mtype, delta, value, buckets, bucket_counts, labels
+		FROM metrics
+		WHERE starts_with(name, $1) AND ($2 = '' OR mtype::text = $2)%s
+		ORDER BY name, mtype, id
+		LIMIT NULLIF($3, 0) OFFSET $4;
+	`, labelsCond)
+	args := append([]any{filter.Prefix, filter.MType, filter.Limit, filter.Offset}, labelsArgs...)
+
+	var metrics []model.Metrics
 
 	err := retry.Do(ctx, db.retryCfg, func() error {
-		rows, err := db.db.Query(ctx, `SELECT id, mtype, delta, value FROM metrics;`)
+		rows, err := db.db.Query(ctx, query, args...)
 		if err != nil {
 			return err
 		}
 		defer rows.Close()
 
-		found := false
-		builder.WriteString("<ul>\n")
-
+		metrics = make([]model.Metrics, 0)
 		for rows.Next() {
-			found = true
-			var id, mtype string
+			var metric model.Metrics
 			var delta sql.NullInt64
 			var value sql.NullFloat64
+			var buckets []float64
+			var counts []int64
+			var labels []byte
 
-			if err := rows.Scan(&id, &mtype, &delta, &value); err != nil {
+			if err := rows.Scan(&metric.ID, &metric.MType, &delta, &value, &buckets, &counts, &labels); err != nil {
 				return fmt.Errorf("failed to scan metric row: %w", err)
 			}
+			if metric.Labels, err = decodeLabels(labels); err != nil {
+				return err
+			}
 
-			// Минимизируем WriteString вызовы
-			builder.WriteString("<li>")
-			builder.WriteString(id)
-			builder.WriteString(" = ")
-
-			if mtype == "counter" && delta.Valid {
-				// Используем AppendInt для минимальной аллокации
-				buf := strconv.AppendInt(make([]byte, 0, 20), delta.Int64, 10)
-				builder.Write(buf)
-			} else if mtype == "gauge" && value.Valid {
-				// Форматируем с фиксированной точностью
-				buf := strconv.AppendFloat(make([]byte, 0, 32), value.Float64, 'f', 2, 64)
-				builder.Write(buf)
+			switch {
+			case metric.MType == model.Histogram:
+				metric.Histogram = &model.HistogramValue{
+					Buckets: buckets,
+					Counts:  counts,
+					Sum:     value.Float64,
+					Count:   delta.Int64,
+				}
+			case delta.Valid:
+				metric.Delta = &delta.Int64
+			case value.Valid:
+				metric.Value = &value.Float64
 			}
-			builder.WriteString("</li>\n")
+			metrics = append(metrics, metric)
 		}
 
-		if err = rows.Err(); err != nil {
+		if err := rows.Err(); err != nil {
 			return fmt.Errorf("row iteration error: %w", err)
 		}
+		return nil
+	})
+
+	if err != nil {
+		db.log.Error("failed to list metrics after retries", zap.Error(err))
+		return nil, wrapError(err)
+	}
+
+	return metrics, nil
+}
+
+func (db *dbstorage) GetHistory(ctx context.Context, mtype, name string, from, to time.Time) ([]model.MetricSample, error) {
+	query := `
+		SELECT ts, delta, value
+		FROM metric_samples
+		WHERE id = $1 AND mtype = $2 AND ts >= $3 AND ts <= $4
+		ORDER BY ts;
+	`
 
-		if !found {
-			return fmt.Errorf("no metrics found")
+	var samples []model.MetricSample
+
+	err := retry.Do(ctx, db.retryCfg, func() error {
+		rows, err := db.db.Query(ctx, query, name, mtype, from, to)
+		if err != nil {
+			return err
 		}
+		defer rows.Close()
 
-		builder.WriteString("</ul>\n")
-		return nil
+		samples = make([]model.MetricSample, 0)
+		for rows.Next() {
+			var ts time.Time
+			var delta sql.NullInt64
+			var value sql.NullFloat64
+
+			if err := rows.Scan(&ts, &delta, &value); err != nil {
+				return fmt.Errorf("failed to scan sample row: %w", err)
+			}
+
+			sample := model.MetricSample{TS: ts.UnixMilli()}
+			if delta.Valid {
+				sample.Delta = &delta.Int64
+			}
+			if value.Valid {
+				sample.Value = &value.Float64
+			}
+			samples = append(samples, sample)
+		}
+
+		return rows.Err()
 	})
 
 	if err != nil {
-		db.log.Error("failed to get all metrics after retries", zap.Error(err))
-		return "", err
+		db.log.Error("failed to get metric history after retries",
+			zap.Error(err),
+			zap.String("metric_type", mtype),
+			zap.String("metric_name", name))
+		return nil, wrapError(err)
 	}
 
-	return builder.String(), nil
+	return samples, nil
+}
+
+// deleteMetricsQuery удаляет метрики, выбранные условием, вместе с историей
+// и возвращает имена, типы и метки удаленных метрик
+const deleteMetricsQuery = `
+	WITH deleted AS (
+		DELETE FROM metrics
+		WHERE %s
+		RETURNING id, mtype, name, labels
+	), deleted_samples AS (
+		DELETE FROM metric_samples s
+		USING deleted d
+		WHERE s.id = d.id AND s.mtype = d.mtype
+	)
+	SELECT name, mtype, labels FROM deleted
+	ORDER BY name, mtype, id;`
+
+func (db *dbstorage) DeleteMetric(ctx context.Context, mtype, name string) error {
+	deleted, err := db.deleteWhere(ctx, `id = $1 AND mtype::text = $2`, name, mtype)
+	if err != nil {
+		db.log.Error("failed to delete metric after retries",
+			zap.Error(err),
+			zap.String("metric_type", mtype),
+			zap.String("metric_name", name))
+		return wrapError(err)
+	}
+	if len(deleted) == 0 {
+		return service.ErrNotFound
+	}
+	return nil
+}
+
+func (db *dbstorage) DeleteMetrics(ctx context.Context, filter model.MetricsFilter) ([]model.Metrics, error) {
+	labelsCond, labelsArgs := labelConditions(filter.Labels, 3)
+	deleted, err := db.deleteWhere(ctx,
+		`starts_with(name, $1) AND ($2 = '' OR mtype::text = $2)`+labelsCond,
+		append([]any{filter.Prefix, filter.MType}, labelsArgs...)...)
+	if err != nil {
+		db.log.Error("failed to delete metrics after retries", zap.Error(err), zap.String("prefix", filter.Prefix))
+		return nil, wrapError(err)
+	}
+	return deleted, nil
+}
+
+func (db *dbstorage) DeleteStale(ctx context.Context, before time.Time) ([]model.Metrics, error) {
+	deleted, err := db.deleteWhere(ctx, `updated_at < $1`, before)
+	if err != nil {
+		db.log.Error("failed to delete stale metrics after retries", zap.Error(err))
+		return nil, wrapError(err)
+	}
+	return deleted, nil
+}
+
+// deleteWhere выполняет deleteMetricsQuery с условием condition
+func (db *dbstorage) deleteWhere(ctx context.Context, condition string, args ...any) ([]model.Metrics, error) {
+	query := fmt.Sprintf(deleteMetricsQuery, condition)
+
+	var deleted []model.Metrics
+	err := retry.Do(ctx, db.retryCfg, func() error {
+		rows, err := db.db.Query(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		deleted = make([]model.Metrics, 0)
+		for rows.Next() {
+			var metric model.Metrics
+			var labels []byte
+			if err := rows.Scan(&metric.ID, &metric.MType, &labels); err != nil {
+				return fmt.Errorf("failed to scan deleted metric row: %w", err)
+			}
+			if metric.Labels, err = decodeLabels(labels); err != nil {
+				return err
+			}
+			deleted = append(deleted, metric)
+		}
+		return rows.Err()
+	})
+	return deleted, err
+}
+
+// labelConditions строит условия на метки для WHERE; параметры нумеруются начиная с next.
+// Отсутствующая метка сравнивается как пустая строка, регулярное выражение должно
+// совпасть со значением целиком, как в model.LabelMatcher.
+func labelConditions(matchers []model.LabelMatcher, next int) (string, []any) {
+	var builder strings.Builder
+	args := make([]any, 0, 2*len(matchers))
+
+	for _, matcher := range matchers {
+		value := matcher.Value
+		var op string
+		switch matcher.Op {
+		case model.MatchEqual:
+			op = "="
+		case model.MatchNotEqual:
+			op = "<>"
+		case model.MatchRegexp:
+			op, value = "~", "^(?:"+value+")$"
+		case model.MatchNotRegexp:
+			op, value = "!~", "^(?:"+value+")$"
+		default:
+			continue
+		}
+
+		fmt.Fprintf(&builder, " AND coalesce(labels->>$%d, '') %s $%d", next, op, next+1)
+		args = append(args, matcher.Name, value)
+		next += 2
+	}
+
+	return builder.String(), args
+}
+
+// labelsJSON кодирует метки для колонки labels, пустые метки - '{}'
+func labelsJSON(labels model.Labels) string {
+	if len(labels) == 0 {
+		return "{}"
+	}
+	// map[string]string всегда кодируется без ошибки
+	data, _ := json.Marshal(labels)
+	return string(data)
+}
+
+// decodeLabels разбирает колонку labels, пустой объект дает nil
+func decodeLabels(data []byte) (model.Labels, error) {
+	var labels model.Labels
+	if err := json.Unmarshal(data, &labels); err != nil {
+		return nil, fmt.Errorf("failed to decode labels: %w", err)
+	}
+	if len(labels) == 0 {
+		return nil, nil
+	}
+	return labels, nil
 }
 
 func (db *dbstorage) Ping(ctx context.Context) error {
@@ -293,6 +724,84 @@ func (db *dbstorage) Close() error {
 	return nil
 }
 
+// wrapError помечает ошибки подключения к БД как service.ErrUnavailable
+func wrapError(err error) error {
+	if isConnectionError(err) || errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("%w: %w", service.ErrUnavailable, err)
+	}
+	return err
+}
+
+// execWrite выполняет запрос записи вне транзакции.
+// Ошибка помечается service.ErrNotApplied, если запрос точно не выполнен, см. classifyWriteError.
+func (db *dbstorage) execWrite(ctx context.Context, query string, args ...any) error {
+	conn, err := db.db.Acquire(ctx)
+	if err != nil {
+		return notApplied(err)
+	}
+	defer conn.Release()
+
+	_, err = conn.Exec(ctx, query, args...)
+	return classifyWriteError(err)
+}
+
+// updateHistogram выполняет histogramQuery для ряда name на отдельном соединении,
+// помечая ошибки как execWrite
+func (db *dbstorage) updateHistogram(ctx context.Context, name string, args []any) error {
+	conn, err := db.db.Acquire(ctx)
+	if err != nil {
+		return notApplied(err)
+	}
+	defer conn.Release()
+
+	return classifyWriteError(execHistogram(ctx, conn, name, args))
+}
+
+// execer выполняет запрос на соединении или в транзакции
+type execer interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+}
+
+// execHistogram выполняет histogramQuery для ряда name. Если запрос не затронул
+// строк, границы корзин не совпали с сохраненными: возвращает model.ErrBucketsMismatch.
+func execHistogram(ctx context.Context, q execer, name string, args []any) error {
+	tag, err := q.Exec(ctx, histogramQuery, args...)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", name, model.ErrBucketsMismatch)
+	}
+	return nil
+}
+
+// notApplied помечает ошибку service.ErrNotApplied
+func notApplied(err error) error {
+	return fmt.Errorf("%w: %w", service.ErrNotApplied, err)
+}
+
+// classifyWriteError помечает service.ErrNotApplied ошибку запроса записи или фиксации,
+// если запрос не был отправлен или сервер его отклонил. Обрыв связи после отправки
+// оставляет ошибку неоднозначной: запись могла сохраниться.
+func classifyWriteError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var pgErr *pgconn.PgError
+	if pgconn.SafeToRetry(err) ||
+		(errors.As(err, &pgErr) && pgErr.Code != pgerrcode.TransactionResolutionUnknown) {
+		return notApplied(err)
+	}
+	return err
+}
+
+// isRetryableWrite разрешает повтор записи только после ошибки подключения,
+// с которой запись точно не сохранена
+func isRetryableWrite(err error) bool {
+	return errors.Is(err, service.ErrNotApplied) && isConnectionError(err)
+}
+
 func isConnectionError(err error) bool {
 	var pgErr *pgconn.PgError
 	if errors.As(err, &pgErr) {
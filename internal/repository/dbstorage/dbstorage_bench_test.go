@@ -0,0 +1,111 @@
+package dbstorage
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/jackc/pgx/v4"
+	"go.uber.org/zap"
+
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/model"
+)
+
+// agentBatch - батч, похожий на отправку агента с метками: 38 gauge и PollCount
+func agentBatch() []model.Metrics {
+	labels := model.Labels{"host": "bench"}
+	metrics := make([]model.Metrics, 0, 40)
+	for i := 0; i < 38; i++ {
+		value := float64(i)
+		metrics = append(metrics, model.Metrics{ID: fmt.Sprintf("gauge%d", i), MType: model.Gauge, Value: &value, Labels: labels})
+	}
+	delta := int64(1)
+	metrics = append(metrics, model.Metrics{ID: "PollCount", MType: model.Counter, Delta: &delta, Labels: labels})
+	return metrics
+}
+
+// applyMetricsPerRow - прежняя реализация: один запрос на каждую метрику батча
+func applyMetricsPerRow(ctx context.Context, tx pgx.Tx, metrics []model.Metrics) error {
+	gaugeQuery := `
+		WITH upserted AS (
+			INSERT INTO metrics (id, mtype, value, name, labels)
+			VALUES ($1, 'gauge', $2, $3, $4::jsonb)
+			ON CONFLICT (id, mtype) DO UPDATE
+			SET value = EXCLUDED.value, updated_at = now()
+			RETURNING id, mtype, value
+		)
+		INSERT INTO metric_samples (id, mtype, value)
+		SELECT id, mtype, value FROM upserted;`
+
+	counterQuery := `
+		WITH upserted AS (
+			INSERT INTO metrics (id, mtype, delta, name, labels)
+			VALUES ($1, 'counter', $2, $3, $4::jsonb)
+			ON CONFLICT (id, mtype) DO UPDATE
+			SET delta = metrics.delta + EXCLUDED.delta, updated_at = now()
+			RETURNING id, mtype, delta
+		)
+		INSERT INTO metric_samples (id, mtype, delta)
+		SELECT id, mtype, delta FROM upserted;`
+
+	for _, metric := range metrics {
+		key := metric.Key()
+		labels := labelsJSON(metric.Labels)
+		var err error
+		switch metric.MType {
+		case model.Gauge:
+			_, err = tx.Exec(ctx, gaugeQuery, key, *metric.Value, metric.ID, labels)
+		case model.Counter:
+			_, err = tx.Exec(ctx, counterQuery, key, *metric.Delta, metric.ID, labels)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyFunc - способ записи батча в рамках транзакции
+type applyFunc func(db *dbstorage, ctx context.Context, tx pgx.Tx, metrics []model.Metrics) error
+
+func runUpdateBenchmark(b *testing.B, apply applyFunc) {
+	storage := newTestStorage(b)
+	ctx := context.Background()
+	metrics := agentBatch()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tx, err := storage.db.Begin(ctx)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if err := apply(storage, ctx, tx, metrics); err != nil {
+			tx.Rollback(ctx)
+			b.Fatal(err)
+		}
+		if err := tx.Commit(ctx); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkUpdateMetrics_PerRow(b *testing.B) {
+	runUpdateBenchmark(b, func(_ *dbstorage, ctx context.Context, tx pgx.Tx, metrics []model.Metrics) error {
+		return applyMetricsPerRow(ctx, tx, metrics)
+	})
+}
+
+func BenchmarkUpdateMetrics_Unnest(b *testing.B) {
+	runUpdateBenchmark(b, (*dbstorage).applyMetrics)
+}
+
+// Подготовка батча без БД: стоимость схлопывания повторов
+func BenchmarkNewMetricsBatch(b *testing.B) {
+	storage := &dbstorage{log: zap.NewNop()}
+	metrics := agentBatch()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		storage.newMetricsBatch(metrics)
+	}
+}
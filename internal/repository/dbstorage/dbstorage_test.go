@@ -0,0 +1,163 @@
+package dbstorage
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgerrcode"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/config"
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/config/db"
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/model"
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/repository/storagetest"
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/service"
+)
+
+// testDSNEnv - переменная окружения с DSN тестовой базы.
+// Тесты dbstorage очищают таблицы метрик, поэтому база должна быть отдельной.
+const testDSNEnv = "TEST_DATABASE_DSN"
+
+// newTestStorage подключается к тестовой базе, применяет миграции и очищает таблицы.
+// Если TEST_DATABASE_DSN не задан, тест пропускается.
+func newTestStorage(tb testing.TB) *dbstorage {
+	tb.Helper()
+
+	dsn := os.Getenv(testDSNEnv)
+	if dsn == "" {
+		tb.Skipf("%s is not set", testDSNEnv)
+	}
+
+	log := zaptest.NewLogger(tb)
+	require.NoError(tb, db.NewMigrator(dsn, "../../../migrations", log).Up())
+
+	database, err := db.NewDatabase(context.Background(), dsn)
+	require.NoError(tb, err)
+	require.True(tb, database.IsConnected())
+
+	_, err = database.Pool.Exec(context.Background(),
+		`TRUNCATE metrics, metric_samples, idempotency_keys;`)
+	require.NoError(tb, err)
+
+	storage, err := NewDBStorage(database.Pool, log, &config.ServerFlags{})
+	require.NoError(tb, err)
+	tb.Cleanup(func() { storage.Close() })
+
+	return storage
+}
+
+func TestDBStorage_SameNameDifferentTypes(t *testing.T) {
+	storagetest.SameNameDifferentTypes(t, newTestStorage(t))
+}
+
+func TestDBStorage_DuplicateIDsInBatch(t *testing.T) {
+	storagetest.DuplicateIDsInBatch(t, newTestStorage(t))
+}
+
+func TestDBStorage_DeleteAndExpire(t *testing.T) {
+	storagetest.DeleteAndExpire(t, newTestStorage(t))
+}
+
+func TestDBStorage_Labels(t *testing.T) {
+	storagetest.Labels(t, newTestStorage(t))
+}
+
+func TestDBStorage_Histograms(t *testing.T) {
+	storagetest.Histograms(t, newTestStorage(t))
+}
+
+func TestNewMetricsBatch(t *testing.T) {
+	storage := &dbstorage{log: zaptest.NewLogger(t)}
+
+	delta1, delta2 := int64(1), int64(2)
+	value1, value2 := 1.5, 2.5
+	histogram := model.HistogramValue{Buckets: []float64{1}, Counts: []int64{1, 0}, Sum: 0.5, Count: 1}
+	batch, err := storage.newMetricsBatch([]model.Metrics{
+		{ID: "PollCount", MType: model.Counter, Delta: &delta1},
+		{ID: "Alloc", MType: model.Gauge, Value: &value1},
+		{ID: "RandomValue", MType: model.Gauge, Value: &value1},
+		{ID: "PollCount", MType: model.Counter, Delta: &delta2},
+		{ID: "Alloc", MType: model.Gauge, Value: &value2},
+		{ID: "Empty", MType: model.Gauge},
+		{ID: "Unknown", MType: "summary", Value: &value1},
+		{ID: "Latency", MType: model.Histogram, Histogram: &histogram},
+		{ID: "Latency", MType: model.Histogram, Histogram: &histogram},
+		{ID: "NoHistogram", MType: model.Histogram},
+		{ID: "CPUutilization", MType: model.Gauge, Value: &value1, Labels: model.Labels{"core": "1"}},
+		{ID: "CPUutilization", MType: model.Gauge, Value: &value2, Labels: model.Labels{"core": "1"}},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"Alloc", "RandomValue", `CPUutilization{core="1"}`}, batch.gaugeIDs)
+	assert.Equal(t, []float64{2.5, 1.5, 2.5}, batch.gaugeValues)
+	assert.Equal(t, []string{"Alloc", "RandomValue", "CPUutilization"}, batch.gaugeNames)
+	assert.Equal(t, []string{"{}", "{}", `{"core":"1"}`}, batch.gaugeLabels)
+	assert.Equal(t, []string{"PollCount"}, batch.counterIDs)
+	assert.Equal(t, []int64{3}, batch.counterDeltas)
+	assert.Equal(t, []string{"Latency"}, batch.histogramIDs)
+	assert.Equal(t, []model.HistogramValue{
+		{Buckets: []float64{1}, Counts: []int64{2, 0}, Sum: 1, Count: 2},
+	}, batch.histograms)
+	// Слияние дубликатов не должно менять гистограмму из запроса
+	assert.Equal(t, []int64{1, 0}, histogram.Counts)
+
+	other := model.HistogramValue{Buckets: []float64{2}, Counts: []int64{1, 0}, Sum: 0.5, Count: 1}
+	_, err = storage.newMetricsBatch([]model.Metrics{
+		{ID: "Latency", MType: model.Histogram, Histogram: &histogram},
+		{ID: "Latency", MType: model.Histogram, Histogram: &other},
+	})
+	assert.ErrorIs(t, err, model.ErrBucketsMismatch)
+}
+
+func TestLabelConditions(t *testing.T) {
+	host, err := model.NewLabelMatcher("host", model.MatchEqual, "a")
+	require.NoError(t, err)
+	core, err := model.NewLabelMatcher("core", model.MatchNotRegexp, "1|2")
+	require.NoError(t, err)
+
+	cond, args := labelConditions([]model.LabelMatcher{host, core}, 3)
+	assert.Equal(t, " AND coalesce(labels->>$3, '') = $4 AND coalesce(labels->>$5, '') !~ $6", cond)
+	assert.Equal(t, []any{"host", "a", "core", "^(?:1|2)$"}, args)
+}
+
+func TestClassifyWriteError(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		notApplied bool
+		retryable  bool
+	}{
+		{name: "no error"},
+		{
+			name:       "rejected by server",
+			err:        &pgconn.PgError{Code: pgerrcode.UniqueViolation},
+			notApplied: true,
+		},
+		{
+			name:       "server shutdown",
+			err:        &pgconn.PgError{Code: pgerrcode.AdminShutdown},
+			notApplied: true,
+			retryable:  true,
+		},
+		{name: "commit outcome unknown", err: &pgconn.PgError{Code: pgerrcode.TransactionResolutionUnknown}},
+		{name: "connection lost after send", err: errors.New("unexpected EOF: network error")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := classifyWriteError(tt.err)
+			if tt.err == nil {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, tt.err)
+			assert.Equal(t, tt.notApplied, errors.Is(err, service.ErrNotApplied))
+			assert.Equal(t, tt.retryable, isRetryableWrite(err))
+		})
+	}
+}
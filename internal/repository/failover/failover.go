@@ -0,0 +1,507 @@
+// Package failover реализует декоратор хранилища, который продолжает принимать
+// обновления во время недоступности основного хранилища (например, Postgres).
+// Обновления копятся в журнале в памяти и применяются по порядку,
+// когда хранилище снова отвечает на Ping. В журнал попадают только записи,
+// которые хранилище точно не сохранило (service.ErrNotApplied).
+package failover
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/config"
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/handler/pinghandler"
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/model"
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/service"
+	"go.uber.org/zap"
+)
+
+const (
+	// defaultCheckInterval - период проверки основного хранилища по умолчанию
+	defaultCheckInterval = 5 * time.Second
+	// pingTimeout - таймаут проверки доступности основного хранилища
+	pingTimeout = 3 * time.Second
+	// replayTimeout - таймаут применения журнала
+	replayTimeout = 30 * time.Second
+)
+
+var _ service.Storage = (*failoverStorage)(nil)
+var _ pinghandler.DegradationReporter = (*failoverStorage)(nil)
+
+// failoverStorage пишет в журнал, пока primary недоступен. Чтения GetGauge,
+// GetCounter, GetHistogram и ListMetrics учитывают еще не примененный журнал;
+// пока запись журнала применяется, чтение может кратко учесть ее дважды.
+// GetHistory журнал не учитывает: в нем нет отдельных обновлений, поэтому
+// принятые во время недоступности записи появятся в истории только после
+// применения журнала, одной точкой.
+// s.mu защищает только состояние декоратора и не удерживается во время
+// вызовов primary: иначе ретраи и таймауты хранилища останавливали бы все запросы.
+type failoverStorage struct {
+	primary service.Storage
+	log     *zap.Logger
+
+	mu       sync.RWMutex
+	degraded bool
+	journal  *journal
+	// keys - ключи идемпотентности батчей, принятых в журнал
+	keys map[string]time.Time
+
+	// replayMu не дает удалению метрики выполняться одновременно
+	// с применением журнала, которое вернуло бы удаленную метрику
+	replayMu sync.Mutex
+
+	interval  time.Duration
+	done      chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+// NewFailoverStorage оборачивает primary и запускает фоновую проверку его доступности.
+// Журнал вмещает не больше cfg.FailoverJournalLimit рядов, при переполнении
+// записи отклоняются с service.ErrUnavailable.
+func NewFailoverStorage(primary service.Storage, cfg *config.ServerFlags, log *zap.Logger) *failoverStorage {
+	interval := time.Duration(cfg.FailoverInterval) * time.Second
+	if interval <= 0 {
+		interval = defaultCheckInterval
+	}
+
+	s := &failoverStorage{
+		primary:  primary,
+		log:      log,
+		journal:  newJournal(cfg.FailoverJournalLimit),
+		keys:     make(map[string]time.Time),
+		interval: interval,
+		done:     make(chan struct{}),
+	}
+
+	s.wg.Add(1)
+	go s.run()
+
+	return s
+}
+
+func (s *failoverStorage) UpdateGauge(ctx context.Context, name string, value float64) error {
+	return s.write(ctx, "", []model.Metrics{{ID: name, MType: model.Gauge, Value: &value}}, func() error {
+		return s.primary.UpdateGauge(ctx, name, value)
+	})
+}
+
+func (s *failoverStorage) UpdateCounter(ctx context.Context, name string, value int64) error {
+	return s.write(ctx, "", []model.Metrics{{ID: name, MType: model.Counter, Delta: &value}}, func() error {
+		return s.primary.UpdateCounter(ctx, name, value)
+	})
+}
+
+func (s *failoverStorage) UpdateHistogram(ctx context.Context, name string, value model.HistogramValue) error {
+	return s.write(ctx, "", []model.Metrics{{ID: name, MType: model.Histogram, Histogram: &value}}, func() error {
+		return s.primary.UpdateHistogram(ctx, name, value)
+	})
+}
+
+func (s *failoverStorage) UpdateMetrics(ctx context.Context, metrics []model.Metrics) error {
+	return s.write(ctx, "", metrics, func() error {
+		return s.primary.UpdateMetrics(ctx, metrics)
+	})
+}
+
+// UpdateMetricsOnce учитывает и ключи, принятые в журнал во время недоступности хранилища.
+// Батч попадает в журнал со своим ключом и применяется через primary.UpdateMetricsOnce,
+// так что хранилище отбросит его, если первая попытка все же была сохранена.
+func (s *failoverStorage) UpdateMetricsOnce(ctx context.Context, key string, metrics []model.Metrics) (bool, error) {
+	s.mu.RLock()
+	seen, degraded := s.seenKey(key, time.Now()), s.degraded
+	s.mu.RUnlock()
+
+	if seen {
+		return false, nil
+	}
+	if !degraded {
+		applied, err := s.primary.UpdateMetricsOnce(ctx, key, metrics)
+		if !s.shouldJournal(ctx, err) {
+			return applied, err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if s.seenKey(key, now) {
+		return false, nil
+	}
+	if err := s.journalLocked(key, metrics); err != nil {
+		return false, err
+	}
+	pruneKeys(s.keys, service.IdempotencyKeyTTL, now)
+	s.keys[key] = now
+	return true, nil
+}
+
+// GetGauge возвращает значение из журнала, если оно новее сохраненного
+func (s *failoverStorage) GetGauge(ctx context.Context, name string) (float64, error) {
+	s.mu.RLock()
+	value, pending := s.journal.gauge(name)
+	s.mu.RUnlock()
+
+	if pending {
+		return value, nil
+	}
+	return s.primary.GetGauge(ctx, name)
+}
+
+// GetCounter добавляет к сохраненному значению дельту из журнала
+func (s *failoverStorage) GetCounter(ctx context.Context, name string) (int64, error) {
+	s.mu.RLock()
+	delta, pending := s.journal.counter(name)
+	s.mu.RUnlock()
+
+	value, err := s.primary.GetCounter(ctx, name)
+	if pending && errors.Is(err, service.ErrNotFound) {
+		return delta, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return value + delta, nil
+}
+
+// GetHistogram объединяет сохраненную гистограмму с приращением из журнала
+func (s *failoverStorage) GetHistogram(ctx context.Context, name string) (model.HistogramValue, error) {
+	s.mu.RLock()
+	delta, pending := s.journal.histogram(name)
+	s.mu.RUnlock()
+
+	value, err := s.primary.GetHistogram(ctx, name)
+	if pending && errors.Is(err, service.ErrNotFound) {
+		return delta, nil
+	}
+	if err != nil {
+		return model.HistogramValue{}, err
+	}
+	if pending {
+		// Приращение с другими границами корзин отбросит восстановление
+		if merged, err := value.Merge(delta); err == nil {
+			return merged, nil
+		}
+	}
+	return value, nil
+}
+
+// ListMetrics накладывает на сохраненные метрики записи журнала так же,
+// как их применит восстановление. Пагинация выполняется после объединения.
+func (s *failoverStorage) ListMetrics(ctx context.Context, filter model.MetricsFilter) ([]model.Metrics, error) {
+	s.mu.RLock()
+	journaled := s.journal.matching(filter)
+	s.mu.RUnlock()
+
+	if len(journaled) == 0 {
+		return s.primary.ListMetrics(ctx, filter)
+	}
+
+	unpaged := filter
+	unpaged.Limit, unpaged.Offset = 0, 0
+	stored, err := s.primary.ListMetrics(ctx, unpaged)
+	if err != nil {
+		return nil, err
+	}
+
+	return paginate(overlayJournal(stored, journaled), filter.Limit, filter.Offset), nil
+}
+
+// GetHistory возвращает историю основного хранилища, см. failoverStorage
+func (s *failoverStorage) GetHistory(ctx context.Context, mtype, name string, from, to time.Time) ([]model.MetricSample, error) {
+	return s.primary.GetHistory(ctx, mtype, name, from, to)
+}
+
+// DeleteMetric удаляет метрику из основного хранилища и из журнала.
+// Удаление требует доступного хранилища: журнал копит только записи.
+// Удаление ждет окончания применения журнала, см. replayMu.
+func (s *failoverStorage) DeleteMetric(ctx context.Context, mtype, name string) error {
+	s.replayMu.Lock()
+	defer s.replayMu.Unlock()
+
+	err := s.primary.DeleteMetric(ctx, mtype, name)
+	if err != nil && !errors.Is(err, service.ErrNotFound) {
+		return err
+	}
+
+	s.mu.Lock()
+	removed := s.journal.remove(mtype, name)
+	s.mu.Unlock()
+
+	if !removed {
+		return err
+	}
+	return nil
+}
+
+// DeleteMetrics удаляет метрики из основного хранилища и из журнала
+func (s *failoverStorage) DeleteMetrics(ctx context.Context, filter model.MetricsFilter) ([]model.Metrics, error) {
+	s.replayMu.Lock()
+	defer s.replayMu.Unlock()
+
+	deleted, err := s.primary.DeleteMetrics(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	removed := s.journal.removeMatching(filter)
+	s.mu.Unlock()
+
+	return mergeDeleted(deleted, removed), nil
+}
+
+// DeleteStale передается основному хранилищу: записи в журнале свежие и не устаревают
+func (s *failoverStorage) DeleteStale(ctx context.Context, before time.Time) ([]model.Metrics, error) {
+	return s.primary.DeleteStale(ctx, before)
+}
+
+// mergeDeleted объединяет удаленные метрики без повторов, отсортированные по имени, типу и меткам
+func mergeDeleted(deleted, journaled []model.Metrics) []model.Metrics {
+	seen := make(map[string]bool, len(deleted))
+	for _, metric := range deleted {
+		seen[metric.MType+"/"+metric.Key()] = true
+	}
+	for _, metric := range journaled {
+		if !seen[metric.MType+"/"+metric.Key()] {
+			deleted = append(deleted, metric)
+		}
+	}
+
+	model.SortMetrics(deleted)
+	return deleted
+}
+
+// overlayJournal накладывает метрики журнала на сохраненные: gauge заменяется,
+// counter и гистограмма складываются; гистограмма журнала с другими границами
+// корзин не накладывается, ее отбросит восстановление. Результат отсортирован по имени, типу и меткам.
+func overlayJournal(stored, journaled []model.Metrics) []model.Metrics {
+	index := make(map[string]int, len(stored))
+	for i, metric := range stored {
+		index[metric.MType+"/"+metric.Key()] = i
+	}
+
+	for _, metric := range journaled {
+		i, ok := index[metric.MType+"/"+metric.Key()]
+		if !ok {
+			stored = append(stored, metric)
+			continue
+		}
+
+		current := &stored[i]
+		switch metric.MType {
+		case model.Gauge:
+			current.Value = metric.Value
+		case model.Counter:
+			if current.Delta != nil {
+				delta := *current.Delta + *metric.Delta
+				current.Delta = &delta
+			}
+		case model.Histogram:
+			if current.Histogram == nil {
+				continue
+			}
+			if merged, err := current.Histogram.Merge(*metric.Histogram); err == nil {
+				current.Histogram = &merged
+			}
+		}
+	}
+
+	model.SortMetrics(stored)
+	return stored
+}
+
+// paginate применяет limit и offset к отсортированным метрикам
+func paginate(metrics []model.Metrics, limit, offset int) []model.Metrics {
+	if offset >= len(metrics) {
+		return []model.Metrics{}
+	}
+	if offset > 0 {
+		metrics = metrics[offset:]
+	}
+	if limit > 0 && limit < len(metrics) {
+		metrics = metrics[:limit]
+	}
+	return metrics
+}
+
+// Ping не возвращает ошибку, пока записи принимаются в журнал.
+// Недоступность основного хранилища переводит декоратор в деградированный режим.
+func (s *failoverStorage) Ping(ctx context.Context) error {
+	if err := s.primary.Ping(ctx); err != nil {
+		s.mu.Lock()
+		s.markDegradedLocked(err)
+		s.mu.Unlock()
+	}
+	return nil
+}
+
+// Degraded сообщает, копятся ли записи в журнале
+func (s *failoverStorage) Degraded() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.degraded
+}
+
+// Close останавливает проверку, пытается применить журнал и закрывает основное хранилище
+func (s *failoverStorage) Close() error {
+	s.stop()
+
+	if s.Degraded() && !s.recover() {
+		s.mu.RLock()
+		s.log.Error("database unavailable on shutdown, journaled metrics lost",
+			zap.Int("metrics_count", s.journal.len()))
+		s.mu.RUnlock()
+	}
+
+	return s.primary.Close()
+}
+
+// write вызывает apply, а если основное хранилище недоступно и запись
+// точно не сохранена, пишет metrics в журнал
+func (s *failoverStorage) write(ctx context.Context, key string, metrics []model.Metrics, apply func() error) error {
+	if !s.Degraded() {
+		if err := apply(); !s.shouldJournal(ctx, err) {
+			return err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.journalLocked(key, metrics)
+}
+
+// shouldJournal сообщает, нужно ли писать в журнал после ошибки записи err.
+// Неоднозначная ошибка возвращается клиенту: запись могла сохраниться,
+// и повтор из журнала применил бы ее дважды.
+func (s *failoverStorage) shouldJournal(ctx context.Context, err error) bool {
+	if err == nil || !errors.Is(err, service.ErrNotApplied) || s.primaryAvailable(ctx) {
+		return false
+	}
+	s.log.Warn("storage write failed, switching to journal", zap.Error(err))
+	return true
+}
+
+// journalLocked пишет батч в журнал. Вызывается под s.mu.
+// Если журнал переполнен, возвращает ошибку, обернутую в service.ErrUnavailable.
+func (s *failoverStorage) journalLocked(key string, metrics []model.Metrics) error {
+	s.markDegradedLocked(nil)
+	err := s.journal.add(key, metrics)
+	if errors.Is(err, errJournalFull) {
+		s.log.Warn("failover journal is full, rejecting write",
+			zap.Int("metrics_count", s.journal.len()))
+		return fmt.Errorf("%w: %w", service.ErrUnavailable, err)
+	}
+	return err
+}
+
+// markDegradedLocked включает деградированный режим. Вызывается под s.mu
+func (s *failoverStorage) markDegradedLocked(err error) {
+	if s.degraded {
+		return
+	}
+	s.degraded = true
+	s.log.Warn("storage unavailable, journaling writes in memory", zap.Error(err))
+}
+
+// seenKey сообщает, был ли батч с ключом принят в журнал. Вызывается под s.mu
+func (s *failoverStorage) seenKey(key string, now time.Time) bool {
+	acceptedAt, ok := s.keys[key]
+	return ok && now.Sub(acceptedAt) < service.IdempotencyKeyTTL
+}
+
+// primaryAvailable проверяет основное хранилище независимо от отмены ctx запроса
+func (s *failoverStorage) primaryAvailable(ctx context.Context) bool {
+	pingCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), pingTimeout)
+	defer cancel()
+	return s.primary.Ping(pingCtx) == nil
+}
+
+// stop останавливает фоновую проверку
+func (s *failoverStorage) stop() {
+	s.closeOnce.Do(func() {
+		close(s.done)
+	})
+	s.wg.Wait()
+}
+
+func (s *failoverStorage) run() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			if s.Degraded() {
+				s.recover()
+			}
+		}
+	}
+}
+
+// recover применяет журнал, если основное хранилище снова доступно.
+// Записи применяются по одной через primary.UpdateMetricsOnce со своим ключом,
+// поэтому повтор после неоднозначной ошибки не применит запись дважды.
+// Записи, поступившие во время применения, применяются следом.
+// Возвращает true, если деградированный режим выключен.
+func (s *failoverStorage) recover() bool {
+	s.replayMu.Lock()
+	defer s.replayMu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), replayTimeout)
+	defer cancel()
+
+	if !s.Degraded() {
+		return true
+	}
+	if !s.primaryAvailable(ctx) {
+		return false
+	}
+
+	count := 0
+	for {
+		s.mu.Lock()
+		entry, ok := s.journal.front()
+		if !ok {
+			s.degraded = false
+			s.mu.Unlock()
+			break
+		}
+		key, batch := entry.key, entry.series.matching(model.MetricsFilter{})
+		s.mu.Unlock()
+
+		_, err := s.primary.UpdateMetricsOnce(ctx, key, batch)
+		if errors.Is(err, model.ErrBucketsMismatch) {
+			// Границы корзин изменились, пока хранилище было недоступно:
+			// такие приращения несопоставимы с сохраненными и отбрасываются
+			s.mu.Lock()
+			dropped := s.journal.dropFrontHistograms()
+			s.mu.Unlock()
+			s.log.Warn("dropping journaled histograms with mismatched buckets",
+				zap.Int("histograms", dropped), zap.Error(err))
+			if dropped > 0 {
+				continue
+			}
+		}
+		if err != nil {
+			s.log.Warn("failed to replay journal", zap.Error(err))
+			return false
+		}
+
+		s.mu.Lock()
+		s.journal.popFront()
+		s.mu.Unlock()
+		count += len(batch)
+	}
+
+	s.log.Info("storage recovered, journal replayed", zap.Int("metrics_count", count))
+	return true
+}
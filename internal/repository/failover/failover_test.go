@@ -0,0 +1,443 @@
+package failover
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/config"
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/handler/pinghandler"
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/mocks"
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/model"
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+// errConnRefused - ошибка, с которой запись точно не сохранена
+var errConnRefused = fmt.Errorf("%w: connection refused", service.ErrNotApplied)
+
+func newTestStorage(t *testing.T) (*failoverStorage, *mocks.MockStorage) {
+	t.Helper()
+	ctrl := gomock.NewController(t)
+	primary := mocks.NewMockStorage(ctrl)
+
+	// Большой интервал: восстановление вызывается в тестах вручную
+	s := NewFailoverStorage(primary, &config.ServerFlags{FailoverInterval: 3600}, zaptest.NewLogger(t))
+	t.Cleanup(s.stop)
+	return s, primary
+}
+
+func int64Ptr(i int64) *int64 {
+	return &i
+}
+
+func TestFailoverStorage_JournalsWhileUnavailable(t *testing.T) {
+	s, primary := newTestStorage(t)
+	ctx := context.Background()
+
+	primary.EXPECT().UpdateCounter(gomock.Any(), "PollCount", int64(3)).Return(errConnRefused)
+	primary.EXPECT().Ping(gomock.Any()).Return(errConnRefused)
+
+	require.NoError(t, s.UpdateCounter(ctx, "PollCount", 3))
+	assert.True(t, s.Degraded())
+
+	// В деградированном режиме основное хранилище не вызывается
+	require.NoError(t, s.UpdateCounter(ctx, "PollCount", 2))
+	require.NoError(t, s.UpdateGauge(ctx, "Alloc", 1.5))
+	require.NoError(t, s.UpdateMetrics(ctx, []model.Metrics{
+		{ID: "PollCount", MType: model.Counter, Delta: int64Ptr(5)},
+	}))
+
+	assert.Equal(t, []model.Metrics{
+		{ID: "Alloc", MType: model.Gauge, Value: float64Ptr(1.5)},
+		{ID: "PollCount", MType: model.Counter, Delta: int64Ptr(10)},
+	}, s.journal.matching(model.MetricsFilter{}))
+
+	gauge, err := s.GetGauge(ctx, "Alloc")
+	require.NoError(t, err)
+	assert.Equal(t, 1.5, gauge)
+}
+
+func TestFailoverStorage_GetCounterAddsJournal(t *testing.T) {
+	s, primary := newTestStorage(t)
+	ctx := context.Background()
+
+	primary.EXPECT().UpdateCounter(gomock.Any(), "PollCount", int64(3)).Return(errConnRefused)
+	primary.EXPECT().Ping(gomock.Any()).Return(errConnRefused)
+	require.NoError(t, s.UpdateCounter(ctx, "PollCount", 3))
+
+	primary.EXPECT().GetCounter(gomock.Any(), "PollCount").Return(int64(10), nil)
+	counter, err := s.GetCounter(ctx, "PollCount")
+	require.NoError(t, err)
+	assert.Equal(t, int64(13), counter)
+
+	// Метрика есть только в журнале
+	primary.EXPECT().GetCounter(gomock.Any(), "PollCount").Return(int64(0), service.ErrNotFound)
+	counter, err = s.GetCounter(ctx, "PollCount")
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), counter)
+
+	primary.EXPECT().GetCounter(gomock.Any(), "PollCount").Return(int64(0), service.ErrUnavailable)
+	_, err = s.GetCounter(ctx, "PollCount")
+	assert.ErrorIs(t, err, service.ErrUnavailable)
+}
+
+func TestFailoverStorage_ReplaysJournalOnRecovery(t *testing.T) {
+	s, primary := newTestStorage(t)
+	ctx := context.Background()
+
+	primary.EXPECT().UpdateCounter(gomock.Any(), "PollCount", int64(3)).Return(errConnRefused)
+	primary.EXPECT().Ping(gomock.Any()).Return(errConnRefused).Times(2)
+
+	require.NoError(t, s.UpdateCounter(ctx, "PollCount", 3))
+	require.NoError(t, s.UpdateCounter(ctx, "PollCount", 4))
+
+	// База еще недоступна
+	assert.False(t, s.recover())
+	assert.True(t, s.Degraded())
+
+	primary.EXPECT().Ping(gomock.Any()).Return(nil)
+	primary.EXPECT().UpdateMetricsOnce(gomock.Any(), gomock.Any(), []model.Metrics{
+		{ID: "PollCount", MType: model.Counter, Delta: int64Ptr(7)},
+	}).Return(true, nil)
+
+	assert.True(t, s.recover())
+	assert.False(t, s.Degraded())
+	assert.Zero(t, s.journal.len())
+
+	// После восстановления запись снова идет в основное хранилище
+	primary.EXPECT().UpdateCounter(gomock.Any(), "PollCount", int64(1)).Return(nil)
+	require.NoError(t, s.UpdateCounter(ctx, "PollCount", 1))
+}
+
+func TestFailoverStorage_ReplayFailureKeepsJournal(t *testing.T) {
+	s, primary := newTestStorage(t)
+	ctx := context.Background()
+
+	primary.EXPECT().UpdateGauge(gomock.Any(), "Alloc", 1.5).Return(errConnRefused)
+	primary.EXPECT().Ping(gomock.Any()).Return(errConnRefused)
+	require.NoError(t, s.UpdateGauge(ctx, "Alloc", 1.5))
+
+	primary.EXPECT().Ping(gomock.Any()).Return(nil)
+	primary.EXPECT().UpdateMetricsOnce(gomock.Any(), gomock.Any(), gomock.Any()).Return(false, errConnRefused)
+
+	assert.False(t, s.recover())
+	assert.True(t, s.Degraded())
+	assert.Equal(t, 1, s.journal.len())
+}
+
+func TestFailoverStorage_HistogramBucketsMismatch(t *testing.T) {
+	s, primary := newTestStorage(t)
+	ctx := context.Background()
+	first := model.HistogramValue{Buckets: []float64{1}, Counts: []int64{1, 0}, Sum: 0.5, Count: 1}
+	rebucketed := model.HistogramValue{Buckets: []float64{5}, Counts: []int64{1, 0}, Sum: 2, Count: 1}
+
+	primary.EXPECT().UpdateHistogram(gomock.Any(), "latency", first).Return(errConnRefused)
+	primary.EXPECT().Ping(gomock.Any()).Return(errConnRefused)
+	require.NoError(t, s.UpdateHistogram(ctx, "latency", first))
+
+	// Журнал не объединяет гистограммы с разными границами
+	assert.ErrorIs(t, s.UpdateHistogram(ctx, "latency", rebucketed), model.ErrBucketsMismatch)
+	require.NoError(t, s.UpdateCounter(ctx, "PollCount", 2))
+
+	// Сохраненная гистограмма несопоставима с журналом: ее приращения
+	// отбрасываются, остальное применяется
+	primary.EXPECT().GetHistogram(gomock.Any(), "latency").Return(rebucketed, nil)
+	histogram, err := s.GetHistogram(ctx, "latency")
+	require.NoError(t, err)
+	assert.Equal(t, rebucketed, histogram)
+
+	primary.EXPECT().Ping(gomock.Any()).Return(nil)
+	gomock.InOrder(
+		primary.EXPECT().UpdateMetricsOnce(gomock.Any(), gomock.Any(), gomock.Len(2)).
+			Return(false, fmt.Errorf("latency: %w", model.ErrBucketsMismatch)),
+		primary.EXPECT().UpdateMetricsOnce(gomock.Any(), gomock.Any(), []model.Metrics{
+			{ID: "PollCount", MType: model.Counter, Delta: int64Ptr(2)},
+		}).Return(true, nil),
+	)
+
+	assert.True(t, s.recover())
+	assert.False(t, s.Degraded())
+	assert.Zero(t, s.journal.len())
+}
+
+func TestFailoverStorage_DeleteRemovesJournal(t *testing.T) {
+	s, primary := newTestStorage(t)
+	ctx := context.Background()
+
+	primary.EXPECT().UpdateCounter(gomock.Any(), "PollCount", int64(3)).Return(errConnRefused)
+	primary.EXPECT().Ping(gomock.Any()).Return(errConnRefused)
+	require.NoError(t, s.UpdateCounter(ctx, "PollCount", 3))
+	require.NoError(t, s.UpdateGauge(ctx, "HeapAlloc", 1.5))
+	require.NoError(t, s.UpdateGauge(ctx, "HeapInuse", 2.5))
+
+	// Метрика есть только в журнале и все равно считается удаленной
+	primary.EXPECT().DeleteMetric(gomock.Any(), model.Counter, "PollCount").Return(service.ErrNotFound)
+	require.NoError(t, s.DeleteMetric(ctx, model.Counter, "PollCount"))
+
+	primary.EXPECT().DeleteMetric(gomock.Any(), model.Counter, "PollCount").Return(service.ErrNotFound)
+	assert.ErrorIs(t, s.DeleteMetric(ctx, model.Counter, "PollCount"), service.ErrNotFound)
+
+	filter := model.MetricsFilter{Prefix: "Heap"}
+	primary.EXPECT().DeleteMetrics(gomock.Any(), filter).Return([]model.Metrics{
+		{ID: "HeapAlloc", MType: model.Gauge},
+		{ID: "HeapSys", MType: model.Gauge},
+	}, nil)
+	deleted, err := s.DeleteMetrics(ctx, filter)
+	require.NoError(t, err)
+	assert.Equal(t, []model.Metrics{
+		{ID: "HeapAlloc", MType: model.Gauge},
+		{ID: "HeapInuse", MType: model.Gauge},
+		{ID: "HeapSys", MType: model.Gauge},
+	}, deleted)
+	assert.Zero(t, s.journal.len())
+
+	// Без основного хранилища удаление не подтверждается
+	primary.EXPECT().DeleteMetric(gomock.Any(), model.Gauge, "Alloc").Return(service.ErrUnavailable)
+	assert.ErrorIs(t, s.DeleteMetric(ctx, model.Gauge, "Alloc"), service.ErrUnavailable)
+}
+
+func TestFailoverStorage_ReturnsErrorWhenPrimaryAvailable(t *testing.T) {
+	s, primary := newTestStorage(t)
+
+	// Хранилище отклонило запись, но доступно: ошибка возвращается клиенту
+	writeErr := fmt.Errorf("%w: constraint violation", service.ErrNotApplied)
+	primary.EXPECT().UpdateGauge(gomock.Any(), "Alloc", 1.5).Return(writeErr)
+	primary.EXPECT().Ping(gomock.Any()).Return(nil)
+
+	err := s.UpdateGauge(context.Background(), "Alloc", 1.5)
+	assert.ErrorIs(t, err, writeErr)
+	assert.False(t, s.Degraded())
+}
+
+func TestFailoverStorage_UpdateMetricsOnceWhileUnavailable(t *testing.T) {
+	s, primary := newTestStorage(t)
+	ctx := context.Background()
+	batch := []model.Metrics{{ID: "PollCount", MType: model.Counter, Delta: int64Ptr(5)}}
+
+	primary.EXPECT().UpdateMetricsOnce(gomock.Any(), "batch-1", batch).Return(false, errConnRefused)
+	primary.EXPECT().Ping(gomock.Any()).Return(errConnRefused)
+
+	applied, err := s.UpdateMetricsOnce(ctx, "batch-1", batch)
+	require.NoError(t, err)
+	assert.True(t, applied)
+
+	// Повтор того же батча не попадает в журнал второй раз
+	applied, err = s.UpdateMetricsOnce(ctx, "batch-1", batch)
+	require.NoError(t, err)
+	assert.False(t, applied)
+
+	counter, ok := s.journal.counter("PollCount")
+	require.True(t, ok)
+	assert.Equal(t, int64(5), counter)
+
+	// Батч применяется со своим ключом: если первая попытка была сохранена, хранилище его отбросит
+	primary.EXPECT().Ping(gomock.Any()).Return(nil)
+	primary.EXPECT().UpdateMetricsOnce(gomock.Any(), "batch-1", batch).Return(false, nil)
+	assert.True(t, s.recover())
+}
+
+func TestFailoverStorage_AmbiguousErrorNotJournaled(t *testing.T) {
+	s, primary := newTestStorage(t)
+	ctx := context.Background()
+	batch := []model.Metrics{{ID: "PollCount", MType: model.Counter, Delta: int64Ptr(5)}}
+
+	// Связь оборвалась при фиксации: запись могла сохраниться
+	ambiguous := fmt.Errorf("%w: unexpected EOF", service.ErrUnavailable)
+	primary.EXPECT().UpdateCounter(gomock.Any(), "PollCount", int64(3)).Return(ambiguous)
+	assert.ErrorIs(t, s.UpdateCounter(ctx, "PollCount", 3), ambiguous)
+
+	primary.EXPECT().UpdateMetricsOnce(gomock.Any(), "batch-1", batch).Return(false, ambiguous)
+	_, err := s.UpdateMetricsOnce(ctx, "batch-1", batch)
+	assert.ErrorIs(t, err, ambiguous)
+
+	assert.False(t, s.Degraded())
+	assert.Zero(t, s.journal.len())
+}
+
+func TestFailoverStorage_ReplaysEntriesInOrder(t *testing.T) {
+	s, primary := newTestStorage(t)
+	ctx := context.Background()
+	keyed := []model.Metrics{{ID: "Alloc", MType: model.Gauge, Value: float64Ptr(2)}}
+
+	primary.EXPECT().UpdateGauge(gomock.Any(), "Alloc", 1.0).Return(errConnRefused)
+	primary.EXPECT().Ping(gomock.Any()).Return(errConnRefused)
+	require.NoError(t, s.UpdateGauge(ctx, "Alloc", 1))
+	require.NoError(t, s.UpdateCounter(ctx, "PollCount", 1))
+	applied, err := s.UpdateMetricsOnce(ctx, "batch-1", keyed)
+	require.NoError(t, err)
+	require.True(t, applied)
+	require.NoError(t, s.UpdateGauge(ctx, "Alloc", 3))
+
+	gauge, err := s.GetGauge(ctx, "Alloc")
+	require.NoError(t, err)
+	assert.Equal(t, 3.0, gauge)
+
+	var keys []string
+	record := func(_ context.Context, key string, _ []model.Metrics) (bool, error) {
+		keys = append(keys, key)
+		return true, nil
+	}
+	primary.EXPECT().Ping(gomock.Any()).Return(nil)
+	gomock.InOrder(
+		primary.EXPECT().UpdateMetricsOnce(gomock.Any(), gomock.Any(), []model.Metrics{
+			{ID: "Alloc", MType: model.Gauge, Value: float64Ptr(1)},
+			{ID: "PollCount", MType: model.Counter, Delta: int64Ptr(1)},
+		}).DoAndReturn(record),
+		primary.EXPECT().UpdateMetricsOnce(gomock.Any(), "batch-1", keyed).DoAndReturn(record),
+		primary.EXPECT().UpdateMetricsOnce(gomock.Any(), gomock.Any(), []model.Metrics{
+			{ID: "Alloc", MType: model.Gauge, Value: float64Ptr(3)},
+		}).DoAndReturn(record),
+	)
+
+	assert.True(t, s.recover())
+	assert.Zero(t, s.journal.len())
+
+	// Записи без ключа получают свои ключи, чтобы повтор применения не удвоил их
+	require.Len(t, keys, 3)
+	assert.True(t, strings.HasPrefix(keys[0], replayKeyPrefix))
+	assert.True(t, strings.HasPrefix(keys[2], replayKeyPrefix))
+	assert.NotEqual(t, keys[0], keys[2])
+}
+
+func TestFailoverStorage_JournalLimit(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	primary := mocks.NewMockStorage(ctrl)
+	cfg := &config.ServerFlags{FailoverInterval: 3600, FailoverJournalLimit: 2}
+	s := NewFailoverStorage(primary, cfg, zaptest.NewLogger(t))
+	t.Cleanup(s.stop)
+	ctx := context.Background()
+
+	primary.EXPECT().UpdateCounter(gomock.Any(), "PollCount", int64(1)).Return(errConnRefused)
+	primary.EXPECT().Ping(gomock.Any()).Return(errConnRefused)
+	require.NoError(t, s.UpdateCounter(ctx, "PollCount", 1))
+	require.NoError(t, s.UpdateGauge(ctx, "Alloc", 1))
+
+	// Уже записанные ряды обновляются, новые отклоняются
+	require.NoError(t, s.UpdateCounter(ctx, "PollCount", 2))
+	assert.ErrorIs(t, s.UpdateGauge(ctx, "HeapAlloc", 1), service.ErrUnavailable)
+
+	// Батч с ключом занимает свои ряды и тоже не помещается
+	applied, err := s.UpdateMetricsOnce(ctx, "batch-1", []model.Metrics{
+		{ID: "PollCount", MType: model.Counter, Delta: int64Ptr(5)},
+	})
+	assert.ErrorIs(t, err, service.ErrUnavailable)
+	assert.False(t, applied)
+	assert.Equal(t, 2, s.journal.len())
+
+	// Отклоненный ключ не запоминается
+	primary.EXPECT().Ping(gomock.Any()).Return(nil)
+	primary.EXPECT().UpdateMetricsOnce(gomock.Any(), gomock.Any(), gomock.Any()).Return(true, nil)
+	require.True(t, s.recover())
+	primary.EXPECT().UpdateMetricsOnce(gomock.Any(), "batch-1", gomock.Any()).Return(true, nil)
+	applied, err = s.UpdateMetricsOnce(ctx, "batch-1", []model.Metrics{
+		{ID: "PollCount", MType: model.Counter, Delta: int64Ptr(5)},
+	})
+	require.NoError(t, err)
+	assert.True(t, applied)
+}
+
+func TestFailoverStorage_PrimaryCallsDoNotHoldLock(t *testing.T) {
+	s, primary := newTestStorage(t)
+	ctx := context.Background()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	primary.EXPECT().UpdateGauge(gomock.Any(), "Alloc", 1.0).DoAndReturn(
+		func(context.Context, string, float64) error {
+			close(started)
+			<-release
+			return nil
+		})
+
+	done := make(chan error)
+	go func() {
+		done <- s.UpdateGauge(ctx, "Alloc", 1)
+	}()
+	<-started
+
+	// Пока запись ждет хранилище, переход в деградированный режим и чтения не блокируются
+	primary.EXPECT().Ping(gomock.Any()).Return(errConnRefused)
+	require.NoError(t, s.Ping(ctx))
+	assert.True(t, s.Degraded())
+
+	primary.EXPECT().GetCounter(gomock.Any(), "PollCount").Return(int64(1), nil)
+	counter, err := s.GetCounter(ctx, "PollCount")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), counter)
+
+	close(release)
+	require.NoError(t, <-done)
+}
+
+func TestFailoverStorage_ListMetricsAddsJournal(t *testing.T) {
+	s, primary := newTestStorage(t)
+	ctx := context.Background()
+
+	primary.EXPECT().UpdateCounter(gomock.Any(), "PollCount", int64(3)).Return(errConnRefused)
+	primary.EXPECT().Ping(gomock.Any()).Return(errConnRefused)
+	require.NoError(t, s.UpdateCounter(ctx, "PollCount", 3))
+	require.NoError(t, s.UpdateGauge(ctx, "Alloc", 2.5))
+	require.NoError(t, s.UpdateGauge(ctx, "Buck", 1))
+
+	// Основное хранилище читается без пагинации, она применяется к объединенному результату
+	stored := func() []model.Metrics {
+		return []model.Metrics{
+			{ID: "Alloc", MType: model.Gauge, Value: float64Ptr(1)},
+			{ID: "PollCount", MType: model.Counter, Delta: int64Ptr(10)},
+			{ID: "Zeta", MType: model.Gauge, Value: float64Ptr(7)},
+		}
+	}
+	primary.EXPECT().ListMetrics(gomock.Any(), model.MetricsFilter{}).Return(stored(), nil)
+	primary.EXPECT().ListMetrics(gomock.Any(), model.MetricsFilter{}).Return(stored(), nil)
+
+	metrics, err := s.ListMetrics(ctx, model.MetricsFilter{})
+	require.NoError(t, err)
+	assert.Equal(t, []model.Metrics{
+		{ID: "Alloc", MType: model.Gauge, Value: float64Ptr(2.5)},
+		{ID: "Buck", MType: model.Gauge, Value: float64Ptr(1)},
+		{ID: "PollCount", MType: model.Counter, Delta: int64Ptr(13)},
+		{ID: "Zeta", MType: model.Gauge, Value: float64Ptr(7)},
+	}, metrics)
+
+	metrics, err = s.ListMetrics(ctx, model.MetricsFilter{Limit: 2, Offset: 1})
+	require.NoError(t, err)
+	assert.Equal(t, []model.Metrics{
+		{ID: "Buck", MType: model.Gauge, Value: float64Ptr(1)},
+		{ID: "PollCount", MType: model.Counter, Delta: int64Ptr(13)},
+	}, metrics)
+
+	// Без подходящих записей журнала фильтр передается как есть
+	filter := model.MetricsFilter{Prefix: "Zeta", Limit: 1}
+	primary.EXPECT().ListMetrics(gomock.Any(), filter).Return(stored()[2:], nil)
+	metrics, err = s.ListMetrics(ctx, filter)
+	require.NoError(t, err)
+	assert.Equal(t, stored()[2:], metrics)
+
+	primary.EXPECT().ListMetrics(gomock.Any(), model.MetricsFilter{}).Return(nil, service.ErrUnavailable)
+	_, err = s.ListMetrics(ctx, model.MetricsFilter{Limit: 1})
+	assert.ErrorIs(t, err, service.ErrUnavailable)
+}
+
+func TestFailoverStorage_PingReportsDegraded(t *testing.T) {
+	s, primary := newTestStorage(t)
+	primary.EXPECT().Ping(gomock.Any()).Return(errConnRefused)
+
+	handler := pinghandler.NewPingHandler(zaptest.NewLogger(t), s)
+	w := httptest.NewRecorder()
+	handler.GetPingDB(w, httptest.NewRequest(http.MethodGet, "/pinghandler/", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, pinghandler.StorageStateDegraded, w.Header().Get(pinghandler.StorageStateHeader))
+	assert.True(t, s.Degraded())
+}
+
+func float64Ptr(f float64) *float64 {
+	return &f
+}
@@ -0,0 +1,390 @@
+package failover
+
+import (
+	"crypto/rand"
+	"errors"
+	"time"
+
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/model"
+)
+
+// errJournalFull - в журнале нет места для новых рядов
+var errJournalFull = errors.New("failover journal is full")
+
+// replayKeyPrefix - префикс ключа идемпотентности записей журнала без ключа
+const replayKeyPrefix = "failover-"
+
+// series накапливает записи: счетчики складываются, для gauge хранится
+// последнее значение, гистограммы объединяются model.HistogramValue.Merge.
+// Метрики хранятся по ключу ряда model.SeriesKey.
+type series struct {
+	counters   map[string]int64
+	gauges     map[string]float64
+	histograms map[string]model.HistogramValue
+}
+
+func newSeries() *series {
+	return &series{
+		counters:   make(map[string]int64),
+		gauges:     make(map[string]float64),
+		histograms: make(map[string]model.HistogramValue),
+	}
+}
+
+// add добавляет батч метрик
+func (s *series) add(metrics []model.Metrics) {
+	for _, metric := range metrics {
+		switch metric.MType {
+		case model.Gauge:
+			if metric.Value != nil {
+				s.gauges[metric.Key()] = *metric.Value
+			}
+		case model.Counter:
+			if metric.Delta != nil {
+				s.counters[metric.Key()] += *metric.Delta
+			}
+		case model.Histogram:
+			if metric.Histogram != nil {
+				s.addHistogram(metric.Key(), *metric.Histogram)
+			}
+		}
+	}
+}
+
+// addHistogram объединяет приращение гистограммы с уже накопленным.
+// Границы корзин проверяет journal.add, приращение с другими границами пропускается
+func (s *series) addHistogram(key string, delta model.HistogramValue) {
+	if current, ok := s.histograms[key]; ok {
+		if merged, err := current.Merge(delta); err == nil {
+			s.histograms[key] = merged
+		}
+		return
+	}
+	s.histograms[key] = delta.Clone()
+}
+
+// merge добавляет записи other так, как если бы они были сделаны позже
+func (s *series) merge(other *series) {
+	for key, delta := range other.counters {
+		s.counters[key] += delta
+	}
+	for key, value := range other.gauges {
+		s.gauges[key] = value
+	}
+	for key, histogram := range other.histograms {
+		s.addHistogram(key, histogram)
+	}
+}
+
+// growth возвращает, сколько новых рядов добавит батч
+func (s *series) growth(metrics []model.Metrics) int {
+	added := make(map[string]bool)
+	for _, metric := range metrics {
+		var ok bool
+		switch metric.MType {
+		case model.Gauge:
+			_, ok = s.gauges[metric.Key()]
+		case model.Counter:
+			_, ok = s.counters[metric.Key()]
+		case model.Histogram:
+			_, ok = s.histograms[metric.Key()]
+		default:
+			continue
+		}
+		if !ok {
+			added[metric.MType+"/"+metric.Key()] = true
+		}
+	}
+	return len(added)
+}
+
+// remove удаляет метрику и сообщает, была ли она
+func (s *series) remove(mtype, key string) bool {
+	switch mtype {
+	case model.Gauge:
+		_, ok := s.gauges[key]
+		delete(s.gauges, key)
+		return ok
+	case model.Counter:
+		_, ok := s.counters[key]
+		delete(s.counters, key)
+		return ok
+	case model.Histogram:
+		_, ok := s.histograms[key]
+		delete(s.histograms, key)
+		return ok
+	}
+	return false
+}
+
+// removeMatching удаляет метрики, подходящие под filter, и возвращает их имена, метки и типы
+func (s *series) removeMatching(filter model.MetricsFilter) []model.Metrics {
+	var removed []model.Metrics
+	for key := range s.counters {
+		id, labels := model.ParseSeriesKey(key)
+		if filter.Match(id, model.Counter, labels) {
+			delete(s.counters, key)
+			removed = append(removed, model.Metrics{ID: id, MType: model.Counter, Labels: labels})
+		}
+	}
+	for key := range s.gauges {
+		id, labels := model.ParseSeriesKey(key)
+		if filter.Match(id, model.Gauge, labels) {
+			delete(s.gauges, key)
+			removed = append(removed, model.Metrics{ID: id, MType: model.Gauge, Labels: labels})
+		}
+	}
+	for key := range s.histograms {
+		id, labels := model.ParseSeriesKey(key)
+		if filter.Match(id, model.Histogram, labels) {
+			delete(s.histograms, key)
+			removed = append(removed, model.Metrics{ID: id, MType: model.Histogram, Labels: labels})
+		}
+	}
+	return removed
+}
+
+// len возвращает количество рядов
+func (s *series) len() int {
+	return len(s.counters) + len(s.gauges) + len(s.histograms)
+}
+
+// matching возвращает метрики, подходящие под filter, отсортированные по имени, типу и меткам
+func (s *series) matching(filter model.MetricsFilter) []model.Metrics {
+	var metrics []model.Metrics
+
+	for key, delta := range s.counters {
+		id, labels := model.ParseSeriesKey(key)
+		if filter.Match(id, model.Counter, labels) {
+			metrics = append(metrics, model.Metrics{ID: id, MType: model.Counter, Delta: &delta, Labels: labels})
+		}
+	}
+	for key, value := range s.gauges {
+		id, labels := model.ParseSeriesKey(key)
+		if filter.Match(id, model.Gauge, labels) {
+			metrics = append(metrics, model.Metrics{ID: id, MType: model.Gauge, Value: &value, Labels: labels})
+		}
+	}
+	for key, histogram := range s.histograms {
+		id, labels := model.ParseSeriesKey(key)
+		if filter.Match(id, model.Histogram, labels) {
+			histogram := histogram.Clone()
+			metrics = append(metrics, model.Metrics{ID: id, MType: model.Histogram, Histogram: &histogram, Labels: labels})
+		}
+	}
+
+	model.SortMetrics(metrics)
+	return metrics
+}
+
+// journalEntry - батч с ключом идемпотентности клиента или записи без ключа,
+// объединенные подряд под сгенерированным ключом. Ключ нужен, чтобы повтор
+// применения после неоднозначной ошибки не применил записи дважды.
+type journalEntry struct {
+	key    string
+	keyed  bool
+	series *series
+	// sealed - запись применяется, новые записи в нее не добавляются
+	sealed bool
+}
+
+// journal накапливает записи, пока основное хранилище недоступно, в порядке
+// поступления: так при применении gauge получают последнее значение.
+// Число рядов во всех записях ограничено limit, ряды батчей с разными ключами
+// считаются отдельно; limit <= 0 снимает ограничение.
+// Не потокобезопасен, вызывается под failoverStorage.mu.
+type journal struct {
+	entries []*journalEntry
+	size    int
+	limit   int
+}
+
+func newJournal(limit int) *journal {
+	return &journal{limit: limit}
+}
+
+// add добавляет батч: с ключом - отдельной записью, без ключа - в последнюю
+// запись без ключа. Возвращает model.ErrBucketsMismatch, если гистограмму
+// нельзя объединить с журналом, и errJournalFull, если рядов станет больше limit.
+func (j *journal) add(key string, metrics []model.Metrics) error {
+	if err := model.CheckBatchBuckets(metrics, j.histogram); err != nil {
+		return err
+	}
+
+	target := j.tail()
+	if key != "" || target == nil {
+		target = &journalEntry{key: key, keyed: key != "", series: newSeries()}
+	}
+
+	growth := target.series.growth(metrics)
+	if j.limit > 0 && j.size+growth > j.limit {
+		return errJournalFull
+	}
+
+	if target != j.tail() {
+		if !target.keyed {
+			target.key = replayKeyPrefix + rand.Text()
+		}
+		j.entries = append(j.entries, target)
+	}
+	target.series.add(metrics)
+	j.size += growth
+	return nil
+}
+
+// tail возвращает последнюю запись без ключа, в которую можно добавлять
+func (j *journal) tail() *journalEntry {
+	if len(j.entries) == 0 {
+		return nil
+	}
+	last := j.entries[len(j.entries)-1]
+	if last.keyed || last.sealed {
+		return nil
+	}
+	return last
+}
+
+// front возвращает первую запись для применения и закрывает ее для добавления
+func (j *journal) front() (*journalEntry, bool) {
+	if len(j.entries) == 0 {
+		return nil, false
+	}
+	entry := j.entries[0]
+	entry.sealed = true
+	return entry, true
+}
+
+// dropFrontHistograms удаляет гистограммы из первой записи и возвращает их число
+func (j *journal) dropFrontHistograms() int {
+	histograms := j.entries[0].series.histograms
+	dropped := len(histograms)
+	clear(histograms)
+	j.size -= dropped
+	return dropped
+}
+
+// popFront удаляет примененную первую запись
+func (j *journal) popFront() {
+	j.size -= j.entries[0].series.len()
+	j.entries[0] = nil
+	j.entries = j.entries[1:]
+}
+
+// merged объединяет все записи в порядке поступления
+func (j *journal) merged() *series {
+	result := newSeries()
+	for _, entry := range j.entries {
+		result.merge(entry.series)
+	}
+	return result
+}
+
+// gauge возвращает последнее значение gauge из журнала
+func (j *journal) gauge(key string) (float64, bool) {
+	for i := len(j.entries) - 1; i >= 0; i-- {
+		if value, ok := j.entries[i].series.gauges[key]; ok {
+			return value, true
+		}
+	}
+	return 0, false
+}
+
+// counter возвращает сумму приращений counter из журнала
+func (j *journal) counter(key string) (int64, bool) {
+	var (
+		sum   int64
+		found bool
+	)
+	for _, entry := range j.entries {
+		if delta, ok := entry.series.counters[key]; ok {
+			sum += delta
+			found = true
+		}
+	}
+	return sum, found
+}
+
+// histogram возвращает объединенное приращение гистограммы из журнала
+func (j *journal) histogram(key string) (model.HistogramValue, bool) {
+	var (
+		result model.HistogramValue
+		found  bool
+	)
+	for _, entry := range j.entries {
+		delta, ok := entry.series.histograms[key]
+		if !ok {
+			continue
+		}
+		if found {
+			// Границы корзин в журнале согласованы, их проверяет add
+			if merged, err := result.Merge(delta); err == nil {
+				result = merged
+			}
+		} else {
+			result = delta.Clone()
+			found = true
+		}
+	}
+	return result, found
+}
+
+// matching возвращает объединенные метрики журнала, подходящие под filter
+func (j *journal) matching(filter model.MetricsFilter) []model.Metrics {
+	return j.merged().matching(filter)
+}
+
+// remove удаляет метрику из всех записей и сообщает, была ли она в журнале
+func (j *journal) remove(mtype, key string) bool {
+	removed := false
+	for _, entry := range j.entries {
+		if entry.series.remove(mtype, key) {
+			j.size--
+			removed = true
+		}
+	}
+	j.compact()
+	return removed
+}
+
+// removeMatching удаляет из журнала метрики, подходящие под filter, и возвращает их имена, метки и типы
+func (j *journal) removeMatching(filter model.MetricsFilter) []model.Metrics {
+	seen := make(map[string]bool)
+	var removed []model.Metrics
+	for _, entry := range j.entries {
+		for _, metric := range entry.series.removeMatching(filter) {
+			j.size--
+			if !seen[metric.MType+"/"+metric.Key()] {
+				seen[metric.MType+"/"+metric.Key()] = true
+				removed = append(removed, metric)
+			}
+		}
+	}
+	j.compact()
+	return removed
+}
+
+// compact удаляет опустевшие записи, кроме закрытых: их применение уже идет
+func (j *journal) compact() {
+	kept := j.entries[:0]
+	for _, entry := range j.entries {
+		if entry.series.len() > 0 || entry.sealed {
+			kept = append(kept, entry)
+		}
+	}
+	clear(j.entries[len(kept):])
+	j.entries = kept
+}
+
+// len возвращает количество рядов в журнале
+func (j *journal) len() int {
+	return j.size
+}
+
+// pruneKeys удаляет ключи идемпотентности старше ttl
+func pruneKeys(keys map[string]time.Time, ttl time.Duration, now time.Time) {
+	for key, appliedAt := range keys {
+		if now.Sub(appliedAt) >= ttl {
+			delete(keys, key)
+		}
+	}
+}
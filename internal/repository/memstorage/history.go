@@ -0,0 +1,53 @@
+package memstorage
+
+import (
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/model"
+)
+
+// defaultHistorySize - количество сэмплов на метрику, если размер не задан в конфигурации
+const defaultHistorySize = 1000
+
+// sampleRing - кольцевой буфер сэмплов одной метрики.
+// При переполнении перезаписывает самые старые значения.
+type sampleRing struct {
+	buf   []model.MetricSample
+	start int
+	size  int
+}
+
+func newSampleRing(capacity int) *sampleRing {
+	return &sampleRing{
+		buf: make([]model.MetricSample, capacity),
+	}
+}
+
+// push добавляет сэмпл в конец буфера
+func (r *sampleRing) push(sample model.MetricSample) {
+	capacity := len(r.buf)
+	if r.size < capacity {
+		r.buf[(r.start+r.size)%capacity] = sample
+		r.size++
+		return
+	}
+
+	r.buf[r.start] = sample
+	r.start = (r.start + 1) % capacity
+}
+
+// between возвращает сэмплы с from <= TS <= to в хронологическом порядке
+func (r *sampleRing) between(from, to int64) []model.MetricSample {
+	result := make([]model.MetricSample, 0)
+	for i := 0; i < r.size; i++ {
+		sample := r.buf[(r.start+i)%len(r.buf)]
+		if sample.TS < from || sample.TS > to {
+			continue
+		}
+		result = append(result, sample)
+	}
+	return result
+}
+
+// historyKey формирует ключ истории: метрики разных типов с одинаковым именем независимы
+func historyKey(mtype, name string) string {
+	return mtype + "/" + name
+}
@@ -0,0 +1,40 @@
+package memstorage
+
+import "time"
+
+// keyCache помнит ключи идемпотентности примененных батчей в течение ttl.
+// Не потокобезопасен, вызывается под memStorage.keysMu.
+type keyCache struct {
+	ttl       time.Duration
+	keys      map[string]time.Time
+	lastPrune time.Time
+}
+
+func newKeyCache(ttl time.Duration) *keyCache {
+	return &keyCache{
+		ttl:  ttl,
+		keys: make(map[string]time.Time),
+	}
+}
+
+// contains сообщает, встречался ли ключ за последние ttl
+func (c *keyCache) contains(key string, now time.Time) bool {
+	appliedAt, exists := c.keys[key]
+	return exists && now.Sub(appliedAt) < c.ttl
+}
+
+// add запоминает ключ и не чаще раза в ttl удаляет устаревшие
+func (c *keyCache) add(key string, now time.Time) {
+	c.keys[key] = now
+
+	if now.Sub(c.lastPrune) < c.ttl {
+		return
+	}
+	c.lastPrune = now
+
+	for k, appliedAt := range c.keys {
+		if now.Sub(appliedAt) >= c.ttl {
+			delete(c.keys, k)
+		}
+	}
+}
@@ -2,7 +2,7 @@ package memstorage
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"sync"
@@ -14,12 +14,27 @@ import (
 	"go.uber.org/zap"
 )
 
+// memStorage хранит метрики в шардах по хешу ключа ряда: имени с метками.
+// Одиночные записи блокируют один шард, батч - все затронутые шарды по возрастанию номера.
+// ListMetrics и снапшот берут блокировки всех шардов в том же порядке,
+// поэтому видят батч целиком или не видят вовсе.
 type memStorage struct {
-	mu       *sync.Mutex
-	counters map[string]int64
-	gauges   map[string]float64
-	cfg      *config.ServerFlags
-	log      *zap.Logger
+	shards [shardCount]*shard
+	cfg    *config.ServerFlags
+	log    *zap.Logger
+
+	historySize int
+
+	// keysMu держится на все время UpdateMetricsOnce, чтобы батч с одним ключом не применился дважды
+	keysMu      sync.Mutex
+	appliedKeys *keyCache
+	wal         *wal
+
+	snapshotGenerations int
+	// saveMu не дает двум сохранениям писать снапшот одновременно
+	saveMu sync.Mutex
+	// snapshotWALSeq - номер последней записи журнала в восстановленном снапшоте
+	snapshotWALSeq uint64
 
 	tickerMu *sync.Mutex
 	ticker   *time.Ticker
@@ -27,24 +42,39 @@ type memStorage struct {
 }
 
 func NewMemStorage(cfg *config.ServerFlags, log *zap.Logger) service.Storage {
+	historySize := cfg.HistorySize
+	if historySize <= 0 {
+		historySize = defaultHistorySize
+	}
+
+	snapshotGenerations := cfg.SnapshotGenerations
+	if snapshotGenerations <= 0 {
+		snapshotGenerations = defaultSnapshotGenerations
+	}
 
 	storage := &memStorage{
-		mu:       &sync.Mutex{},
-		tickerMu: &sync.Mutex{},
-		counters: make(map[string]int64),
-		gauges:   make(map[string]float64),
-		cfg:      cfg,
-		done:     make(chan struct{}),
-		log:      log,
+		tickerMu:            &sync.Mutex{},
+		historySize:         historySize,
+		appliedKeys:         newKeyCache(service.IdempotencyKeyTTL),
+		snapshotGenerations: snapshotGenerations,
+		cfg:                 cfg,
+		done:                make(chan struct{}),
+		log:                 log,
+	}
+	for i := range storage.shards {
+		storage.shards[i] = newShard()
 	}
 
 	if cfg.Restore {
-		err := storage.LoadFromFile(cfg.FileStoragePath)
-		if err != nil {
-			return nil
+		if err := storage.LoadFromFile(cfg.FileStoragePath); err != nil {
+			log.Error("failed to restore metrics, starting with empty storage", zap.Error(err))
 		}
 	}
 
+	if cfg.WALPath != "" {
+		storage.initWAL(cfg)
+	}
+
 	if cfg.StoreInterval > 0 {
 		storage.StartPeriodicSave(
 			time.Duration(cfg.StoreInterval)*time.Second,
@@ -56,159 +86,439 @@ func NewMemStorage(cfg *config.ServerFlags, log *zap.Logger) service.Storage {
 }
 
 func (m *memStorage) UpdateGauge(ctx context.Context, name string, value float64) error {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-	m.gauges[name] = value
+	s := m.shardFor(name)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := m.logWAL("", []model.Metrics{{ID: name, MType: model.Gauge, Value: &value}}); err != nil {
+		return err
+	}
+	s.setGauge(name, value, time.Now(), m.historySize)
 	return nil
 }
 
 func (m *memStorage) UpdateCounter(ctx context.Context, name string, value int64) error {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-	if existing, exists := m.counters[name]; exists {
-		newDelta := existing + value
-		m.counters[name] = newDelta
-	} else {
-		m.counters[name] = value
+	s := m.shardFor(name)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := m.logWAL("", []model.Metrics{{ID: name, MType: model.Counter, Delta: &value}}); err != nil {
+		return err
+	}
+	s.addCounter(name, value, time.Now(), m.historySize)
+	return nil
+}
+
+func (m *memStorage) UpdateHistogram(ctx context.Context, name string, value model.HistogramValue) error {
+	s := m.shardFor(name)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if current, ok := s.histograms[name]; ok {
+		if err := current.CheckBuckets(value); err != nil {
+			return err
+		}
 	}
+	if err := m.logWAL("", []model.Metrics{{ID: name, MType: model.Histogram, Histogram: &value}}); err != nil {
+		return err
+	}
+	s.mergeHistogram(name, value, time.Now(), m.historySize)
 	return nil
 }
 
 func (m *memStorage) UpdateMetrics(ctx context.Context, metrics []model.Metrics) error {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+	indexes := shardIndexes(metrics)
+	m.lockShards(indexes)
+	defer m.unlockShards(indexes)
+
+	if err := m.checkBuckets(metrics); err != nil {
+		return err
+	}
+	if err := m.logWAL("", metrics); err != nil {
+		return err
+	}
+	m.applyMetrics(metrics, time.Now())
+	return nil
+}
+
+func (m *memStorage) UpdateMetricsOnce(ctx context.Context, key string, metrics []model.Metrics) (bool, error) {
+	m.keysMu.Lock()
+	defer m.keysMu.Unlock()
+
+	now := time.Now()
+	if m.appliedKeys.contains(key, now) {
+		return false, nil
+	}
+
+	indexes := shardIndexes(metrics)
+	m.lockShards(indexes)
+	defer m.unlockShards(indexes)
+
+	if err := m.checkBuckets(metrics); err != nil {
+		return false, err
+	}
+	if err := m.logWAL(key, metrics); err != nil {
+		return false, err
+	}
+	m.applyMetrics(metrics, now)
+	m.appliedKeys.add(key, now)
+	return true, nil
+}
+
+// initWAL открывает журнал. При восстановлении журнал применяется поверх снапшота,
+// иначе очищается, чтобы старые приращения не попали в следующий запуск с restore.
+// Ошибка открытия журнала не останавливает сервер: хранилище работает без журнала.
+func (m *memStorage) initWAL(cfg *config.ServerFlags) {
+	w, err := openWAL(cfg.WALPath, cfg.WALSync, time.Duration(cfg.WALSyncInterval)*time.Second, m.log)
+	if err != nil {
+		m.log.Error("failed to open wal, continuing without it", zap.Error(err))
+		return
+	}
+
+	if cfg.Restore {
+		m.keysMu.Lock()
+		m.lockAll()
+		now := time.Now()
+		count, err := w.replay(func(record walRecord) {
+			if record.Key != "" {
+				m.appliedKeys.add(record.Key, now)
+			}
+			// Записи, уже вошедшие в снапшот, не применяются повторно
+			if record.Seq != 0 && record.Seq <= m.snapshotWALSeq {
+				return
+			}
+			if record.Delete {
+				for _, metric := range record.Metrics {
+					key := metric.Key()
+					m.shardFor(key).remove(metric.MType, key)
+				}
+				return
+			}
+			m.applyMetrics(record.Metrics, now)
+		})
+		m.unlockAll()
+		m.keysMu.Unlock()
+		if err != nil {
+			m.log.Error("failed to replay wal", zap.Error(err))
+		}
+		m.log.Info("wal replayed", zap.String("path", cfg.WALPath), zap.Int("records", count))
+		w.advanceSeq(m.snapshotWALSeq)
+	} else if err := w.truncate(); err != nil {
+		m.log.Error("failed to reset wal", zap.Error(err))
+	}
+
+	m.wal = w
+}
 
+// logWAL дописывает изменение в журнал до его применения.
+// Вызывается под блокировками затронутых шардов, поэтому порядок записей
+// в журнале для одной метрики совпадает с порядком применения.
+func (m *memStorage) logWAL(key string, metrics []model.Metrics) error {
+	if m.wal == nil {
+		return nil
+	}
+	return m.wal.append(walRecord{Key: key, Metrics: metrics})
+}
+
+// logDelete дописывает удаление в журнал до его применения
+func (m *memStorage) logDelete(metrics []model.Metrics) error {
+	if m.wal == nil {
+		return nil
+	}
+	return m.wal.append(walRecord{Metrics: metrics, Delete: true})
+}
+
+// checkBuckets возвращает model.ErrBucketsMismatch, если гистограмму батча
+// нельзя добавить к сохраненной. Вызывается под блокировками затронутых шардов
+func (m *memStorage) checkBuckets(metrics []model.Metrics) error {
+	return model.CheckBatchBuckets(metrics, func(key string) (model.HistogramValue, bool) {
+		histogram, ok := m.shardFor(key).histograms[key]
+		return histogram, ok
+	})
+}
+
+// applyMetrics применяет батч метрик. Вызывается под блокировками затронутых шардов
+func (m *memStorage) applyMetrics(metrics []model.Metrics, now time.Time) {
 	for _, metric := range metrics {
+		key := metric.Key()
+		s := m.shardFor(key)
 		switch metric.MType {
 		case model.Gauge:
 			if metric.Value != nil {
-				m.gauges[metric.ID] = *metric.Value
+				s.setGauge(key, *metric.Value, now, m.historySize)
 			}
 		case model.Counter:
 			if metric.Delta != nil {
-				if existing, exists := m.counters[metric.ID]; exists {
-					m.counters[metric.ID] = existing + *metric.Delta
-				} else {
-					m.counters[metric.ID] = *metric.Delta
-				}
+				s.addCounter(key, *metric.Delta, now, m.historySize)
+			}
+		case model.Histogram:
+			if metric.Histogram != nil {
+				s.mergeHistogram(key, *metric.Histogram, now, m.historySize)
 			}
 		}
 	}
-	return nil
 }
 
-func (m *memStorage) GetGauge(ctx context.Context, name string) (float64, bool) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-	if metric, exists := m.gauges[name]; exists {
-		return metric, true
+func (m *memStorage) shardFor(key string) *shard {
+	return m.shards[shardIndex(key)]
+}
+
+func (m *memStorage) lockShards(indexes []int) {
+	for _, i := range indexes {
+		m.shards[i].mu.Lock()
 	}
-	return 0, false
 }
 
-func (m *memStorage) GetCounter(ctx context.Context, name string) (int64, bool) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-	if metric, exists := m.counters[name]; exists {
-		return metric, true
+func (m *memStorage) unlockShards(indexes []int) {
+	for _, i := range indexes {
+		m.shards[i].mu.Unlock()
 	}
-	return 0, false
 }
 
-func (m *memStorage) GetAllMetrics(ctx context.Context) (string, error) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+func (m *memStorage) lockAll() {
+	for _, s := range m.shards {
+		s.mu.Lock()
+	}
+}
 
-	var result string
+func (m *memStorage) unlockAll() {
+	for _, s := range m.shards {
+		s.mu.Unlock()
+	}
+}
 
-	result += "<ul>\n"
+// rlockAll блокирует все шарды на чтение, чтобы получить согласованный срез хранилища
+func (m *memStorage) rlockAll() {
+	for _, s := range m.shards {
+		s.mu.RLock()
+	}
+}
 
-	for key, value := range m.counters {
-		result += fmt.Sprintf("<li>%s = %d</li>\n", key, value)
+func (m *memStorage) runlockAll() {
+	for _, s := range m.shards {
+		s.mu.RUnlock()
 	}
+}
 
-	for key, value := range m.gauges {
-		result += fmt.Sprintf("<li>%s = %f</li>\n", key, value)
+// GetGauge читает значение без блокировок: на горячем пути /value не ждет записи батчей
+func (m *memStorage) GetGauge(ctx context.Context, name string) (float64, error) {
+	if value, exists := m.shardFor(name).getGauge(name); exists {
+		return value, nil
 	}
+	return 0, service.ErrNotFound
+}
 
-	result += "</ul>\n"
+func (m *memStorage) GetCounter(ctx context.Context, name string) (int64, error) {
+	s := m.shardFor(name)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if metric, exists := s.counters[name]; exists {
+		return metric, nil
+	}
+	return 0, service.ErrNotFound
+}
 
-	if result != "<ul>\n</ul>\n" {
-		return result, nil
+func (m *memStorage) GetHistogram(ctx context.Context, name string) (model.HistogramValue, error) {
+	s := m.shardFor(name)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if histogram, exists := s.histograms[name]; exists {
+		return histogram.Clone(), nil
 	}
+	return model.HistogramValue{}, service.ErrNotFound
+}
+
+func (m *memStorage) ListMetrics(ctx context.Context, filter model.MetricsFilter) ([]model.Metrics, error) {
+	m.rlockAll()
+	result := m.collect(filter)
+	m.runlockAll()
 
-	return "", fmt.Errorf("no metrics found")
+	// Сортировка нужна для стабильной пагинации
+	model.SortMetrics(result)
+
+	return paginate(result, filter.Limit, filter.Offset), nil
 }
 
-func (m *memStorage) SaveToFile(filename string) error {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+// collect собирает метрики всех шардов. Вызывается под rlockAll
+func (m *memStorage) collect(filter model.MetricsFilter) []model.Metrics {
+	var result []model.Metrics
+	for _, s := range m.shards {
+		result = s.appendTo(result, filter)
+	}
+	return result
+}
 
-	var metrics []model.Metrics
+func (m *memStorage) DeleteMetric(ctx context.Context, mtype, name string) error {
+	s := m.shardFor(name)
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	for id, delta := range m.counters {
-		deltaCopy := delta
-		metrics = append(metrics, model.Metrics{
-			ID:    id,
-			MType: "counter",
-			Delta: &deltaCopy,
-		})
+	if !s.has(mtype, name) {
+		return service.ErrNotFound
+	}
+	if err := m.logDelete([]model.Metrics{{ID: name, MType: mtype}}); err != nil {
+		return err
 	}
+	s.remove(mtype, name)
+	return nil
+}
 
-	for id, value := range m.gauges {
-		valueCopy := value
-		metrics = append(metrics, model.Metrics{
-			ID:    id,
-			MType: "gauge",
-			Value: &valueCopy,
-		})
+func (m *memStorage) DeleteMetrics(ctx context.Context, filter model.MetricsFilter) ([]model.Metrics, error) {
+	return m.deleteMatching(func(key, mtype string, _ time.Time) bool {
+		return filter.MatchKey(key, mtype)
+	})
+}
+
+func (m *memStorage) DeleteStale(ctx context.Context, before time.Time) ([]model.Metrics, error) {
+	return m.deleteMatching(func(_, _ string, updatedAt time.Time) bool {
+		return updatedAt.Before(before)
+	})
+}
+
+// deleteMatching удаляет метрики, для которых match вернул true.
+// Шарды обрабатываются по одному, чтобы не останавливать запись во все хранилище.
+func (m *memStorage) deleteMatching(match func(key, mtype string, updatedAt time.Time) bool) ([]model.Metrics, error) {
+	deleted := make([]model.Metrics, 0)
+	for _, s := range m.shards {
+		s.mu.Lock()
+		matched := s.matching(match)
+		if len(matched) > 0 {
+			if err := m.logDelete(matched); err != nil {
+				s.mu.Unlock()
+				return nil, err
+			}
+			for _, metric := range matched {
+				s.remove(metric.MType, metric.Key())
+			}
+			deleted = append(deleted, matched...)
+		}
+		s.mu.Unlock()
 	}
 
-	data, err := json.MarshalIndent(metrics, "", "  ")
-	if err != nil {
-		return fmt.Errorf("failed to marshal metrics: %w", err)
+	model.SortMetrics(deleted)
+	return deleted, nil
+}
+
+// paginate возвращает страницу отсортированного списка
+func paginate(metrics []model.Metrics, limit, offset int) []model.Metrics {
+	if offset >= len(metrics) {
+		return []model.Metrics{}
+	}
+	if offset > 0 {
+		metrics = metrics[offset:]
 	}
+	if limit > 0 && limit < len(metrics) {
+		metrics = metrics[:limit]
+	}
+	return metrics
+}
 
-	if err := os.WriteFile(filename, data, 0644); err != nil {
-		return fmt.Errorf("failed to write file: %w", err)
+func (m *memStorage) GetHistory(ctx context.Context, mtype, name string, from, to time.Time) ([]model.MetricSample, error) {
+	s := m.shardFor(name)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ring, exists := s.history[historyKey(mtype, name)]
+	if !exists {
+		return []model.MetricSample{}, nil
 	}
 
-	return nil
+	return ring.between(from.UnixMilli(), to.UnixMilli()), nil
 }
 
-func (m *memStorage) LoadFromFile(filename string) error {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+func (m *memStorage) SaveToFile(filename string) error {
+	m.saveMu.Lock()
+	defer m.saveMu.Unlock()
+
+	// Под блокировками всех шардов только копируем состояние: записи
+	// с номером до walSeq уже в копии, более поздних в ней нет
+	m.rlockAll()
+	metrics := m.collect(model.MetricsFilter{})
+	var walSeq uint64
+	if m.wal != nil {
+		walSeq = m.wal.lastSeq()
+	}
+	m.runlockAll()
 
-	data, err := os.ReadFile(filename)
-	if err != nil {
-		if os.IsNotExist(err) {
-			m.log.Error("error while loading file", zap.Error(err))
-			return nil
-		}
-		return fmt.Errorf("failed to read file: %w", err)
+	if err := writeSnapshot(filename, m.snapshotGenerations, metrics, walSeq); err != nil {
+		return err
 	}
 
-	var metrics []model.Metrics
-	if err := json.Unmarshal(data, &metrics); err != nil {
-		return fmt.Errorf("failed to unmarshal metrics: %w", err)
+	// Из журнала удаляются только записи, вошедшие в снапшот
+	if m.wal != nil {
+		if err := m.wal.truncateThrough(walSeq); err != nil {
+			return err
+		}
 	}
 
-	for _, metric := range metrics {
-		switch metric.MType {
-		case "counter":
-			if metric.Delta != nil {
-				m.counters[metric.ID] = *metric.Delta
+	return nil
+}
+
+// LoadFromFile восстанавливает метрики из самого свежего корректного поколения снапшота.
+// Поврежденные файлы переименовываются в *.corrupt-<время> и пропускаются.
+// Если ни одного снапшота нет, хранилище остается пустым.
+func (m *memStorage) LoadFromFile(filename string) error {
+	m.lockAll()
+	defer m.unlockAll()
+
+	var lastErr error
+	for gen := 0; gen < m.snapshotGenerations; gen++ {
+		path := generationPath(filename, gen)
+
+		snap, err := readSnapshot(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
 			}
-		case "gauge":
-			if metric.Value != nil {
-				m.gauges[metric.ID] = *metric.Value
+			if errors.Is(err, errCorruptSnapshot) {
+				target, qErr := quarantine(path)
+				m.log.Warn("corrupt snapshot moved aside",
+					zap.String("filename", path),
+					zap.String("moved_to", target),
+					zap.Error(err),
+					zap.NamedError("move_error", qErr))
+			} else {
+				m.log.Error("failed to read snapshot", zap.String("filename", path), zap.Error(err))
 			}
+			lastErr = err
+			continue
 		}
+
+		// Время обновления в снапшоте не хранится, TTL отсчитывается от восстановления
+		now := time.Now()
+		for _, metric := range snap.metrics {
+			key := metric.Key()
+			s := m.shardFor(key)
+			switch metric.MType {
+			case model.Counter:
+				if metric.Delta != nil {
+					s.counters[key] = *metric.Delta
+					s.updated[historyKey(model.Counter, key)] = now
+				}
+			case model.Gauge:
+				if metric.Value != nil {
+					s.storeGauge(key, *metric.Value)
+					s.updated[historyKey(model.Gauge, key)] = now
+				}
+			case model.Histogram:
+				if metric.Histogram != nil {
+					s.histograms[key] = *metric.Histogram
+					s.updated[historyKey(model.Histogram, key)] = now
+				}
+			}
+		}
+		m.snapshotWALSeq = snap.walSeq
+
+		if gen > 0 {
+			m.log.Warn("restored from older snapshot generation, recent changes may be lost",
+				zap.String("filename", path))
+		}
+		m.log.Info("load metrics from file", zap.String("filename", path))
+		return nil
 	}
 
-	m.log.Info("load metrics from file", zap.String("filename", filename))
+	if lastErr != nil && !errors.Is(lastErr, errCorruptSnapshot) {
+		return fmt.Errorf("no readable snapshot: %w", lastErr)
+	}
 
+	m.log.Warn("no valid snapshot found, starting with empty storage", zap.String("filename", filename))
 	return nil
 }
 
@@ -264,5 +574,11 @@ func (m *memStorage) Close() error {
 		return fmt.Errorf("failed to save on close: %w", err)
 	}
 
+	if m.wal != nil {
+		if err := m.wal.close(); err != nil {
+			return fmt.Errorf("failed to close wal: %w", err)
+		}
+	}
+
 	return nil
 }
@@ -1,8 +1,15 @@
 package memstorage
 
 import (
+	"context"
+	"fmt"
 	"sync"
 	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/config"
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/model"
 )
 
 // --- Вариант 1: с обычным Mutex ---
@@ -31,6 +38,19 @@ func (m *memStorageMutex) UpdateCounter(name string, value int64) {
 	m.counters[name] += value
 }
 
+func (m *memStorageMutex) UpdateMetrics(metrics []model.Metrics) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, metric := range metrics {
+		switch metric.MType {
+		case model.Gauge:
+			m.gauges[metric.ID] = *metric.Value
+		case model.Counter:
+			m.counters[metric.ID] += *metric.Delta
+		}
+	}
+}
+
 func (m *memStorageMutex) GetGauge(name string) (float64, bool) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -85,6 +105,55 @@ func (m *memStorageRWMutex) GetCounter(name string) (int64, bool) {
 	return v, ok
 }
 
+// --- Вариант 3: шардированный memStorage ---
+func newShardedStorage() *memStorage {
+	storage := NewMemStorage(&config.ServerFlags{}, zap.NewNop()).(*memStorage)
+	ctx := context.Background()
+	storage.UpdateGauge(ctx, "g1", 0)
+	storage.UpdateCounter(ctx, "c1", 0)
+	return storage
+}
+
+// --- Вариант 4: прежняя схема, тот же memStorage под одним Mutex ---
+type globalLockStorage struct {
+	mu sync.Mutex
+	s  *memStorage
+}
+
+func newGlobalLockStorage() *globalLockStorage {
+	return &globalLockStorage{s: newShardedStorage()}
+}
+
+func (g *globalLockStorage) UpdateGauge(ctx context.Context, name string, value float64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.s.UpdateGauge(ctx, name, value)
+}
+
+func (g *globalLockStorage) UpdateCounter(ctx context.Context, name string, value int64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.s.UpdateCounter(ctx, name, value)
+}
+
+func (g *globalLockStorage) UpdateMetrics(ctx context.Context, metrics []model.Metrics) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.s.UpdateMetrics(ctx, metrics)
+}
+
+func (g *globalLockStorage) GetGauge(ctx context.Context, name string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.s.GetGauge(ctx, name)
+}
+
+func (g *globalLockStorage) GetCounter(ctx context.Context, name string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.s.GetCounter(ctx, name)
+}
+
 // --- Бенчмарки ---
 
 // Read-heavy: 90% чтений, 10% записей
@@ -96,6 +165,14 @@ func BenchmarkRWMutex_ReadHeavy(b *testing.B) {
 	runBenchmark(b, newMemStorageRWMutex(), 9, 1)
 }
 
+func BenchmarkGlobalLock_ReadHeavy(b *testing.B) {
+	runBenchmark(b, newGlobalLockStorage(), 9, 1)
+}
+
+func BenchmarkSharded_ReadHeavy(b *testing.B) {
+	runBenchmark(b, newShardedStorage(), 9, 1)
+}
+
 // Balanced: 50% чтений, 50% записей
 func BenchmarkMutex_Balanced(b *testing.B) {
 	runBenchmark(b, newMemStorageMutex(), 1, 1)
@@ -105,6 +182,14 @@ func BenchmarkRWMutex_Balanced(b *testing.B) {
 	runBenchmark(b, newMemStorageRWMutex(), 1, 1)
 }
 
+func BenchmarkGlobalLock_Balanced(b *testing.B) {
+	runBenchmark(b, newGlobalLockStorage(), 1, 1)
+}
+
+func BenchmarkSharded_Balanced(b *testing.B) {
+	runBenchmark(b, newShardedStorage(), 1, 1)
+}
+
 // Write-heavy: 10% чтений, 90% записей
 func BenchmarkMutex_WriteHeavy(b *testing.B) {
 	runBenchmark(b, newMemStorageMutex(), 1, 9)
@@ -114,8 +199,30 @@ func BenchmarkRWMutex_WriteHeavy(b *testing.B) {
 	runBenchmark(b, newMemStorageRWMutex(), 1, 9)
 }
 
+func BenchmarkGlobalLock_WriteHeavy(b *testing.B) {
+	runBenchmark(b, newGlobalLockStorage(), 1, 9)
+}
+
+func BenchmarkSharded_WriteHeavy(b *testing.B) {
+	runBenchmark(b, newShardedStorage(), 1, 9)
+}
+
+// Чтение gauge на фоне батчей агента: 90% GetGauge по разным именам, 10% UpdateMetrics
+func BenchmarkMutex_ReadsDuringBatches(b *testing.B) {
+	runBatchBenchmark(b, newMemStorageMutex(), 9, 1)
+}
+
+func BenchmarkGlobalLock_ReadsDuringBatches(b *testing.B) {
+	runBatchBenchmark(b, newGlobalLockStorage(), 9, 1)
+}
+
+func BenchmarkSharded_ReadsDuringBatches(b *testing.B) {
+	runBatchBenchmark(b, newShardedStorage(), 9, 1)
+}
+
 // Общий runner для всех сценариев
 func runBenchmark(b *testing.B, s interface{}, readRatio, writeRatio int) {
+	ctx := context.Background()
 	b.ResetTimer()
 	b.RunParallel(func(pb *testing.PB) {
 		counter := 0
@@ -131,6 +238,12 @@ func runBenchmark(b *testing.B, s interface{}, readRatio, writeRatio int) {
 				case *memStorageRWMutex:
 					st.GetGauge("g1")
 					st.GetCounter("c1")
+				case *globalLockStorage:
+					st.GetGauge(ctx, "g1")
+					st.GetCounter(ctx, "c1")
+				case *memStorage:
+					st.GetGauge(ctx, "g1")
+					st.GetCounter(ctx, "c1")
 				}
 			} else {
 				// Запись
@@ -141,6 +254,67 @@ func runBenchmark(b *testing.B, s interface{}, readRatio, writeRatio int) {
 				case *memStorageRWMutex:
 					st.UpdateGauge("g1", float64(counter))
 					st.UpdateCounter("c1", 1)
+				case *globalLockStorage:
+					st.UpdateGauge(ctx, "g1", float64(counter))
+					st.UpdateCounter(ctx, "c1", 1)
+				case *memStorage:
+					st.UpdateGauge(ctx, "g1", float64(counter))
+					st.UpdateCounter(ctx, "c1", 1)
+				}
+			}
+		}
+	})
+}
+
+// agentBatch - батч, похожий на отправку агента: 38 gauge и PollCount
+func agentBatch() []model.Metrics {
+	metrics := make([]model.Metrics, 0, 40)
+	for i := 0; i < 38; i++ {
+		value := float64(i)
+		metrics = append(metrics, model.Metrics{ID: fmt.Sprintf("gauge%d", i), MType: model.Gauge, Value: &value})
+	}
+	delta := int64(1)
+	metrics = append(metrics, model.Metrics{ID: "PollCount", MType: model.Counter, Delta: &delta})
+	return metrics
+}
+
+// runBatchBenchmark читает gauge из батча агента, пока параллельно пишутся целые батчи
+func runBatchBenchmark(b *testing.B, s interface{}, readRatio, writeRatio int) {
+	ctx := context.Background()
+	metrics := agentBatch()
+	switch st := s.(type) {
+	case *memStorageMutex:
+		st.UpdateMetrics(metrics)
+	case *globalLockStorage:
+		st.UpdateMetrics(ctx, metrics)
+	case *memStorage:
+		st.UpdateMetrics(ctx, metrics)
+	}
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		counter := 0
+		for pb.Next() {
+			counter++
+			op := counter % (readRatio + writeRatio)
+			if op < readRatio {
+				name := metrics[counter%(len(metrics)-1)].ID
+				switch st := s.(type) {
+				case *memStorageMutex:
+					st.GetGauge(name)
+				case *globalLockStorage:
+					st.GetGauge(ctx, name)
+				case *memStorage:
+					st.GetGauge(ctx, name)
+				}
+			} else {
+				switch st := s.(type) {
+				case *memStorageMutex:
+					st.UpdateMetrics(metrics)
+				case *globalLockStorage:
+					st.UpdateMetrics(ctx, metrics)
+				case *memStorage:
+					st.UpdateMetrics(ctx, metrics)
 				}
 			}
 		}
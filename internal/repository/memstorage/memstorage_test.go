@@ -2,11 +2,17 @@ package memstorage
 
 import (
 	"context"
+	"fmt"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/kazakovdmitriy/go-musthave-metrics/internal/config"
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/model"
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/repository/storagetest"
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/service"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"go.uber.org/zap/zaptest"
 )
 
@@ -18,9 +24,9 @@ func TestMemStorage_UpdateAndGetGauge(t *testing.T) {
 
 	ctx := context.Background()
 	storage.UpdateGauge(ctx, name, value)
-	got, ok := storage.GetGauge(ctx, name)
+	got, err := storage.GetGauge(ctx, name)
 
-	assert.True(t, ok)
+	require.NoError(t, err)
 	assert.Equal(t, value, got)
 }
 
@@ -32,9 +38,9 @@ func TestMemStorage_UpdateAndGetCounter(t *testing.T) {
 
 	ctx := context.Background()
 	storage.UpdateCounter(ctx, name, value)
-	got, ok := storage.GetCounter(ctx, name)
+	got, err := storage.GetCounter(ctx, name)
 
-	assert.True(t, ok)
+	require.NoError(t, err)
 	assert.Equal(t, value, got)
 }
 
@@ -47,8 +53,8 @@ func TestMemStorage_UpdateCounterIncrement(t *testing.T) {
 	storage.UpdateCounter(ctx, name, 10)
 	storage.UpdateCounter(ctx, name, 5)
 
-	got, ok := storage.GetCounter(ctx, name)
-	assert.True(t, ok)
+	got, err := storage.GetCounter(ctx, name)
+	require.NoError(t, err)
 	assert.Equal(t, int64(15), got)
 }
 
@@ -57,14 +63,14 @@ func TestMemStorage_GetNonExistent(t *testing.T) {
 	storage := NewMemStorage(&config.ServerFlags{}, logger)
 
 	ctx := context.Background()
-	_, ok := storage.GetGauge(ctx, "nonexistent")
-	assert.False(t, ok)
+	_, err := storage.GetGauge(ctx, "nonexistent")
+	assert.ErrorIs(t, err, service.ErrNotFound)
 
-	_, ok = storage.GetCounter(ctx, "nonexistent")
-	assert.False(t, ok)
+	_, err = storage.GetCounter(ctx, "nonexistent")
+	assert.ErrorIs(t, err, service.ErrNotFound)
 }
 
-func TestMemStorage_GetAllMetrics(t *testing.T) {
+func TestMemStorage_ListMetrics(t *testing.T) {
 	logger := zaptest.NewLogger(t)
 	storage := NewMemStorage(&config.ServerFlags{}, logger)
 
@@ -72,20 +78,65 @@ func TestMemStorage_GetAllMetrics(t *testing.T) {
 	storage.UpdateGauge(ctx, "gauge1", 3.14)
 	storage.UpdateCounter(ctx, "counter1", 42)
 
-	result, err := storage.GetAllMetrics(ctx)
+	result, err := storage.ListMetrics(ctx, model.MetricsFilter{})
+	require.NoError(t, err)
+	require.Len(t, result, 2)
+
+	assert.Equal(t, "counter1", result[0].ID)
+	assert.Equal(t, model.Counter, result[0].MType)
+	assert.Equal(t, int64(42), *result[0].Delta)
+
+	assert.Equal(t, "gauge1", result[1].ID)
+	assert.Equal(t, model.Gauge, result[1].MType)
+	assert.Equal(t, 3.14, *result[1].Value)
+}
+
+func TestMemStorage_ListMetrics_Empty(t *testing.T) {
+	logger := zaptest.NewLogger(t)
+	storage := NewMemStorage(&config.ServerFlags{}, logger)
+
+	ctx := context.Background()
+	result, err := storage.ListMetrics(ctx, model.MetricsFilter{})
 	assert.NoError(t, err)
-	assert.Contains(t, result, "<li>gauge1 = 3.140000</li>")
-	assert.Contains(t, result, "<li>counter1 = 42</li>")
+	assert.Empty(t, result)
 }
 
-func TestMemStorage_GetAllMetrics_Empty(t *testing.T) {
+func TestMemStorage_ListMetrics_Filter(t *testing.T) {
 	logger := zaptest.NewLogger(t)
 	storage := NewMemStorage(&config.ServerFlags{}, logger)
 
 	ctx := context.Background()
-	_, err := storage.GetAllMetrics(ctx)
-	assert.Error(t, err)
-	assert.Equal(t, "no metricshandler found", err.Error())
+	storage.UpdateGauge(ctx, "CPUutilization1", 10)
+	storage.UpdateGauge(ctx, "CPUutilization2", 20)
+	storage.UpdateGauge(ctx, "CPUutilization3", 30)
+	storage.UpdateGauge(ctx, "HeapAlloc", 1)
+	storage.UpdateCounter(ctx, "CPUcount", 4)
+
+	tests := []struct {
+		name     string
+		filter   model.MetricsFilter
+		expected []string
+	}{
+		{"prefix", model.MetricsFilter{Prefix: "CPUutil"}, []string{"CPUutilization1", "CPUutilization2", "CPUutilization3"}},
+		{"type", model.MetricsFilter{MType: model.Counter}, []string{"CPUcount"}},
+		{"prefix and type", model.MetricsFilter{Prefix: "CPU", MType: model.Gauge}, []string{"CPUutilization1", "CPUutilization2", "CPUutilization3"}},
+		{"limit", model.MetricsFilter{Prefix: "CPU", Limit: 2}, []string{"CPUcount", "CPUutilization1"}},
+		{"limit and offset", model.MetricsFilter{Prefix: "CPU", Limit: 2, Offset: 2}, []string{"CPUutilization2", "CPUutilization3"}},
+		{"offset out of range", model.MetricsFilter{Offset: 10}, []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := storage.ListMetrics(ctx, tt.filter)
+			require.NoError(t, err)
+
+			ids := make([]string, 0, len(result))
+			for _, m := range result {
+				ids = append(ids, m.ID)
+			}
+			assert.Equal(t, tt.expected, ids)
+		})
+	}
 }
 
 func TestMemStorage_ConcurrentAccess(t *testing.T) {
@@ -108,7 +159,163 @@ func TestMemStorage_ConcurrentAccess(t *testing.T) {
 	}
 	wg.Wait()
 
-	counter, ok := storage.GetCounter(ctx, "counter")
-	assert.True(t, ok)
+	counter, err := storage.GetCounter(ctx, "counter")
+	require.NoError(t, err)
 	assert.Equal(t, int64(workers*increments), counter)
 }
+
+func TestMemStorage_GetHistory(t *testing.T) {
+	logger := zaptest.NewLogger(t)
+	storage := NewMemStorage(&config.ServerFlags{}, logger)
+
+	ctx := context.Background()
+	from := time.Now().Add(-time.Second)
+	storage.UpdateGauge(ctx, "gauge", 1.5)
+	storage.UpdateGauge(ctx, "gauge", 2.5)
+	storage.UpdateCounter(ctx, "counter", 10)
+	storage.UpdateMetrics(ctx, []model.Metrics{
+		{ID: "counter", MType: model.Counter, Delta: int64Ptr(5)},
+	})
+	to := time.Now().Add(time.Second)
+
+	gauges, err := storage.GetHistory(ctx, model.Gauge, "gauge", from, to)
+	require.NoError(t, err)
+	require.Len(t, gauges, 2)
+	assert.Equal(t, 1.5, *gauges[0].Value)
+	assert.Equal(t, 2.5, *gauges[1].Value)
+
+	counters, err := storage.GetHistory(ctx, model.Counter, "counter", from, to)
+	require.NoError(t, err)
+	require.Len(t, counters, 2)
+	assert.Equal(t, int64(10), *counters[0].Delta)
+	assert.Equal(t, int64(15), *counters[1].Delta)
+
+	missing, err := storage.GetHistory(ctx, model.Gauge, "counter", from, to)
+	require.NoError(t, err)
+	assert.Empty(t, missing)
+
+	outOfRange, err := storage.GetHistory(ctx, model.Gauge, "gauge", to, to.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Empty(t, outOfRange)
+}
+
+func TestMemStorage_HistoryIsBounded(t *testing.T) {
+	logger := zaptest.NewLogger(t)
+	storage := NewMemStorage(&config.ServerFlags{HistorySize: 3}, logger)
+
+	ctx := context.Background()
+	for i := 1; i <= 5; i++ {
+		storage.UpdateGauge(ctx, "gauge", float64(i))
+	}
+
+	samples, err := storage.GetHistory(ctx, model.Gauge, "gauge", time.Unix(0, 0), time.Now().Add(time.Second))
+	require.NoError(t, err)
+	require.Len(t, samples, 3)
+	assert.Equal(t, 3.0, *samples[0].Value)
+	assert.Equal(t, 5.0, *samples[2].Value)
+}
+
+func int64Ptr(i int64) *int64 {
+	return &i
+}
+
+func TestMemStorage_UpdateMetricsOnce(t *testing.T) {
+	storage := NewMemStorage(&config.ServerFlags{}, zaptest.NewLogger(t))
+	ctx := context.Background()
+
+	batch := []model.Metrics{{ID: "PollCount", MType: model.Counter, Delta: int64Ptr(5)}}
+
+	applied, err := storage.UpdateMetricsOnce(ctx, "batch-1", batch)
+	require.NoError(t, err)
+	assert.True(t, applied)
+
+	// Повтор с тем же ключом не увеличивает счетчик
+	applied, err = storage.UpdateMetricsOnce(ctx, "batch-1", batch)
+	require.NoError(t, err)
+	assert.False(t, applied)
+
+	applied, err = storage.UpdateMetricsOnce(ctx, "batch-2", batch)
+	require.NoError(t, err)
+	assert.True(t, applied)
+
+	got, err := storage.GetCounter(ctx, "PollCount")
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), got)
+}
+
+func TestKeyCache_Expiry(t *testing.T) {
+	cache := newKeyCache(time.Minute)
+	now := time.Now()
+
+	cache.add("a", now)
+	assert.True(t, cache.contains("a", now.Add(30*time.Second)))
+	assert.False(t, cache.contains("a", now.Add(time.Minute)))
+
+	// Добавление после ttl удаляет устаревшие ключи
+	cache.add("b", now.Add(2*time.Minute))
+	assert.NotContains(t, cache.keys, "a")
+	assert.Contains(t, cache.keys, "b")
+}
+
+func TestMemStorage_SameNameDifferentTypes(t *testing.T) {
+	storage := NewMemStorage(&config.ServerFlags{}, zaptest.NewLogger(t))
+	storagetest.SameNameDifferentTypes(t, storage)
+}
+
+func TestMemStorage_DuplicateIDsInBatch(t *testing.T) {
+	storage := NewMemStorage(&config.ServerFlags{}, zaptest.NewLogger(t))
+	storagetest.DuplicateIDsInBatch(t, storage)
+}
+
+func TestMemStorage_DeleteAndExpire(t *testing.T) {
+	storage := NewMemStorage(&config.ServerFlags{}, zaptest.NewLogger(t))
+	storagetest.DeleteAndExpire(t, storage)
+}
+
+func TestMemStorage_Labels(t *testing.T) {
+	storage := NewMemStorage(&config.ServerFlags{}, zaptest.NewLogger(t))
+	storagetest.Labels(t, storage)
+}
+
+func TestMemStorage_Histograms(t *testing.T) {
+	storage := NewMemStorage(&config.ServerFlags{}, zaptest.NewLogger(t))
+	storagetest.Histograms(t, storage)
+}
+
+// Батч затрагивает разные шарды, но ListMetrics должен видеть его целиком
+func TestMemStorage_ListMetricsSeesWholeBatch(t *testing.T) {
+	storage := NewMemStorage(&config.ServerFlags{}, zaptest.NewLogger(t))
+	ctx := context.Background()
+
+	batch := func(n int) []model.Metrics {
+		metrics := make([]model.Metrics, 0, 64)
+		for i := 0; i < 64; i++ {
+			value := float64(n)
+			metrics = append(metrics, model.Metrics{ID: fmt.Sprintf("g%d", i), MType: model.Gauge, Value: &value})
+		}
+		return metrics
+	}
+	require.NoError(t, storage.UpdateMetrics(ctx, batch(0)))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for n := 1; n <= 200; n++ {
+			assert.NoError(t, storage.UpdateMetrics(ctx, batch(n)))
+		}
+	}()
+
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		metrics, err := storage.ListMetrics(ctx, model.MetricsFilter{})
+		require.NoError(t, err)
+		require.Len(t, metrics, 64)
+		for _, metric := range metrics {
+			require.Equal(t, *metrics[0].Value, *metric.Value, "partial batch in ListMetrics")
+		}
+	}
+}
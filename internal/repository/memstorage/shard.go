@@ -0,0 +1,248 @@
+package memstorage
+
+import (
+	"hash/maphash"
+	"math"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/model"
+)
+
+// shardCount - количество шардов, степень двойки
+const shardCount = 32
+
+var shardSeed = maphash.MakeSeed()
+
+// gaugeCell хранит значение gauge в битах float64, чтобы читать его без блокировки
+type gaugeCell struct {
+	bits atomic.Uint64
+}
+
+func (c *gaugeCell) load() float64 {
+	return math.Float64frombits(c.bits.Load())
+}
+
+func (c *gaugeCell) store(value float64) {
+	c.bits.Store(math.Float64bits(value))
+}
+
+// shard - часть метрик, выбранная по хешу ключа ряда (model.SeriesKey).
+// Запись идет под mu. Gauge читаются без блокировки: набор имен меняется редко,
+// поэтому хранится в sync.Map, а значение обновляется атомарно.
+type shard struct {
+	mu       sync.RWMutex
+	gauges   sync.Map // string -> *gaugeCell
+	counters map[string]int64
+	// histograms хранит гистограммы, которые не изменяются после записи:
+	// обновление заменяет значение новым
+	histograms map[string]model.HistogramValue
+	history    map[string]*sampleRing
+	// updated - время последнего обновления метрики по ключу historyKey
+	updated map[string]time.Time
+}
+
+func newShard() *shard {
+	return &shard{
+		counters:   make(map[string]int64),
+		histograms: make(map[string]model.HistogramValue),
+		history:    make(map[string]*sampleRing),
+		updated:    make(map[string]time.Time),
+	}
+}
+
+// shardIndex возвращает номер шарда для ключа ряда
+func shardIndex(key string) int {
+	return int(maphash.String(shardSeed, key) & (shardCount - 1))
+}
+
+// shardIndexes возвращает отсортированные номера шардов, затронутых батчем.
+// Шарды блокируются в порядке возрастания, чтобы батчи не взаимоблокировались.
+func shardIndexes(metrics []model.Metrics) []int {
+	var seen [shardCount]bool
+	indexes := make([]int, 0, min(len(metrics), shardCount))
+	for _, metric := range metrics {
+		i := shardIndex(metric.Key())
+		if !seen[i] {
+			seen[i] = true
+			indexes = append(indexes, i)
+		}
+	}
+	sort.Ints(indexes)
+	return indexes
+}
+
+// getGauge читает gauge без блокировки
+func (s *shard) getGauge(id string) (float64, bool) {
+	cell, ok := s.gauges.Load(id)
+	if !ok {
+		return 0, false
+	}
+	return cell.(*gaugeCell).load(), true
+}
+
+// storeGauge сохраняет значение gauge без записи в историю. Вызывается под s.mu
+func (s *shard) storeGauge(id string, value float64) {
+	if cell, ok := s.gauges.Load(id); ok {
+		cell.(*gaugeCell).store(value)
+		return
+	}
+	cell := &gaugeCell{}
+	cell.store(value)
+	s.gauges.Store(id, cell)
+}
+
+// setGauge сохраняет значение gauge и добавляет сэмпл в историю. Вызывается под s.mu
+func (s *shard) setGauge(id string, value float64, now time.Time, historySize int) {
+	s.storeGauge(id, value)
+	s.updated[historyKey(model.Gauge, id)] = now
+	s.ring(model.Gauge, id, historySize).push(model.MetricSample{
+		TS:    now.UnixMilli(),
+		Value: &value,
+	})
+}
+
+// addCounter увеличивает counter и добавляет накопленное значение в историю. Вызывается под s.mu
+func (s *shard) addCounter(id string, delta int64, now time.Time, historySize int) {
+	total := s.counters[id] + delta
+	s.counters[id] = total
+	s.updated[historyKey(model.Counter, id)] = now
+	s.ring(model.Counter, id, historySize).push(model.MetricSample{
+		TS:    now.UnixMilli(),
+		Delta: &total,
+	})
+}
+
+// mergeHistogram добавляет приращение к гистограмме и сохраняет в историю количество и сумму.
+// Приращение с другими границами корзин пропускается: такие записи отсекает
+// checkBuckets до записи в журнал. Вызывается под s.mu
+func (s *shard) mergeHistogram(id string, delta model.HistogramValue, now time.Time, historySize int) {
+	merged := delta.Clone()
+	if current, ok := s.histograms[id]; ok {
+		var err error
+		if merged, err = current.Merge(delta); err != nil {
+			return
+		}
+	}
+	s.histograms[id] = merged
+	s.updated[historyKey(model.Histogram, id)] = now
+	s.ring(model.Histogram, id, historySize).push(model.MetricSample{
+		TS:    now.UnixMilli(),
+		Delta: &merged.Count,
+		Value: &merged.Sum,
+	})
+}
+
+// appendTo добавляет метрики шарда, подходящие под filter. Вызывается под s.mu
+func (s *shard) appendTo(result []model.Metrics, filter model.MetricsFilter) []model.Metrics {
+	for key, delta := range s.counters {
+		id, labels := model.ParseSeriesKey(key)
+		if !filter.Match(id, model.Counter, labels) {
+			continue
+		}
+		result = append(result, model.Metrics{
+			ID:     id,
+			MType:  model.Counter,
+			Delta:  &delta,
+			Labels: labels,
+		})
+	}
+
+	s.gauges.Range(func(key, cell any) bool {
+		id, labels := model.ParseSeriesKey(key.(string))
+		if filter.Match(id, model.Gauge, labels) {
+			value := cell.(*gaugeCell).load()
+			result = append(result, model.Metrics{
+				ID:     id,
+				MType:  model.Gauge,
+				Value:  &value,
+				Labels: labels,
+			})
+		}
+		return true
+	})
+
+	for key, histogram := range s.histograms {
+		id, labels := model.ParseSeriesKey(key)
+		if !filter.Match(id, model.Histogram, labels) {
+			continue
+		}
+		result = append(result, model.Metrics{
+			ID:        id,
+			MType:     model.Histogram,
+			Histogram: &histogram,
+			Labels:    labels,
+		})
+	}
+
+	return result
+}
+
+// has сообщает, сохранена ли метрика. Вызывается под s.mu
+func (s *shard) has(mtype, id string) bool {
+	switch mtype {
+	case model.Gauge:
+		_, ok := s.gauges.Load(id)
+		return ok
+	case model.Counter:
+		_, ok := s.counters[id]
+		return ok
+	case model.Histogram:
+		_, ok := s.histograms[id]
+		return ok
+	}
+	return false
+}
+
+// remove удаляет метрику вместе с историей. Вызывается под s.mu
+func (s *shard) remove(mtype, id string) {
+	switch mtype {
+	case model.Gauge:
+		s.gauges.Delete(id)
+	case model.Counter:
+		delete(s.counters, id)
+	case model.Histogram:
+		delete(s.histograms, id)
+	}
+	key := historyKey(mtype, id)
+	delete(s.history, key)
+	delete(s.updated, key)
+}
+
+// matching возвращает имена, метки и типы метрик, для которых match вернул true. Вызывается под s.mu
+func (s *shard) matching(match func(key, mtype string, updatedAt time.Time) bool) []model.Metrics {
+	var result []model.Metrics
+	for key := range s.counters {
+		if match(key, model.Counter, s.updated[historyKey(model.Counter, key)]) {
+			id, labels := model.ParseSeriesKey(key)
+			result = append(result, model.Metrics{ID: id, MType: model.Counter, Labels: labels})
+		}
+	}
+	s.gauges.Range(func(k, _ any) bool {
+		key := k.(string)
+		if match(key, model.Gauge, s.updated[historyKey(model.Gauge, key)]) {
+			id, labels := model.ParseSeriesKey(key)
+			result = append(result, model.Metrics{ID: id, MType: model.Gauge, Labels: labels})
+		}
+		return true
+	})
+	for key := range s.histograms {
+		if match(key, model.Histogram, s.updated[historyKey(model.Histogram, key)]) {
+			id, labels := model.ParseSeriesKey(key)
+			result = append(result, model.Metrics{ID: id, MType: model.Histogram, Labels: labels})
+		}
+	}
+	return result
+}
+
+func (s *shard) ring(mtype, name string, historySize int) *sampleRing {
+	key := historyKey(mtype, name)
+	ring, exists := s.history[key]
+	if !exists {
+		ring = newSampleRing(historySize)
+		s.history[key] = ring
+	}
+	return ring
+}
@@ -0,0 +1,183 @@
+package memstorage
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/model"
+)
+
+// snapshotVersion - текущая версия формата файла снапшота
+const snapshotVersion = 1
+
+// defaultSnapshotGenerations - сколько поколений снапшота хранится по умолчанию
+const defaultSnapshotGenerations = 3
+
+// errCorruptSnapshot - файл снапшота поврежден или имеет неизвестный формат
+var errCorruptSnapshot = errors.New("corrupt snapshot")
+
+// snapshotHeader - первая строка файла снапшота.
+// Checksum - SHA-256 от тела (всего, что после первой строки).
+// WALSeq - номер последней записи журнала, вошедшей в снапшот.
+type snapshotHeader struct {
+	Version   int       `json:"version"`
+	Checksum  string    `json:"checksum"`
+	CreatedAt time.Time `json:"created_at"`
+	WALSeq    uint64    `json:"wal_seq"`
+}
+
+// snapshot - содержимое прочитанного файла снапшота
+type snapshot struct {
+	metrics []model.Metrics
+	walSeq  uint64
+}
+
+// generationPath возвращает путь к поколению снапшота: 0 - текущий файл, n - path.n
+func generationPath(path string, generation int) string {
+	if generation == 0 {
+		return path
+	}
+	return path + "." + strconv.Itoa(generation)
+}
+
+// writeSnapshot атомарно записывает снапшот: во временный файл в том же каталоге,
+// fsync, сдвиг старых поколений и переименование поверх текущего файла.
+func writeSnapshot(path string, generations int, metrics []model.Metrics, walSeq uint64) error {
+	body, err := json.MarshalIndent(metrics, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal metrics: %w", err)
+	}
+
+	sum := sha256.Sum256(body)
+	header, err := json.Marshal(snapshotHeader{
+		Version:   snapshotVersion,
+		Checksum:  hex.EncodeToString(sum[:]),
+		CreatedAt: time.Now().UTC(),
+		WALSeq:    walSeq,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal snapshot header: %w", err)
+	}
+
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName)
+
+	writer := bufio.NewWriter(tmp)
+	writer.Write(header)
+	writer.WriteByte('\n')
+	writer.Write(body)
+	if err := writer.Flush(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close file: %w", err)
+	}
+
+	if err := rotateGenerations(path, generations); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmpName, path); err != nil {
+		return fmt.Errorf("failed to rename snapshot: %w", err)
+	}
+
+	return syncDir(dir)
+}
+
+// rotateGenerations сдвигает поколения: path.n-2 -> path.n-1, ..., path -> path.1.
+// Самое старое поколение перезаписывается.
+func rotateGenerations(path string, generations int) error {
+	for gen := generations - 1; gen > 0; gen-- {
+		from := generationPath(path, gen-1)
+		if err := os.Rename(from, generationPath(path, gen)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to rotate snapshot %s: %w", from, err)
+		}
+	}
+	return nil
+}
+
+// readSnapshot читает и проверяет файл снапшота.
+// Файлы старого формата без заголовка (JSON-массив) читаются без проверки контрольной суммы.
+func readSnapshot(path string) (snapshot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return snapshot{}, err
+	}
+
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		var metrics []model.Metrics
+		if err := json.Unmarshal(trimmed, &metrics); err != nil {
+			return snapshot{}, fmt.Errorf("%w: %v", errCorruptSnapshot, err)
+		}
+		return snapshot{metrics: metrics}, nil
+	}
+
+	headerLine, body, found := bytes.Cut(data, []byte{'\n'})
+	if !found {
+		return snapshot{}, fmt.Errorf("%w: missing header", errCorruptSnapshot)
+	}
+
+	var header snapshotHeader
+	if err := json.Unmarshal(headerLine, &header); err != nil {
+		return snapshot{}, fmt.Errorf("%w: invalid header: %v", errCorruptSnapshot, err)
+	}
+	if header.Version != snapshotVersion {
+		return snapshot{}, fmt.Errorf("%w: unsupported version %d", errCorruptSnapshot, header.Version)
+	}
+
+	sum := sha256.Sum256(body)
+	if hex.EncodeToString(sum[:]) != header.Checksum {
+		return snapshot{}, fmt.Errorf("%w: checksum mismatch", errCorruptSnapshot)
+	}
+
+	var metrics []model.Metrics
+	if err := json.Unmarshal(body, &metrics); err != nil {
+		return snapshot{}, fmt.Errorf("%w: %v", errCorruptSnapshot, err)
+	}
+
+	return snapshot{metrics: metrics, walSeq: header.WALSeq}, nil
+}
+
+// quarantine переименовывает поврежденный файл, чтобы он не мешал следующим запускам
+// и остался доступен для разбора
+func quarantine(path string) (string, error) {
+	target := fmt.Sprintf("%s.corrupt-%d", path, time.Now().UnixNano())
+	if err := os.Rename(path, target); err != nil {
+		return "", err
+	}
+	return target, nil
+}
+
+// syncDir сбрасывает на диск запись каталога после переименования
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("failed to open dir: %w", err)
+	}
+	defer d.Close()
+
+	if err := d.Sync(); err != nil {
+		return fmt.Errorf("failed to sync dir: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package memstorage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/config"
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func snapshotConfig(t *testing.T) *config.ServerFlags {
+	t.Helper()
+	return &config.ServerFlags{
+		FileStoragePath:     filepath.Join(t.TempDir(), "metrics.json"),
+		Restore:             true,
+		SnapshotGenerations: 3,
+	}
+}
+
+func TestSnapshot_RoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.json")
+	metrics := []model.Metrics{
+		{ID: "PollCount", MType: model.Counter, Delta: int64Ptr(7)},
+	}
+
+	require.NoError(t, writeSnapshot(path, 3, metrics, 42))
+
+	snap, err := readSnapshot(path)
+	require.NoError(t, err)
+	assert.Equal(t, metrics, snap.metrics)
+	assert.Equal(t, uint64(42), snap.walSeq)
+}
+
+func TestSnapshot_ChecksumMismatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.json")
+	require.NoError(t, writeSnapshot(path, 1, []model.Metrics{
+		{ID: "PollCount", MType: model.Counter, Delta: int64Ptr(7)},
+	}, 0))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	data[len(data)-3] ^= 0xff
+	require.NoError(t, os.WriteFile(path, data, 0644))
+
+	_, err = readSnapshot(path)
+	assert.ErrorIs(t, err, errCorruptSnapshot)
+}
+
+func TestSnapshot_RotationKeepsGenerations(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.json")
+
+	for i := int64(1); i <= 5; i++ {
+		require.NoError(t, writeSnapshot(path, 3, []model.Metrics{
+			{ID: "PollCount", MType: model.Counter, Delta: int64Ptr(i)},
+		}, 0))
+	}
+
+	for gen, want := range []int64{5, 4, 3} {
+		snap, err := readSnapshot(generationPath(path, gen))
+		require.NoError(t, err)
+		assert.Equal(t, want, *snap.metrics[0].Delta)
+	}
+
+	_, err := os.Stat(generationPath(path, 3))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestMemStorage_RestoreFallsBackToOlderGeneration(t *testing.T) {
+	cfg := snapshotConfig(t)
+	ctx := context.Background()
+
+	storage := NewMemStorage(cfg, zaptest.NewLogger(t))
+	require.NoError(t, storage.UpdateCounter(ctx, "PollCount", 3))
+	require.NoError(t, storage.(*memStorage).SaveToFile(cfg.FileStoragePath))
+	require.NoError(t, storage.UpdateCounter(ctx, "PollCount", 2))
+	require.NoError(t, storage.(*memStorage).SaveToFile(cfg.FileStoragePath))
+
+	// Последнее поколение повреждено: записано наполовину
+	require.NoError(t, os.WriteFile(cfg.FileStoragePath, []byte(`{"version":1,"checksum":"ab`), 0644))
+
+	restored := NewMemStorage(cfg, zaptest.NewLogger(t))
+	require.NotNil(t, restored)
+
+	counter, err := restored.GetCounter(ctx, "PollCount")
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), counter)
+
+	// Поврежденный файл отложен в сторону
+	_, err = os.Stat(cfg.FileStoragePath)
+	assert.True(t, os.IsNotExist(err))
+	corrupt, err := filepath.Glob(cfg.FileStoragePath + ".corrupt-*")
+	require.NoError(t, err)
+	assert.Len(t, corrupt, 1)
+}
+
+func TestMemStorage_RestoreWithoutValidSnapshot(t *testing.T) {
+	cfg := snapshotConfig(t)
+	require.NoError(t, os.WriteFile(cfg.FileStoragePath, []byte("garbage"), 0644))
+
+	storage := NewMemStorage(cfg, zaptest.NewLogger(t))
+	require.NotNil(t, storage)
+
+	result, err := storage.ListMetrics(context.Background(), model.MetricsFilter{})
+	require.NoError(t, err)
+	assert.Empty(t, result)
+}
+
+func TestMemStorage_RestoreLegacySnapshot(t *testing.T) {
+	cfg := snapshotConfig(t)
+	data := `[{"id":"PollCount","type":"counter","delta":4},{"id":"Alloc","type":"gauge","value":1.5}]`
+	require.NoError(t, os.WriteFile(cfg.FileStoragePath, []byte(data), 0644))
+
+	storage := NewMemStorage(cfg, zaptest.NewLogger(t))
+	ctx := context.Background()
+
+	counter, err := storage.GetCounter(ctx, "PollCount")
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), counter)
+
+	gauge, err := storage.GetGauge(ctx, "Alloc")
+	require.NoError(t, err)
+	assert.Equal(t, 1.5, gauge)
+}
+
+func TestMemStorage_WALRecordsInSnapshotNotReplayed(t *testing.T) {
+	dir := t.TempDir()
+	cfg := walConfig(t, dir, WALSyncAlways)
+	ctx := context.Background()
+
+	storage := NewMemStorage(cfg, zaptest.NewLogger(t))
+	require.NoError(t, storage.UpdateCounter(ctx, "PollCount", 5))
+
+	// Снапшот записан, но журнал не успел очиститься перед падением
+	walData, err := os.ReadFile(cfg.WALPath)
+	require.NoError(t, err)
+	require.NoError(t, storage.(*memStorage).SaveToFile(cfg.FileStoragePath))
+	require.NoError(t, storage.(*memStorage).wal.close())
+	require.NoError(t, os.WriteFile(cfg.WALPath, walData, 0644))
+
+	restored := NewMemStorage(cfg, zaptest.NewLogger(t))
+	counter, err := restored.GetCounter(ctx, "PollCount")
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), counter)
+
+	// Нумерация журнала продолжается после снапшота
+	require.NoError(t, restored.UpdateCounter(ctx, "PollCount", 1))
+	assert.Greater(t, restored.(*memStorage).wal.lastSeq(), uint64(1))
+	require.NoError(t, restored.Close())
+}
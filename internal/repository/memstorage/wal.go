@@ -0,0 +1,311 @@
+package memstorage
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/model"
+	"go.uber.org/zap"
+)
+
+// Политики fsync журнала
+const (
+	WALSyncAlways   = "always"
+	WALSyncInterval = "interval"
+	WALSyncNever    = "never"
+)
+
+// walRecord - одна запись журнала: порядковый номер, батч метрик
+// и ключ идемпотентности, если он был.
+// Для удаления Delete = true, а Metrics содержит id и типы удаленных метрик.
+type walRecord struct {
+	Seq     uint64          `json:"seq"`
+	Key     string          `json:"key,omitempty"`
+	Metrics []model.Metrics `json:"metrics"`
+	Delete  bool            `json:"delete,omitempty"`
+}
+
+// wal - журнал изменений, дописываемый между снапшотами.
+// Каждая запись - строка JSON. Запись идет напрямую в файл без буфера,
+// поэтому падение процесса не теряет данные; политика fsync определяет
+// устойчивость к потере питания.
+type wal struct {
+	mu     sync.Mutex
+	path   string
+	file   *os.File
+	policy string
+	seq    uint64
+	log    *zap.Logger
+
+	done     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+func openWAL(path, policy string, interval time.Duration, log *zap.Logger) (*wal, error) {
+	switch policy {
+	case WALSyncAlways, WALSyncInterval, WALSyncNever:
+	default:
+		return nil, fmt.Errorf("unknown wal sync policy %q", policy)
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open wal: %w", err)
+	}
+
+	w := &wal{
+		path:   path,
+		file:   file,
+		policy: policy,
+		log:    log,
+		done:   make(chan struct{}),
+	}
+
+	if policy == WALSyncInterval && interval > 0 {
+		w.wg.Add(1)
+		go w.syncLoop(interval)
+	}
+
+	return w, nil
+}
+
+// append присваивает записи следующий номер и дописывает ее в журнал
+func (w *wal) append(record walRecord) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	record.Seq = w.seq + 1
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal wal record: %w", err)
+	}
+	data = append(data, '\n')
+
+	if _, err := w.file.Write(data); err != nil {
+		return fmt.Errorf("failed to write wal record: %w", err)
+	}
+	w.seq = record.Seq
+
+	if w.policy == WALSyncAlways {
+		if err := w.file.Sync(); err != nil {
+			return fmt.Errorf("failed to sync wal: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// replay читает записи журнала по порядку.
+// Чтение останавливается на первой поврежденной записи - обычно это
+// недописанная строка после аварийного завершения. Журнал обрезается
+// до последней целой записи, иначе следующие записи дописались бы
+// к поврежденной строке и не читались бы при следующем запуске.
+func (w *wal) replay(apply func(walRecord)) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if _, err := w.file.Seek(0, io.SeekStart); err != nil {
+		return 0, fmt.Errorf("failed to seek wal: %w", err)
+	}
+
+	reader := bufio.NewReader(w.file)
+	count := 0
+	var offset int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			if len(line) > 0 {
+				w.log.Warn("skipping incomplete wal record", zap.Int("record", count+1))
+				return count, w.cutTail(offset)
+			}
+			return count, nil
+		}
+		if err != nil {
+			return count, fmt.Errorf("failed to read wal: %w", err)
+		}
+
+		var record walRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			w.log.Warn("corrupted wal record, stopping replay",
+				zap.Int("record", count+1), zap.Error(err))
+			return count, w.cutTail(offset)
+		}
+
+		if record.Seq > w.seq {
+			w.seq = record.Seq
+		}
+		apply(record)
+		count++
+		offset += int64(len(line))
+	}
+}
+
+// cutTail отбрасывает журнал после offset и сбрасывает его на диск
+// до следующей записи
+func (w *wal) cutTail(offset int64) error {
+	if err := w.file.Truncate(offset); err != nil {
+		return fmt.Errorf("failed to truncate wal tail: %w", err)
+	}
+	if err := w.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync wal: %w", err)
+	}
+	return nil
+}
+
+// lastSeq возвращает номер последней записи журнала
+func (w *wal) lastSeq() uint64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.seq
+}
+
+// advanceSeq продолжает нумерацию не ниже seq, например после снапшота
+// с более поздней записью, чем сохранились в журнале
+func (w *wal) advanceSeq(seq uint64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if seq > w.seq {
+		w.seq = seq
+	}
+}
+
+// truncate очищает журнал
+func (w *wal) truncate() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.truncateLocked()
+}
+
+func (w *wal) truncateLocked() error {
+	if err := w.file.Truncate(0); err != nil {
+		return fmt.Errorf("failed to truncate wal: %w", err)
+	}
+	if w.policy != WALSyncNever {
+		if err := w.file.Sync(); err != nil {
+			return fmt.Errorf("failed to sync wal: %w", err)
+		}
+	}
+	return nil
+}
+
+// truncateThrough удаляет из журнала записи с номером не больше seq,
+// вошедшие в снапшот. Записи, дописанные во время записи снапшота,
+// сохраняются: журнал переписывается во временный файл и заменяет исходный.
+func (w *wal) truncateThrough(seq uint64) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.seq <= seq {
+		// После снапшота записей не было
+		return w.truncateLocked()
+	}
+
+	if _, err := w.file.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to seek wal: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(w.path), filepath.Base(w.path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp wal: %w", err)
+	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName)
+
+	reader := bufio.NewReader(w.file)
+	writer := bufio.NewWriter(tmp)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			tmp.Close()
+			return fmt.Errorf("failed to read wal: %w", err)
+		}
+
+		var record walRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			// Поврежденный хвост обрезается в replay, дальше записей нет
+			break
+		}
+		if record.Seq <= seq {
+			continue
+		}
+		if _, err := writer.Write(line); err != nil {
+			tmp.Close()
+			return fmt.Errorf("failed to write temp wal: %w", err)
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write temp wal: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync temp wal: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close temp wal: %w", err)
+	}
+
+	if err := os.Rename(tmpName, w.path); err != nil {
+		return fmt.Errorf("failed to replace wal: %w", err)
+	}
+	file, err := os.OpenFile(w.path, os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to reopen wal: %w", err)
+	}
+	if err := w.file.Close(); err != nil {
+		w.log.Error("failed to close replaced wal", zap.Error(err))
+	}
+	w.file = file
+
+	return syncDir(filepath.Dir(w.path))
+}
+
+// close останавливает фоновый fsync, сбрасывает журнал на диск и закрывает файл
+func (w *wal) close() error {
+	w.stopOnce.Do(func() {
+		close(w.done)
+	})
+	w.wg.Wait()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.policy != WALSyncNever {
+		if err := w.file.Sync(); err != nil {
+			w.log.Error("failed to sync wal on close", zap.Error(err))
+		}
+	}
+	return w.file.Close()
+}
+
+func (w *wal) syncLoop(interval time.Duration) {
+	defer w.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			w.mu.Lock()
+			err := w.file.Sync()
+			w.mu.Unlock()
+			if err != nil {
+				w.log.Error("failed to sync wal", zap.Error(err))
+			}
+		case <-w.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package memstorage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/config"
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/model"
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func walConfig(t *testing.T, dir string, policy string) *config.ServerFlags {
+	t.Helper()
+	return &config.ServerFlags{
+		FileStoragePath: filepath.Join(dir, "metrics.json"),
+		WALPath:         filepath.Join(dir, "metrics.wal"),
+		WALSync:         policy,
+		WALSyncInterval: 1,
+		Restore:         true,
+	}
+}
+
+func TestMemStorage_WALReplayAfterCrash(t *testing.T) {
+	for _, policy := range []string{WALSyncAlways, WALSyncInterval, WALSyncNever} {
+		t.Run(policy, func(t *testing.T) {
+			dir := t.TempDir()
+			cfg := walConfig(t, dir, policy)
+			ctx := context.Background()
+
+			storage := NewMemStorage(cfg, zaptest.NewLogger(t))
+			require.NoError(t, storage.UpdateCounter(ctx, "PollCount", 3))
+			require.NoError(t, storage.UpdateGauge(ctx, "Alloc", 1.5))
+			require.NoError(t, storage.UpdateMetrics(ctx, []model.Metrics{
+				{ID: "PollCount", MType: model.Counter, Delta: int64Ptr(2)},
+			}))
+			applied, err := storage.UpdateMetricsOnce(ctx, "batch-1", []model.Metrics{
+				{ID: "PollCount", MType: model.Counter, Delta: int64Ptr(10)},
+			})
+			require.NoError(t, err)
+			require.True(t, applied)
+
+			// Без Close: имитируем аварийное завершение до снапшота
+			restored := NewMemStorage(cfg, zaptest.NewLogger(t))
+
+			counter, err := restored.GetCounter(ctx, "PollCount")
+			require.NoError(t, err)
+			assert.Equal(t, int64(15), counter)
+
+			gauge, err := restored.GetGauge(ctx, "Alloc")
+			require.NoError(t, err)
+			assert.Equal(t, 1.5, gauge)
+
+			// Ключ идемпотентности тоже восстановлен из журнала
+			applied, err = restored.UpdateMetricsOnce(ctx, "batch-1", []model.Metrics{
+				{ID: "PollCount", MType: model.Counter, Delta: int64Ptr(10)},
+			})
+			require.NoError(t, err)
+			assert.False(t, applied)
+
+			require.NoError(t, restored.Close())
+			require.NoError(t, storage.(*memStorage).wal.close())
+		})
+	}
+}
+
+func TestMemStorage_WALTruncatedAfterSave(t *testing.T) {
+	dir := t.TempDir()
+	cfg := walConfig(t, dir, WALSyncAlways)
+	ctx := context.Background()
+
+	storage := NewMemStorage(cfg, zaptest.NewLogger(t))
+	require.NoError(t, storage.UpdateCounter(ctx, "PollCount", 5))
+	require.NoError(t, storage.(*memStorage).SaveToFile(cfg.FileStoragePath))
+
+	info, err := os.Stat(cfg.WALPath)
+	require.NoError(t, err)
+	assert.Zero(t, info.Size())
+
+	require.NoError(t, storage.UpdateCounter(ctx, "PollCount", 1))
+
+	// Снапшот и журнал вместе дают итоговое значение без двойного счета
+	restored := NewMemStorage(cfg, zaptest.NewLogger(t))
+	counter, err := restored.GetCounter(ctx, "PollCount")
+	require.NoError(t, err)
+	assert.Equal(t, int64(6), counter)
+
+	require.NoError(t, restored.Close())
+	require.NoError(t, storage.(*memStorage).wal.close())
+}
+
+func TestMemStorage_WALReplayKeepsDeleted(t *testing.T) {
+	dir := t.TempDir()
+	cfg := walConfig(t, dir, WALSyncAlways)
+	ctx := context.Background()
+
+	storage := NewMemStorage(cfg, zaptest.NewLogger(t))
+	require.NoError(t, storage.UpdateCounter(ctx, "PollCount", 3))
+	require.NoError(t, storage.UpdateGauge(ctx, "HeapAlloc", 1.5))
+	require.NoError(t, storage.UpdateGauge(ctx, "Alloc", 2.5))
+	require.NoError(t, storage.DeleteMetric(ctx, model.Counter, "PollCount"))
+	_, err := storage.DeleteMetrics(ctx, model.MetricsFilter{Prefix: "Heap"})
+	require.NoError(t, err)
+	require.NoError(t, storage.UpdateCounter(ctx, "PollCount", 1))
+
+	// Без Close: удаленные метрики не должны воскреснуть при повторе журнала
+	restored := NewMemStorage(cfg, zaptest.NewLogger(t))
+
+	counter, err := restored.GetCounter(ctx, "PollCount")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), counter)
+
+	_, err = restored.GetGauge(ctx, "HeapAlloc")
+	assert.ErrorIs(t, err, service.ErrNotFound)
+
+	gauge, err := restored.GetGauge(ctx, "Alloc")
+	require.NoError(t, err)
+	assert.Equal(t, 2.5, gauge)
+	require.NoError(t, restored.Close())
+}
+
+func TestMemStorage_WALSkipsTornRecord(t *testing.T) {
+	dir := t.TempDir()
+	cfg := walConfig(t, dir, WALSyncAlways)
+
+	data := `{"metrics":[{"id":"PollCount","type":"counter","delta":4}]}` + "\n" +
+		`{"metrics":[{"id":"PollCount","type":"coun`
+	require.NoError(t, os.WriteFile(cfg.WALPath, []byte(data), 0644))
+
+	storage := NewMemStorage(cfg, zaptest.NewLogger(t))
+	counter, err := storage.GetCounter(context.Background(), "PollCount")
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), counter)
+	require.NoError(t, storage.Close())
+}
+
+func TestMemStorage_WALWritesAfterTornRecordSurviveCrash(t *testing.T) {
+	dir := t.TempDir()
+	cfg := walConfig(t, dir, WALSyncAlways)
+	ctx := context.Background()
+
+	data := `{"seq":1,"metrics":[{"id":"PollCount","type":"counter","delta":4}]}` + "\n" +
+		`{"seq":2,"metrics":[{"id":"PollCount","type":"coun`
+	require.NoError(t, os.WriteFile(cfg.WALPath, []byte(data), 0644))
+
+	// Первый перезапуск отбрасывает недописанную запись, новые пишутся с новой строки
+	storage := NewMemStorage(cfg, zaptest.NewLogger(t))
+	require.NoError(t, storage.UpdateCounter(ctx, "PollCount", 3))
+	require.NoError(t, storage.UpdateCounter(ctx, "PollCount", 2))
+
+	// Без Close: второе аварийное завершение
+	restored := NewMemStorage(cfg, zaptest.NewLogger(t))
+	counter, err := restored.GetCounter(ctx, "PollCount")
+	require.NoError(t, err)
+	assert.Equal(t, int64(9), counter)
+	require.NoError(t, restored.Close())
+}
+
+func TestMemStorage_WALResetWithoutRestore(t *testing.T) {
+	dir := t.TempDir()
+	cfg := walConfig(t, dir, WALSyncNever)
+	cfg.Restore = false
+
+	data := `{"metrics":[{"id":"PollCount","type":"counter","delta":4}]}` + "\n"
+	require.NoError(t, os.WriteFile(cfg.WALPath, []byte(data), 0644))
+
+	storage := NewMemStorage(cfg, zaptest.NewLogger(t))
+	_, err := storage.GetCounter(context.Background(), "PollCount")
+	assert.ErrorIs(t, err, service.ErrNotFound)
+
+	info, err := os.Stat(cfg.WALPath)
+	require.NoError(t, err)
+	assert.Zero(t, info.Size())
+	require.NoError(t, storage.Close())
+}
+
+func TestWAL_TruncateThroughKeepsLaterRecords(t *testing.T) {
+	for _, policy := range []string{WALSyncAlways, WALSyncNever} {
+		t.Run(policy, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "metrics.wal")
+			w, err := openWAL(path, policy, 0, zaptest.NewLogger(t))
+			require.NoError(t, err)
+
+			for i := int64(1); i <= 3; i++ {
+				require.NoError(t, w.append(walRecord{Metrics: []model.Metrics{
+					{ID: "PollCount", MType: model.Counter, Delta: int64Ptr(i)},
+				}}))
+			}
+
+			// Снапшот вошел до записи 2, запись 3 дописана во время его сохранения
+			require.NoError(t, w.truncateThrough(2))
+			require.NoError(t, w.append(walRecord{Key: "batch-4", Metrics: []model.Metrics{
+				{ID: "PollCount", MType: model.Counter, Delta: int64Ptr(4)},
+			}}))
+
+			var seqs []uint64
+			_, err = w.replay(func(record walRecord) {
+				seqs = append(seqs, record.Seq)
+			})
+			require.NoError(t, err)
+			assert.Equal(t, []uint64{3, 4}, seqs)
+
+			// Без новых записей журнал просто очищается
+			require.NoError(t, w.truncateThrough(4))
+			info, err := os.Stat(path)
+			require.NoError(t, err)
+			assert.Zero(t, info.Size())
+
+			require.NoError(t, w.close())
+		})
+	}
+}
+
+func TestMemStorage_SaveDuringWrites(t *testing.T) {
+	dir := t.TempDir()
+	cfg := walConfig(t, dir, WALSyncNever)
+	ctx := context.Background()
+
+	storage := NewMemStorage(cfg, zaptest.NewLogger(t)).(*memStorage)
+
+	const writes = 500
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < writes; i++ {
+			assert.NoError(t, storage.UpdateCounter(ctx, "PollCount", 1))
+		}
+	}()
+	for saving := true; saving; {
+		select {
+		case <-done:
+			saving = false
+		default:
+			require.NoError(t, storage.SaveToFile(cfg.FileStoragePath))
+		}
+	}
+
+	// Каждое приращение либо в снапшоте, либо в журнале, но не в обоих
+	restored := NewMemStorage(cfg, zaptest.NewLogger(t))
+	counter, err := restored.GetCounter(ctx, "PollCount")
+	require.NoError(t, err)
+	assert.Equal(t, int64(writes), counter)
+
+	require.NoError(t, restored.Close())
+	require.NoError(t, storage.wal.close())
+}
+
+func TestOpenWAL_UnknownPolicy(t *testing.T) {
+	_, err := openWAL(filepath.Join(t.TempDir(), "metrics.wal"), "sometimes", 0, zaptest.NewLogger(t))
+	assert.Error(t, err)
+}
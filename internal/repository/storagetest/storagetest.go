@@ -0,0 +1,349 @@
+// Package storagetest содержит общие проверки реализаций service.Storage.
+// Одни и те же проверки запускаются для memstorage, dbstorage и boltstorage,
+// чтобы поведение хранилищ не расходилось.
+package storagetest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/model"
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/service"
+)
+
+// SameNameDifferentTypes проверяет, что gauge и counter с одинаковым именем независимы.
+// Хранилище должно быть пустым.
+func SameNameDifferentTypes(t *testing.T, storage service.Storage) {
+	t.Helper()
+	ctx := context.Background()
+	from := time.Now().Add(-time.Second)
+
+	require.NoError(t, storage.UpdateGauge(ctx, "foo", 1.5))
+	require.NoError(t, storage.UpdateCounter(ctx, "foo", 3))
+	require.NoError(t, storage.UpdateCounter(ctx, "foo", 2))
+	require.NoError(t, storage.UpdateGauge(ctx, "foo", 2.5))
+
+	delta := int64(7)
+	value := 0.5
+	require.NoError(t, storage.UpdateMetrics(ctx, []model.Metrics{
+		{ID: "bar", MType: model.Counter, Delta: &delta},
+		{ID: "bar", MType: model.Gauge, Value: &value},
+	}))
+	to := time.Now().Add(time.Second)
+
+	gauge, err := storage.GetGauge(ctx, "foo")
+	require.NoError(t, err)
+	assert.Equal(t, 2.5, gauge)
+
+	counter, err := storage.GetCounter(ctx, "foo")
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), counter)
+
+	gauge, err = storage.GetGauge(ctx, "bar")
+	require.NoError(t, err)
+	assert.Equal(t, 0.5, gauge)
+
+	counter, err = storage.GetCounter(ctx, "bar")
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), counter)
+
+	_, err = storage.GetGauge(ctx, "baz")
+	assert.ErrorIs(t, err, service.ErrNotFound)
+	_, err = storage.GetCounter(ctx, "baz")
+	assert.ErrorIs(t, err, service.ErrNotFound)
+
+	metrics, err := storage.ListMetrics(ctx, model.MetricsFilter{})
+	require.NoError(t, err)
+	require.Len(t, metrics, 4)
+	for i, want := range []struct{ id, mtype string }{
+		{"bar", model.Counter},
+		{"bar", model.Gauge},
+		{"foo", model.Counter},
+		{"foo", model.Gauge},
+	} {
+		assert.Equal(t, want.id, metrics[i].ID)
+		assert.Equal(t, want.mtype, metrics[i].MType)
+	}
+
+	gauges, err := storage.GetHistory(ctx, model.Gauge, "foo", from, to)
+	require.NoError(t, err)
+	require.Len(t, gauges, 2)
+	assert.Equal(t, 1.5, *gauges[0].Value)
+	assert.Equal(t, 2.5, *gauges[1].Value)
+
+	counters, err := storage.GetHistory(ctx, model.Counter, "foo", from, to)
+	require.NoError(t, err)
+	require.Len(t, counters, 2)
+	assert.Equal(t, int64(3), *counters[0].Delta)
+	assert.Equal(t, int64(5), *counters[1].Delta)
+}
+
+// DuplicateIDsInBatch проверяет батч с повторяющимися id:
+// counter суммируются, у gauge остается последнее значение.
+// Хранилище должно быть пустым.
+func DuplicateIDsInBatch(t *testing.T, storage service.Storage) {
+	t.Helper()
+	ctx := context.Background()
+
+	delta1, delta2, delta3 := int64(1), int64(2), int64(4)
+	value1, value2 := 1.5, 2.5
+	require.NoError(t, storage.UpdateMetrics(ctx, []model.Metrics{
+		{ID: "PollCount", MType: model.Counter, Delta: &delta1},
+		{ID: "Alloc", MType: model.Gauge, Value: &value1},
+		{ID: "PollCount", MType: model.Counter, Delta: &delta2},
+		{ID: "Alloc", MType: model.Gauge, Value: &value2},
+		{ID: "PollCount", MType: model.Counter, Delta: &delta3},
+	}))
+
+	counter, err := storage.GetCounter(ctx, "PollCount")
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), counter)
+
+	gauge, err := storage.GetGauge(ctx, "Alloc")
+	require.NoError(t, err)
+	assert.Equal(t, 2.5, gauge)
+
+	// Повторный батч добавляется к сохраненному значению
+	require.NoError(t, storage.UpdateMetrics(ctx, []model.Metrics{
+		{ID: "PollCount", MType: model.Counter, Delta: &delta1},
+		{ID: "PollCount", MType: model.Counter, Delta: &delta1},
+	}))
+
+	counter, err = storage.GetCounter(ctx, "PollCount")
+	require.NoError(t, err)
+	assert.Equal(t, int64(9), counter)
+}
+
+// DeleteAndExpire проверяет удаление метрик по имени, префиксу и давности обновления.
+// Хранилище должно быть пустым.
+func DeleteAndExpire(t *testing.T, storage service.Storage) {
+	t.Helper()
+	ctx := context.Background()
+	from := time.Now().Add(-time.Second)
+
+	require.NoError(t, storage.UpdateGauge(ctx, "foo", 1.5))
+	require.NoError(t, storage.UpdateCounter(ctx, "foo", 3))
+	require.NoError(t, storage.UpdateGauge(ctx, "HeapAlloc", 1))
+	require.NoError(t, storage.UpdateGauge(ctx, "HeapInuse", 2))
+	require.NoError(t, storage.UpdateCounter(ctx, "HeapCount", 4))
+
+	// Удаление gauge не затрагивает counter с тем же именем
+	require.NoError(t, storage.DeleteMetric(ctx, model.Gauge, "foo"))
+	_, err := storage.GetGauge(ctx, "foo")
+	assert.ErrorIs(t, err, service.ErrNotFound)
+	counter, err := storage.GetCounter(ctx, "foo")
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), counter)
+
+	history, err := storage.GetHistory(ctx, model.Gauge, "foo", from, time.Now().Add(time.Second))
+	require.NoError(t, err)
+	assert.Empty(t, history)
+
+	assert.ErrorIs(t, storage.DeleteMetric(ctx, model.Gauge, "foo"), service.ErrNotFound)
+	assert.ErrorIs(t, storage.DeleteMetric(ctx, model.Counter, "missing"), service.ErrNotFound)
+
+	deleted, err := storage.DeleteMetrics(ctx, model.MetricsFilter{Prefix: "Heap", MType: model.Gauge})
+	require.NoError(t, err)
+	require.Len(t, deleted, 2)
+	assert.Equal(t, model.Metrics{ID: "HeapAlloc", MType: model.Gauge}, deleted[0])
+	assert.Equal(t, model.Metrics{ID: "HeapInuse", MType: model.Gauge}, deleted[1])
+
+	_, err = storage.GetCounter(ctx, "HeapCount")
+	require.NoError(t, err)
+
+	deleted, err = storage.DeleteMetrics(ctx, model.MetricsFilter{Prefix: "Missing"})
+	require.NoError(t, err)
+	assert.Empty(t, deleted)
+
+	// Метрики обновлены позже границы и не считаются устаревшими
+	deleted, err = storage.DeleteStale(ctx, from)
+	require.NoError(t, err)
+	assert.Empty(t, deleted)
+
+	deleted, err = storage.DeleteStale(ctx, time.Now().Add(time.Second))
+	require.NoError(t, err)
+	require.Len(t, deleted, 2)
+	assert.Equal(t, model.Metrics{ID: "HeapCount", MType: model.Counter}, deleted[0])
+	assert.Equal(t, model.Metrics{ID: "foo", MType: model.Counter}, deleted[1])
+
+	metrics, err := storage.ListMetrics(ctx, model.MetricsFilter{})
+	require.NoError(t, err)
+	assert.Empty(t, metrics)
+}
+
+// Labels проверяет ряды с метками: одно имя с разными метками хранится раздельно,
+// ряд без меток независим, ListMetrics и DeleteMetrics отбирают ряды по условиям на метки.
+// Хранилище должно быть пустым.
+func Labels(t *testing.T, storage service.Storage) {
+	t.Helper()
+	ctx := context.Background()
+	from := time.Now().Add(-time.Second)
+
+	value0, value1, value2, value3 := 0.5, 1.5, 2.5, 3.5
+	delta := int64(4)
+	require.NoError(t, storage.UpdateMetrics(ctx, []model.Metrics{
+		{ID: "CPUutilization", MType: model.Gauge, Value: &value2, Labels: model.Labels{"host": "a", "core": "2"}},
+		{ID: "CPUutilization", MType: model.Gauge, Value: &value1, Labels: model.Labels{"host": "a", "core": "1"}},
+		{ID: "CPUutilization", MType: model.Gauge, Value: &value3, Labels: model.Labels{"host": "b", "core": "1"}},
+		{ID: "CPUutilization", MType: model.Gauge, Value: &value0},
+		{ID: "PollCount", MType: model.Counter, Delta: &delta, Labels: model.Labels{"host": "a"}},
+	}))
+
+	hostA := model.Labels{"host": "a", "core": "1"}
+	gauge, err := storage.GetGauge(ctx, model.SeriesKey("CPUutilization", hostA))
+	require.NoError(t, err)
+	assert.Equal(t, 1.5, gauge)
+
+	gauge, err = storage.GetGauge(ctx, "CPUutilization")
+	require.NoError(t, err)
+	assert.Equal(t, 0.5, gauge)
+
+	_, err = storage.GetCounter(ctx, "PollCount")
+	assert.ErrorIs(t, err, service.ErrNotFound)
+
+	require.NoError(t, storage.UpdateCounter(ctx, model.SeriesKey("PollCount", model.Labels{"host": "a"}), 1))
+	counter, err := storage.GetCounter(ctx, `PollCount{host="a"}`)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), counter)
+
+	history, err := storage.GetHistory(ctx, model.Gauge, model.SeriesKey("CPUutilization", hostA), from, time.Now().Add(time.Second))
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	assert.Equal(t, 1.5, *history[0].Value)
+
+	metrics, err := storage.ListMetrics(ctx, model.MetricsFilter{Prefix: "CPU"})
+	require.NoError(t, err)
+	require.Len(t, metrics, 4)
+	assert.Nil(t, metrics[0].Labels)
+	assert.Equal(t, model.Labels{"host": "a", "core": "1"}, metrics[1].Labels)
+	assert.Equal(t, model.Labels{"host": "b", "core": "1"}, metrics[2].Labels)
+	assert.Equal(t, model.Labels{"host": "a", "core": "2"}, metrics[3].Labels)
+	for _, metric := range metrics {
+		assert.Equal(t, "CPUutilization", metric.ID)
+	}
+
+	for _, tc := range []struct {
+		matchers string
+		want     []string
+	}{
+		{`host="a"`, []string{`CPUutilization{core="1",host="a"}`, `CPUutilization{core="2",host="a"}`, `PollCount{host="a"}`}},
+		{`core=~"1|3",host!="b"`, []string{`CPUutilization{core="1",host="a"}`}},
+		{`host=""`, []string{"CPUutilization"}},
+		{`host!~"a|b"`, []string{"CPUutilization"}},
+	} {
+		matchers, err := model.ParseLabelMatchers(tc.matchers)
+		require.NoError(t, err)
+
+		metrics, err := storage.ListMetrics(ctx, model.MetricsFilter{Labels: matchers})
+		require.NoError(t, err)
+
+		keys := make([]string, 0, len(metrics))
+		for _, metric := range metrics {
+			keys = append(keys, metric.Key())
+		}
+		assert.Equal(t, tc.want, keys, tc.matchers)
+	}
+
+	matchers, err := model.ParseLabelMatchers(`host="b"`)
+	require.NoError(t, err)
+	deleted, err := storage.DeleteMetrics(ctx, model.MetricsFilter{Prefix: "CPU", Labels: matchers})
+	require.NoError(t, err)
+	assert.Equal(t, []model.Metrics{
+		{ID: "CPUutilization", MType: model.Gauge, Labels: model.Labels{"host": "b", "core": "1"}},
+	}, deleted)
+
+	require.NoError(t, storage.DeleteMetric(ctx, model.Gauge, model.SeriesKey("CPUutilization", hostA)))
+	_, err = storage.GetGauge(ctx, model.SeriesKey("CPUutilization", hostA))
+	assert.ErrorIs(t, err, service.ErrNotFound)
+
+	metrics, err = storage.ListMetrics(ctx, model.MetricsFilter{Prefix: "CPU"})
+	require.NoError(t, err)
+	assert.Len(t, metrics, 2)
+}
+
+// Histograms проверяет слияние гистограмм, замену при смене границ корзин,
+// историю, ListMetrics и удаление. Хранилище должно быть пустым.
+func Histograms(t *testing.T, storage service.Storage) {
+	t.Helper()
+	ctx := context.Background()
+	from := time.Now().Add(-time.Second)
+
+	_, err := storage.GetHistogram(ctx, "latency")
+	assert.ErrorIs(t, err, service.ErrNotFound)
+
+	first := model.HistogramValue{Buckets: []float64{0.1, 1}, Counts: []int64{1, 0, 0}, Sum: 0.05, Count: 1}
+	second := model.HistogramValue{Buckets: []float64{0.1, 1}, Counts: []int64{0, 2, 1}, Sum: 3.5, Count: 3}
+	require.NoError(t, storage.UpdateHistogram(ctx, "latency", first))
+	require.NoError(t, storage.UpdateMetrics(ctx, []model.Metrics{
+		{ID: "latency", MType: model.Histogram, Histogram: &second},
+	}))
+	// Гистограмма не пересекается с gauge того же имени
+	require.NoError(t, storage.UpdateGauge(ctx, "latency", 1))
+
+	histogram, err := storage.GetHistogram(ctx, "latency")
+	require.NoError(t, err)
+	assert.Equal(t, []float64{0.1, 1}, histogram.Buckets)
+	assert.Equal(t, []int64{1, 2, 1}, histogram.Counts)
+	assert.Equal(t, int64(4), histogram.Count)
+	assert.InDelta(t, 3.55, histogram.Sum, 1e-9)
+
+	history, err := storage.GetHistory(ctx, model.Histogram, "latency", from, time.Now().Add(time.Second))
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	assert.Equal(t, int64(1), *history[0].Delta)
+	assert.Equal(t, int64(4), *history[1].Delta)
+	assert.InDelta(t, 3.55, *history[1].Value, 1e-9)
+
+	metrics, err := storage.ListMetrics(ctx, model.MetricsFilter{MType: model.Histogram})
+	require.NoError(t, err)
+	require.Len(t, metrics, 1)
+	assert.Equal(t, "latency", metrics[0].ID)
+	require.NotNil(t, metrics[0].Histogram)
+	assert.Equal(t, []int64{1, 2, 1}, metrics[0].Histogram.Counts)
+
+	// Приращение с другими границами корзин отклоняется вместе со всем батчем
+	rebucketed := model.HistogramValue{Buckets: []float64{5}, Counts: []int64{1, 0}, Sum: 2, Count: 1}
+	assert.ErrorIs(t, storage.UpdateHistogram(ctx, "latency", rebucketed), model.ErrBucketsMismatch)
+	gaugeValue := 2.0
+	mismatched := []model.Metrics{
+		{ID: "latency", MType: model.Gauge, Value: &gaugeValue},
+		{ID: "latency", MType: model.Histogram, Histogram: &rebucketed},
+	}
+	assert.ErrorIs(t, storage.UpdateMetrics(ctx, mismatched), model.ErrBucketsMismatch)
+	_, err = storage.UpdateMetricsOnce(ctx, "rebucketed", mismatched)
+	assert.ErrorIs(t, err, model.ErrBucketsMismatch)
+
+	histogram, err = storage.GetHistogram(ctx, "latency")
+	require.NoError(t, err)
+	assert.Equal(t, []int64{1, 2, 1}, histogram.Counts)
+	gauge, err := storage.GetGauge(ctx, "latency")
+	require.NoError(t, err)
+	assert.Equal(t, 1.0, gauge)
+	history, err = storage.GetHistory(ctx, model.Histogram, "latency", from, time.Now().Add(time.Second))
+	require.NoError(t, err)
+	assert.Len(t, history, 2)
+
+	// Отклоненный батч не запоминает ключ
+	applied, err := storage.UpdateMetricsOnce(ctx, "rebucketed", []model.Metrics{
+		{ID: "latency", MType: model.Gauge, Value: &gaugeValue},
+	})
+	require.NoError(t, err)
+	assert.True(t, applied)
+
+	// После удаления гистограмму можно завести с новыми границами
+	require.NoError(t, storage.DeleteMetric(ctx, model.Histogram, "latency"))
+	_, err = storage.GetHistogram(ctx, "latency")
+	assert.ErrorIs(t, err, service.ErrNotFound)
+	require.NoError(t, storage.UpdateHistogram(ctx, "latency", rebucketed))
+	histogram, err = storage.GetHistogram(ctx, "latency")
+	require.NoError(t, err)
+	assert.Equal(t, rebucketed, histogram)
+
+	gauge, err = storage.GetGauge(ctx, "latency")
+	require.NoError(t, err)
+	assert.Equal(t, 2.0, gauge)
+}
@@ -5,13 +5,22 @@ import (
 	"errors"
 	"fmt"
 	"github.com/go-chi/chi/v5"
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/handler/alertshandler"
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/handler/grpchandler"
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/handler/influxhandler"
 	"github.com/kazakovdmitriy/go-musthave-metrics/internal/handler/mainpagehandler"
 	"github.com/kazakovdmitriy/go-musthave-metrics/internal/handler/metricshandler"
 	"github.com/kazakovdmitriy/go-musthave-metrics/internal/handler/middlewares"
 	"github.com/kazakovdmitriy/go-musthave-metrics/internal/handler/middlewares/compressor"
 	"github.com/kazakovdmitriy/go-musthave-metrics/internal/handler/middlewares/signer"
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/handler/otlphandler"
 	"github.com/kazakovdmitriy/go-musthave-metrics/internal/handler/pinghandler"
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/handler/prometheushandler"
 	"github.com/kazakovdmitriy/go-musthave-metrics/internal/observers"
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/receiver/graphite"
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/receiver/statsd"
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/service/alertservice"
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/service/expiryservice"
 	"github.com/kazakovdmitriy/go-musthave-metrics/internal/service/mainpageservice"
 	"github.com/kazakovdmitriy/go-musthave-metrics/internal/service/metricsservice"
 	"github.com/kazakovdmitriy/go-musthave-metrics/internal/service/signerservice"
@@ -25,7 +34,10 @@ import (
 
 	"github.com/kazakovdmitriy/go-musthave-metrics/internal/config"
 	"github.com/kazakovdmitriy/go-musthave-metrics/internal/config/db"
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/model"
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/repository/boltstorage"
 	"github.com/kazakovdmitriy/go-musthave-metrics/internal/repository/dbstorage"
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/repository/failover"
 	"github.com/kazakovdmitriy/go-musthave-metrics/internal/repository/memstorage"
 	"github.com/kazakovdmitriy/go-musthave-metrics/internal/service"
 	"go.uber.org/zap"
@@ -39,6 +51,12 @@ type Server struct {
 }
 
 func NewApp(cfg *config.ServerFlags, log *zap.Logger) (*Server, error) {
+	if len(cfg.HistogramBuckets) > 0 {
+		if err := model.ValidateBuckets(cfg.HistogramBuckets); err != nil {
+			return nil, fmt.Errorf("invalid histogram buckets: %w", err)
+		}
+	}
+
 	app := &Server{
 		cfg: cfg,
 		log: log,
@@ -50,26 +68,61 @@ func (s *Server) Run(ctx context.Context) error {
 	// 1. Инициализируем все зависимости
 	storage, subject, resources, err := s.initDependencies(ctx)
 	if err != nil {
+		s.closeResources(resources)
 		return fmt.Errorf("failed to init dependencies: %w", err)
 	}
 
-	// 2. Создаем WaitGroup для активных запросов
+	// 2. Запускаем проверку правил алертинга
+	alertService, err := s.initAlerting(ctx, storage, subject)
+	if err != nil {
+		s.closeResources(resources)
+		return fmt.Errorf("failed to init alerting: %w", err)
+	}
+	// Останавливаем проверку правил раньше, чем закроется хранилище
+	resources = append([]closableResource{alertService}, resources...)
+
+	// Удаление метрик, не обновлявшихся дольше TTL
+	expiryService := expiryservice.NewExpiryService(
+		storage,
+		subject,
+		time.Duration(s.cfg.MetricTTL)*time.Second,
+		s.log,
+	)
+	expiryService.Start(ctx)
+	resources = append([]closableResource{expiryService}, resources...)
+
+	// 3. Создаем сервис метрик, общий для HTTP и сетевых приемников
+	metricsService := metricsservice.NewMetricService(storage, subject, s.cfg.HistogramBuckets)
+
+	// 4. Общий лимит конкурентности для HTTP и сетевых приемников
+	limiter := middlewares.NewLimiter(s.cfg.RateLimit)
+
+	// 5. Запускаем сетевые приемники метрик
+	listeners, err := s.startListeners(storage, metricsService, limiter)
+	if err != nil {
+		s.closeResources(resources)
+		return fmt.Errorf("failed to start listeners: %w", err)
+	}
+
+	// 6. Создаем WaitGroup для активных запросов
 	activeRequests := &sync.WaitGroup{}
 	shutdownCh := make(chan struct{})
 
-	// 3. Создаем роутер (все в одном месте)
-	router, err := s.createRouter(storage, subject, activeRequests, shutdownCh)
+	// 7. Создаем роутер (все в одном месте)
+	router, err := s.createRouter(storage, metricsService, alertService, limiter, activeRequests, shutdownCh)
 	if err != nil {
+		s.shutdownListeners(listeners)
+		s.closeResources(resources)
 		return fmt.Errorf("failed to create router: %w", err)
 	}
 
-	// 4. Создаем HTTP сервер
+	// 8. Создаем HTTP сервер
 	s.server = &http.Server{
 		Addr:    s.cfg.ServerAddr,
 		Handler: router,
 	}
 
-	// 5. Запускаем сервер
+	// 9. Запускаем сервер
 	go func() {
 		s.log.Info("server starting", zap.String("addr", s.cfg.ServerAddr))
 		if err := s.server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
@@ -77,8 +130,8 @@ func (s *Server) Run(ctx context.Context) error {
 		}
 	}()
 
-	// 6. Graceful shutdown
-	return s.waitForShutdown(ctx, resources, activeRequests, shutdownCh)
+	// 10. Graceful shutdown
+	return s.waitForShutdown(ctx, resources, listeners, activeRequests, shutdownCh)
 }
 
 func (s *Server) Close() {
@@ -116,6 +169,15 @@ func (s *Server) initDependencies(ctx context.Context) (
 }
 
 func (s *Server) initStorage(ctx context.Context) (service.Storage, error) {
+	if s.cfg.DatabaseDSN == "" && s.cfg.BoltPath != "" {
+		storage, err := boltstorage.NewBoltStorage(s.cfg, s.log)
+		if err != nil {
+			return nil, fmt.Errorf("failed to init embedded storage: %w", err)
+		}
+		s.log.Info("using embedded storage", zap.String("path", s.cfg.BoltPath))
+		return storage, nil
+	}
+
 	if s.cfg.DatabaseDSN == "" {
 		s.log.Info("using in-memory storage")
 		return memstorage.NewMemStorage(s.cfg, s.log), nil
@@ -125,6 +187,9 @@ func (s *Server) initStorage(ctx context.Context) (service.Storage, error) {
 	dbase, err := db.NewDatabase(ctx, s.cfg.DatabaseDSN)
 	if err != nil || !dbase.IsConnected() {
 		s.log.Warn("database connection failed, falling back to memory", zap.Error(err))
+		if dbase != nil {
+			dbase.Close()
+		}
 		return memstorage.NewMemStorage(s.cfg, s.log), nil
 	}
 
@@ -138,10 +203,12 @@ func (s *Server) initStorage(ctx context.Context) (service.Storage, error) {
 	storage, err := dbstorage.NewDBStorage(dbase.Pool, s.log, s.cfg)
 	if err != nil {
 		s.log.Warn("DB storage init failed, falling back to memory", zap.Error(err))
+		dbase.Close()
 		return memstorage.NewMemStorage(s.cfg, s.log), nil
 	}
 
-	return storage, nil
+	// При падении БД во время работы записи копятся в журнале
+	return failover.NewFailoverStorage(storage, s.cfg, s.log), nil
 }
 
 func (s *Server) initObservers() (
@@ -179,10 +246,95 @@ func (s *Server) initObservers() (
 	return subject, resources, nil
 }
 
+// initAlerting загружает правила алертинга и запускает их фоновую проверку
+func (s *Server) initAlerting(
+	ctx context.Context,
+	storage service.Storage,
+	subject metricsservice.EventPublisher,
+) (alertsService, error) {
+	rules, err := alertservice.LoadRules(s.cfg.AlertRulesFile)
+	if err != nil {
+		return nil, err
+	}
+
+	alertService, err := alertservice.NewAlertService(
+		storage,
+		subject,
+		rules,
+		time.Duration(s.cfg.AlertInterval)*time.Second,
+		s.log,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("alert rules: %w", err)
+	}
+
+	alertService.Start(ctx)
+	return alertService, nil
+}
+
+// startListeners запускает включенные в конфигурации сетевые приемники метрик
+func (s *Server) startListeners(
+	storage service.Storage,
+	metricsService metricshandler.MetricsService,
+	limiter *middlewares.Limiter,
+) ([]metricsListener, error) {
+	var listeners []metricsListener
+
+	if s.cfg.StatsDAddr != "" {
+		statsdListener := statsd.NewListener(s.cfg.StatsDAddr, metricsService, s.log)
+		if err := statsdListener.Start(); err != nil {
+			return nil, err
+		}
+		listeners = append(listeners, statsdListener)
+	}
+
+	if s.cfg.GraphiteAddr != "" {
+		graphiteListener := graphite.NewListener(s.cfg.GraphiteAddr, storage, limiter, s.log)
+		if err := graphiteListener.Start(); err != nil {
+			s.shutdownListeners(listeners)
+			return nil, err
+		}
+		listeners = append(listeners, graphiteListener)
+	}
+
+	if s.cfg.GRPCAddr != "" {
+		grpcServer := grpchandler.NewServer(s.cfg.GRPCAddr, metricsService, s.newSigner(), limiter, s.log)
+		if err := grpcServer.Start(); err != nil {
+			s.shutdownListeners(listeners)
+			return nil, err
+		}
+		listeners = append(listeners, grpcServer)
+	}
+
+	return listeners, nil
+}
+
+// newSigner создает сервис проверки подписи или nil, если ключ не задан
+func (s *Server) newSigner() signer.Signer {
+	if s.cfg.SecretKet == "" {
+		return nil
+	}
+	return signerservice.NewSHA256Signer(s.cfg.SecretKet)
+}
+
+// shutdownListeners останавливает уже запущенные приемники при ошибке старта
+func (s *Server) shutdownListeners(listeners []metricsListener) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for _, listener := range listeners {
+		if err := listener.Shutdown(ctx); err != nil {
+			s.log.Error("listener shutdown failed", zap.Error(err))
+		}
+	}
+}
+
 // createRouter создает и настраивает роутер со всеми middleware и хендлерами
 func (s *Server) createRouter(
 	storage service.Storage,
-	subject metricsservice.EventPublisher,
+	metricsService metricshandler.MetricsService,
+	alertService alertshandler.AlertsService,
+	limiter *middlewares.Limiter,
 	activeRequests *sync.WaitGroup,
 	shutdownCh chan struct{},
 ) (http.Handler, error) {
@@ -191,16 +343,13 @@ func (s *Server) createRouter(
 	// MIDDLEWARE: Создаем сервисы для middleware
 	compressorService := compressor.NewHTTPGzipAdapter()
 
-	var signerService signer.Signer
-	if s.cfg.SecretKet != "" {
-		signerService = signerservice.NewSHA256Signer(s.cfg.SecretKet)
-	}
+	signerService := s.newSigner()
 
 	// MIDDLEWARE: Устанавливаем middleware
 	r.Use(middlewares.RequestLogger(s.log))
 	r.Use(middlewares.ResponseLogger(s.log))
 	r.Use(middlewares.TrackActiveRequests(activeRequests, shutdownCh))
-	r.Use(middlewares.RateLimiter(s.cfg.RateLimit, s.log))
+	r.Use(middlewares.RateLimiter(limiter, s.log))
 	r.Use(compressor.Compress(compressorService, s.log))
 
 	if signerService != nil {
@@ -213,11 +362,13 @@ func (s *Server) createRouter(
 		return nil, fmt.Errorf("main page service: %w", err)
 	}
 
-	metricsService := metricsservice.NewMetricService(storage, subject)
-
 	pingHandler := pinghandler.NewPingHandler(s.log, storage)
 	mainPageHandler := mainpagehandler.NewMainPageHandler(mainPageService)
 	metricsHandler := metricshandler.NewMetricsHandler(metricsService, s.log)
+	alertsHandler := alertshandler.NewAlertsHandler(alertService, s.log)
+	prometheusHandler := prometheushandler.NewPrometheusHandler(metricsService, s.log)
+	influxHandler := influxhandler.NewInfluxHandler(metricsService, s.log)
+	otlpHandler := otlphandler.NewOTLPHandler(metricsService, s.log)
 
 	// ROUTES: Настраиваем все маршруты
 	r.Route("/pinghandler", func(r chi.Router) {
@@ -242,16 +393,43 @@ func (s *Server) createRouter(
 	r.Route("/value", func(r chi.Router) {
 		r.Route("/{metricType}/{metricName}", func(r chi.Router) {
 			r.Get("/", metricsHandler.GetMetric)
+			r.Delete("/", metricsHandler.DeleteMetric)
 		})
 		r.Post("/", metricsHandler.SentMetricPost)
 	})
 
+	r.Route("/values", func(r chi.Router) {
+		r.Get("/", metricsHandler.ListMetrics)
+		r.Delete("/", metricsHandler.DeleteMetrics)
+	})
+
+	r.Route("/metrics", func(r chi.Router) {
+		r.Get("/", prometheusHandler.GetMetrics)
+	})
+
+	r.Route("/write", func(r chi.Router) {
+		r.Post("/", influxHandler.Write)
+	})
+
+	r.Route("/v1/metrics", func(r chi.Router) {
+		r.Post("/", otlpHandler.ExportMetrics)
+	})
+
+	r.Route("/history", func(r chi.Router) {
+		r.Get("/{metricType}/{metricName}", metricsHandler.GetHistory)
+	})
+
+	r.Route("/api/alerts", func(r chi.Router) {
+		r.Get("/", alertsHandler.GetFiringAlerts)
+	})
+
 	return r, nil
 }
 
 func (s *Server) waitForShutdown(
 	ctx context.Context,
 	resources []closableResource,
+	listeners []metricsListener,
 	activeRequests *sync.WaitGroup,
 	shutdownCh chan struct{},
 ) error {
@@ -276,6 +454,13 @@ func (s *Server) waitForShutdown(
 		s.log.Error("server shutdown failed", zap.Error(err))
 	}
 
+	// Останавливаем сетевые приемники метрик
+	for _, listener := range listeners {
+		if err := listener.Shutdown(shutdownCtx); err != nil {
+			s.log.Error("listener shutdown failed", zap.Error(err))
+		}
+	}
+
 	// Ждем завершения запросов
 	s.log.Info("waiting for active requests...")
 	waitDone := make(chan struct{})
@@ -293,17 +478,34 @@ func (s *Server) waitForShutdown(
 
 	// Закрываем ресурсы
 	s.log.Info("closing resources...")
+	s.closeResources(resources)
+
+	s.log.Info("server stopped")
+	return nil
+}
+
+// closeResources закрывает ресурсы по порядку: хранилище, а с ним пул
+// соединений с БД, закрывается после остановленных фоновых сервисов
+func (s *Server) closeResources(resources []closableResource) {
 	for _, resource := range resources {
 		if err := resource.Close(); err != nil {
 			s.log.Error("resource close error", zap.Error(err))
 		}
 	}
-
-	s.log.Info("server stopped")
-	return nil
 }
 
 // Интерфейс для ресурсов, которые нужно закрыть
 type closableResource interface {
 	Close() error
 }
+
+// Сетевой приемник метрик, останавливаемый вместе с HTTP сервером
+type metricsListener interface {
+	Shutdown(ctx context.Context) error
+}
+
+// Сервис алертинга: отдает сработавшие алерты и закрывается при остановке
+type alertsService interface {
+	alertshandler.AlertsService
+	closableResource
+}
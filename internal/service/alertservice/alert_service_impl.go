@@ -0,0 +1,228 @@
+package alertservice
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/model"
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/service"
+	"go.uber.org/zap"
+)
+
+// alertService периодически проверяет правила алертинга по данным хранилища
+// и переводит алерты между состояниями pending/firing/resolved.
+type alertService struct {
+	storage  service.Storage
+	eventPub EventPublisher
+	log      *zap.Logger
+	interval time.Duration
+	rules    []rule
+
+	mu     sync.RWMutex
+	alerts map[string]*model.Alert
+
+	done     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+func NewAlertService(
+	storage service.Storage,
+	eventPub EventPublisher,
+	rules []model.AlertRule,
+	interval time.Duration,
+	log *zap.Logger,
+) (*alertService, error) {
+	compiled, err := compileRules(rules)
+	if err != nil {
+		return nil, err
+	}
+
+	alerts := make(map[string]*model.Alert, len(compiled))
+	for _, r := range compiled {
+		alerts[r.Name] = &model.Alert{
+			Rule:  r.AlertRule,
+			State: model.AlertInactive,
+		}
+	}
+
+	return &alertService{
+		storage:  storage,
+		eventPub: eventPub,
+		log:      log,
+		interval: interval,
+		rules:    compiled,
+		alerts:   alerts,
+		done:     make(chan struct{}),
+	}, nil
+}
+
+// Start запускает фоновую проверку правил
+func (s *alertService) Start(ctx context.Context) {
+	if len(s.rules) == 0 || s.interval <= 0 {
+		s.log.Info("alert evaluation disabled", zap.Int("rules", len(s.rules)))
+		return
+	}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				s.evaluate(ctx, time.Now())
+			case <-s.done:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	s.log.Info("alert evaluation started",
+		zap.Int("rules", len(s.rules)),
+		zap.Duration("interval", s.interval),
+	)
+}
+
+// FiringAlerts возвращает алерты в состоянии firing, отсортированные по имени правила
+func (s *alertService) FiringAlerts(ctx context.Context) []model.Alert {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make([]model.Alert, 0)
+	for _, alert := range s.alerts {
+		if alert.State == model.AlertFiring {
+			result = append(result, *alert)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Rule.Name < result[j].Rule.Name
+	})
+
+	return result
+}
+
+// Close останавливает фоновую проверку правил
+func (s *alertService) Close() error {
+	s.stopOnce.Do(func() {
+		close(s.done)
+	})
+	s.wg.Wait()
+	return nil
+}
+
+// evaluate выполняет один проход по всем правилам
+func (s *alertService) evaluate(ctx context.Context, now time.Time) {
+	for _, r := range s.rules {
+		value, err := s.currentValue(ctx, r)
+		if errors.Is(err, service.ErrNotFound) {
+			s.log.Debug("alert metric not found, skipping",
+				zap.String("rule", r.Name),
+				zap.String("metric_id", r.MetricID),
+			)
+			continue
+		}
+		if err != nil {
+			s.log.Warn("failed to get alert metric, skipping",
+				zap.String("rule", r.Name),
+				zap.String("metric_id", r.MetricID),
+				zap.Error(err),
+			)
+			continue
+		}
+
+		s.transition(r, value, now)
+	}
+}
+
+func (s *alertService) currentValue(ctx context.Context, r rule) (float64, error) {
+	switch r.MType {
+	case model.Gauge:
+		return s.storage.GetGauge(ctx, r.MetricID)
+	case model.Counter:
+		value, err := s.storage.GetCounter(ctx, r.MetricID)
+		return float64(value), err
+	}
+	return 0, service.ErrNotFound
+}
+
+// transition переводит алерт в следующее состояние и публикует событие при его смене
+func (s *alertService) transition(r rule, value float64, now time.Time) {
+	s.mu.Lock()
+
+	alert := s.alerts[r.Name]
+	prevState := alert.State
+	alert.Value = value
+
+	if r.matches(value) {
+		switch alert.State {
+		case model.AlertInactive, model.AlertResolved:
+			alert.ActiveAt = &now
+			alert.FiredAt = nil
+			alert.ResolvedAt = nil
+			alert.State = model.AlertPending
+			if r.forDuration == 0 {
+				alert.State = model.AlertFiring
+				alert.FiredAt = &now
+			}
+		case model.AlertPending:
+			if now.Sub(*alert.ActiveAt) >= r.forDuration {
+				alert.State = model.AlertFiring
+				alert.FiredAt = &now
+			}
+		}
+	} else {
+		switch alert.State {
+		case model.AlertPending:
+			alert.State = model.AlertInactive
+			alert.ActiveAt = nil
+		case model.AlertFiring:
+			alert.State = model.AlertResolved
+			alert.ResolvedAt = &now
+		}
+	}
+
+	newState := alert.State
+	s.mu.Unlock()
+
+	if newState != prevState {
+		s.publish(r, prevState, newState, value, now)
+	}
+}
+
+func (s *alertService) publish(r rule, prevState, newState string, value float64, now time.Time) {
+	s.log.Info("alert state changed",
+		zap.String("rule", r.Name),
+		zap.String("metric_id", r.MetricID),
+		zap.String("prev_state", prevState),
+		zap.String("state", newState),
+		zap.Float64("value", value),
+	)
+
+	event := model.MetricProcessedEvent{
+		Timestamp: now,
+		TS:        now.UnixMilli(),
+		Metrics:   []string{r.MetricID},
+		Alert: &model.AlertEvent{
+			Name:      r.Name,
+			MetricID:  r.MetricID,
+			State:     newState,
+			PrevState: prevState,
+			Value:     value,
+			Threshold: r.Threshold,
+		},
+	}
+
+	if err := s.eventPub.Publish(event); err != nil {
+		s.log.Error("failed to publish alert event", zap.Error(err))
+	}
+}
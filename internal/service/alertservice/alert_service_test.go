@@ -0,0 +1,198 @@
+package alertservice
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/mocks"
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/model"
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func newTestService(t *testing.T, rules []model.AlertRule) (*alertService, *mocks.MockStorage, *mocks.MockEventPublisher) {
+	ctrl := gomock.NewController(t)
+	t.Cleanup(ctrl.Finish)
+
+	storage := mocks.NewMockStorage(ctrl)
+	eventPub := mocks.NewMockEventPublisher(ctrl)
+
+	service, err := NewAlertService(storage, eventPub, rules, time.Second, zap.NewNop())
+	require.NoError(t, err)
+
+	return service, storage, eventPub
+}
+
+func expectState(t *testing.T, eventPub *mocks.MockEventPublisher, state string) *gomock.Call {
+	return eventPub.EXPECT().
+		Publish(gomock.Any()).
+		DoAndReturn(func(event model.MetricProcessedEvent) error {
+			require.NotNil(t, event.Alert)
+			assert.Equal(t, state, event.Alert.State)
+			return nil
+		})
+}
+
+func TestAlertService_PendingFiringResolved(t *testing.T) {
+	service, storage, eventPub := newTestService(t, []model.AlertRule{{
+		Name:      "high_heap",
+		MetricID:  "HeapAlloc",
+		MType:     model.Gauge,
+		Operator:  OpGreater,
+		Threshold: 100,
+		For:       "1m",
+	}})
+
+	ctx := context.Background()
+	start := time.Now()
+
+	gomock.InOrder(
+		storage.EXPECT().GetGauge(ctx, "HeapAlloc").Return(150.0, nil),
+		storage.EXPECT().GetGauge(ctx, "HeapAlloc").Return(160.0, nil),
+		storage.EXPECT().GetGauge(ctx, "HeapAlloc").Return(170.0, nil),
+		storage.EXPECT().GetGauge(ctx, "HeapAlloc").Return(50.0, nil),
+	)
+	gomock.InOrder(
+		expectState(t, eventPub, model.AlertPending),
+		expectState(t, eventPub, model.AlertFiring),
+		expectState(t, eventPub, model.AlertResolved),
+	)
+
+	service.evaluate(ctx, start)
+	assert.Empty(t, service.FiringAlerts(ctx))
+
+	service.evaluate(ctx, start.Add(30*time.Second))
+	assert.Empty(t, service.FiringAlerts(ctx))
+
+	service.evaluate(ctx, start.Add(time.Minute))
+	firing := service.FiringAlerts(ctx)
+	require.Len(t, firing, 1)
+	assert.Equal(t, "high_heap", firing[0].Rule.Name)
+	assert.Equal(t, 170.0, firing[0].Value)
+
+	service.evaluate(ctx, start.Add(2*time.Minute))
+	assert.Empty(t, service.FiringAlerts(ctx))
+}
+
+func TestAlertService_FiresImmediatelyWithoutFor(t *testing.T) {
+	service, storage, eventPub := newTestService(t, []model.AlertRule{{
+		Name:      "too_many_polls",
+		MetricID:  "PollCount",
+		MType:     model.Counter,
+		Operator:  OpGreaterEqual,
+		Threshold: 10,
+	}})
+
+	ctx := context.Background()
+	storage.EXPECT().GetCounter(ctx, "PollCount").Return(int64(10), nil)
+	expectState(t, eventPub, model.AlertFiring)
+
+	now := time.Now()
+	service.evaluate(ctx, now)
+
+	alerts := service.FiringAlerts(ctx)
+	require.Len(t, alerts, 1)
+	require.NotNil(t, alerts[0].FiredAt)
+	assert.Equal(t, now, *alerts[0].FiredAt)
+	// Алерт не разрешался: время разрешения не выводится в JSON
+	assert.Nil(t, alerts[0].ResolvedAt)
+	body, err := json.Marshal(alerts[0])
+	require.NoError(t, err)
+	assert.NotContains(t, string(body), "resolved_at")
+}
+
+func TestAlertService_PendingReturnsToInactive(t *testing.T) {
+	service, storage, eventPub := newTestService(t, []model.AlertRule{{
+		Name:      "low_memory",
+		MetricID:  "FreeMemory",
+		MType:     model.Gauge,
+		Operator:  OpLess,
+		Threshold: 10,
+		For:       "1m",
+	}})
+
+	ctx := context.Background()
+	start := time.Now()
+
+	gomock.InOrder(
+		storage.EXPECT().GetGauge(ctx, "FreeMemory").Return(5.0, nil),
+		storage.EXPECT().GetGauge(ctx, "FreeMemory").Return(20.0, nil),
+	)
+	gomock.InOrder(
+		expectState(t, eventPub, model.AlertPending),
+		expectState(t, eventPub, model.AlertInactive),
+	)
+
+	service.evaluate(ctx, start)
+	service.evaluate(ctx, start.Add(10*time.Second))
+
+	assert.Empty(t, service.FiringAlerts(ctx))
+}
+
+func TestAlertService_MissingMetricKeepsState(t *testing.T) {
+	svc, storage, _ := newTestService(t, []model.AlertRule{{
+		Name:      "missing",
+		MetricID:  "Unknown",
+		MType:     model.Gauge,
+		Operator:  OpGreater,
+		Threshold: 0,
+	}})
+
+	ctx := context.Background()
+	storage.EXPECT().GetGauge(ctx, "Unknown").Return(0.0, service.ErrNotFound)
+	storage.EXPECT().GetGauge(ctx, "Unknown").Return(0.0, service.ErrUnavailable)
+
+	svc.evaluate(ctx, time.Now())
+	svc.evaluate(ctx, time.Now())
+
+	assert.Empty(t, svc.FiringAlerts(ctx))
+}
+
+func TestNewAlertService_InvalidRules(t *testing.T) {
+	tests := []struct {
+		name string
+		rule model.AlertRule
+	}{
+		{"empty name", model.AlertRule{MetricID: "a", MType: model.Gauge, Operator: OpGreater}},
+		{"empty metric", model.AlertRule{Name: "r", MType: model.Gauge, Operator: OpGreater}},
+		{"unknown type", model.AlertRule{Name: "r", MetricID: "a", MType: "histogram", Operator: OpGreater}},
+		{"unknown operator", model.AlertRule{Name: "r", MetricID: "a", MType: model.Gauge, Operator: "~"}},
+		{"invalid for", model.AlertRule{Name: "r", MetricID: "a", MType: model.Gauge, Operator: OpGreater, For: "soon"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewAlertService(nil, nil, []model.AlertRule{tt.rule}, time.Second, zap.NewNop())
+			assert.Error(t, err)
+		})
+	}
+
+	t.Run("duplicate name", func(t *testing.T) {
+		r := model.AlertRule{Name: "r", MetricID: "a", MType: model.Gauge, Operator: OpGreater}
+		_, err := NewAlertService(nil, nil, []model.AlertRule{r, r}, time.Second, zap.NewNop())
+		assert.Error(t, err)
+	})
+}
+
+func TestLoadRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	data := `[{"name":"high_heap","metric_id":"HeapAlloc","type":"gauge","operator":">","threshold":1e9,"for":"5m"}]`
+	require.NoError(t, os.WriteFile(path, []byte(data), 0644))
+
+	rules, err := LoadRules(path)
+	require.NoError(t, err)
+	require.Len(t, rules, 1)
+	assert.Equal(t, "HeapAlloc", rules[0].MetricID)
+	assert.Equal(t, "5m", rules[0].For)
+
+	rules, err = LoadRules("")
+	assert.NoError(t, err)
+	assert.Empty(t, rules)
+}
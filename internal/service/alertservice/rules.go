@@ -0,0 +1,115 @@
+package alertservice
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/model"
+)
+
+// Поддерживаемые операторы сравнения
+const (
+	OpGreater      = ">"
+	OpGreaterEqual = ">="
+	OpLess         = "<"
+	OpLessEqual    = "<="
+	OpEqual        = "=="
+	OpNotEqual     = "!="
+)
+
+// rule - провалидированное правило с распарсенной длительностью
+type rule struct {
+	model.AlertRule
+	forDuration time.Duration
+}
+
+// LoadRules читает правила алертинга из JSON-файла.
+// Пустой путь означает отсутствие правил.
+func LoadRules(path string) ([]model.AlertRule, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read alert rules: %w", err)
+	}
+
+	var rules []model.AlertRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal alert rules: %w", err)
+	}
+
+	return rules, nil
+}
+
+// compileRules проверяет правила и приводит их к внутреннему представлению
+func compileRules(rules []model.AlertRule) ([]rule, error) {
+	compiled := make([]rule, 0, len(rules))
+	names := make(map[string]struct{}, len(rules))
+
+	for i, r := range rules {
+		if r.Name == "" {
+			return nil, fmt.Errorf("rule #%d: name is required", i)
+		}
+		if _, exists := names[r.Name]; exists {
+			return nil, fmt.Errorf("rule %q: duplicate name", r.Name)
+		}
+		names[r.Name] = struct{}{}
+
+		if r.MetricID == "" {
+			return nil, fmt.Errorf("rule %q: metric_id is required", r.Name)
+		}
+		if r.MType != model.Gauge && r.MType != model.Counter {
+			return nil, fmt.Errorf("rule %q: unknown metric type %q", r.Name, r.MType)
+		}
+		if !isValidOperator(r.Operator) {
+			return nil, fmt.Errorf("rule %q: unknown operator %q", r.Name, r.Operator)
+		}
+
+		var forDuration time.Duration
+		if r.For != "" {
+			d, err := time.ParseDuration(r.For)
+			if err != nil {
+				return nil, fmt.Errorf("rule %q: invalid for duration: %w", r.Name, err)
+			}
+			if d < 0 {
+				return nil, fmt.Errorf("rule %q: for duration must not be negative", r.Name)
+			}
+			forDuration = d
+		}
+
+		compiled = append(compiled, rule{AlertRule: r, forDuration: forDuration})
+	}
+
+	return compiled, nil
+}
+
+func isValidOperator(op string) bool {
+	switch op {
+	case OpGreater, OpGreaterEqual, OpLess, OpLessEqual, OpEqual, OpNotEqual:
+		return true
+	}
+	return false
+}
+
+// matches проверяет выполнение условия правила для значения
+func (r rule) matches(value float64) bool {
+	switch r.Operator {
+	case OpGreater:
+		return value > r.Threshold
+	case OpGreaterEqual:
+		return value >= r.Threshold
+	case OpLess:
+		return value < r.Threshold
+	case OpLessEqual:
+		return value <= r.Threshold
+	case OpEqual:
+		return value == r.Threshold
+	case OpNotEqual:
+		return value != r.Threshold
+	}
+	return false
+}
@@ -0,0 +1,9 @@
+package expiryservice
+
+import (
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/model"
+)
+
+type EventPublisher interface {
+	Publish(event model.MetricProcessedEvent) error
+}
@@ -0,0 +1,120 @@
+package expiryservice
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/model"
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/service"
+	"go.uber.org/zap"
+)
+
+// expiryService периодически удаляет метрики, которые не обновлялись дольше ttl,
+// и отправляет событие аудита об удаленных метриках.
+type expiryService struct {
+	storage  service.Storage
+	eventPub EventPublisher
+	log      *zap.Logger
+	ttl      time.Duration
+	interval time.Duration
+
+	done     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+func NewExpiryService(
+	storage service.Storage,
+	eventPub EventPublisher,
+	ttl time.Duration,
+	log *zap.Logger,
+) *expiryService {
+	return &expiryService{
+		storage:  storage,
+		eventPub: eventPub,
+		log:      log,
+		ttl:      ttl,
+		interval: checkInterval(ttl),
+		done:     make(chan struct{}),
+	}
+}
+
+// checkInterval - период проверки: десятая часть ttl, но от секунды до минуты
+func checkInterval(ttl time.Duration) time.Duration {
+	return min(max(ttl/10, time.Second), time.Minute)
+}
+
+// Start запускает фоновое удаление устаревших метрик
+func (s *expiryService) Start(ctx context.Context) {
+	if s.ttl <= 0 {
+		s.log.Info("metric expiry disabled")
+		return
+	}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				s.expire(ctx, time.Now())
+			case <-s.done:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	s.log.Info("metric expiry started",
+		zap.Duration("ttl", s.ttl),
+		zap.Duration("interval", s.interval),
+	)
+}
+
+// Close останавливает фоновое удаление
+func (s *expiryService) Close() error {
+	s.stopOnce.Do(func() {
+		close(s.done)
+	})
+	s.wg.Wait()
+	return nil
+}
+
+// expire удаляет метрики, не обновлявшиеся с момента now - ttl
+func (s *expiryService) expire(ctx context.Context, now time.Time) {
+	deleted, err := s.storage.DeleteStale(ctx, now.Add(-s.ttl))
+	if err != nil {
+		s.log.Warn("failed to delete stale metrics", zap.Error(err))
+		return
+	}
+	if len(deleted) == 0 {
+		return
+	}
+
+	ids := make([]string, 0, len(deleted))
+	for _, metric := range deleted {
+		ids = append(ids, metric.Key())
+	}
+
+	s.log.Info("stale metrics deleted",
+		zap.Int("metrics_count", len(deleted)),
+		zap.Duration("ttl", s.ttl),
+	)
+
+	event := model.MetricProcessedEvent{
+		Timestamp: now,
+		TS:        now.UnixMilli(),
+		Metrics:   ids,
+		Action:    model.AuditActionExpire,
+	}
+
+	if err := s.eventPub.Publish(event); err != nil {
+		s.log.Error("failed to publish expiry event", zap.Error(err))
+	}
+}
@@ -0,0 +1,67 @@
+package expiryservice
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/mocks"
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/model"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func newTestService(t *testing.T, ttl time.Duration) (*expiryService, *mocks.MockStorage, *mocks.MockEventPublisher) {
+	ctrl := gomock.NewController(t)
+	t.Cleanup(ctrl.Finish)
+
+	storage := mocks.NewMockStorage(ctrl)
+	eventPub := mocks.NewMockEventPublisher(ctrl)
+
+	return NewExpiryService(storage, eventPub, ttl, zap.NewNop()), storage, eventPub
+}
+
+func TestExpiryService_PublishesExpired(t *testing.T) {
+	service, storage, eventPub := newTestService(t, time.Minute)
+	ctx := context.Background()
+	now := time.Now()
+
+	storage.EXPECT().DeleteStale(ctx, now.Add(-time.Minute)).Return([]model.Metrics{
+		{ID: "Alloc", MType: model.Gauge},
+		{ID: "PollCount", MType: model.Counter},
+	}, nil)
+	eventPub.EXPECT().Publish(gomock.Any()).DoAndReturn(func(event model.MetricProcessedEvent) error {
+		assert.Equal(t, model.AuditActionExpire, event.Action)
+		assert.Equal(t, []string{"Alloc", "PollCount"}, event.Metrics)
+		return nil
+	})
+
+	service.expire(ctx, now)
+}
+
+func TestExpiryService_NothingStale(t *testing.T) {
+	service, storage, _ := newTestService(t, time.Minute)
+	ctx := context.Background()
+
+	// Событие без удаленных метрик не отправляется
+	storage.EXPECT().DeleteStale(ctx, gomock.Any()).Return(nil, nil)
+	service.expire(ctx, time.Now())
+
+	storage.EXPECT().DeleteStale(ctx, gomock.Any()).Return(nil, errors.New("db error"))
+	service.expire(ctx, time.Now())
+}
+
+func TestExpiryService_DisabledWithoutTTL(t *testing.T) {
+	service, _, _ := newTestService(t, 0)
+
+	service.Start(context.Background())
+	assert.NoError(t, service.Close())
+}
+
+func TestCheckInterval(t *testing.T) {
+	assert.Equal(t, time.Second, checkInterval(5*time.Second))
+	assert.Equal(t, 30*time.Second, checkInterval(5*time.Minute))
+	assert.Equal(t, time.Minute, checkInterval(24*time.Hour))
+}
@@ -3,8 +3,10 @@ package mainpageservice
 import (
 	"context"
 	"html/template"
+	"strconv"
 	"strings"
 
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/model"
 	"github.com/kazakovdmitriy/go-musthave-metrics/internal/service"
 )
 
@@ -14,7 +16,9 @@ type mainPageService struct {
 }
 
 func NewMainPageService(storage service.Storage) (*mainPageService, error) {
-	tmpl, err := template.New("mainpage").Parse(`<!DOCTYPE html>
+	tmpl, err := template.New("mainpage").Funcs(template.FuncMap{
+		"metricValue": formatMetricValue,
+	}).Parse(`<!DOCTYPE html>
 <html lang="ru">
 <head>
     <meta charset="UTF-8">
@@ -23,7 +27,11 @@ func NewMainPageService(storage service.Storage) (*mainPageService, error) {
 </head>
 <body>
     <h1>Список метрик</h1>
-    <p>{{.}}</p>
+    <ul>
+{{- range .}}
+        <li>{{.Key}} = {{metricValue .}}</li>
+{{- end}}
+    </ul>
 </body>
 </html>`)
 
@@ -38,15 +46,30 @@ func NewMainPageService(storage service.Storage) (*mainPageService, error) {
 }
 
 func (s *mainPageService) GetMainPage(ctx context.Context) (string, error) {
-	metricsResult, err := s.storage.GetAllMetrics(ctx)
+	metrics, err := s.storage.ListMetrics(ctx, model.MetricsFilter{})
 	if err != nil {
 		return "", err
 	}
 
 	var builder strings.Builder
-	if err := s.template.Execute(&builder, metricsResult); err != nil {
+	if err := s.template.Execute(&builder, metrics); err != nil {
 		return "", err
 	}
 
 	return builder.String(), nil
 }
+
+// formatMetricValue форматирует значение метрики так же, как эндпоинт /value.
+// Для histogram выводятся только количество наблюдений и их сумма.
+func formatMetricValue(metric model.Metrics) string {
+	switch {
+	case metric.MType == model.Counter && metric.Delta != nil:
+		return strconv.FormatInt(*metric.Delta, 10)
+	case metric.MType == model.Gauge && metric.Value != nil:
+		return strconv.FormatFloat(*metric.Value, 'f', -1, 64)
+	case metric.MType == model.Histogram && metric.Histogram != nil:
+		return "count " + strconv.FormatInt(metric.Histogram.Count, 10) +
+			", sum " + strconv.FormatFloat(metric.Histogram.Sum, 'f', -1, 64)
+	}
+	return ""
+}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/golang/mock/gomock"
 	"github.com/kazakovdmitriy/go-musthave-metrics/internal/mocks"
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/model"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -19,10 +20,15 @@ func TestMainPageService_GetMainPage_WithGomock(t *testing.T) {
 
 		mockStorage := mocks.NewMockStorage(ctrl)
 		ctx := context.Background()
-		expectedMetrics := "counter1 = 10\ngauge1 = 3.14"
+		delta := int64(10)
+		value := 3.14
+		expectedMetrics := []model.Metrics{
+			{ID: "counter1", MType: model.Counter, Delta: &delta},
+			{ID: "gauge1", MType: model.Gauge, Value: &value},
+		}
 
 		mockStorage.EXPECT().
-			GetAllMetrics(ctx).
+			ListMetrics(ctx, model.MetricsFilter{}).
 			Return(expectedMetrics, nil).
 			Times(1)
 
@@ -35,8 +41,8 @@ func TestMainPageService_GetMainPage_WithGomock(t *testing.T) {
 		// Assert
 		require.NoError(t, err)
 		assert.Contains(t, result, "<h1>Список метрик</h1>")
-		assert.Contains(t, result, "counter1 = 10")
-		assert.Contains(t, result, "gauge1 = 3.14")
+		assert.Contains(t, result, "<li>counter1 = 10</li>")
+		assert.Contains(t, result, "<li>gauge1 = 3.14</li>")
 	})
 
 	t.Run("error from storage", func(t *testing.T) {
@@ -49,8 +55,8 @@ func TestMainPageService_GetMainPage_WithGomock(t *testing.T) {
 		expectedErr := errors.New("storage unavailable")
 
 		mockStorage.EXPECT().
-			GetAllMetrics(ctx).
-			Return("", expectedErr).
+			ListMetrics(ctx, model.MetricsFilter{}).
+			Return(nil, expectedErr).
 			Times(1)
 
 		service, err := NewMainPageService(mockStorage)
@@ -65,6 +71,32 @@ func TestMainPageService_GetMainPage_WithGomock(t *testing.T) {
 		assert.Empty(t, result)
 	})
 
+	t.Run("metric names are escaped", func(t *testing.T) {
+		// Arrange
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		mockStorage := mocks.NewMockStorage(ctrl)
+		ctx := context.Background()
+		value := 1.0
+
+		mockStorage.EXPECT().
+			ListMetrics(ctx, model.MetricsFilter{}).
+			Return([]model.Metrics{{ID: "<script>", MType: model.Gauge, Value: &value}}, nil).
+			Times(1)
+
+		service, err := NewMainPageService(mockStorage)
+		require.NoError(t, err)
+
+		// Act
+		result, err := service.GetMainPage(ctx)
+
+		// Assert
+		require.NoError(t, err)
+		assert.NotContains(t, result, "<script>")
+		assert.Contains(t, result, "&lt;script&gt; = 1")
+	})
+
 	t.Run("verify HTML structure", func(t *testing.T) {
 		// Arrange
 		ctrl := gomock.NewController(t)
@@ -74,8 +106,8 @@ func TestMainPageService_GetMainPage_WithGomock(t *testing.T) {
 		ctx := context.Background()
 
 		mockStorage.EXPECT().
-			GetAllMetrics(ctx).
-			Return("test", nil).
+			ListMetrics(ctx, model.MetricsFilter{}).
+			Return([]model.Metrics{}, nil).
 			Times(1)
 
 		service, err := NewMainPageService(mockStorage)
@@ -90,6 +122,7 @@ func TestMainPageService_GetMainPage_WithGomock(t *testing.T) {
 		assert.Contains(t, result, "<html lang=\"ru\">")
 		assert.Contains(t, result, "<title>Доступные метрики</title>")
 		assert.Contains(t, result, "<body>")
+		assert.Contains(t, result, "<ul>")
 		assert.Contains(t, result, "</body>")
 		assert.Contains(t, result, "</html>")
 	})
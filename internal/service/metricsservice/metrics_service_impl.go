@@ -13,24 +13,58 @@ import (
 type metricsService struct {
 	storage  service.Storage
 	eventPub EventPublisher
+	// buckets - границы корзин новых гистограмм, заполняемых по одному наблюдению
+	buckets []float64
 }
 
+// NewMetricService создает сервис метрик. Пустые buckets заменяются model.DefaultBuckets.
 func NewMetricService(
 	storage service.Storage,
 	eventPub EventPublisher,
+	buckets []float64,
 ) *metricsService {
+	if len(buckets) == 0 {
+		buckets = model.DefaultBuckets
+	}
 	return &metricsService{
 		storage:  storage,
 		eventPub: eventPub,
+		buckets:  buckets,
 	}
 }
 
+// UpdateGauge сохраняет gauge. name может содержать метки: name{label="value",...},
+// здесь и в остальных методах по имени он приводится к каноническому ключу ряда.
 func (s *metricsService) UpdateGauge(ctx context.Context, name string, value float64) error {
-	return s.storage.UpdateGauge(ctx, name, value)
+	return s.storage.UpdateGauge(ctx, model.NormalizeSeriesKey(name), value)
 }
 
 func (s *metricsService) UpdateCounter(ctx context.Context, name string, value int64) error {
-	return s.storage.UpdateCounter(ctx, name, value)
+	return s.storage.UpdateCounter(ctx, model.NormalizeSeriesKey(name), value)
+}
+
+// ObserveHistogram добавляет одно наблюдение в гистограмму.
+// Новая гистограмма создается с границами корзин из конфигурации, существующая сохраняет свои.
+func (s *metricsService) ObserveHistogram(ctx context.Context, name string, value float64) error {
+	name = model.NormalizeSeriesKey(name)
+
+	buckets := s.buckets
+	current, err := s.storage.GetHistogram(ctx, name)
+	switch {
+	case err == nil:
+		buckets = current.Buckets
+	case !errors.Is(err, service.ErrNotFound):
+		return fmt.Errorf("failed to get histogram metric: %w", err)
+	}
+
+	delta := model.NewHistogram(buckets)
+	delta.Observe(value)
+	return s.storage.UpdateHistogram(ctx, name, delta)
+}
+
+// UpdateHistogram добавляет к гистограмме приращение распределения, см. service.Storage
+func (s *metricsService) UpdateHistogram(ctx context.Context, name string, value model.HistogramValue) error {
+	return s.storage.UpdateHistogram(ctx, model.NormalizeSeriesKey(name), value)
 }
 
 func (s *metricsService) UpdateMetrics(ctx context.Context, metrics []model.Metrics, ipAddr string) error {
@@ -38,43 +72,166 @@ func (s *metricsService) UpdateMetrics(ctx context.Context, metrics []model.Metr
 		return fmt.Errorf("failed to save metrics in storage: %w", err)
 	}
 
+	s.publishProcessed(metrics, ipAddr)
+	return nil
+}
+
+// UpdateMetricsOnce применяет батч с ключом идемпотентности.
+// Повторный батч с тем же ключом не применяется и не попадает в аудит, возвращается false.
+// Пустой ключ означает обычное обновление.
+func (s *metricsService) UpdateMetricsOnce(ctx context.Context, key string, metrics []model.Metrics, ipAddr string) (bool, error) {
+	if key == "" {
+		return true, s.UpdateMetrics(ctx, metrics, ipAddr)
+	}
+
+	applied, err := s.storage.UpdateMetricsOnce(ctx, key, metrics)
+	if err != nil {
+		return false, fmt.Errorf("failed to save metrics in storage: %w", err)
+	}
+
+	if applied {
+		s.publishProcessed(metrics, ipAddr)
+	}
+	return applied, nil
+}
+
+// DeleteMetric удаляет метрику и отправляет событие аудита.
+// Если метрики нет, возвращает ошибку, обернутую в service.ErrNotFound.
+func (s *metricsService) DeleteMetric(ctx context.Context, metricType, name, ipAddr string) error {
+	name = model.NormalizeSeriesKey(name)
+	if err := s.storage.DeleteMetric(ctx, metricType, name); err != nil {
+		return fmt.Errorf("failed to delete metric: %w", err)
+	}
+
+	s.publishDeleted([]model.Metrics{{ID: name, MType: metricType}}, ipAddr)
+	return nil
+}
+
+// DeleteMetrics удаляет метрики, подходящие под фильтр, и отправляет событие аудита
+func (s *metricsService) DeleteMetrics(ctx context.Context, filter model.MetricsFilter, ipAddr string) ([]model.Metrics, error) {
+	deleted, err := s.storage.DeleteMetrics(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete metrics: %w", err)
+	}
+
+	if len(deleted) > 0 {
+		s.publishDeleted(deleted, ipAddr)
+	}
+	return deleted, nil
+}
+
+// publishProcessed асинхронно отправляет событие аудита о сохраненных метриках
+func (s *metricsService) publishProcessed(metrics []model.Metrics, ipAddr string) {
+	s.publish(newEvent(metrics, ipAddr))
+}
+
+// publishDeleted асинхронно отправляет событие аудита об удаленных метриках
+func (s *metricsService) publishDeleted(metrics []model.Metrics, ipAddr string) {
+	event := newEvent(metrics, ipAddr)
+	event.Action = model.AuditActionDelete
+	s.publish(event)
+}
+
+func newEvent(metrics []model.Metrics, ipAddr string) model.MetricProcessedEvent {
 	var metricsArr []string
 	for _, m := range metrics {
-		metricsArr = append(metricsArr, m.ID)
+		metricsArr = append(metricsArr, m.Key())
 	}
 
 	now := time.Now()
-	event := model.MetricProcessedEvent{
+	return model.MetricProcessedEvent{
 		Timestamp: now,
 		TS:        now.UnixMilli(),
 		Metrics:   metricsArr,
 		IPAddr:    ipAddr,
 	}
+}
 
+func (s *metricsService) publish(event model.MetricProcessedEvent) {
 	go func() {
 		err := s.eventPub.Publish(event)
 		if err != nil {
 			fmt.Printf("failed to publish metrics: %v\n", err)
 		}
 	}()
-
-	return nil
 }
 
+// GetGauge возвращает значение gauge. Ошибки хранилища (service.ErrNotFound,
+// service.ErrUnavailable) доступны через errors.Is.
 func (s *metricsService) GetGauge(ctx context.Context, name string) (float64, error) {
-	value, exist := s.storage.GetGauge(ctx, name)
-	if !exist {
-		return 0, errors.New("gauge metric not found")
+	value, err := s.storage.GetGauge(ctx, model.NormalizeSeriesKey(name))
+	if err != nil {
+		return 0, fmt.Errorf("failed to get gauge metric: %w", err)
 	}
 
 	return value, nil
 }
 
+// GetCounter возвращает значение counter. Ошибки хранилища (service.ErrNotFound,
+// service.ErrUnavailable) доступны через errors.Is.
 func (s *metricsService) GetCounter(ctx context.Context, name string) (int64, error) {
-	value, exist := s.storage.GetCounter(ctx, name)
-	if !exist {
-		return 0, errors.New("counter metric not found")
+	value, err := s.storage.GetCounter(ctx, model.NormalizeSeriesKey(name))
+	if err != nil {
+		return 0, fmt.Errorf("failed to get counter metric: %w", err)
 	}
 
 	return value, nil
 }
+
+// GetHistogram возвращает гистограмму. Ошибки хранилища (service.ErrNotFound,
+// service.ErrUnavailable) доступны через errors.Is.
+func (s *metricsService) GetHistogram(ctx context.Context, name string) (model.HistogramValue, error) {
+	value, err := s.storage.GetHistogram(ctx, model.NormalizeSeriesKey(name))
+	if err != nil {
+		return model.HistogramValue{}, fmt.Errorf("failed to get histogram metric: %w", err)
+	}
+
+	return value, nil
+}
+
+func (s *metricsService) ListMetrics(ctx context.Context, filter model.MetricsFilter) ([]model.Metrics, error) {
+	metrics, err := s.storage.ListMetrics(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list metrics: %w", err)
+	}
+
+	return metrics, nil
+}
+
+func (s *metricsService) GetHistory(
+	ctx context.Context,
+	metricType, name string,
+	from, to time.Time,
+	step time.Duration,
+) ([]model.MetricSample, error) {
+	samples, err := s.storage.GetHistory(ctx, metricType, model.NormalizeSeriesKey(name), from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get metric history: %w", err)
+	}
+
+	return downsample(samples, step), nil
+}
+
+// downsample оставляет по одному сэмплу на интервал step - последний в интервале.
+// Метка времени точки выравнивается по началу интервала.
+// Для counter последний сэмпл интервала - накопленное значение на его конец.
+func downsample(samples []model.MetricSample, step time.Duration) []model.MetricSample {
+	stepMs := step.Milliseconds()
+	if stepMs <= 0 || len(samples) == 0 {
+		return samples
+	}
+
+	result := make([]model.MetricSample, 0, len(samples))
+	for _, sample := range samples {
+		bucket := sample.TS - sample.TS%stepMs
+		sample.TS = bucket
+
+		if n := len(result); n > 0 && result[n-1].TS == bucket {
+			result[n-1] = sample
+			continue
+		}
+		result = append(result, sample)
+	}
+
+	return result
+}
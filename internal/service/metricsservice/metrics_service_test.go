@@ -3,10 +3,14 @@ package metricsservice
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/golang/mock/gomock"
 	"github.com/kazakovdmitriy/go-musthave-metrics/internal/mocks"
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/model"
+	"github.com/kazakovdmitriy/go-musthave-metrics/internal/service"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestMetricsService_UpdateGauge(t *testing.T) {
@@ -15,7 +19,7 @@ func TestMetricsService_UpdateGauge(t *testing.T) {
 
 	storage := mocks.NewMockStorage(ctrl)
 	eventPub := mocks.NewMockEventPublisher(ctrl)
-	service := NewMetricService(storage, eventPub)
+	service := NewMetricService(storage, eventPub, nil)
 
 	ctx := context.Background()
 	storage.EXPECT().UpdateGauge(ctx, "test_gauge", 123.45).Times(1)
@@ -30,7 +34,7 @@ func TestMetricsService_UpdateCounter(t *testing.T) {
 
 	storage := mocks.NewMockStorage(ctrl)
 	eventPub := mocks.NewMockEventPublisher(ctrl)
-	service := NewMetricService(storage, eventPub)
+	service := NewMetricService(storage, eventPub, nil)
 
 	ctx := context.Background()
 	storage.EXPECT().UpdateCounter(ctx, "test_counter", int64(10)).Times(1)
@@ -39,16 +43,68 @@ func TestMetricsService_UpdateCounter(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestMetricsService_ObserveHistogram_New(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	storage := mocks.NewMockStorage(ctrl)
+	eventPub := mocks.NewMockEventPublisher(ctrl)
+	svc := NewMetricService(storage, eventPub, []float64{1, 5})
+
+	ctx := context.Background()
+	storage.EXPECT().GetHistogram(ctx, "latency").Return(model.HistogramValue{}, service.ErrNotFound)
+	storage.EXPECT().UpdateHistogram(ctx, "latency", model.HistogramValue{
+		Buckets: []float64{1, 5}, Counts: []int64{0, 1, 0}, Sum: 2, Count: 1,
+	}).Return(nil)
+
+	assert.NoError(t, svc.ObserveHistogram(ctx, "latency", 2))
+}
+
+// Существующая гистограмма сохраняет свои границы, даже если в конфигурации другие
+func TestMetricsService_ObserveHistogram_KeepsBuckets(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	storage := mocks.NewMockStorage(ctrl)
+	eventPub := mocks.NewMockEventPublisher(ctrl)
+	svc := NewMetricService(storage, eventPub, nil)
+
+	ctx := context.Background()
+	storage.EXPECT().GetHistogram(ctx, "latency").Return(model.HistogramValue{
+		Buckets: []float64{10}, Counts: []int64{3, 0}, Sum: 6, Count: 3,
+	}, nil)
+	storage.EXPECT().UpdateHistogram(ctx, "latency", model.HistogramValue{
+		Buckets: []float64{10}, Counts: []int64{0, 1}, Sum: 20, Count: 1,
+	}).Return(nil)
+
+	assert.NoError(t, svc.ObserveHistogram(ctx, "latency", 20))
+}
+
+func TestMetricsService_ObserveHistogram_Unavailable(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	storage := mocks.NewMockStorage(ctrl)
+	eventPub := mocks.NewMockEventPublisher(ctrl)
+	svc := NewMetricService(storage, eventPub, nil)
+
+	ctx := context.Background()
+	storage.EXPECT().GetHistogram(ctx, "latency").Return(model.HistogramValue{}, service.ErrUnavailable)
+
+	err := svc.ObserveHistogram(ctx, "latency", 1)
+	assert.ErrorIs(t, err, service.ErrUnavailable)
+}
+
 func TestMetricsService_GetGauge_Success(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
 	storage := mocks.NewMockStorage(ctrl)
 	eventPub := mocks.NewMockEventPublisher(ctrl)
-	service := NewMetricService(storage, eventPub)
+	service := NewMetricService(storage, eventPub, nil)
 
 	ctx := context.Background()
-	storage.EXPECT().GetGauge(ctx, "existing_gauge").Return(99.99, true)
+	storage.EXPECT().GetGauge(ctx, "existing_gauge").Return(99.99, nil)
 
 	value, err := service.GetGauge(ctx, "existing_gauge")
 	assert.NoError(t, err)
@@ -61,14 +117,13 @@ func TestMetricsService_GetGauge_NotFound(t *testing.T) {
 
 	storage := mocks.NewMockStorage(ctrl)
 	eventPub := mocks.NewMockEventPublisher(ctrl)
-	service := NewMetricService(storage, eventPub)
+	svc := NewMetricService(storage, eventPub, nil)
 
 	ctx := context.Background()
-	storage.EXPECT().GetGauge(ctx, "missing_gauge").Return(0.0, false)
+	storage.EXPECT().GetGauge(ctx, "missing_gauge").Return(0.0, service.ErrNotFound)
 
-	_, err := service.GetGauge(ctx, "missing_gauge")
-	assert.Error(t, err)
-	assert.Equal(t, "gauge metric not found", err.Error())
+	_, err := svc.GetGauge(ctx, "missing_gauge")
+	assert.ErrorIs(t, err, service.ErrNotFound)
 }
 
 func TestMetricsService_GetCounter_Success(t *testing.T) {
@@ -77,10 +132,10 @@ func TestMetricsService_GetCounter_Success(t *testing.T) {
 
 	storage := mocks.NewMockStorage(ctrl)
 	eventPub := mocks.NewMockEventPublisher(ctrl)
-	service := NewMetricService(storage, eventPub)
+	service := NewMetricService(storage, eventPub, nil)
 
 	ctx := context.Background()
-	storage.EXPECT().GetCounter(ctx, "existing_counter").Return(int64(5), true)
+	storage.EXPECT().GetCounter(ctx, "existing_counter").Return(int64(5), nil)
 
 	value, err := service.GetCounter(ctx, "existing_counter")
 	assert.NoError(t, err)
@@ -93,12 +148,159 @@ func TestMetricsService_GetCounter_NotFound(t *testing.T) {
 
 	storage := mocks.NewMockStorage(ctrl)
 	eventPub := mocks.NewMockEventPublisher(ctrl)
-	service := NewMetricService(storage, eventPub)
+	svc := NewMetricService(storage, eventPub, nil)
+
+	ctx := context.Background()
+	storage.EXPECT().GetCounter(ctx, "missing_counter").Return(int64(0), service.ErrNotFound)
+
+	_, err := svc.GetCounter(ctx, "missing_counter")
+	assert.ErrorIs(t, err, service.ErrNotFound)
+}
+
+func TestMetricsService_GetCounter_Unavailable(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	storage := mocks.NewMockStorage(ctrl)
+	eventPub := mocks.NewMockEventPublisher(ctrl)
+	svc := NewMetricService(storage, eventPub, nil)
+
+	ctx := context.Background()
+	storage.EXPECT().GetCounter(ctx, "PollCount").Return(int64(0), service.ErrUnavailable)
+
+	_, err := svc.GetCounter(ctx, "PollCount")
+	assert.ErrorIs(t, err, service.ErrUnavailable)
+	assert.NotErrorIs(t, err, service.ErrNotFound)
+}
+
+func TestMetricsService_GetHistory_Downsample(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	storage := mocks.NewMockStorage(ctrl)
+	eventPub := mocks.NewMockEventPublisher(ctrl)
+	service := NewMetricService(storage, eventPub, nil)
+
+	ctx := context.Background()
+	from := time.UnixMilli(0)
+	to := time.UnixMilli(100_000)
+
+	v1, v2, v3 := 1.0, 2.0, 3.0
+	storage.EXPECT().GetHistory(ctx, model.Gauge, "HeapAlloc", from, to).Return([]model.MetricSample{
+		{TS: 1_000, Value: &v1},
+		{TS: 9_000, Value: &v2},
+		{TS: 12_000, Value: &v3},
+	}, nil).Times(2)
+
+	raw, err := service.GetHistory(ctx, model.Gauge, "HeapAlloc", from, to, 0)
+	require.NoError(t, err)
+	assert.Len(t, raw, 3)
+
+	points, err := service.GetHistory(ctx, model.Gauge, "HeapAlloc", from, to, 10*time.Second)
+	require.NoError(t, err)
+	require.Len(t, points, 2)
+	assert.Equal(t, int64(0), points[0].TS)
+	assert.Equal(t, 2.0, *points[0].Value)
+	assert.Equal(t, int64(10_000), points[1].TS)
+	assert.Equal(t, 3.0, *points[1].Value)
+}
+
+func TestMetricsService_UpdateMetricsOnce_Replay(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	storage := mocks.NewMockStorage(ctrl)
+	eventPub := mocks.NewMockEventPublisher(ctrl)
+	service := NewMetricService(storage, eventPub, nil)
+
+	ctx := context.Background()
+	delta := int64(1)
+	batch := []model.Metrics{{ID: "PollCount", MType: model.Counter, Delta: &delta}}
+
+	// Повторный батч не применяется и не попадает в аудит
+	storage.EXPECT().UpdateMetricsOnce(ctx, "batch-1", batch).Return(false, nil)
+
+	applied, err := service.UpdateMetricsOnce(ctx, "batch-1", batch, "127.0.0.1")
+	require.NoError(t, err)
+	assert.False(t, applied)
+}
+
+func TestMetricsService_UpdateMetricsOnce_EmptyKey(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	storage := mocks.NewMockStorage(ctrl)
+	eventPub := mocks.NewMockEventPublisher(ctrl)
+	service := NewMetricService(storage, eventPub, nil)
+
+	ctx := context.Background()
+	delta := int64(1)
+	batch := []model.Metrics{{ID: "PollCount", MType: model.Counter, Delta: &delta}}
+
+	published := make(chan struct{})
+	storage.EXPECT().UpdateMetrics(ctx, batch).Return(nil)
+	eventPub.EXPECT().Publish(gomock.Any()).DoAndReturn(func(model.MetricProcessedEvent) error {
+		close(published)
+		return nil
+	})
+
+	applied, err := service.UpdateMetricsOnce(ctx, "", batch, "127.0.0.1")
+	require.NoError(t, err)
+	assert.True(t, applied)
+
+	select {
+	case <-published:
+	case <-time.After(time.Second):
+		t.Fatal("audit event was not published")
+	}
+}
+
+func TestMetricsService_DeleteMetric(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	storage := mocks.NewMockStorage(ctrl)
+	eventPub := mocks.NewMockEventPublisher(ctrl)
+	svc := NewMetricService(storage, eventPub, nil)
+
+	ctx := context.Background()
+
+	published := make(chan model.MetricProcessedEvent, 1)
+	storage.EXPECT().DeleteMetric(ctx, model.Gauge, "Alloc").Return(nil)
+	eventPub.EXPECT().Publish(gomock.Any()).DoAndReturn(func(event model.MetricProcessedEvent) error {
+		published <- event
+		return nil
+	})
+
+	require.NoError(t, svc.DeleteMetric(ctx, model.Gauge, "Alloc", "127.0.0.1"))
+
+	select {
+	case event := <-published:
+		assert.Equal(t, model.AuditActionDelete, event.Action)
+		assert.Equal(t, []string{"Alloc"}, event.Metrics)
+		assert.Equal(t, "127.0.0.1", event.IPAddr)
+	case <-time.After(time.Second):
+		t.Fatal("audit event was not published")
+	}
+
+	// Ненайденная метрика не попадает в аудит
+	storage.EXPECT().DeleteMetric(ctx, model.Gauge, "missing").Return(service.ErrNotFound)
+	assert.ErrorIs(t, svc.DeleteMetric(ctx, model.Gauge, "missing", "127.0.0.1"), service.ErrNotFound)
+}
+
+func TestMetricsService_DeleteMetrics_NothingDeleted(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	storage := mocks.NewMockStorage(ctrl)
+	eventPub := mocks.NewMockEventPublisher(ctrl)
+	service := NewMetricService(storage, eventPub, nil)
 
 	ctx := context.Background()
-	storage.EXPECT().GetCounter(ctx, "missing_counter").Return(int64(0), false)
+	filter := model.MetricsFilter{Prefix: "Heap"}
+	storage.EXPECT().DeleteMetrics(ctx, filter).Return(nil, nil)
 
-	_, err := service.GetCounter(ctx, "missing_counter")
-	assert.Error(t, err)
-	assert.Equal(t, "counter metric not found", err.Error())
+	deleted, err := service.DeleteMetrics(ctx, filter, "127.0.0.1")
+	require.NoError(t, err)
+	assert.Empty(t, deleted)
 }
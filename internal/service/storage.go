@@ -2,17 +2,55 @@ package service
 
 import (
 	"context"
+	"errors"
+	"time"
 
 	"github.com/kazakovdmitriy/go-musthave-metrics/internal/model"
 )
 
+// IdempotencyKeyTTL - сколько хранилище помнит ключи идемпотентности примененных батчей
+const IdempotencyKeyTTL = 24 * time.Hour
+
+var (
+	// ErrNotFound - метрика с таким именем и типом не сохранена
+	ErrNotFound = errors.New("metric not found")
+	// ErrUnavailable - хранилище временно недоступно, запрос можно повторить позже
+	ErrUnavailable = errors.New("storage unavailable")
+	// ErrNotApplied - запись точно не сохранена: соединение не установлено,
+	// сервер отклонил запрос или транзакция откатилась. Без этой пометки
+	// ошибка записи неоднозначна: обрыв связи при фиксации мог произойти
+	// уже после сохранения.
+	ErrNotApplied = errors.New("write not applied")
+)
+
+// Storage хранит метрики по ключу ряда: name в методах - model.SeriesKey,
+// то есть имя с метками в каноническом виде или просто имя для метрики без меток.
 type Storage interface {
 	UpdateGauge(ctx context.Context, name string, value float64) error
 	UpdateCounter(ctx context.Context, name string, value int64) error
+	// UpdateHistogram добавляет приращение распределения к гистограмме.
+	// Если границы корзин не совпадают с сохраненными, возвращает
+	// model.ErrBucketsMismatch и ничего не меняет; UpdateMetrics
+	// и UpdateMetricsOnce в этом случае отклоняют весь батч.
+	UpdateHistogram(ctx context.Context, name string, value model.HistogramValue) error
 	UpdateMetrics(ctx context.Context, metrics []model.Metrics) error
-	GetGauge(ctx context.Context, name string) (float64, bool)
-	GetCounter(ctx context.Context, name string) (int64, bool)
-	GetAllMetrics(ctx context.Context) (string, error)
+	// UpdateMetricsOnce применяет батч, только если ключ key еще не встречался.
+	// Возвращает false, если батч с таким ключом уже был применен.
+	UpdateMetricsOnce(ctx context.Context, key string, metrics []model.Metrics) (bool, error)
+	// GetGauge, GetCounter и GetHistogram возвращают ErrNotFound, если метрики нет,
+	// и ошибку, обернутую в ErrUnavailable, если хранилище недоступно.
+	GetGauge(ctx context.Context, name string) (float64, error)
+	GetCounter(ctx context.Context, name string) (int64, error)
+	GetHistogram(ctx context.Context, name string) (model.HistogramValue, error)
+	ListMetrics(ctx context.Context, filter model.MetricsFilter) ([]model.Metrics, error)
+	GetHistory(ctx context.Context, mtype, name string, from, to time.Time) ([]model.MetricSample, error)
+	// DeleteMetric удаляет метрику вместе с историей. Возвращает ErrNotFound, если метрики нет.
+	DeleteMetric(ctx context.Context, mtype, name string) error
+	// DeleteMetrics удаляет метрики, подходящие под Prefix, MType и Labels фильтра,
+	// и возвращает их имена, метки и типы. Limit и Offset не учитываются.
+	DeleteMetrics(ctx context.Context, filter model.MetricsFilter) ([]model.Metrics, error)
+	// DeleteStale удаляет метрики, не обновлявшиеся с момента before, и возвращает их имена, метки и типы.
+	DeleteStale(ctx context.Context, before time.Time) ([]model.Metrics, error)
 	Ping(ctx context.Context) error
 	Close() error
 }
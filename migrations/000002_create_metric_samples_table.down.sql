@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_metric_samples_id_mtype_ts;
+DROP TABLE IF EXISTS metric_samples;
\ No newline at end of file
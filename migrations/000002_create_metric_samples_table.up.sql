@@ -0,0 +1,14 @@
+CREATE TABLE metric_samples (
+    id    TEXT NOT NULL,
+    mtype metric_type NOT NULL,
+    ts    TIMESTAMPTZ NOT NULL DEFAULT now(),
+    delta BIGINT,
+    value DOUBLE PRECISION,
+
+    CONSTRAINT chk_metric_sample CHECK (
+        (mtype = 'counter' AND delta IS NOT NULL AND value IS NULL) OR
+        (mtype = 'gauge'   AND delta IS NULL     AND value IS NOT NULL)
+    )
+);
+
+CREATE INDEX idx_metric_samples_id_mtype_ts ON metric_samples (id, mtype, ts);
\ No newline at end of file
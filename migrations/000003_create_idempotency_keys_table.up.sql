@@ -0,0 +1,6 @@
+CREATE TABLE idempotency_keys (
+    key        TEXT PRIMARY KEY,
+    applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_idempotency_keys_applied_at ON idempotency_keys (applied_at);
\ No newline at end of file
@@ -0,0 +1,7 @@
+-- Старый ключ допускает одну метрику на имя: при совпадении имен сохраняется counter.
+DELETE FROM metrics g
+USING metrics c
+WHERE g.id = c.id AND g.mtype = 'gauge' AND c.mtype = 'counter';
+
+ALTER TABLE metrics DROP CONSTRAINT metrics_pkey;
+ALTER TABLE metrics ADD CONSTRAINT metrics_pkey PRIMARY KEY (id);
\ No newline at end of file
@@ -0,0 +1,4 @@
+-- Метрики разных типов с одинаковым именем независимы: ключ (id, mtype).
+-- Существующие строки уникальны по id, поэтому остаются уникальны и по (id, mtype).
+ALTER TABLE metrics DROP CONSTRAINT metrics_pkey;
+ALTER TABLE metrics ADD CONSTRAINT metrics_pkey PRIMARY KEY (id, mtype);
\ No newline at end of file
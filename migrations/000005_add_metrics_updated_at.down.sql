@@ -0,0 +1,3 @@
+DROP INDEX idx_metrics_updated_at;
+
+ALTER TABLE metrics DROP COLUMN updated_at;
\ No newline at end of file
@@ -0,0 +1,5 @@
+-- updated_at - время последнего обновления метрики, по нему удаляются устаревшие метрики.
+-- Существующим строкам ставится время миграции.
+ALTER TABLE metrics ADD COLUMN updated_at TIMESTAMPTZ NOT NULL DEFAULT now();
+
+CREATE INDEX idx_metrics_updated_at ON metrics (updated_at);
\ No newline at end of file
@@ -0,0 +1,6 @@
+-- Ряды с метками остаются под ключом ряда в id и после отката выглядят как метрики с таким именем.
+DROP INDEX idx_metrics_labels;
+DROP INDEX idx_metrics_name;
+
+ALTER TABLE metrics DROP COLUMN labels;
+ALTER TABLE metrics DROP COLUMN name;
\ No newline at end of file
@@ -0,0 +1,11 @@
+-- Метки метрик. id остается ключом ряда: имя с отсортированными метками (model.SeriesKey),
+-- name - имя без меток для фильтра по префиксу, labels - метки для отбора по условиям.
+-- У существующих строк меток нет, поэтому имя совпадает с id.
+ALTER TABLE metrics ADD COLUMN name TEXT;
+UPDATE metrics SET name = id;
+ALTER TABLE metrics ALTER COLUMN name SET NOT NULL;
+
+ALTER TABLE metrics ADD COLUMN labels JSONB NOT NULL DEFAULT '{}';
+
+CREATE INDEX idx_metrics_name ON metrics (name);
+CREATE INDEX idx_metrics_labels ON metrics USING GIN (labels);
\ No newline at end of file
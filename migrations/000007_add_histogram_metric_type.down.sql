@@ -0,0 +1,3 @@
+-- Значение enum нельзя удалить без пересоздания типа, поэтому откат оставляет его.
+-- Строки histogram удаляет откат 000008.
+SELECT 1;
\ No newline at end of file
@@ -0,0 +1,3 @@
+-- Тип histogram добавляется отдельной миграцией: новое значение enum
+-- нельзя использовать в той же транзакции, в которой оно добавлено.
+ALTER TYPE metric_type ADD VALUE IF NOT EXISTS 'histogram';
\ No newline at end of file
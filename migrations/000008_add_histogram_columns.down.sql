@@ -0,0 +1,17 @@
+DELETE FROM metric_samples WHERE mtype = 'histogram';
+DELETE FROM metrics WHERE mtype = 'histogram';
+
+ALTER TABLE metric_samples DROP CONSTRAINT chk_metric_sample;
+ALTER TABLE metric_samples ADD CONSTRAINT chk_metric_sample CHECK (
+    (mtype = 'counter' AND delta IS NOT NULL AND value IS NULL) OR
+    (mtype = 'gauge'   AND delta IS NULL     AND value IS NOT NULL)
+);
+
+ALTER TABLE metrics DROP CONSTRAINT chk_metric;
+ALTER TABLE metrics ADD CONSTRAINT chk_metric CHECK (
+    (mtype = 'counter' AND delta IS NOT NULL AND value IS NULL) OR
+    (mtype = 'gauge'   AND delta IS NULL     AND value IS NOT NULL)
+);
+
+ALTER TABLE metrics DROP COLUMN bucket_counts;
+ALTER TABLE metrics DROP COLUMN buckets;
\ No newline at end of file
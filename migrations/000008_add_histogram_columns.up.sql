@@ -0,0 +1,21 @@
+-- Гистограммы: delta - количество наблюдений, value - их сумма,
+-- buckets - верхние границы корзин, bucket_counts - наблюдения по корзинам,
+-- последний элемент - наблюдения больше последней границы.
+ALTER TABLE metrics ADD COLUMN buckets DOUBLE PRECISION[];
+ALTER TABLE metrics ADD COLUMN bucket_counts BIGINT[];
+
+ALTER TABLE metrics DROP CONSTRAINT chk_metric;
+ALTER TABLE metrics ADD CONSTRAINT chk_metric CHECK (
+    (mtype = 'counter'   AND delta IS NOT NULL AND value IS NULL     AND buckets IS NULL) OR
+    (mtype = 'gauge'     AND delta IS NULL     AND value IS NOT NULL AND buckets IS NULL) OR
+    (mtype = 'histogram' AND delta IS NOT NULL AND value IS NOT NULL AND buckets IS NOT NULL
+        AND cardinality(bucket_counts) = cardinality(buckets) + 1)
+);
+
+-- В истории гистограммы хранятся накопленные количество и сумма
+ALTER TABLE metric_samples DROP CONSTRAINT chk_metric_sample;
+ALTER TABLE metric_samples ADD CONSTRAINT chk_metric_sample CHECK (
+    (mtype = 'counter'   AND delta IS NOT NULL AND value IS NULL) OR
+    (mtype = 'gauge'     AND delta IS NULL     AND value IS NOT NULL) OR
+    (mtype = 'histogram' AND delta IS NOT NULL AND value IS NOT NULL)
+);
\ No newline at end of file